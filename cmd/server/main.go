@@ -11,9 +11,12 @@ import (
 	"strings"
 	"syscall"
 	"time"
+	_ "time/tzdata"
 
 	_ "github.com/lib/pq"
+	"github.com/yeboahd24/personal-finance-manager/internal/config"
 	"github.com/yeboahd24/personal-finance-manager/internal/handler"
+	"github.com/yeboahd24/personal-finance-manager/internal/mailer"
 	"github.com/yeboahd24/personal-finance-manager/internal/middleware"
 	"github.com/yeboahd24/personal-finance-manager/internal/repository"
 	"github.com/yeboahd24/personal-finance-manager/internal/service"
@@ -21,6 +24,16 @@ import (
 )
 
 func main() {
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatal("Error loading configuration: ", err)
+	}
+
+	// Load the keys auth tokens are signed and verified with
+	if err := middleware.ConfigureJWT(cfg); err != nil {
+		log.Fatal("Error loading JWT keys: ", err)
+	}
+
 	// Initialize DB connection
 	dbURL := os.Getenv("DATABASE_URL")
 	if dbURL == "" {
@@ -49,32 +62,105 @@ func main() {
 	}
 
 	// Initialize services
-	userService := service.NewUserService(repo)
+	sessionService := service.NewSessionService(repo)
+	middleware.ConfigureSessions(sessionService)
+	if err := middleware.ConfigureTrustedProxies(cfg.Server.TrustedProxies); err != nil {
+		log.Fatal("Error configuring trusted proxies: ", err)
+	}
+	twoFactorService, err := service.NewTwoFactorService(repo, cfg.TwoFactor.EncryptionKey, cfg.TwoFactor.Issuer)
+	if err != nil {
+		log.Fatal("Error initializing two-factor authentication: ", err)
+	}
 	accountService := service.NewAccountService(repo, plaidService)
-	transactionService := service.NewTransactionService(repo, plaidService)
+	transport, err := mailer.NewTransportFromEnv()
+	if err != nil {
+		log.Fatal("Error initializing email transport: ", err)
+	}
+	emailService := service.NewEmailService(repo, transport)
+	userService := service.NewUserService(repo, emailService, cfg.Server.URL)
+	webhookService := service.NewWebhookService(repo, cfg.Webhooks.AllowPrivateNetworks)
+	eventService := service.NewEventService(repo, webhookService)
+	notificationService := service.NewNotificationService(repo, emailService, eventService)
+	goalService := service.NewGoalService(repo, notificationService)
+	transactionAlertService := service.NewTransactionAlertService(repo, notificationService)
+	transactionService := service.NewTransactionService(repo, plaidService, goalService, eventService, transactionAlertService)
 	categoryService := service.NewCategoryService(repo)
 	budgetService := service.NewBudgetService(repo)
 	analyticsService := service.NewAnalyticsService(repo)
-	emailService := service.NewEmailService()
-	notificationService := service.NewNotificationService(repo, emailService)
-	recurringService := service.NewRecurringTransactionService(repo, transactionService)
+	recurringService := service.NewRecurringTransactionService(repo, transactionService, notificationService)
 	metricsService := service.NewMetricsService(repo)
+	subscriptionService := service.NewSubscriptionService(repo, recurringService)
+	holidayCalendarService := service.NewHolidayCalendarService(repo)
+	cashFlowService := service.NewCashFlowService(repo, recurringService)
+	reminderService := service.NewBillReminderService(repo, notificationService)
+	lowBalanceService := service.NewLowBalanceService(repo, notificationService)
+	anomalyService := service.NewSpendingAnomalyService(repo, analyticsService, notificationService)
+	digestService := service.NewDigestService(repo, notificationService, recurringService, emailService)
 
 	// Initialize handlers
-	userHandler := handler.NewUserHandler(userService)
+	userHandler := handler.NewUserHandler(userService, sessionService, twoFactorService)
 	accountHandler := handler.NewAccountHandler(accountService)
 	transactionHandler := handler.NewTransactionHandler(transactionService)
 	categoryHandler := handler.NewCategoryHandler(categoryService)
 	budgetHandler := handler.NewBudgetHandler(budgetService)
 	analyticsHandler := handler.NewAnalyticsHandler(analyticsService)
-	notificationHandler := handler.NewNotificationHandler(notificationService)
+	notificationHandler := handler.NewNotificationHandler(notificationService, eventService)
 	recurringHandler := handler.NewRecurringTransactionHandler(recurringService)
-	metricsHandler := handler.NewSystemMetricsHandler(metricsService)
+	recurringRetryHandler := handler.NewRecurringRetryHandler(recurringService)
+	holidayCalendarHandler := handler.NewHolidayCalendarHandler(holidayCalendarService)
+	cashFlowHandler := handler.NewCashFlowHandler(cashFlowService)
+	financialMetricsHandler := handler.NewFinancialMetricsHandler(metricsService)
+	goalHandler := handler.NewGoalHandler(goalService, recurringService)
+	subscriptionHandler := handler.NewSubscriptionHandler(subscriptionService)
+	webhookHandler := handler.NewWebhookHandler(webhookService)
+	transactionAlertHandler := handler.NewTransactionAlertHandler(transactionAlertService)
+
+	// Relay live events from every server instance to this one's streams
+	go func() {
+		if err := eventService.Listen(context.Background(), dbURL); err != nil {
+			log.Printf("Error listening for events: %v", err)
+		}
+	}()
 
 	// Initialize and start recurring transaction worker
-	recurringWorker := worker.NewRecurringTransactionWorker(recurringService, notificationService, 5*time.Minute)
+	recurringWorker := worker.NewRecurringTransactionWorker(recurringService, 5*time.Minute)
 	go recurringWorker.Start(context.Background())
 
+	// Initialize and start goal notification worker
+	goalWorker := worker.NewGoalNotificationWorker(goalService, time.Hour)
+	go goalWorker.Start(context.Background())
+
+	// Initialize and start upcoming bill reminder worker
+	reminderWorker := worker.NewBillReminderWorker(reminderService, time.Hour)
+	go reminderWorker.Start(context.Background())
+
+	// Initialize and start daily low balance prediction worker
+	lowBalanceWorker := worker.NewLowBalanceWorker(lowBalanceService, 24*time.Hour)
+	go lowBalanceWorker.Start(context.Background())
+
+	// Initialize and start daily spending anomaly worker for users who turned
+	// anomaly notifications on
+	anomalyWorker := worker.NewSpendingAnomalyWorker(anomalyService, 24*time.Hour)
+	go anomalyWorker.Start(context.Background())
+
+	// Initialize and start notification digest worker. Digests go out at
+	// each user's chosen local time, so this runs more often than daily.
+	digestWorker := worker.NewDigestWorker(digestService, 15*time.Minute)
+	go digestWorker.Start(context.Background())
+
+	// Initialize and start webhook delivery worker
+	webhookWorker := worker.NewWebhookWorker(webhookService, 30*time.Second)
+	go webhookWorker.Start(context.Background())
+
+	// Initialize and start worker for notifications held back by quiet hours
+	// or snoozed
+	notificationDeliveryWorker := worker.NewNotificationDeliveryWorker(notificationService, time.Minute)
+	go notificationDeliveryWorker.Start(context.Background())
+
+	// Initialize and start email outbox worker
+	emailWorker := worker.NewEmailWorker(emailService, time.Minute)
+	go emailWorker.Start(context.Background())
+
 	// Create or get system user
 	systemUser, err := userService.CreateUser(context.Background(), "system@personal-finance.local", "system", "System", "User")
 	if err != nil {
@@ -102,13 +188,16 @@ func main() {
 	}
 
 	// Process any due recurring transactions
-	if err := recurringService.ProcessDueTransactions(context.Background()); err != nil {
+	if report, err := recurringService.ProcessDueTransactions(context.Background()); err != nil {
 		log.Println("Error processing recurring transactions:", err)
+	} else if posted, skipped, failed := report.Counts(); posted+skipped+failed > 0 {
+		log.Printf("Caught up recurring transactions: %d occurrences posted, %d skipped, %d failed", posted, skipped, failed)
 	}
 
 	// Setup router
 	router := setupRoutes(userHandler, accountHandler, transactionHandler, categoryHandler,
-		budgetHandler, analyticsHandler, recurringHandler, metricsHandler, notificationHandler)
+		budgetHandler, analyticsHandler, recurringHandler, notificationHandler, goalHandler, subscriptionHandler, recurringRetryHandler,
+		holidayCalendarHandler, cashFlowHandler, financialMetricsHandler, webhookHandler, transactionAlertHandler)
 
 	// Create server
 	srv := &http.Server{
@@ -147,8 +236,12 @@ func main() {
 func setupRoutes(userHandler *handler.UserHandler, accountHandler *handler.AccountHandler,
 	transactionHandler *handler.TransactionHandler, categoryHandler *handler.CategoryHandler,
 	budgetHandler *handler.BudgetHandler, analyticsHandler *handler.AnalyticsHandler,
-	recurringHandler *handler.RecurringTransactionHandler, metricsHandler *handler.SystemMetricsHandler,
-	notificationHandler *handler.NotificationHandler) http.Handler {
+	recurringHandler *handler.RecurringTransactionHandler, notificationHandler *handler.NotificationHandler,
+	goalHandler *handler.GoalHandler,
+	subscriptionHandler *handler.SubscriptionHandler, recurringRetryHandler *handler.RecurringRetryHandler,
+	holidayCalendarHandler *handler.HolidayCalendarHandler, cashFlowHandler *handler.CashFlowHandler,
+	financialMetricsHandler *handler.FinancialMetricsHandler, webhookHandler *handler.WebhookHandler,
+	transactionAlertHandler *handler.TransactionAlertHandler) http.Handler {
 
 	mux := http.NewServeMux()
 
@@ -163,10 +256,44 @@ func setupRoutes(userHandler *handler.UserHandler, accountHandler *handler.Accou
 	mux.Handle("/api/budgets/", middleware.AuthMiddleware(budgetHandler))
 	mux.Handle("/api/analytics", middleware.AuthMiddleware(analyticsHandler))
 	mux.Handle("/api/analytics/", middleware.AuthMiddleware(analyticsHandler))
+	mux.Handle("/api/goals", middleware.AuthMiddleware(goalHandler))
+	mux.Handle("/api/goals/", middleware.AuthMiddleware(goalHandler))
+	mux.Handle("/api/subscriptions", middleware.AuthMiddleware(subscriptionHandler))
+	mux.Handle("/api/subscriptions/", middleware.AuthMiddleware(subscriptionHandler))
+	mux.Handle("/api/recurring", middleware.AuthMiddleware(recurringHandler))
+	mux.Handle("/api/recurring/", middleware.AuthMiddleware(recurringHandler))
+	mux.Handle("/api/recurring/failures", middleware.AuthMiddleware(recurringRetryHandler))
+	mux.Handle("/api/recurring/failures/", middleware.AuthMiddleware(recurringRetryHandler))
+	mux.Handle("/api/holiday-calendars", middleware.AuthMiddleware(holidayCalendarHandler))
+	mux.Handle("/api/holiday-calendars/", middleware.AuthMiddleware(holidayCalendarHandler))
+	mux.Handle("/api/cashflow/", middleware.AuthMiddleware(cashFlowHandler))
+	mux.Handle("/api/notifications", middleware.AuthMiddleware(notificationHandler))
+	mux.Handle("/api/notifications/", middleware.AuthMiddleware(notificationHandler))
+	mux.Handle("/api/webhooks", middleware.AuthMiddleware(webhookHandler))
+	mux.Handle("/api/webhooks/", middleware.AuthMiddleware(webhookHandler))
+	mux.Handle("/api/transaction-alerts", middleware.AuthMiddleware(transactionAlertHandler))
+	mux.Handle("/api/transaction-alerts/", middleware.AuthMiddleware(transactionAlertHandler))
+	mux.Handle("/api/metrics", middleware.AuthMiddleware(financialMetricsHandler))
 
 	// Auth routes
 	mux.HandleFunc("/api/users", userHandler.CreateUser)
 	mux.HandleFunc("/api/users/login", userHandler.Login)
+	mux.HandleFunc("/api/users/login/2fa", userHandler.LoginTwoFactor)
+	mux.HandleFunc("/api/users/refresh", userHandler.Refresh)
+	mux.HandleFunc("/api/users/verify-email", userHandler.VerifyEmail)
+	mux.HandleFunc("/api/users/password-reset", userHandler.RequestPasswordReset)
+	mux.HandleFunc("/api/users/password-reset/confirm", userHandler.ConfirmPasswordReset)
+	mux.Handle("/api/users/verify-email/resend", middleware.AuthMiddleware(http.HandlerFunc(userHandler.ResendVerification)))
+	mux.Handle("/api/users/password", middleware.AuthMiddleware(http.HandlerFunc(userHandler.ChangePassword)))
+	mux.Handle("/api/users/logout", middleware.AuthMiddleware(http.HandlerFunc(userHandler.Logout)))
+	mux.Handle("/api/users/logout-all", middleware.AuthMiddleware(http.HandlerFunc(userHandler.LogoutAll)))
+	mux.Handle("/api/users/sessions", middleware.AuthMiddleware(http.HandlerFunc(userHandler.Sessions)))
+	mux.Handle("/api/users/sessions/", middleware.AuthMiddleware(http.HandlerFunc(userHandler.Sessions)))
+	mux.Handle("/api/users/2fa", middleware.AuthMiddleware(http.HandlerFunc(userHandler.TwoFactor)))
+	mux.Handle("/api/users/2fa/", middleware.AuthMiddleware(http.HandlerFunc(userHandler.TwoFactor)))
+
+	// Public keys for services verifying our tokens
+	mux.HandleFunc("/.well-known/jwks.json", middleware.JWKSHandler)
 
 	// Web routes
 	templates := template.Must(template.ParseGlob("web/templates/*.html"))
@@ -214,6 +341,26 @@ func setupRoutes(userHandler *handler.UserHandler, accountHandler *handler.Accou
 		}
 	})
 
+	// Linked to from verification and password reset emails, so they work
+	// whether or not the user is logged in
+	mux.HandleFunc("/verify-email", func(w http.ResponseWriter, r *http.Request) {
+		data := map[string]interface{}{
+			"Page": "verify_email",
+		}
+		if err := templates.ExecuteTemplate(w, "layout", data); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	})
+
+	mux.HandleFunc("/reset-password", func(w http.ResponseWriter, r *http.Request) {
+		data := map[string]interface{}{
+			"Page": "reset_password",
+		}
+		if err := templates.ExecuteTemplate(w, "layout", data); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	})
+
 	// Protected page routes
 	protectedPages := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		var page string
@@ -18,6 +18,9 @@ type Config struct {
 	}
 	Server struct {
 		Port int
+		URL  string // Public base URL, for links in emails
+
+		TrustedProxies []string // IPs or CIDR ranges whose forwarding headers are believed
 	}
 	Plaid struct {
 		ClientID     string
@@ -27,7 +30,19 @@ type Config struct {
 		WebhookURL   string
 	}
 	JWT struct {
-		Secret string
+		Secret          string   // HS256 signing secret
+		PreviousSecrets []string // Retired HS256 secrets still accepted
+		KeysDir         string   // Directory of RS256 and EdDSA PEM keys named <kid>.pem
+		SigningKeyID    string   // kid of the key that signs new tokens
+		Issuer          string
+		Audience        string
+	}
+	TwoFactor struct {
+		EncryptionKey string // 32 byte AES key, base64 or hex, encrypting TOTP secrets at rest
+		Issuer        string // Name shown in authenticator apps
+	}
+	Webhooks struct {
+		AllowPrivateNetworks bool // Development only: allow plain HTTP and loopback or private endpoints
 	}
 	Email struct {
 		SMTPHost     string
@@ -66,6 +81,8 @@ func Load() (*Config, error) {
 
 	// Server configuration
 	cfg.Server.Port = viper.GetInt("SERVER_PORT")
+	cfg.Server.URL = viper.GetString("APP_URL")
+	cfg.Server.TrustedProxies = splitList(viper.GetString("TRUSTED_PROXIES"))
 
 	// Plaid configuration
 	cfg.Plaid.ClientID = viper.GetString("PLAID_CLIENT_ID")
@@ -76,13 +93,25 @@ func Load() (*Config, error) {
 
 	// JWT configuration
 	cfg.JWT.Secret = viper.GetString("JWT_SECRET")
+	cfg.JWT.PreviousSecrets = splitList(viper.GetString("JWT_PREVIOUS_SECRETS"))
+	cfg.JWT.KeysDir = viper.GetString("JWT_KEYS_DIR")
+	cfg.JWT.SigningKeyID = viper.GetString("JWT_SIGNING_KEY_ID")
+	cfg.JWT.Issuer = viper.GetString("JWT_ISSUER")
+	cfg.JWT.Audience = viper.GetString("JWT_AUDIENCE")
+
+	// Two-factor configuration
+	cfg.TwoFactor.EncryptionKey = viper.GetString("TOTP_ENCRYPTION_KEY")
+	cfg.TwoFactor.Issuer = viper.GetString("TOTP_ISSUER")
+
+	// Webhook configuration
+	cfg.Webhooks.AllowPrivateNetworks = viper.GetBool("WEBHOOK_ALLOW_PRIVATE_NETWORKS")
 
 	// Email configuration
-	cfg.Email.SMTPHost = viper.GetString("EMAIL_SMTP_HOST")
-	cfg.Email.SMTPPort = viper.GetInt("EMAIL_SMTP_PORT")
-	cfg.Email.SMTPUser = viper.GetString("EMAIL_SMTP_USER")
-	cfg.Email.SMTPPassword = viper.GetString("EMAIL_SMTP_PASSWORD")
-	cfg.Email.FromAddress = viper.GetString("EMAIL_FROM_ADDRESS")
+	cfg.Email.SMTPHost = viper.GetString("SMTP_HOST")
+	cfg.Email.SMTPPort = viper.GetInt("SMTP_PORT")
+	cfg.Email.SMTPUser = viper.GetString("SMTP_USERNAME")
+	cfg.Email.SMTPPassword = viper.GetString("SMTP_PASSWORD")
+	cfg.Email.FromAddress = viper.GetString("FROM_EMAIL")
 
 	return cfg, nil
 }
@@ -90,3 +119,14 @@ func Load() (*Config, error) {
 func Get() *Config {
 	return cfg
 }
+
+// splitList splits a comma separated value, dropping empty items
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -7,6 +7,7 @@ import (
 	"net/http"
 	"strings"
 
+	"github.com/yeboahd24/personal-finance-manager/internal/errors"
 	"github.com/yeboahd24/personal-finance-manager/internal/middleware"
 	"github.com/yeboahd24/personal-finance-manager/internal/model"
 	"github.com/yeboahd24/personal-finance-manager/internal/service"
@@ -36,7 +37,7 @@ func (h *AccountHandler) CreateLinkToken(w http.ResponseWriter, r *http.Request)
 
 	linkToken, err := h.accountService.CreateLinkToken(r.Context(), userID)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		http.Error(w, err.Error(), errors.StatusCode(err))
 		return
 	}
 
@@ -67,7 +68,7 @@ func (h *AccountHandler) LinkAccount(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if err := h.accountService.LinkAccount(r.Context(), userID, req.PublicToken); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		http.Error(w, err.Error(), errors.StatusCode(err))
 		return
 	}
 
@@ -6,7 +6,9 @@ import (
 	"strconv"
 	"strings"
 
+	"github.com/yeboahd24/personal-finance-manager/internal/errors"
 	"github.com/yeboahd24/personal-finance-manager/internal/middleware"
+	"github.com/yeboahd24/personal-finance-manager/internal/model"
 	"github.com/yeboahd24/personal-finance-manager/internal/service"
 )
 
@@ -252,6 +254,45 @@ func (h *AnalyticsHandler) GetBudgetPerformance(w http.ResponseWriter, r *http.R
 	}
 }
 
+// GetSpendingAnomalies lists this period's unusual spending. The period
+// (week or month), lookback and threshold query parameters tune the detector.
+func (h *AnalyticsHandler) GetSpendingAnomalies(w http.ResponseWriter, r *http.Request) {
+	userID, err := middleware.GetUserID(r.Context())
+	if err != nil {
+		http.Error(w, "Failed to get user ID: "+err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	opts := model.AnomalyOptions{Period: model.AnomalyPeriod(r.URL.Query().Get("period"))}
+	if v := r.URL.Query().Get("lookback"); v != "" {
+		if opts.Lookback, err = strconv.Atoi(v); err != nil {
+			http.Error(w, "Invalid lookback", http.StatusBadRequest)
+			return
+		}
+	}
+	if v := r.URL.Query().Get("threshold"); v != "" {
+		if opts.Threshold, err = strconv.ParseFloat(v, 64); err != nil {
+			http.Error(w, "Invalid threshold", http.StatusBadRequest)
+			return
+		}
+	}
+
+	anomalies, err := h.analyticsService.GetSpendingAnomalies(r.Context(), userID, opts)
+	if err != nil {
+		http.Error(w, errors.Message(err), errors.StatusCode(err))
+		return
+	}
+	if anomalies == nil {
+		anomalies = []*model.SpendingAnomaly{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(anomalies); err != nil {
+		http.Error(w, "Failed to encode response: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
 // ServeHTTP implements the http.Handler interface
 func (h *AnalyticsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
@@ -279,6 +320,8 @@ func (h *AnalyticsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		h.GetIncomeVsExpenses(w, r)
 	case "savings":
 		h.GetIncomeVsExpenses(w, r)
+	case "anomalies":
+		h.GetSpendingAnomalies(w, r)
 	default:
 		http.Error(w, "Invalid analytics type", http.StatusBadRequest)
 	}
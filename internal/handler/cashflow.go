@@ -0,0 +1,81 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/yeboahd24/personal-finance-manager/internal/errors"
+	"github.com/yeboahd24/personal-finance-manager/internal/middleware"
+	"github.com/yeboahd24/personal-finance-manager/internal/model"
+	"github.com/yeboahd24/personal-finance-manager/internal/service"
+)
+
+type CashFlowHandler struct {
+	cashFlowService *service.CashFlowService
+}
+
+func NewCashFlowHandler(cashFlowService *service.CashFlowService) *CashFlowHandler {
+	return &CashFlowHandler{
+		cashFlowService: cashFlowService,
+	}
+}
+
+// GetCalendar projects balances for the number of days in the days query
+// parameter. The minimum query parameter overrides the user's minimum
+// balance preference.
+func (h *CashFlowHandler) GetCalendar(w http.ResponseWriter, r *http.Request) {
+	userID, err := middleware.GetUserID(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	days := model.DefaultCashFlowDays
+	if v := r.URL.Query().Get("days"); v != "" {
+		if days, err = strconv.Atoi(v); err != nil {
+			http.Error(w, "Invalid days", http.StatusBadRequest)
+			return
+		}
+	}
+
+	var minimum *float64
+	if v := r.URL.Query().Get("minimum"); v != "" {
+		m, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			http.Error(w, "Invalid minimum", http.StatusBadRequest)
+			return
+		}
+		minimum = &m
+	}
+
+	calendar, err := h.cashFlowService.GetCalendar(r.Context(), userID, days, minimum)
+	if err != nil {
+		http.Error(w, errors.Message(err), errors.StatusCode(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(calendar)
+}
+
+// ServeHTTP implements the http.Handler interface
+//
+// Routes:
+//
+//	/api/cashflow/calendar
+func (h *CashFlowHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	path := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/cashflow"), "/")
+
+	switch path {
+	case "calendar":
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		h.GetCalendar(w, r)
+	default:
+		http.NotFound(w, r)
+	}
+}
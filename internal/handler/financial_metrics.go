@@ -1,9 +1,11 @@
 package handler
 
 import (
+	"context"
 	"encoding/json"
 	"net/http"
 
+	"github.com/yeboahd24/personal-finance-manager/internal/errors"
 	"github.com/yeboahd24/personal-finance-manager/internal/middleware"
 	"github.com/yeboahd24/personal-finance-manager/internal/service"
 )
@@ -20,115 +22,76 @@ func NewFinancialMetricsHandler(metricsService *service.MetricsService) *Financi
 	}
 }
 
+// MetricResponse is the current value of one financial metric
+type MetricResponse struct {
+	MetricType   string  `json:"metric_type"`
+	CurrentValue float64 `json:"current_value"`
+}
+
 // GetNetWorth handles net worth calculation requests
 func (h *FinancialMetricsHandler) GetNetWorth(w http.ResponseWriter, r *http.Request) {
-	ctx := r.Context()
-
-	// Get user ID from context
-	userID, err := middleware.GetUserID(ctx)
-	if err != nil {
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
-		return
-	}
-
-	netWorth, err := h.metricsService.GetNetWorth(ctx, userID)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
-	}
-
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]float64{
-		"net_worth": netWorth,
-	})
+	h.respond(w, r, "net_worth", h.metricsService.GetNetWorth)
 }
 
 // GetSavingsRate handles savings rate calculation requests
 func (h *FinancialMetricsHandler) GetSavingsRate(w http.ResponseWriter, r *http.Request) {
-	ctx := r.Context()
-
-	// Get user ID from context
-	userID, err := middleware.GetUserID(ctx)
-	if err != nil {
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
-		return
-	}
-
-	savingsRate, err := h.metricsService.GetSavingsRate(ctx, userID)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
-	}
-
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]float64{
-		"savings_rate": savingsRate,
-	})
+	h.respond(w, r, "savings_rate", h.metricsService.GetSavingsRate)
 }
 
 // GetDebtToIncomeRatio handles debt-to-income ratio calculation requests
 func (h *FinancialMetricsHandler) GetDebtToIncomeRatio(w http.ResponseWriter, r *http.Request) {
-	ctx := r.Context()
-
-	// Get user ID from context
-	userID, err := middleware.GetUserID(ctx)
-	if err != nil {
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
-		return
-	}
-
-	ratio, err := h.metricsService.GetDebtToIncomeRatio(ctx, userID)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
-	}
-
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]float64{
-		"debt_to_income_ratio": ratio,
-	})
+	h.respond(w, r, "debt_to_income", h.metricsService.GetDebtToIncomeRatio)
 }
 
 // GetEmergencyFundCoverage handles emergency fund coverage calculation requests
 func (h *FinancialMetricsHandler) GetEmergencyFundCoverage(w http.ResponseWriter, r *http.Request) {
-	ctx := r.Context()
+	h.respond(w, r, "emergency_fund", h.metricsService.GetEmergencyFundCoverage)
+}
 
-	// Get user ID from context
-	userID, err := middleware.GetUserID(ctx)
+// respond calculates a metric for the authenticated user
+func (h *FinancialMetricsHandler) respond(w http.ResponseWriter, r *http.Request, metricType string, calculate func(ctx context.Context, userID string) (float64, error)) {
+	userID, err := middleware.GetUserID(r.Context())
 	if err != nil {
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		http.Error(w, err.Error(), http.StatusUnauthorized)
 		return
 	}
 
-	coverage, err := h.metricsService.GetEmergencyFundCoverage(ctx, userID)
+	value, err := calculate(r.Context(), userID)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		http.Error(w, errors.Message(err), errors.StatusCode(err))
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]float64{
-		"emergency_fund_coverage": coverage,
+	json.NewEncoder(w).Encode(MetricResponse{
+		MetricType:   metricType,
+		CurrentValue: value,
 	})
 }
 
 // ServeHTTP implements the http.Handler interface
+//
+// Routes:
+//
+//	/api/metrics?type={net_worth|savings_rate|debt_to_income|emergency_fund}
 func (h *FinancialMetricsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	switch r.Method {
-	case http.MethodGet:
-		switch r.URL.Query().Get("type") {
-		case "net_worth":
-			h.GetNetWorth(w, r)
-		case "savings_rate":
-			h.GetSavingsRate(w, r)
-		case "debt_to_income":
-			h.GetDebtToIncomeRatio(w, r)
-		case "emergency_fund":
-			h.GetEmergencyFundCoverage(w, r)
-		default:
-			http.Error(w, "Invalid metrics type", http.StatusBadRequest)
-		}
-	default:
+	if r.Method != http.MethodGet {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	switch r.URL.Query().Get("type") {
+	case "net_worth":
+		h.GetNetWorth(w, r)
+	case "savings_rate":
+		h.GetSavingsRate(w, r)
+	case "debt_to_income":
+		h.GetDebtToIncomeRatio(w, r)
+	case "emergency_fund":
+		h.GetEmergencyFundCoverage(w, r)
+	case "":
+		http.Error(w, "Metrics type is required", http.StatusBadRequest)
+	default:
+		http.Error(w, "Invalid metrics type", http.StatusBadRequest)
 	}
 }
@@ -0,0 +1,295 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/yeboahd24/personal-finance-manager/internal/errors"
+	"github.com/yeboahd24/personal-finance-manager/internal/middleware"
+	"github.com/yeboahd24/personal-finance-manager/internal/model"
+	"github.com/yeboahd24/personal-finance-manager/internal/service"
+)
+
+type GoalHandler struct {
+	goalService      *service.GoalService
+	recurringService *service.RecurringTransactionService
+}
+
+func NewGoalHandler(goalService *service.GoalService, recurringService *service.RecurringTransactionService) *GoalHandler {
+	return &GoalHandler{
+		goalService:      goalService,
+		recurringService: recurringService,
+	}
+}
+
+func (h *GoalHandler) CreateGoal(w http.ResponseWriter, r *http.Request) {
+	userID, err := middleware.GetUserID(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	var goal model.Goal
+	if err := json.NewDecoder(r.Body).Decode(&goal); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.goalService.CreateGoal(r.Context(), userID, &goal); err != nil {
+		http.Error(w, errors.Message(err), errors.StatusCode(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(goal)
+}
+
+func (h *GoalHandler) GetGoals(w http.ResponseWriter, r *http.Request) {
+	userID, err := middleware.GetUserID(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	goals, err := h.goalService.GetGoals(r.Context(), userID)
+	if err != nil {
+		http.Error(w, errors.Message(err), errors.StatusCode(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(goals)
+}
+
+func (h *GoalHandler) GetGoal(w http.ResponseWriter, r *http.Request, id string) {
+	userID, err := middleware.GetUserID(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	goal, err := h.goalService.GetGoalByID(r.Context(), userID, id)
+	if err != nil {
+		http.Error(w, errors.Message(err), errors.StatusCode(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(goal)
+}
+
+func (h *GoalHandler) UpdateGoal(w http.ResponseWriter, r *http.Request, id string) {
+	userID, err := middleware.GetUserID(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	var goal model.Goal
+	if err := json.NewDecoder(r.Body).Decode(&goal); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	goal.ID = id
+	if err := h.goalService.UpdateGoal(r.Context(), userID, &goal); err != nil {
+		http.Error(w, errors.Message(err), errors.StatusCode(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(goal)
+}
+
+func (h *GoalHandler) DeleteGoal(w http.ResponseWriter, r *http.Request, id string) {
+	userID, err := middleware.GetUserID(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	if err := h.goalService.DeleteGoal(r.Context(), userID, id); err != nil {
+		http.Error(w, errors.Message(err), errors.StatusCode(err))
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *GoalHandler) AddContribution(w http.ResponseWriter, r *http.Request, goalID string) {
+	userID, err := middleware.GetUserID(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	var contribution model.GoalContribution
+	if err := json.NewDecoder(r.Body).Decode(&contribution); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.goalService.AddContribution(r.Context(), userID, goalID, &contribution); err != nil {
+		http.Error(w, errors.Message(err), errors.StatusCode(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(contribution)
+}
+
+func (h *GoalHandler) GetContributions(w http.ResponseWriter, r *http.Request, goalID string) {
+	userID, err := middleware.GetUserID(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	contributions, err := h.goalService.GetContributions(r.Context(), userID, goalID)
+	if err != nil {
+		http.Error(w, errors.Message(err), errors.StatusCode(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(contributions)
+}
+
+func (h *GoalHandler) DeleteContribution(w http.ResponseWriter, r *http.Request, goalID, contributionID string) {
+	userID, err := middleware.GetUserID(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	if err := h.goalService.DeleteContribution(r.Context(), userID, goalID, contributionID); err != nil {
+		http.Error(w, errors.Message(err), errors.StatusCode(err))
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetTransferSuggestion returns the monthly transfer from the funding account that would fully fund a sinking fund
+func (h *GoalHandler) GetTransferSuggestion(w http.ResponseWriter, r *http.Request, goalID string) {
+	userID, err := middleware.GetUserID(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	goal, err := h.goalService.GetGoalByID(r.Context(), userID, goalID)
+	if err != nil {
+		http.Error(w, errors.Message(err), errors.StatusCode(err))
+		return
+	}
+
+	suggestion, err := h.goalService.GetTransferSuggestion(r.Context(), goal)
+	if err != nil {
+		http.Error(w, errors.Message(err), errors.StatusCode(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(suggestion)
+}
+
+// AcceptTransferSuggestion creates the suggested transfer for a sinking fund as a
+// recurring debit from the funding account and a recurring credit into the fund
+func (h *GoalHandler) AcceptTransferSuggestion(w http.ResponseWriter, r *http.Request, goalID string) {
+	userID, err := middleware.GetUserID(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	goal, err := h.goalService.GetGoalByID(r.Context(), userID, goalID)
+	if err != nil {
+		http.Error(w, errors.Message(err), errors.StatusCode(err))
+		return
+	}
+
+	suggestion, err := h.goalService.GetTransferSuggestion(r.Context(), goal)
+	if err != nil {
+		http.Error(w, errors.Message(err), errors.StatusCode(err))
+		return
+	}
+
+	if err := h.recurringService.AcceptSinkingFundTransfer(r.Context(), userID, goal, suggestion); err != nil {
+		http.Error(w, errors.Message(err), errors.StatusCode(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(suggestion)
+}
+
+// ServeHTTP implements the http.Handler interface
+//
+// Routes:
+//
+//	/api/goals
+//	/api/goals/{id}
+//	/api/goals/{id}/contributions
+//	/api/goals/{id}/contributions/{contribution_id}
+//	/api/goals/{id}/transfer-suggestion
+func (h *GoalHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	path := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/goals"), "/")
+	var parts []string
+	if path != "" {
+		parts = strings.Split(path, "/")
+	}
+
+	switch {
+	case len(parts) == 0:
+		switch r.Method {
+		case http.MethodGet:
+			h.GetGoals(w, r)
+		case http.MethodPost:
+			h.CreateGoal(w, r)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	case len(parts) == 1:
+		switch r.Method {
+		case http.MethodGet:
+			h.GetGoal(w, r, parts[0])
+		case http.MethodPut:
+			h.UpdateGoal(w, r, parts[0])
+		case http.MethodDelete:
+			h.DeleteGoal(w, r, parts[0])
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	case len(parts) == 2 && parts[1] == "contributions":
+		switch r.Method {
+		case http.MethodGet:
+			h.GetContributions(w, r, parts[0])
+		case http.MethodPost:
+			h.AddContribution(w, r, parts[0])
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	case len(parts) == 2 && parts[1] == "transfer-suggestion":
+		switch r.Method {
+		case http.MethodGet:
+			h.GetTransferSuggestion(w, r, parts[0])
+		case http.MethodPost:
+			h.AcceptTransferSuggestion(w, r, parts[0])
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	case len(parts) == 3 && parts[1] == "contributions":
+		if r.Method != http.MethodDelete {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		h.DeleteContribution(w, r, parts[0], parts[2])
+	default:
+		http.NotFound(w, r)
+	}
+}
@@ -0,0 +1,206 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/yeboahd24/personal-finance-manager/internal/errors"
+	"github.com/yeboahd24/personal-finance-manager/internal/holiday"
+	"github.com/yeboahd24/personal-finance-manager/internal/middleware"
+	"github.com/yeboahd24/personal-finance-manager/internal/model"
+	"github.com/yeboahd24/personal-finance-manager/internal/service"
+)
+
+type HolidayCalendarHandler struct {
+	holidayCalendarService *service.HolidayCalendarService
+}
+
+func NewHolidayCalendarHandler(holidayCalendarService *service.HolidayCalendarService) *HolidayCalendarHandler {
+	return &HolidayCalendarHandler{
+		holidayCalendarService: holidayCalendarService,
+	}
+}
+
+type bundledCalendarResponse struct {
+	Name     string              `json:"name"`
+	Year     int                 `json:"year"`
+	Holidays []model.HolidayDate `json:"holidays"`
+}
+
+// GetBundledCalendars returns the names of the bundled calendars
+func (h *HolidayCalendarHandler) GetBundledCalendars(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(holiday.BundledNames())
+}
+
+// GetBundledCalendar returns a bundled calendar's holidays for the year given
+// by the year query parameter, or the current year
+func (h *HolidayCalendarHandler) GetBundledCalendar(w http.ResponseWriter, r *http.Request, name string) {
+	year := time.Now().Year()
+	if v := r.URL.Query().Get("year"); v != "" {
+		y, err := strconv.Atoi(v)
+		if err != nil {
+			http.Error(w, "Invalid year", http.StatusBadRequest)
+			return
+		}
+		year = y
+	}
+
+	holidays, err := h.holidayCalendarService.BundledHolidays(name, year)
+	if err != nil {
+		http.Error(w, errors.Message(err), errors.StatusCode(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(bundledCalendarResponse{Name: name, Year: year, Holidays: holidays})
+}
+
+func (h *HolidayCalendarHandler) GetHolidayCalendars(w http.ResponseWriter, r *http.Request) {
+	userID, err := middleware.GetUserID(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	calendars, err := h.holidayCalendarService.GetHolidayCalendars(r.Context(), userID)
+	if err != nil {
+		http.Error(w, errors.Message(err), errors.StatusCode(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(calendars)
+}
+
+func (h *HolidayCalendarHandler) CreateHolidayCalendar(w http.ResponseWriter, r *http.Request) {
+	userID, err := middleware.GetUserID(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	var calendar model.HolidayCalendar
+	if err := json.NewDecoder(r.Body).Decode(&calendar); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.holidayCalendarService.CreateHolidayCalendar(r.Context(), userID, &calendar); err != nil {
+		http.Error(w, errors.Message(err), errors.StatusCode(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(calendar)
+}
+
+func (h *HolidayCalendarHandler) GetHolidayCalendar(w http.ResponseWriter, r *http.Request, id string) {
+	userID, err := middleware.GetUserID(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	calendar, err := h.holidayCalendarService.GetHolidayCalendarByID(r.Context(), userID, id)
+	if err != nil {
+		http.Error(w, errors.Message(err), errors.StatusCode(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(calendar)
+}
+
+func (h *HolidayCalendarHandler) UpdateHolidayCalendar(w http.ResponseWriter, r *http.Request, id string) {
+	userID, err := middleware.GetUserID(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	var calendar model.HolidayCalendar
+	if err := json.NewDecoder(r.Body).Decode(&calendar); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	calendar.ID = id
+	if err := h.holidayCalendarService.UpdateHolidayCalendar(r.Context(), userID, &calendar); err != nil {
+		http.Error(w, errors.Message(err), errors.StatusCode(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(calendar)
+}
+
+func (h *HolidayCalendarHandler) DeleteHolidayCalendar(w http.ResponseWriter, r *http.Request, id string) {
+	userID, err := middleware.GetUserID(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	if err := h.holidayCalendarService.DeleteHolidayCalendar(r.Context(), userID, id); err != nil {
+		http.Error(w, errors.Message(err), errors.StatusCode(err))
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ServeHTTP implements the http.Handler interface
+//
+// Routes:
+//
+//	/api/holiday-calendars
+//	/api/holiday-calendars/bundled
+//	/api/holiday-calendars/bundled/{name}
+//	/api/holiday-calendars/{id}
+func (h *HolidayCalendarHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	path := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/holiday-calendars"), "/")
+	var parts []string
+	if path != "" {
+		parts = strings.Split(path, "/")
+	}
+
+	switch {
+	case len(parts) == 0:
+		switch r.Method {
+		case http.MethodGet:
+			h.GetHolidayCalendars(w, r)
+		case http.MethodPost:
+			h.CreateHolidayCalendar(w, r)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	case parts[0] == "bundled" && len(parts) <= 2:
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if len(parts) == 1 {
+			h.GetBundledCalendars(w, r)
+		} else {
+			h.GetBundledCalendar(w, r, parts[1])
+		}
+	case len(parts) == 1:
+		switch r.Method {
+		case http.MethodGet:
+			h.GetHolidayCalendar(w, r, parts[0])
+		case http.MethodPut:
+			h.UpdateHolidayCalendar(w, r, parts[0])
+		case http.MethodDelete:
+			h.DeleteHolidayCalendar(w, r, parts[0])
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	default:
+		http.NotFound(w, r)
+	}
+}
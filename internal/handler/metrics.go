@@ -5,6 +5,7 @@ import (
 	"net/http"
 	"time"
 
+	"github.com/yeboahd24/personal-finance-manager/internal/errors"
 	"github.com/yeboahd24/personal-finance-manager/internal/service"
 	"github.com/yeboahd24/personal-finance-manager/internal/worker"
 )
@@ -42,7 +43,11 @@ func (h *RecurringTransactionMetricsHandler) GetRecurringTransactionMetrics(w ht
 	}
 
 	metrics := h.recurringService.GetMetrics()
-	retryMetrics := h.recurringWorker.GetRetryQueueMetrics()
+	retryMetrics, err := h.recurringWorker.GetRetryQueueMetrics(r.Context())
+	if err != nil {
+		http.Error(w, errors.Message(err), errors.StatusCode(err))
+		return
+	}
 
 	response := RecurringTransactionMetricsResponse{
 		ProcessedCount:   metrics.GetProcessedCount(),
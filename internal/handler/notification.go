@@ -4,131 +4,420 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
+	"github.com/yeboahd24/personal-finance-manager/internal/errors"
+	"github.com/yeboahd24/personal-finance-manager/internal/middleware"
 	"github.com/yeboahd24/personal-finance-manager/internal/model"
 	"github.com/yeboahd24/personal-finance-manager/internal/service"
 )
 
+// streamHeartbeat is how often an idle notification stream sends a comment
+// to keep proxies from closing it
+const streamHeartbeat = 25 * time.Second
+
+// streamRecentEvents is how many sent event IDs a stream remembers, so events
+// it gets both from the replay and live are only sent once
+const streamRecentEvents = 1024
+
 type NotificationHandler struct {
 	service *service.NotificationService
+	events  *service.EventService
 }
 
-func NewNotificationHandler(service *service.NotificationService) *NotificationHandler {
+func NewNotificationHandler(service *service.NotificationService, events *service.EventService) *NotificationHandler {
 	return &NotificationHandler{
 		service: service,
+		events:  events,
 	}
 }
 
-// Add your notification endpoints here
+// GetNotifications lists the user's notifications, only unread ones when the
+// unread_only query parameter is true. Snoozed notifications are left out
+// unless include_snoozed is true.
 func (h *NotificationHandler) GetNotifications(w http.ResponseWriter, r *http.Request) {
-	userID := r.Context().Value("userID").(string)
-	unreadOnly := r.URL.Query().Get("unread") == "true"
+	userID, err := middleware.GetUserID(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	var unreadOnly bool
+	if v := r.URL.Query().Get("unread_only"); v != "" {
+		if unreadOnly, err = strconv.ParseBool(v); err != nil {
+			http.Error(w, "Invalid unread_only", http.StatusBadRequest)
+			return
+		}
+	}
 
-	notifications, err := h.service.GetUserNotifications(r.Context(), userID, unreadOnly)
+	var includeSnoozed bool
+	if v := r.URL.Query().Get("include_snoozed"); v != "" {
+		if includeSnoozed, err = strconv.ParseBool(v); err != nil {
+			http.Error(w, "Invalid include_snoozed", http.StatusBadRequest)
+			return
+		}
+	}
+
+	notifications, err := h.service.GetUserNotifications(r.Context(), userID, unreadOnly, includeSnoozed)
 	if err != nil {
-		http.Error(w, "Failed to fetch notifications", http.StatusInternalServerError)
+		http.Error(w, errors.Message(err), errors.StatusCode(err))
 		return
 	}
 
-	respondJSON(w, notifications)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(notifications)
 }
 
-// CreateNotification handles the creation of a new notification
-func (h *NotificationHandler) CreateNotification(w http.ResponseWriter, r *http.Request) {
-	var notificationReq service.NotificationRequest
-	if err := decodeJSON(r, &notificationReq); err != nil {
+func (h *NotificationHandler) GetPreferences(w http.ResponseWriter, r *http.Request) {
+	userID, err := middleware.GetUserID(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	preferences, err := h.service.GetNotificationPreferences(r.Context(), userID)
+	if err != nil {
+		http.Error(w, errors.Message(err), errors.StatusCode(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(preferences)
+}
+
+// UpdatePreferences replaces the user's notification preferences
+func (h *NotificationHandler) UpdatePreferences(w http.ResponseWriter, r *http.Request) {
+	userID, err := middleware.GetUserID(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	var preferences model.NotificationPreferences
+	if err := json.NewDecoder(r.Body).Decode(&preferences); err != nil {
 		http.Error(w, "Invalid request body", http.StatusBadRequest)
 		return
 	}
 
-	userID := r.Context().Value("userID").(string)
-	notificationReq.UserID = userID
+	if err := h.service.UpdateNotificationPreferences(r.Context(), userID, &preferences); err != nil {
+		http.Error(w, errors.Message(err), errors.StatusCode(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(preferences)
+}
+
+func (h *NotificationHandler) MarkAsRead(w http.ResponseWriter, r *http.Request, id string) {
+	userID, err := middleware.GetUserID(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
 
-	// Convert request to model
-	notification := &model.Notification{
-		UserID:    notificationReq.UserID,
-		Title:     notificationReq.Title,
-		Message:   notificationReq.Message,
-		Type:      model.NotificationType(notificationReq.Type),
-		Priority:  model.NotificationPriority(notificationReq.Priority),
-		Data:      notificationReq.Metadata,
-		CreatedAt: time.Now(),
-		UpdatedAt: time.Now(),
+	if err := h.service.MarkAsRead(r.Context(), userID, id); err != nil {
+		http.Error(w, errors.Message(err), errors.StatusCode(err))
+		return
 	}
 
-	err := h.service.CreateNotification(r.Context(), notification)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// MarkManyAsRead marks the notifications listed in the body, or all of them,
+// as read
+func (h *NotificationHandler) MarkManyAsRead(w http.ResponseWriter, r *http.Request) {
+	userID, err := middleware.GetUserID(r.Context())
 	if err != nil {
-		http.Error(w, "Failed to create notification", http.StatusInternalServerError)
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	var req model.NotificationBulkRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
 		return
 	}
 
-	w.WriteHeader(http.StatusCreated)
+	updated, err := h.service.MarkManyAsRead(r.Context(), userID, &req)
+	if err != nil {
+		http.Error(w, errors.Message(err), errors.StatusCode(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"updated": updated,
+	})
 }
 
-// UpdatePreferences handles updating user notification preferences
-func (h *NotificationHandler) UpdatePreferences(w http.ResponseWriter, r *http.Request) {
-	var preferences model.NotificationPreferences
-	if err := decodeJSON(r, &preferences); err != nil {
+// DeleteMany deletes the notifications listed in the body, or all of them
+func (h *NotificationHandler) DeleteMany(w http.ResponseWriter, r *http.Request) {
+	userID, err := middleware.GetUserID(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	var req model.NotificationBulkRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		http.Error(w, "Invalid request body", http.StatusBadRequest)
 		return
 	}
 
-	userID := r.Context().Value("userID").(string)
-	err := h.service.UpdateNotificationPreferences(r.Context(), userID, &preferences)
+	deleted, err := h.service.DeleteMany(r.Context(), userID, &req)
 	if err != nil {
-		http.Error(w, "Failed to update notification preferences", http.StatusInternalServerError)
+		http.Error(w, errors.Message(err), errors.StatusCode(err))
 		return
 	}
 
-	w.WriteHeader(http.StatusOK)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"deleted": deleted,
+	})
 }
 
-// MarkAsRead handles marking a notification as read
-func (h *NotificationHandler) MarkAsRead(w http.ResponseWriter, r *http.Request) {
-	userID := r.URL.Query().Get("user_id")
-	notificationID := r.URL.Query().Get("notification_id")
-	
-	if userID == "" || notificationID == "" {
-		http.Error(w, "Missing user_id or notification_id parameter", http.StatusBadRequest)
+// Snooze hides a notification until the time in the body
+func (h *NotificationHandler) Snooze(w http.ResponseWriter, r *http.Request, id string) {
+	userID, err := middleware.GetUserID(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
 		return
 	}
 
-	if err := h.service.MarkAsRead(r.Context(), userID, notificationID); err != nil {
-		http.Error(w, fmt.Sprintf("Failed to mark notification as read: %v", err), http.StatusInternalServerError)
+	var req model.NotificationSnooze
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
 		return
 	}
 
-	w.WriteHeader(http.StatusOK)
+	if err := h.service.Snooze(r.Context(), userID, id, req.Until); err != nil {
+		http.Error(w, errors.Message(err), errors.StatusCode(err))
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
 }
 
-// ServeHTTP implements the http.Handler interface
-func (h *NotificationHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	switch r.Method {
-	case http.MethodGet:
-		h.GetNotifications(w, r)
-	case http.MethodPost:
-		if r.URL.Path == "/api/notifications/preferences" {
-			h.UpdatePreferences(w, r)
-		} else {
-			h.CreateNotification(w, r)
+// Unsnooze brings a snoozed notification back now
+func (h *NotificationHandler) Unsnooze(w http.ResponseWriter, r *http.Request, id string) {
+	userID, err := middleware.GetUserID(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	if err := h.service.Unsnooze(r.Context(), userID, id); err != nil {
+		http.Error(w, errors.Message(err), errors.StatusCode(err))
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Stream pushes the user's events as Server-Sent Events. A client resuming
+// with a Last-Event-ID header (or last_event_id query parameter) first gets
+// the events it missed.
+//
+// Event IDs come from a sequence, and concurrent transactions can commit out
+// of order. A live event whose ID is below one already sent is still sent,
+// but without an id field so the client's resume position doesn't move
+// back. An event that commits out of order while the client is disconnected
+// is not replayed when it resumes, so delivery is at most once; clients
+// should refresh the notification list after reconnecting.
+func (h *NotificationHandler) Stream(w http.ResponseWriter, r *http.Request) {
+	userID, err := middleware.GetUserID(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	var lastID int64
+	resume := r.Header.Get("Last-Event-ID")
+	if resume == "" {
+		resume = r.URL.Query().Get("last_event_id")
+	}
+	if resume != "" {
+		if lastID, err = strconv.ParseInt(resume, 10, 64); err != nil || lastID < 0 {
+			http.Error(w, "Invalid Last-Event-ID", http.StatusBadRequest)
+			return
+		}
+	}
+
+	// Subscribe before replaying so nothing published in between is missed
+	events, unsubscribe := h.events.Subscribe(userID)
+	defer unsubscribe()
+
+	// The stream outlives the server's write timeout
+	rc := http.NewResponseController(w)
+	rc.SetWriteDeadline(time.Time{})
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprint(w, "retry: 5000\n\n")
+
+	sent := newSentEvents(streamRecentEvents)
+	if resume != "" {
+		for {
+			missed, err := h.events.EventsAfter(r.Context(), userID, lastID)
+			if err != nil {
+				return
+			}
+			for _, event := range missed {
+				writeEvent(w, event, true)
+				sent.add(event.ID)
+				lastID = event.ID
+			}
+			if len(missed) < service.MaxEventReplay {
+				break
+			}
+		}
+	}
+	if err := rc.Flush(); err != nil {
+		return
+	}
+
+	heartbeat := time.NewTicker(streamHeartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": heartbeat\n\n")
+		case event, ok := <-events:
+			// A closed channel means the stream fell behind. The client
+			// reconnects and resumes from the last event it got.
+			if !ok {
+				return
+			}
+			if sent.has(event.ID) {
+				continue
+			}
+			writeEvent(w, event, event.ID > lastID)
+			sent.add(event.ID)
+			if event.ID > lastID {
+				lastID = event.ID
+			}
+		}
+		if err := rc.Flush(); err != nil {
+			return
 		}
-	case http.MethodPatch:
-		h.MarkAsRead(w, r)
-	default:
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 	}
 }
 
-// Helper functions
-func respondJSON(w http.ResponseWriter, data interface{}) {
-	w.Header().Set("Content-Type", "application/json")
-	if err := json.NewEncoder(w).Encode(data); err != nil {
-		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+// writeEvent writes event in the Server-Sent Events format. The data is
+// single line JSON. The id field, which the client resumes from, is left
+// out unless withID is set.
+func writeEvent(w http.ResponseWriter, event *model.Event, withID bool) {
+	if withID {
+		fmt.Fprintf(w, "id: %d\n", event.ID)
+	}
+	fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.Type, event.Data)
+}
+
+// sentEvents remembers the IDs of the events a stream sent most recently
+type sentEvents struct {
+	ids   map[int64]struct{}
+	order []int64
+	size  int
+}
+
+func newSentEvents(size int) *sentEvents {
+	return &sentEvents{ids: make(map[int64]struct{}, size), size: size}
+}
+
+func (s *sentEvents) has(id int64) bool {
+	_, ok := s.ids[id]
+	return ok
+}
+
+// add records id, forgetting the oldest ID once full
+func (s *sentEvents) add(id int64) {
+	if s.has(id) {
 		return
 	}
+	if len(s.order) == s.size {
+		delete(s.ids, s.order[0])
+		s.order = s.order[1:]
+	}
+	s.ids[id] = struct{}{}
+	s.order = append(s.order, id)
 }
 
-func decodeJSON(r *http.Request, v interface{}) error {
-	return json.NewDecoder(r.Body).Decode(v)
+// ServeHTTP implements the http.Handler interface
+//
+// Routes:
+//
+//	/api/notifications
+//	/api/notifications/preferences
+//	/api/notifications/stream
+//	/api/notifications/read
+//	/api/notifications/delete
+//	/api/notifications/{id}/read
+//	/api/notifications/{id}/snooze
+func (h *NotificationHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	path := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/notifications"), "/")
+	var parts []string
+	if path != "" {
+		parts = strings.Split(path, "/")
+	}
+
+	switch {
+	case len(parts) == 0:
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		h.GetNotifications(w, r)
+	case len(parts) == 1 && parts[0] == "stream":
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		h.Stream(w, r)
+	case len(parts) == 1 && parts[0] == "read":
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		h.MarkManyAsRead(w, r)
+	case len(parts) == 1 && parts[0] == "delete":
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		h.DeleteMany(w, r)
+	case len(parts) == 1 && parts[0] == "preferences":
+		switch r.Method {
+		case http.MethodGet:
+			h.GetPreferences(w, r)
+		case http.MethodPut:
+			h.UpdatePreferences(w, r)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	case len(parts) == 2 && parts[1] == "read":
+		if r.Method != http.MethodPut {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		h.MarkAsRead(w, r, parts[0])
+	case len(parts) == 2 && parts[1] == "snooze":
+		switch r.Method {
+		case http.MethodPut:
+			h.Snooze(w, r, parts[0])
+		case http.MethodDelete:
+			h.Unsnooze(w, r, parts[0])
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	default:
+		http.NotFound(w, r)
+	}
 }
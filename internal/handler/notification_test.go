@@ -0,0 +1,47 @@
+package handler
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/yeboahd24/personal-finance-manager/internal/model"
+)
+
+func TestSentEventsForgetsOldest(t *testing.T) {
+	sent := newSentEvents(3)
+	for _, id := range []int64{10, 12, 11, 12} {
+		sent.add(id)
+	}
+	for _, id := range []int64{10, 11, 12} {
+		if !sent.has(id) {
+			t.Errorf("forgot event %d", id)
+		}
+	}
+
+	sent.add(13)
+	if sent.has(10) {
+		t.Error("kept the oldest event past the limit")
+	}
+	for _, id := range []int64{11, 12, 13} {
+		if !sent.has(id) {
+			t.Errorf("forgot event %d", id)
+		}
+	}
+}
+
+func TestWriteEvent(t *testing.T) {
+	event := &model.Event{ID: 42, Type: model.EventNotification, Data: []byte(`{"title":"Hi"}`)}
+
+	w := httptest.NewRecorder()
+	writeEvent(w, event, true)
+	if got, want := w.Body.String(), "id: 42\nevent: notification\ndata: {\"title\":\"Hi\"}\n\n"; got != want {
+		t.Errorf("with id wrote %q, want %q", got, want)
+	}
+
+	// A late event leaves the client's resume position alone
+	w = httptest.NewRecorder()
+	writeEvent(w, event, false)
+	if got, want := w.Body.String(), "event: notification\ndata: {\"title\":\"Hi\"}\n\n"; got != want {
+		t.Errorf("without id wrote %q, want %q", got, want)
+	}
+}
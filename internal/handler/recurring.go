@@ -5,7 +5,10 @@ import (
 	"net/http"
 	"path"
 	"strconv"
+	"strings"
+	"time"
 
+	"github.com/yeboahd24/personal-finance-manager/internal/errors"
 	"github.com/yeboahd24/personal-finance-manager/internal/middleware"
 	"github.com/yeboahd24/personal-finance-manager/internal/model"
 	"github.com/yeboahd24/personal-finance-manager/internal/service"
@@ -40,7 +43,7 @@ func (h *RecurringTransactionHandler) CreateRecurringTransaction(w http.Response
 	}
 
 	if err := h.service.CreateRecurringTransaction(r.Context(), userID, &tx); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		http.Error(w, errors.Message(err), errors.StatusCode(err))
 		return
 	}
 
@@ -64,7 +67,7 @@ func (h *RecurringTransactionHandler) GetRecurringTransaction(w http.ResponseWri
 	id := path.Base(r.URL.Path)
 	tx, err := h.service.GetRecurringTransactionByID(r.Context(), userID, id)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		http.Error(w, errors.Message(err), errors.StatusCode(err))
 		return
 	}
 
@@ -98,7 +101,7 @@ func (h *RecurringTransactionHandler) GetRecurringTransactions(w http.ResponseWr
 
 	transactions, err := h.service.GetRecurringTransactions(r.Context(), userID, filter)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		http.Error(w, errors.Message(err), errors.StatusCode(err))
 		return
 	}
 
@@ -127,7 +130,7 @@ func (h *RecurringTransactionHandler) UpdateRecurringTransaction(w http.Response
 
 	tx.ID = id
 	if err := h.service.UpdateRecurringTransaction(r.Context(), userID, &tx); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		http.Error(w, errors.Message(err), errors.StatusCode(err))
 		return
 	}
 
@@ -149,29 +152,261 @@ func (h *RecurringTransactionHandler) DeleteRecurringTransaction(w http.Response
 
 	id := path.Base(r.URL.Path)
 	if err := h.service.DeleteRecurringTransaction(r.Context(), userID, id); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		http.Error(w, errors.Message(err), errors.StatusCode(err))
 		return
 	}
 
 	w.WriteHeader(http.StatusNoContent)
 }
 
+// GetUpcomingOccurrences lists the occurrences of all the user's recurring
+// transactions over the next days (default 30)
+func (h *RecurringTransactionHandler) GetUpcomingOccurrences(w http.ResponseWriter, r *http.Request) {
+	userID, err := middleware.GetUserID(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	days, ok := occurrenceDays(w, r, 30)
+	if !ok {
+		return
+	}
+
+	occurrences, err := h.service.GetUpcomingOccurrences(r.Context(), userID, days)
+	if err != nil {
+		http.Error(w, errors.Message(err), errors.StatusCode(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(occurrences)
+}
+
+// GetOccurrences lists one recurring transaction's occurrences over the next
+// days (default 90)
+func (h *RecurringTransactionHandler) GetOccurrences(w http.ResponseWriter, r *http.Request, id string) {
+	userID, err := middleware.GetUserID(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	days, ok := occurrenceDays(w, r, 90)
+	if !ok {
+		return
+	}
+
+	occurrences, err := h.service.GetOccurrences(r.Context(), userID, id, days)
+	if err != nil {
+		http.Error(w, errors.Message(err), errors.StatusCode(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(occurrences)
+}
+
+func (h *RecurringTransactionHandler) OverrideOccurrence(w http.ResponseWriter, r *http.Request, id, date string) {
+	userID, err := middleware.GetUserID(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	var override model.OccurrenceOverride
+	if err := json.NewDecoder(r.Body).Decode(&override); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	tx, err := h.service.OverrideOccurrence(r.Context(), userID, id, date, override)
+	if err != nil {
+		http.Error(w, errors.Message(err), errors.StatusCode(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(tx)
+}
+
+func (h *RecurringTransactionHandler) ClearOccurrenceOverride(w http.ResponseWriter, r *http.Request, id, date string) {
+	userID, err := middleware.GetUserID(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	tx, err := h.service.ClearOccurrenceOverride(r.Context(), userID, id, date)
+	if err != nil {
+		http.Error(w, errors.Message(err), errors.StatusCode(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(tx)
+}
+
+func (h *RecurringTransactionHandler) SkipOccurrence(w http.ResponseWriter, r *http.Request, id, date string) {
+	userID, err := middleware.GetUserID(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	tx, err := h.service.SkipOccurrence(r.Context(), userID, id, date)
+	if err != nil {
+		http.Error(w, errors.Message(err), errors.StatusCode(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(tx)
+}
+
+func (h *RecurringTransactionHandler) UnskipOccurrence(w http.ResponseWriter, r *http.Request, id, date string) {
+	userID, err := middleware.GetUserID(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	tx, err := h.service.UnskipOccurrence(r.Context(), userID, id, date)
+	if err != nil {
+		http.Error(w, errors.Message(err), errors.StatusCode(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(tx)
+}
+
+// PauseRecurringTransaction pauses a recurring transaction, until resume_at
+// if given
+func (h *RecurringTransactionHandler) PauseRecurringTransaction(w http.ResponseWriter, r *http.Request, id string) {
+	userID, err := middleware.GetUserID(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	var req struct {
+		ResumeAt *time.Time `json:"resume_at"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+	}
+
+	tx, err := h.service.PauseRecurringTransaction(r.Context(), userID, id, req.ResumeAt)
+	if err != nil {
+		http.Error(w, errors.Message(err), errors.StatusCode(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(tx)
+}
+
+func (h *RecurringTransactionHandler) ResumeRecurringTransaction(w http.ResponseWriter, r *http.Request, id string) {
+	userID, err := middleware.GetUserID(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	tx, err := h.service.ResumeRecurringTransaction(r.Context(), userID, id)
+	if err != nil {
+		http.Error(w, errors.Message(err), errors.StatusCode(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(tx)
+}
+
+// occurrenceDays reads the days query parameter, writing an error response
+// if it isn't a number
+func occurrenceDays(w http.ResponseWriter, r *http.Request, fallback int) (int, bool) {
+	v := r.URL.Query().Get("days")
+	if v == "" {
+		return fallback, true
+	}
+	days, err := strconv.Atoi(v)
+	if err != nil {
+		http.Error(w, "Invalid days", http.StatusBadRequest)
+		return 0, false
+	}
+	return days, true
+}
+
 // ServeHTTP implements the http.Handler interface
 func (h *RecurringTransactionHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	switch r.Method {
-	case http.MethodGet:
-		if r.URL.Query().Get("id") != "" {
+	p := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/recurring"), "/")
+	parts := strings.Split(p, "/")
+
+	switch {
+	case p == "":
+		switch r.Method {
+		case http.MethodGet:
+			if r.URL.Query().Get("id") != "" {
+				h.GetRecurringTransaction(w, r)
+			} else {
+				h.GetRecurringTransactions(w, r)
+			}
+		case http.MethodPost:
+			h.CreateRecurringTransaction(w, r)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+
+	case p == "upcoming" && r.Method == http.MethodGet:
+		h.GetUpcomingOccurrences(w, r)
+
+	case len(parts) == 1:
+		switch r.Method {
+		case http.MethodGet:
 			h.GetRecurringTransaction(w, r)
-		} else {
-			h.GetRecurringTransactions(w, r)
+		case http.MethodPut:
+			h.UpdateRecurringTransaction(w, r)
+		case http.MethodDelete:
+			h.DeleteRecurringTransaction(w, r)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		}
-	case http.MethodPost:
-		h.CreateRecurringTransaction(w, r)
-	case http.MethodPut:
-		h.UpdateRecurringTransaction(w, r)
-	case http.MethodDelete:
-		h.DeleteRecurringTransaction(w, r)
+
+	case len(parts) == 2 && parts[1] == "occurrences" && r.Method == http.MethodGet:
+		h.GetOccurrences(w, r, parts[0])
+
+	case len(parts) == 3 && parts[1] == "occurrences":
+		switch r.Method {
+		case http.MethodPut:
+			h.OverrideOccurrence(w, r, parts[0], parts[2])
+		case http.MethodDelete:
+			h.ClearOccurrenceOverride(w, r, parts[0], parts[2])
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+
+	case len(parts) == 4 && parts[1] == "occurrences" && parts[3] == "skip":
+		switch r.Method {
+		case http.MethodPost:
+			h.SkipOccurrence(w, r, parts[0], parts[2])
+		case http.MethodDelete:
+			h.UnskipOccurrence(w, r, parts[0], parts[2])
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+
+	case len(parts) == 2 && parts[1] == "pause" && r.Method == http.MethodPost:
+		h.PauseRecurringTransaction(w, r, parts[0])
+
+	case len(parts) == 2 && parts[1] == "resume" && r.Method == http.MethodPost:
+		h.ResumeRecurringTransaction(w, r, parts[0])
+
 	default:
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		http.NotFound(w, r)
 	}
 }
@@ -0,0 +1,113 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/yeboahd24/personal-finance-manager/internal/errors"
+	"github.com/yeboahd24/personal-finance-manager/internal/middleware"
+	"github.com/yeboahd24/personal-finance-manager/internal/model"
+	"github.com/yeboahd24/personal-finance-manager/internal/service"
+)
+
+// RecurringRetryHandler exposes recurring transaction occurrences that failed to post
+type RecurringRetryHandler struct {
+	recurringService *service.RecurringTransactionService
+}
+
+func NewRecurringRetryHandler(recurringService *service.RecurringTransactionService) *RecurringRetryHandler {
+	return &RecurringRetryHandler{
+		recurringService: recurringService,
+	}
+}
+
+// GetFailedOccurrences lists failed occurrences, optionally filtered by ?status=
+func (h *RecurringRetryHandler) GetFailedOccurrences(w http.ResponseWriter, r *http.Request) {
+	userID, err := middleware.GetUserID(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	status := model.RecurringRetryStatus(r.URL.Query().Get("status"))
+	retries, err := h.recurringService.GetFailedOccurrences(r.Context(), userID, status)
+	if err != nil {
+		http.Error(w, errors.Message(err), errors.StatusCode(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(retries)
+}
+
+// RetryFailedOccurrence queues a failed occurrence for an immediate attempt
+func (h *RecurringRetryHandler) RetryFailedOccurrence(w http.ResponseWriter, r *http.Request, id string) {
+	userID, err := middleware.GetUserID(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	retry, err := h.recurringService.RetryFailedOccurrence(r.Context(), userID, id)
+	if err != nil {
+		http.Error(w, errors.Message(err), errors.StatusCode(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(retry)
+}
+
+// DismissFailedOccurrence stops retrying a failed occurrence
+func (h *RecurringRetryHandler) DismissFailedOccurrence(w http.ResponseWriter, r *http.Request, id string) {
+	userID, err := middleware.GetUserID(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	if err := h.recurringService.DismissFailedOccurrence(r.Context(), userID, id); err != nil {
+		http.Error(w, errors.Message(err), errors.StatusCode(err))
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ServeHTTP implements the http.Handler interface
+//
+// Routes:
+//
+//	/api/recurring/failures
+//	/api/recurring/failures/{id}/retry
+//	/api/recurring/failures/{id}/dismiss
+func (h *RecurringRetryHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	path := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/recurring/failures"), "/")
+	var parts []string
+	if path != "" {
+		parts = strings.Split(path, "/")
+	}
+
+	switch {
+	case len(parts) == 0:
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		h.GetFailedOccurrences(w, r)
+	case len(parts) == 2 && (parts[1] == "retry" || parts[1] == "dismiss"):
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if parts[1] == "retry" {
+			h.RetryFailedOccurrence(w, r, parts[0])
+		} else {
+			h.DismissFailedOccurrence(w, r, parts[0])
+		}
+	default:
+		http.NotFound(w, r)
+	}
+}
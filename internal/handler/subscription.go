@@ -0,0 +1,147 @@
+package handler
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/yeboahd24/personal-finance-manager/internal/errors"
+	"github.com/yeboahd24/personal-finance-manager/internal/middleware"
+	"github.com/yeboahd24/personal-finance-manager/internal/service"
+)
+
+type SubscriptionHandler struct {
+	subscriptionService *service.SubscriptionService
+}
+
+func NewSubscriptionHandler(subscriptionService *service.SubscriptionService) *SubscriptionHandler {
+	return &SubscriptionHandler{
+		subscriptionService: subscriptionService,
+	}
+}
+
+type acceptSubscriptionRequest struct {
+	CategoryID string `json:"category_id"`
+}
+
+// GetSubscriptions returns every subscription detected in the user's transactions
+func (h *SubscriptionHandler) GetSubscriptions(w http.ResponseWriter, r *http.Request) {
+	userID, err := middleware.GetUserID(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	subscriptions, err := h.subscriptionService.DetectSubscriptions(r.Context(), userID)
+	if err != nil {
+		http.Error(w, errors.Message(err), errors.StatusCode(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(subscriptions)
+}
+
+// GetSuggestions returns detected subscriptions that aren't tracked yet
+func (h *SubscriptionHandler) GetSuggestions(w http.ResponseWriter, r *http.Request) {
+	userID, err := middleware.GetUserID(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	suggestions, err := h.subscriptionService.GetSuggestions(r.Context(), userID)
+	if err != nil {
+		http.Error(w, errors.Message(err), errors.StatusCode(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(suggestions)
+}
+
+// AcceptSuggestion creates a recurring transaction from a detected subscription
+func (h *SubscriptionHandler) AcceptSuggestion(w http.ResponseWriter, r *http.Request, id string) {
+	userID, err := middleware.GetUserID(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	// The body is optional
+	var req acceptSubscriptionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	rt, err := h.subscriptionService.AcceptSuggestion(r.Context(), userID, id, req.CategoryID)
+	if err != nil {
+		http.Error(w, errors.Message(err), errors.StatusCode(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(rt)
+}
+
+// DismissSuggestion hides a detected subscription
+func (h *SubscriptionHandler) DismissSuggestion(w http.ResponseWriter, r *http.Request, id string) {
+	userID, err := middleware.GetUserID(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	if err := h.subscriptionService.DismissSuggestion(r.Context(), userID, id); err != nil {
+		http.Error(w, errors.Message(err), errors.StatusCode(err))
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ServeHTTP implements the http.Handler interface
+//
+// Routes:
+//
+//	/api/subscriptions
+//	/api/subscriptions/suggestions
+//	/api/subscriptions/{id}/accept
+//	/api/subscriptions/{id}/dismiss
+func (h *SubscriptionHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	path := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/subscriptions"), "/")
+	var parts []string
+	if path != "" {
+		parts = strings.Split(path, "/")
+	}
+
+	switch {
+	case len(parts) == 0:
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		h.GetSubscriptions(w, r)
+	case len(parts) == 1 && parts[0] == "suggestions":
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		h.GetSuggestions(w, r)
+	case len(parts) == 2 && (parts[1] == "accept" || parts[1] == "dismiss"):
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if parts[1] == "accept" {
+			h.AcceptSuggestion(w, r, parts[0])
+		} else {
+			h.DismissSuggestion(w, r, parts[0])
+		}
+	default:
+		http.NotFound(w, r)
+	}
+}
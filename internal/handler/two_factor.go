@@ -0,0 +1,126 @@
+package handler
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/yeboahd24/personal-finance-manager/internal/errors"
+	"github.com/yeboahd24/personal-finance-manager/internal/middleware"
+	"github.com/yeboahd24/personal-finance-manager/internal/model"
+)
+
+// twoFactorChallengeResponse is returned by Login instead of tokens when the
+// user has two-factor authentication on
+type twoFactorChallengeResponse struct {
+	TwoFactorRequired bool   `json:"two_factor_required"`
+	ChallengeToken    string `json:"challenge_token"`
+	ExpiresIn         int    `json:"expires_in"` // Seconds left to complete the login
+}
+
+type twoFactorLoginRequest struct {
+	ChallengeToken string `json:"challenge_token"`
+	Code           string `json:"code"` // A TOTP code or a recovery code
+}
+
+// LoginTwoFactor completes a login with the challenge token from Login and a
+// code from the user's authenticator app or a recovery code
+func (h *UserHandler) LoginTwoFactor(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req twoFactorLoginRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	user, err := h.twoFactorService.CompleteLogin(r.Context(), req.ChallengeToken, req.Code)
+	if err != nil {
+		http.Error(w, errors.Message(err), errors.StatusCode(err))
+		return
+	}
+
+	response, err := h.startSession(w, r, user)
+	if err != nil {
+		http.Error(w, "Error generating token", http.StatusInternalServerError)
+		return
+	}
+	log.Printf("Set auth cookie for user: %s", user.ID)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+type twoFactorCodeRequest struct {
+	Password string `json:"password"`
+	Code     string `json:"code"`
+}
+
+// TwoFactor routes:
+//
+//	GET  /api/users/2fa                - two-factor status
+//	POST /api/users/2fa/setup          - start enrolment, returning the secret and otpauth URI
+//	POST /api/users/2fa/enable         - confirm enrolment with a code, returning recovery codes
+//	POST /api/users/2fa/disable        - turn off, with the password and a code
+//	POST /api/users/2fa/recovery-codes - replace the recovery codes, with the password and a code
+func (h *UserHandler) TwoFactor(w http.ResponseWriter, r *http.Request) {
+	userID, err := middleware.GetUserID(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	action := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/users/2fa"), "/")
+	method := http.MethodPost
+	if action == "" {
+		method = http.MethodGet
+	}
+	switch action {
+	case "", "setup", "enable", "disable", "recovery-codes":
+		if r.Method != method {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+	default:
+		http.NotFound(w, r)
+		return
+	}
+
+	var req twoFactorCodeRequest
+	if method == http.MethodPost && action != "setup" {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+	}
+
+	var response interface{}
+	switch action {
+	case "":
+		response, err = h.twoFactorService.GetStatus(r.Context(), userID)
+	case "setup":
+		response, err = h.twoFactorService.Setup(r.Context(), userID)
+	case "enable":
+		var codes []string
+		codes, err = h.twoFactorService.Enable(r.Context(), userID, req.Code)
+		response = map[string][]string{"recovery_codes": codes}
+	case "disable":
+		err = h.twoFactorService.Disable(r.Context(), userID, req.Password, req.Code)
+		response = &model.TwoFactorStatus{}
+	case "recovery-codes":
+		var codes []string
+		codes, err = h.twoFactorService.RegenerateRecoveryCodes(r.Context(), userID, req.Password, req.Code)
+		response = map[string][]string{"recovery_codes": codes}
+	}
+	if err != nil {
+		http.Error(w, errors.Message(err), errors.StatusCode(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
@@ -4,19 +4,25 @@ import (
 	"encoding/json"
 	"log"
 	"net/http"
+	"strings"
 
+	"github.com/yeboahd24/personal-finance-manager/internal/errors"
 	"github.com/yeboahd24/personal-finance-manager/internal/middleware"
 	"github.com/yeboahd24/personal-finance-manager/internal/model"
 	"github.com/yeboahd24/personal-finance-manager/internal/service"
 )
 
 type UserHandler struct {
-	userService *service.UserService
+	userService      *service.UserService
+	sessionService   *service.SessionService
+	twoFactorService *service.TwoFactorService
 }
 
-func NewUserHandler(userService *service.UserService) *UserHandler {
+func NewUserHandler(userService *service.UserService, sessionService *service.SessionService, twoFactorService *service.TwoFactorService) *UserHandler {
 	return &UserHandler{
-		userService: userService,
+		userService:      userService,
+		sessionService:   sessionService,
+		twoFactorService: twoFactorService,
 	}
 }
 
@@ -39,36 +45,22 @@ func (h *UserHandler) CreateUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	user, err := h.userService.CreateUser(r.Context(), req.Email, req.Password, req.FirstName, req.LastName)
+	user, err := h.userService.Register(r.Context(), req.Email, req.Password, req.FirstName, req.LastName)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		http.Error(w, errors.Message(err), errors.StatusCode(err))
 		return
 	}
 
-	// Generate JWT token for new user
-	token, err := middleware.GenerateToken(user.ID)
+	// Log the new user in
+	response, err := h.startSession(w, r, user)
 	if err != nil {
 		http.Error(w, "Error generating token", http.StatusInternalServerError)
 		return
 	}
-
-	// Set auth cookie
-	cookie := &http.Cookie{
-		Name:     "authToken",
-		Value:    token,
-		Path:     "/",
-		MaxAge:   86400, // 24 hours
-		HttpOnly: true,
-		SameSite: http.SameSiteLaxMode,
-	}
-	http.SetCookie(w, cookie)
 	log.Printf("Set auth cookie for new user: %s", user.ID)
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]interface{}{
-		"user":  user,
-		"token": token,
-	})
+	json.NewEncoder(w).Encode(response)
 }
 
 type loginRequest struct {
@@ -77,8 +69,10 @@ type loginRequest struct {
 }
 
 type loginResponse struct {
-	User  *model.User `json:"user"`
-	Token string      `json:"token"`
+	User         *model.User `json:"user,omitempty"`
+	Token        string      `json:"token"`
+	RefreshToken string      `json:"refresh_token"`
+	ExpiresIn    int         `json:"expires_in"` // Seconds until the access token expires
 }
 
 func (h *UserHandler) Login(w http.ResponseWriter, r *http.Request) {
@@ -99,31 +93,186 @@ func (h *UserHandler) Login(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Generate JWT token
-	token, err := middleware.GenerateToken(user.ID)
+	// Users with two-factor authentication on finish logging in at
+	// /api/users/login/2fa
+	challenge, err := h.twoFactorService.BeginLogin(r.Context(), user)
 	if err != nil {
-		http.Error(w, "Error generating token", http.StatusInternalServerError)
+		http.Error(w, errors.Message(err), errors.StatusCode(err))
+		return
+	}
+	if challenge != "" {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(twoFactorChallengeResponse{
+			TwoFactorRequired: true,
+			ChallengeToken:    challenge,
+			ExpiresIn:         int(model.LoginChallengeTTL.Seconds()),
+		})
 		return
 	}
 
-	// Set auth cookie
-	cookie := &http.Cookie{
-		Name:     "authToken",
-		Value:    token,
-		Path:     "/",
-		MaxAge:   86400, // 24 hours
-		HttpOnly: true,
-		SameSite: http.SameSiteLaxMode,
+	// Start a session and issue its tokens
+	response, err := h.startSession(w, r, user)
+	if err != nil {
+		http.Error(w, "Error generating token", http.StatusInternalServerError)
+		return
 	}
-	http.SetCookie(w, cookie)
 	log.Printf("Set auth cookie for user: %s", user.ID)
 
-	// Create response with user and token
-	response := loginResponse{
-		User:  user,
-		Token: token,
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// startSession opens a session for a user who just registered or logged in,
+// sets its cookies and returns its tokens
+func (h *UserHandler) startSession(w http.ResponseWriter, r *http.Request, user *model.User) (*loginResponse, error) {
+	session, refreshToken, err := h.sessionService.StartSession(r.Context(), user.ID, middleware.UserAgent(r), middleware.ClientIP(r))
+	if err != nil {
+		return nil, err
+	}
+	token, err := middleware.IssueTokens(w, session, refreshToken)
+	if err != nil {
+		return nil, err
+	}
+	return &loginResponse{
+		User:         user,
+		Token:        token,
+		RefreshToken: refreshToken,
+		ExpiresIn:    int(model.AccessTokenTTL.Seconds()),
+	}, nil
+}
+
+type refreshRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+// Refresh exchanges a refresh token, from the body or the refresh cookie, for
+// a new access token and refresh token. The old refresh token stops working.
+func (h *UserHandler) Refresh(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req refreshRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+	}
+	if req.RefreshToken == "" {
+		req.RefreshToken = middleware.RefreshTokenFromCookie(r)
+	}
+
+	session, refreshToken, err := h.sessionService.Refresh(r.Context(), req.RefreshToken, middleware.UserAgent(r), middleware.ClientIP(r))
+	if err != nil {
+		middleware.ClearTokens(w)
+		http.Error(w, errors.Message(err), errors.StatusCode(err))
+		return
+	}
+
+	token, err := middleware.IssueTokens(w, session, refreshToken)
+	if err != nil {
+		http.Error(w, "Error generating token", http.StatusInternalServerError)
+		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(response)
+	json.NewEncoder(w).Encode(loginResponse{
+		Token:        token,
+		RefreshToken: refreshToken,
+		ExpiresIn:    int(model.AccessTokenTTL.Seconds()),
+	})
+}
+
+// Logout ends the current session
+func (h *UserHandler) Logout(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, err := middleware.GetUserID(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	sessionID, err := middleware.GetSessionID(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	if err := h.sessionService.Logout(r.Context(), userID, sessionID); err != nil {
+		http.Error(w, errors.Message(err), errors.StatusCode(err))
+		return
+	}
+
+	middleware.ClearTokens(w)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// LogoutAll ends every session of the user, on all devices
+func (h *UserHandler) LogoutAll(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, err := middleware.GetUserID(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	revoked, err := h.sessionService.LogoutAll(r.Context(), userID)
+	if err != nil {
+		http.Error(w, errors.Message(err), errors.StatusCode(err))
+		return
+	}
+
+	middleware.ClearTokens(w)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]int64{"revoked": revoked})
+}
+
+// Sessions routes:
+//
+//	GET    /api/users/sessions       - list the user's active sessions
+//	DELETE /api/users/sessions/{id}  - revoke a session
+func (h *UserHandler) Sessions(w http.ResponseWriter, r *http.Request) {
+	userID, err := middleware.GetUserID(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	id := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/users/sessions"), "/")
+	switch {
+	case id == "" && r.Method == http.MethodGet:
+		currentID, _ := middleware.GetSessionID(r.Context())
+		sessions, err := h.sessionService.GetSessions(r.Context(), userID, currentID)
+		if err != nil {
+			http.Error(w, errors.Message(err), errors.StatusCode(err))
+			return
+		}
+		if sessions == nil {
+			sessions = []*model.Session{}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(sessions)
+	case id != "" && !strings.Contains(id, "/") && r.Method == http.MethodDelete:
+		if err := h.sessionService.RevokeSession(r.Context(), userID, id); err != nil {
+			http.Error(w, errors.Message(err), errors.StatusCode(err))
+			return
+		}
+		if currentID, _ := middleware.GetSessionID(r.Context()); currentID == id {
+			middleware.ClearTokens(w)
+		}
+		w.WriteHeader(http.StatusNoContent)
+	case id == "" || !strings.Contains(id, "/"):
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	default:
+		http.NotFound(w, r)
+	}
 }
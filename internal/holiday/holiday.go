@@ -0,0 +1,159 @@
+// Package holiday provides business day calendars: Saturdays, Sundays and a
+// list of holidays. Calendars for the US and UK are bundled; others can be
+// built from user supplied dates.
+package holiday
+
+import (
+	"bufio"
+	"embed"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const dateFormat = "2006-01-02"
+
+//go:embed data/*.txt
+var data embed.FS
+
+// bundledFiles maps bundled calendar names to their data files
+var bundledFiles = map[string]string{
+	"US": "data/us.txt",
+	"UK": "data/uk.txt",
+}
+
+// Calendar tells business days apart from weekends and holidays
+type Calendar interface {
+	IsBusinessDay(day time.Time) bool
+}
+
+// Dates is a calendar of holidays on top of Saturdays and Sundays. Days are
+// matched by calendar date in the location of the time passed in.
+type Dates struct {
+	Name     string
+	holidays map[string]string
+}
+
+// Weekends is a calendar with no holidays
+var Weekends Calendar = NewDates("")
+
+// NewDates creates a calendar with no holidays
+func NewDates(name string) *Dates {
+	return &Dates{Name: name, holidays: make(map[string]string)}
+}
+
+// Add marks day as a holiday
+func (d *Dates) Add(day time.Time, name string) {
+	d.holidays[day.Format(dateFormat)] = name
+}
+
+// Holiday returns the name of the holiday on day, if it is one
+func (d *Dates) Holiday(day time.Time) (string, bool) {
+	name, ok := d.holidays[day.Format(dateFormat)]
+	return name, ok
+}
+
+// IsBusinessDay reports whether day is neither a weekend nor a holiday
+func (d *Dates) IsBusinessDay(day time.Time) bool {
+	if day.Weekday() == time.Saturday || day.Weekday() == time.Sunday {
+		return false
+	}
+	_, ok := d.holidays[day.Format(dateFormat)]
+	return !ok
+}
+
+// Between returns the holidays from start to end, including both ends, as
+// dates mapped to names
+func (d *Dates) Between(start, end time.Time) map[string]string {
+	from, to := start.Format(dateFormat), end.Format(dateFormat)
+	holidays := make(map[string]string)
+	for date, name := range d.holidays {
+		if date >= from && date <= to {
+			holidays[date] = name
+		}
+	}
+	return holidays
+}
+
+// Parse reads a calendar with one holiday per line, as a date followed by
+// its name, e.g. "2025-12-25 Christmas Day". Blank lines and lines starting
+// with # are ignored.
+func Parse(name string, r io.Reader) (*Dates, error) {
+	d := NewDates(name)
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		date, holiday, _ := strings.Cut(text, " ")
+		day, err := time.Parse(dateFormat, date)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %q is not a date", line, date)
+		}
+		d.Add(day, strings.TrimSpace(holiday))
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+var (
+	bundledOnce sync.Once
+	bundled     map[string]*Dates
+)
+
+// Bundled returns the bundled calendar with the given name, e.g. "US"
+func Bundled(name string) (*Dates, bool) {
+	bundledOnce.Do(loadBundled)
+	d, ok := bundled[name]
+	return d, ok
+}
+
+// BundledNames returns the names of the bundled calendars
+func BundledNames() []string {
+	names := make([]string, 0, len(bundledFiles))
+	for name := range bundledFiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func loadBundled() {
+	bundled = make(map[string]*Dates, len(bundledFiles))
+	for name, file := range bundledFiles {
+		f, err := data.Open(file)
+		if err != nil {
+			panic(fmt.Sprintf("holiday: opening %s: %v", file, err))
+		}
+		d, err := Parse(name, f)
+		f.Close()
+		if err != nil {
+			panic(fmt.Sprintf("holiday: parsing %s: %v", file, err))
+		}
+		bundled[name] = d
+	}
+}
+
+// Combine returns a calendar whose business days are business days in all
+// of calendars
+func Combine(calendars ...Calendar) Calendar {
+	return combined(calendars)
+}
+
+type combined []Calendar
+
+func (c combined) IsBusinessDay(day time.Time) bool {
+	for _, cal := range c {
+		if !cal.IsBusinessDay(day) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,46 @@
+package mailer
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// FileTransport writes each message to a maildir, where mail clients and
+// tools such as mutt can read it. Meant for development.
+type FileTransport struct {
+	dir string
+}
+
+// NewFileTransport creates the maildir's tmp, new and cur folders under dir
+// if they don't exist
+func NewFileTransport(dir string) (*FileTransport, error) {
+	for _, sub := range []string{"tmp", "new", "cur"} {
+		if err := os.MkdirAll(filepath.Join(dir, sub), 0o755); err != nil {
+			return nil, fmt.Errorf("create maildir: %w", err)
+		}
+	}
+	return &FileTransport{dir: dir}, nil
+}
+
+// Send writes the message to tmp and moves it into new once complete, so
+// readers never see a partial message
+func (t *FileTransport) Send(ctx context.Context, msg *Message) error {
+	body, err := msg.Bytes()
+	if err != nil {
+		return fmt.Errorf("build message: %w", err)
+	}
+
+	host, _ := os.Hostname()
+	name := fmt.Sprintf("%s.%s", randomID(), host)
+	tmp := filepath.Join(t.dir, "tmp", name)
+	if err := os.WriteFile(tmp, body, 0o644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, filepath.Join(t.dir, "new", name)); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,176 @@
+// Package mailer builds multipart email messages and sends them through a
+// pluggable transport: SMTP with STARTTLS, a maildir for development, or
+// memory for tests.
+package mailer
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/textproto"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Message is an email with a plain text and an HTML version of its body
+type Message struct {
+	ID      string // Unique part of the Message-ID header
+	From    string
+	To      string
+	Subject string
+	Text    string
+	HTML    string
+	Date    time.Time
+}
+
+// Transport delivers messages
+type Transport interface {
+	Send(ctx context.Context, msg *Message) error
+}
+
+// Bytes renders msg as a MIME message. A message with both bodies is sent as
+// multipart/alternative so clients can pick the one they display.
+func (m *Message) Bytes() ([]byte, error) {
+	var buf bytes.Buffer
+
+	date := m.Date
+	if date.IsZero() {
+		date = time.Now()
+	}
+	id := m.ID
+	if id == "" {
+		id = randomID()
+	}
+
+	header := func(key, value string) {
+		fmt.Fprintf(&buf, "%s: %s\r\n", key, value)
+	}
+	header("From", m.From)
+	header("To", m.To)
+	header("Subject", mime.QEncoding.Encode("utf-8", m.Subject))
+	header("Date", date.Format(time.RFC1123Z))
+	header("Message-ID", "<"+id+"@"+domain(m.From)+">")
+	header("MIME-Version", "1.0")
+
+	switch {
+	case m.HTML == "":
+		return writeSinglePart(&buf, "text/plain", m.Text)
+	case m.Text == "":
+		return writeSinglePart(&buf, "text/html", m.HTML)
+	}
+
+	mw := multipart.NewWriter(&buf)
+	header("Content-Type", `multipart/alternative; boundary="`+mw.Boundary()+`"`)
+	buf.WriteString("\r\n")
+
+	for _, part := range []struct{ contentType, body string }{
+		{"text/plain", m.Text},
+		{"text/html", m.HTML},
+	} {
+		w, err := mw.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType + "; charset=UTF-8"},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		if err := writeQuotedPrintable(w, part.body); err != nil {
+			return nil, err
+		}
+	}
+	if err := mw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func writeSinglePart(buf *bytes.Buffer, contentType, body string) ([]byte, error) {
+	fmt.Fprintf(buf, "Content-Type: %s; charset=UTF-8\r\n", contentType)
+	buf.WriteString("Content-Transfer-Encoding: quoted-printable\r\n\r\n")
+	if err := writeQuotedPrintable(buf, body); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func writeQuotedPrintable(w interface{ Write([]byte) (int, error) }, body string) error {
+	qp := quotedprintable.NewWriter(w)
+	if _, err := qp.Write([]byte(strings.ReplaceAll(body, "\n", "\r\n"))); err != nil {
+		return err
+	}
+	return qp.Close()
+}
+
+// domain returns the domain of an address such as "Name <user@example.com>"
+func domain(address string) string {
+	address = strings.TrimSuffix(strings.TrimSpace(address), ">")
+	if i := strings.LastIndex(address, "@"); i >= 0 && i < len(address)-1 {
+		return address[i+1:]
+	}
+	return "localhost"
+}
+
+func randomID() string {
+	b := make([]byte, 12)
+	rand.Read(b)
+	return strconv.FormatInt(time.Now().UnixNano(), 36) + "." + hex.EncodeToString(b)
+}
+
+// NewTransportFromEnv builds the transport named by EMAIL_TRANSPORT:
+//
+//	smtp    SMTP_HOST, SMTP_PORT, SMTP_USERNAME and SMTP_PASSWORD, upgraded
+//	        with STARTTLS. SMTP_INSECURE=true allows servers without it.
+//	file    A maildir at EMAIL_DIR (default tmp/mail)
+//	memory  Kept in memory, for tests
+//
+// Without EMAIL_TRANSPORT, SMTP is used when SMTP_HOST is set and the
+// maildir otherwise.
+func NewTransportFromEnv() (Transport, error) {
+	name := os.Getenv("EMAIL_TRANSPORT")
+	if name == "" {
+		name = "file"
+		if os.Getenv("SMTP_HOST") != "" {
+			name = "smtp"
+		}
+	}
+
+	switch name {
+	case "smtp":
+		insecure, _ := strconv.ParseBool(os.Getenv("SMTP_INSECURE"))
+		return NewSMTPTransport(SMTPConfig{
+			Host:          os.Getenv("SMTP_HOST"),
+			Port:          os.Getenv("SMTP_PORT"),
+			Username:      os.Getenv("SMTP_USERNAME"),
+			Password:      os.Getenv("SMTP_PASSWORD"),
+			AllowInsecure: insecure,
+		})
+	case "file":
+		dir := os.Getenv("EMAIL_DIR")
+		if dir == "" {
+			dir = "tmp/mail"
+		}
+		log.Printf("Writing emails to the maildir at %s", dir)
+		return NewFileTransport(dir)
+	case "memory":
+		return NewMemoryTransport(), nil
+	default:
+		return nil, fmt.Errorf("unknown email transport %q", name)
+	}
+}
+
+// address returns the bare address of "Name <user@example.com>"
+func address(s string) string {
+	if a, err := mail.ParseAddress(s); err == nil {
+		return a.Address
+	}
+	return s
+}
@@ -0,0 +1,281 @@
+package mailer
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"strings"
+	"testing"
+	"time"
+)
+
+func parseMessage(t *testing.T, msg *Message) *mail.Message {
+	t.Helper()
+	raw, err := msg.Bytes()
+	if err != nil {
+		t.Fatalf("Bytes returned error: %v", err)
+	}
+	parsed, err := mail.ReadMessage(bytes.NewReader(raw))
+	if err != nil {
+		t.Fatalf("message does not parse: %v\n%s", err, raw)
+	}
+	return parsed
+}
+
+func decodeQuotedPrintable(t *testing.T, r io.Reader) string {
+	t.Helper()
+	body, err := io.ReadAll(quotedprintable.NewReader(r))
+	if err != nil {
+		t.Fatalf("body is not quoted-printable: %v", err)
+	}
+	return strings.ReplaceAll(string(body), "\r\n", "\n")
+}
+
+func TestMessageBytesMultipart(t *testing.T) {
+	text := "Hello Ama,\n\nYou spent 120.00 on Groceries — a long line that has to be wrapped by the quoted-printable encoder because it goes well past 76 characters."
+	html := `<p>Hello Ama, you spent <b>120.00</b> on Groceries</p>`
+	msg := &Message{
+		ID:      "abc123",
+		From:    "Personal Finance Manager <no-reply@finance.example.com>",
+		To:      "ama@example.com",
+		Subject: "Budget alert: Groceries €",
+		Text:    text,
+		HTML:    html,
+		Date:    time.Date(2024, 3, 1, 9, 30, 0, 0, time.UTC),
+	}
+
+	parsed := parseMessage(t, msg)
+	header := parsed.Header
+
+	if got := header.Get("From"); got != msg.From {
+		t.Errorf("From = %q", got)
+	}
+	if got := header.Get("To"); got != msg.To {
+		t.Errorf("To = %q", got)
+	}
+	subject, err := new(mime.WordDecoder).DecodeHeader(header.Get("Subject"))
+	if err != nil || subject != msg.Subject {
+		t.Errorf("Subject = %q (%v), want %q", subject, err, msg.Subject)
+	}
+	if got := header.Get("Message-Id"); got != "<abc123@finance.example.com>" {
+		t.Errorf("Message-ID = %q", got)
+	}
+	if date, err := header.Date(); err != nil || !date.Equal(msg.Date) {
+		t.Errorf("Date = %v (%v), want %v", date, err, msg.Date)
+	}
+	if got := header.Get("MIME-Version"); got != "1.0" {
+		t.Errorf("MIME-Version = %q", got)
+	}
+
+	mediaType, params, err := mime.ParseMediaType(header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/alternative" {
+		t.Fatalf("Content-Type = %q (%v), want multipart/alternative", header.Get("Content-Type"), err)
+	}
+
+	reader := multipart.NewReader(parsed.Body, params["boundary"])
+	want := []struct{ contentType, body string }{
+		{"text/plain", text},
+		{"text/html", html},
+	}
+	for _, w := range want {
+		part, err := reader.NextRawPart()
+		if err != nil {
+			t.Fatalf("missing %s part: %v", w.contentType, err)
+		}
+		if got := part.Header.Get("Content-Type"); got != w.contentType+"; charset=UTF-8" {
+			t.Errorf("part Content-Type = %q, want %s", got, w.contentType)
+		}
+		if got := part.Header.Get("Content-Transfer-Encoding"); got != "quoted-printable" {
+			t.Errorf("%s Content-Transfer-Encoding = %q", w.contentType, got)
+		}
+		if got := decodeQuotedPrintable(t, part); got != w.body {
+			t.Errorf("%s body = %q, want %q", w.contentType, got, w.body)
+		}
+	}
+	if _, err := reader.NextPart(); err != io.EOF {
+		t.Errorf("unexpected extra part: %v", err)
+	}
+}
+
+func TestMessageBytesSinglePart(t *testing.T) {
+	tests := []struct {
+		name        string
+		msg         Message
+		contentType string
+		body        string
+	}{
+		{"text only", Message{Text: "Plain\nbody"}, "text/plain; charset=UTF-8", "Plain\nbody"},
+		{"HTML only", Message{HTML: "<p>Rich</p>"}, "text/html; charset=UTF-8", "<p>Rich</p>"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg := tt.msg
+			msg.From = "no-reply@example.com"
+			msg.To = "user@example.com"
+			parsed := parseMessage(t, &msg)
+
+			if got := parsed.Header.Get("Content-Type"); got != tt.contentType {
+				t.Errorf("Content-Type = %q, want %q", got, tt.contentType)
+			}
+			if got := decodeQuotedPrintable(t, parsed.Body); got != tt.body {
+				t.Errorf("body = %q, want %q", got, tt.body)
+			}
+			// A missing ID and date are filled in
+			if !strings.HasSuffix(parsed.Header.Get("Message-Id"), "@example.com>") {
+				t.Errorf("Message-ID = %q", parsed.Header.Get("Message-Id"))
+			}
+			if _, err := parsed.Header.Date(); err != nil {
+				t.Errorf("Date header: %v", err)
+			}
+		})
+	}
+}
+
+func TestDomain(t *testing.T) {
+	tests := map[string]string{
+		"user@example.com":                    "example.com",
+		"Finance <no-reply@mail.example.com>": "mail.example.com",
+		"no-at-sign":                          "localhost",
+		"trailing@":                           "localhost",
+	}
+	for in, want := range tests {
+		if got := domain(in); got != want {
+			t.Errorf("domain(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestRender(t *testing.T) {
+	data := map[string]interface{}{
+		"Title":   "Bill due <soon>",
+		"Message": "Rent & utilities are due",
+		"Data": map[string]interface{}{
+			"amount":   -1250.5,
+			"due_date": time.Date(2024, 3, 5, 0, 0, 0, 0, time.UTC),
+		},
+	}
+
+	text, html, err := Render("notification", data)
+	if err != nil {
+		t.Fatalf("Render returned error: %v", err)
+	}
+
+	for _, want := range []string{"Bill due <soon>", "Rent & utilities are due", "Amount: 1250.50", "Due Date: Mar 5, 2024", "notification preferences"} {
+		if !strings.Contains(text, want) {
+			t.Errorf("text is missing %q:\n%s", want, text)
+		}
+	}
+	for _, want := range []string{"<h2>Bill due &lt;soon&gt;</h2>", "Rent &amp; utilities are due", "Amount: 1250.50", "<html>", "notification preferences"} {
+		if !strings.Contains(html, want) {
+			t.Errorf("HTML is missing %q:\n%s", want, html)
+		}
+	}
+	if strings.Contains(html, "<soon>") {
+		t.Error("HTML version is not escaped")
+	}
+}
+
+func TestRenderUnknownTemplate(t *testing.T) {
+	if HasTemplate("no_such_template") {
+		t.Error("HasTemplate reported a missing template")
+	}
+	if _, _, err := Render("no_such_template", nil); err == nil {
+		t.Error("Render returned no error for a missing template")
+	}
+}
+
+func TestEveryTemplateHasBothVersions(t *testing.T) {
+	if len(htmlTemplates) == 0 {
+		t.Fatal("no templates loaded")
+	}
+	for name := range htmlTemplates {
+		if textTemplates[name] == nil {
+			t.Errorf("template %s has no text version", name)
+		}
+		if !HasTemplate(name) {
+			t.Errorf("HasTemplate(%q) = false", name)
+		}
+	}
+}
+
+func TestTemplateFuncs(t *testing.T) {
+	if got := money(-12.5); got != "12.50" {
+		t.Errorf("money(-12.5) = %q", got)
+	}
+	if got := money(3); got != "3.00" {
+		t.Errorf("money(3) = %q", got)
+	}
+	if got := money(nil); got != "" {
+		t.Errorf("money(nil) = %q", got)
+	}
+
+	day := time.Date(2024, 3, 5, 23, 0, 0, 0, time.UTC)
+	if got := formatTime(day, "Jan 2, 2006", nil); got != "Mar 5, 2024" {
+		t.Errorf("formatTime(time) = %q", got)
+	}
+	if got := formatTime(day.Format(time.RFC3339), "Jan 2, 2006", nil); got != "Mar 5, 2024" {
+		t.Errorf("formatTime(RFC 3339 string) = %q", got)
+	}
+	if got := formatTime((*time.Time)(nil), "Jan 2, 2006", nil); got != "" {
+		t.Errorf("formatTime(nil) = %q", got)
+	}
+	tokyo := time.FixedZone("JST", 9*60*60)
+	if got := formatTime(day, "Mon Jan 2", tokyo); got != "Wed Mar 6" {
+		t.Errorf("formatTime in Tokyo = %q", got)
+	}
+}
+
+func TestMemoryTransport(t *testing.T) {
+	transport := NewMemoryTransport()
+	ctx := context.Background()
+
+	first := &Message{To: "a@example.com", Subject: "First"}
+	if err := transport.Send(ctx, first); err != nil {
+		t.Fatalf("Send returned error: %v", err)
+	}
+	// The transport keeps a copy, not the caller's message
+	first.Subject = "Changed"
+
+	failure := fmt.Errorf("smtp: 421 service not available")
+	transport.FailWith(failure)
+	if err := transport.Send(ctx, &Message{To: "b@example.com"}); err != failure {
+		t.Errorf("Send while failing = %v, want %v", err, failure)
+	}
+
+	transport.FailWith(nil)
+	if err := transport.Send(ctx, &Message{To: "c@example.com", Subject: "Third"}); err != nil {
+		t.Fatalf("Send after recovering returned error: %v", err)
+	}
+
+	messages := transport.Messages()
+	if len(messages) != 2 || messages[0].Subject != "First" || messages[1].Subject != "Third" {
+		t.Errorf("Messages = %+v, want First and Third", messages)
+	}
+
+	transport.Reset()
+	if got := transport.Messages(); len(got) != 0 {
+		t.Errorf("Messages after Reset = %+v", got)
+	}
+}
+
+func TestNewTransportFromEnv(t *testing.T) {
+	t.Setenv("EMAIL_TRANSPORT", "memory")
+	transport, err := NewTransportFromEnv()
+	if err != nil {
+		t.Fatalf("NewTransportFromEnv returned error: %v", err)
+	}
+	if _, ok := transport.(*MemoryTransport); !ok {
+		t.Errorf("transport = %T, want *MemoryTransport", transport)
+	}
+
+	t.Setenv("EMAIL_TRANSPORT", "pigeon")
+	if _, err := NewTransportFromEnv(); err == nil {
+		t.Error("NewTransportFromEnv accepted an unknown transport")
+	}
+}
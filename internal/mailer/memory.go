@@ -0,0 +1,52 @@
+package mailer
+
+import (
+	"context"
+	"sync"
+)
+
+// MemoryTransport keeps sent messages in memory, for tests
+type MemoryTransport struct {
+	mu       sync.Mutex
+	messages []Message
+	err      error
+}
+
+func NewMemoryTransport() *MemoryTransport {
+	return &MemoryTransport{}
+}
+
+func (t *MemoryTransport) Send(ctx context.Context, msg *Message) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.err != nil {
+		return t.err
+	}
+	t.messages = append(t.messages, *msg)
+	return nil
+}
+
+// Messages returns the messages sent so far, oldest first
+func (t *MemoryTransport) Messages() []Message {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return append([]Message(nil), t.messages...)
+}
+
+// Reset forgets the messages sent so far
+func (t *MemoryTransport) Reset() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.messages = nil
+}
+
+// FailWith makes every Send return err until called with nil
+func (t *MemoryTransport) FailWith(err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.err = err
+}
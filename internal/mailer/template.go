@@ -0,0 +1,122 @@
+package mailer
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	htmltemplate "html/template"
+	"io/fs"
+	"math"
+	"path"
+	"strings"
+	texttemplate "text/template"
+	"time"
+)
+
+// Templates are pairs of NAME.html and NAME.txt files under templates/. Each
+// defines a "content" template that layout.html or layout.txt wraps.
+//
+//go:embed templates/*.html templates/*.txt
+var templateFiles embed.FS
+
+var (
+	htmlTemplates = make(map[string]*htmltemplate.Template)
+	textTemplates = make(map[string]*texttemplate.Template)
+)
+
+// funcs are available to every template
+var funcs = map[string]interface{}{
+	"money": money,
+	"date":  func(v interface{}) string { return formatTime(v, "Jan 2, 2006", nil) },
+	"day":   func(v interface{}) string { return formatTime(v, "Mon Jan 2", nil) },
+	"dayIn": func(v interface{}, loc *time.Location) string { return formatTime(v, "Mon Jan 2", loc) },
+	"pct": func(p *float64) string {
+		if p == nil {
+			return "0%"
+		}
+		return fmt.Sprintf("%.0f%%", math.Abs(*p))
+	},
+}
+
+func init() {
+	htmlLayout := htmltemplate.Must(htmltemplate.New("layout.html").Funcs(funcs).ParseFS(templateFiles, "templates/layout.html"))
+	textLayout := texttemplate.Must(texttemplate.New("layout.txt").Funcs(funcs).ParseFS(templateFiles, "templates/layout.txt"))
+
+	files, err := fs.Glob(templateFiles, "templates/*.html")
+	if err != nil {
+		panic(err)
+	}
+	for _, file := range files {
+		name := strings.TrimSuffix(path.Base(file), ".html")
+		if name == "layout" {
+			continue
+		}
+		htmlTemplates[name] = htmltemplate.Must(htmltemplate.Must(htmlLayout.Clone()).ParseFS(templateFiles, file))
+		textTemplates[name] = texttemplate.Must(texttemplate.Must(textLayout.Clone()).ParseFS(templateFiles, "templates/"+name+".txt"))
+	}
+}
+
+// HasTemplate reports whether there is a template called name
+func HasTemplate(name string) bool {
+	_, ok := htmlTemplates[name]
+	return ok
+}
+
+// Render executes the named template's text and HTML versions with data
+func Render(name string, data interface{}) (text, html string, err error) {
+	htmlTmpl, ok := htmlTemplates[name]
+	if !ok {
+		return "", "", fmt.Errorf("no email template %q", name)
+	}
+
+	var textBuf, htmlBuf bytes.Buffer
+	if err := textTemplates[name].ExecuteTemplate(&textBuf, "layout.txt", data); err != nil {
+		return "", "", fmt.Errorf("render %s.txt: %w", name, err)
+	}
+	if err := htmlTmpl.ExecuteTemplate(&htmlBuf, "layout.html", data); err != nil {
+		return "", "", fmt.Errorf("render %s.html: %w", name, err)
+	}
+	return textBuf.String(), htmlBuf.String(), nil
+}
+
+// money formats an amount without its sign, since the wording says whether
+// it is spent or received
+func money(v interface{}) string {
+	switch n := v.(type) {
+	case float64:
+		return fmt.Sprintf("%.2f", math.Abs(n))
+	case float32:
+		return fmt.Sprintf("%.2f", math.Abs(float64(n)))
+	case int:
+		return fmt.Sprintf("%d.00", int(math.Abs(float64(n))))
+	case nil:
+		return ""
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+func formatTime(v interface{}, layout string, loc *time.Location) string {
+	var t time.Time
+	switch tv := v.(type) {
+	case time.Time:
+		t = tv
+	case *time.Time:
+		if tv == nil {
+			return ""
+		}
+		t = *tv
+	case string:
+		parsed, err := time.Parse(time.RFC3339, tv)
+		if err != nil {
+			return tv
+		}
+		t = parsed
+	default:
+		return fmt.Sprint(v)
+	}
+	if loc != nil {
+		t = t.In(loc)
+	}
+	return t.Format(layout)
+}
@@ -3,6 +3,7 @@ package middleware
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
@@ -10,37 +11,49 @@ import (
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/yeboahd24/personal-finance-manager/internal/model"
 )
 
 type contextKey string
 
 const (
 	UserIDContextKey contextKey = "user_id"
-	// You should use a secure method to store this key in production
-	jwtSecret = "your-secret-key"
 )
 
 type Claims struct {
-	UserID string `json:"user_id"`
+	UserID    string `json:"user_id"`
+	SessionID string `json:"sid"`
 	jwt.RegisteredClaims
 }
 
-func GenerateToken(userID string) (string, error) {
+// GenerateToken signs a short-lived access token for the user's session with
+// the configured signing key
+func GenerateToken(userID, sessionID string) (string, error) {
+	if keySet == nil {
+		return "", fmt.Errorf("JWT keys are not configured")
+	}
+
+	now := time.Now()
 	claims := &Claims{
-		UserID: userID,
+		UserID:    userID,
+		SessionID: sessionID,
 		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(24 * time.Hour)),
-			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			ID:        uuid.New().String(),
+			Subject:   userID,
+			Issuer:    keySet.issuer,
+			Audience:  jwt.ClaimStrings{keySet.audience},
+			ExpiresAt: jwt.NewNumericDate(now.Add(model.AccessTokenTTL)),
+			IssuedAt:  jwt.NewNumericDate(now),
 		},
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString([]byte(jwtSecret))
+	return keySet.sign(claims)
 }
 
 func getTokenFromRequest(r *http.Request) string {
 	// First check cookie
-	cookie, err := r.Cookie("authToken")
+	cookie, err := r.Cookie(authCookieName)
 	if err == nil && cookie.Value != "" {
 		log.Printf("Found auth cookie: %s", cookie.Value)
 		return cookie.Value
@@ -66,7 +79,7 @@ func AuthMiddleware(next http.Handler) http.Handler {
 		log.Printf("Auth middleware: %s %s", r.Method, r.URL.Path)
 
 		// Skip auth for login and register pages
-		if r.URL.Path == "/login" || r.URL.Path == "/register" || r.URL.Path == "/api/users/login" || r.URL.Path == "/api/users" {
+		if r.URL.Path == "/login" || r.URL.Path == "/register" || r.URL.Path == "/api/users/login" || r.URL.Path == "/api/users" || r.URL.Path == "/api/users/refresh" {
 			log.Printf("Skipping auth for public path: %s", r.URL.Path)
 			next.ServeHTTP(w, r)
 			return
@@ -79,25 +92,36 @@ func AuthMiddleware(next http.Handler) http.Handler {
 			return
 		}
 
+		if keySet == nil || sessions == nil {
+			log.Printf("JWT keys or sessions are not configured")
+			handleAuthError(w, r)
+			return
+		}
+
 		token := getTokenFromRequest(r)
 		if token == "" {
 			log.Printf("No token found in request")
-			handleAuthError(w, r)
+			// Browser clients renew their session with the refresh cookie
+			claims := refreshFromCookie(w, r)
+			if claims == nil {
+				handleAuthError(w, r)
+				return
+			}
+			serveAuthenticated(next, w, r, claims)
 			return
 		}
 
 		claims := &Claims{}
-		parsedToken, err := jwt.ParseWithClaims(token, claims, func(token *jwt.Token) (interface{}, error) {
-			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-				return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-			}
-			return []byte(jwtSecret), nil
-		})
+		parsedToken, err := keySet.parse(token, claims)
 
 		if err != nil {
 			log.Printf("Token validation error: %v", err)
 			// Check if the error is due to token expiration
-			if err.Error() == "token has expired" {
+			if errors.Is(err, jwt.ErrTokenExpired) {
+				if claims := refreshFromCookie(w, r); claims != nil {
+					serveAuthenticated(next, w, r, claims)
+					return
+				}
 				// Handle expired token
 				handleTokenExpired(w, r)
 				return
@@ -106,18 +130,34 @@ func AuthMiddleware(next http.Handler) http.Handler {
 			return
 		}
 
-		if !parsedToken.Valid {
+		if !parsedToken.Valid || claims.SessionID == "" {
 			log.Printf("Token is invalid")
 			handleAuthError(w, r)
 			return
 		}
 
+		// Tokens stop working as soon as their session is logged out or
+		// revoked, not only when they expire
+		if err := sessions.ValidateSession(r.Context(), claims.UserID, claims.SessionID); err != nil {
+			log.Printf("Session validation error: %v", err)
+			ClearTokens(w)
+			handleAuthError(w, r)
+			return
+		}
+
 		log.Printf("Token is valid for user: %s", claims.UserID)
-		ctx := context.WithValue(r.Context(), UserIDContextKey, claims.UserID)
-		next.ServeHTTP(w, r.WithContext(ctx))
+		serveAuthenticated(next, w, r, claims)
 	})
 }
 
+// serveAuthenticated passes the request on with the user and session from
+// its access token
+func serveAuthenticated(next http.Handler, w http.ResponseWriter, r *http.Request, claims *Claims) {
+	ctx := context.WithValue(r.Context(), UserIDContextKey, claims.UserID)
+	ctx = context.WithValue(ctx, SessionIDContextKey, claims.SessionID)
+	next.ServeHTTP(w, r.WithContext(ctx))
+}
+
 func handleAuthError(w http.ResponseWriter, r *http.Request) {
     // For API requests, return JSON error
     if strings.HasPrefix(r.URL.Path, "/api/") {
@@ -136,7 +176,7 @@ func handleAuthError(w http.ResponseWriter, r *http.Request) {
 func handleTokenExpired(w http.ResponseWriter, r *http.Request) {
     // Clear the expired token cookie
 	http.SetCookie(w, &http.Cookie{
-		Name:     "authToken",
+		Name:     authCookieName,
 		Value:    "",
 		Path:     "/",
 		Expires:  time.Now().Add(-24 * time.Hour),
@@ -0,0 +1,308 @@
+package middleware
+
+import (
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"log"
+	"math/big"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/yeboahd24/personal-finance-manager/internal/config"
+)
+
+const (
+	defaultJWTIssuer   = "personal-finance-manager"
+	defaultJWTAudience = "personal-finance-manager"
+
+	// minRSAKeyBits is the smallest RSA key accepted for RS256
+	minRSAKeyBits = 2048
+
+	// minSecretLength is the shortest HS256 secret used without a warning
+	minSecretLength = 32
+)
+
+// jwtKey is a key tokens are signed or verified with. Keys loaded from a
+// public key file or retired secrets can only verify.
+type jwtKey struct {
+	id        string
+	method    jwt.SigningMethod
+	signKey   interface{}
+	verifyKey interface{}
+}
+
+// KeySet holds the key that signs new tokens and every key accepted when
+// verifying them, looked up by the kid header, so keys can be rotated without
+// invalidating tokens signed with the previous one
+type KeySet struct {
+	signing  *jwtKey
+	keys     map[string]*jwtKey
+	issuer   string
+	audience string
+}
+
+// keySet is set by ConfigureJWT
+var keySet *KeySet
+
+// ConfigureJWT loads the signing and verification keys from cfg. It must be
+// called before tokens are generated or checked.
+func ConfigureJWT(cfg *config.Config) error {
+	ks, err := LoadKeySet(cfg)
+	if err != nil {
+		return err
+	}
+	keySet = ks
+	return nil
+}
+
+// LoadKeySet builds a key set from JWT_SECRET, JWT_PREVIOUS_SECRETS and the
+// PEM files in JWT_KEYS_DIR. Each file is named after its kid; private keys
+// can sign, public keys only verify. JWT_SIGNING_KEY_ID picks the signing key
+// and is required when more than one could sign.
+func LoadKeySet(cfg *config.Config) (*KeySet, error) {
+	ks := &KeySet{
+		keys:     make(map[string]*jwtKey),
+		issuer:   cfg.JWT.Issuer,
+		audience: cfg.JWT.Audience,
+	}
+	if ks.issuer == "" {
+		ks.issuer = defaultJWTIssuer
+	}
+	if ks.audience == "" {
+		ks.audience = defaultJWTAudience
+	}
+
+	var signers []*jwtKey
+	if cfg.JWT.Secret != "" {
+		if len(cfg.JWT.Secret) < minSecretLength {
+			log.Printf("Warning: JWT_SECRET is shorter than %d characters", minSecretLength)
+		}
+		key := secretKey(cfg.JWT.Secret, true)
+		ks.keys[key.id] = key
+		signers = append(signers, key)
+	}
+	for _, secret := range cfg.JWT.PreviousSecrets {
+		key := secretKey(secret, false)
+		if _, ok := ks.keys[key.id]; !ok {
+			ks.keys[key.id] = key
+		}
+	}
+
+	if cfg.JWT.KeysDir != "" {
+		paths, err := filepath.Glob(filepath.Join(cfg.JWT.KeysDir, "*.pem"))
+		if err != nil {
+			return nil, fmt.Errorf("failed to list JWT keys: %w", err)
+		}
+		sort.Strings(paths)
+		for _, path := range paths {
+			key, err := loadPEMKey(path)
+			if err != nil {
+				return nil, err
+			}
+			if _, ok := ks.keys[key.id]; ok {
+				return nil, fmt.Errorf("duplicate JWT key ID %q", key.id)
+			}
+			ks.keys[key.id] = key
+			if key.signKey != nil {
+				signers = append(signers, key)
+			}
+		}
+	}
+
+	if id := cfg.JWT.SigningKeyID; id != "" {
+		key, ok := ks.keys[id]
+		if !ok || key.signKey == nil {
+			return nil, fmt.Errorf("JWT_SIGNING_KEY_ID %q is not a configured private key or secret", id)
+		}
+		ks.signing = key
+	} else {
+		switch len(signers) {
+		case 0:
+			return nil, fmt.Errorf("JWT_SECRET or a private key in JWT_KEYS_DIR is required")
+		case 1:
+			ks.signing = signers[0]
+		default:
+			return nil, fmt.Errorf("JWT_SIGNING_KEY_ID is required when more than one key can sign")
+		}
+	}
+
+	return ks, nil
+}
+
+// secretKey returns an HS256 key whose kid is derived from the secret, so
+// every instance sharing the secret agrees on it without configuration
+func secretKey(secret string, sign bool) *jwtKey {
+	sum := sha256.Sum256([]byte(secret))
+	key := &jwtKey{
+		id:        "hs-" + hex.EncodeToString(sum[:])[:12],
+		method:    jwt.SigningMethodHS256,
+		verifyKey: []byte(secret),
+	}
+	if sign {
+		key.signKey = key.verifyKey
+	}
+	return key
+}
+
+// loadPEMKey reads an RSA or Ed25519 key, private or public, from a PEM file
+// named <kid>.pem
+func loadPEMKey(path string) (*jwtKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read JWT key %s: %w", path, err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("JWT key %s is not PEM encoded", path)
+	}
+
+	key := &jwtKey{id: strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))}
+	var parsed interface{}
+	switch block.Type {
+	case "PRIVATE KEY":
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PUBLIC KEY":
+		parsed, err = x509.ParsePKIXPublicKey(block.Bytes)
+	case "RSA PUBLIC KEY":
+		parsed, err = x509.ParsePKCS1PublicKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("JWT key %s has unsupported PEM type %q", path, block.Type)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse JWT key %s: %w", path, err)
+	}
+
+	switch k := parsed.(type) {
+	case *rsa.PrivateKey:
+		key.method, key.signKey, key.verifyKey = jwt.SigningMethodRS256, k, &k.PublicKey
+	case *rsa.PublicKey:
+		key.method, key.verifyKey = jwt.SigningMethodRS256, k
+	case ed25519.PrivateKey:
+		key.method, key.signKey, key.verifyKey = jwt.SigningMethodEdDSA, k, k.Public()
+	case ed25519.PublicKey:
+		key.method, key.verifyKey = jwt.SigningMethodEdDSA, k
+	default:
+		return nil, fmt.Errorf("JWT key %s must be an RSA or Ed25519 key", path)
+	}
+
+	if pub, ok := key.verifyKey.(*rsa.PublicKey); ok && pub.N.BitLen() < minRSAKeyBits {
+		return nil, fmt.Errorf("JWT key %s is shorter than %d bits", path, minRSAKeyBits)
+	}
+	return key, nil
+}
+
+// sign signs claims with the signing key, stamping its kid in the header
+func (ks *KeySet) sign(claims jwt.Claims) (string, error) {
+	token := jwt.NewWithClaims(ks.signing.method, claims)
+	token.Header["kid"] = ks.signing.id
+	return token.SignedString(ks.signing.signKey)
+}
+
+// parse verifies a token's signature with the key named by its kid and checks
+// its expiry, issuer and audience
+func (ks *KeySet) parse(tokenString string, claims jwt.Claims) (*jwt.Token, error) {
+	return jwt.ParseWithClaims(tokenString, claims, ks.keyFunc,
+		jwt.WithValidMethods(ks.methods()),
+		jwt.WithIssuer(ks.issuer),
+		jwt.WithAudience(ks.audience),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+	)
+}
+
+func (ks *KeySet) keyFunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	key, ok := ks.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+	// A key only verifies tokens signed with its own algorithm, so a public
+	// key can't be used as an HMAC secret
+	if token.Method.Alg() != key.method.Alg() {
+		return nil, fmt.Errorf("unexpected signing method %v for key %q", token.Header["alg"], kid)
+	}
+	return key.verifyKey, nil
+}
+
+func (ks *KeySet) methods() []string {
+	seen := make(map[string]bool)
+	var methods []string
+	for _, key := range ks.keys {
+		if alg := key.method.Alg(); !seen[alg] {
+			seen[alg] = true
+			methods = append(methods, alg)
+		}
+	}
+	return methods
+}
+
+// jwk is a public key in JSON Web Key form
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+// jwks returns the public RS256 and EdDSA keys as a JSON Web Key Set, for
+// other services verifying our tokens. HS256 secrets are never published.
+func (ks *KeySet) jwks() map[string][]jwk {
+	keys := []jwk{}
+	for _, key := range ks.keys {
+		switch pub := key.verifyKey.(type) {
+		case *rsa.PublicKey:
+			keys = append(keys, jwk{
+				Kty: "RSA",
+				Kid: key.id,
+				Use: "sig",
+				Alg: key.method.Alg(),
+				N:   base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+				E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+			})
+		case ed25519.PublicKey:
+			keys = append(keys, jwk{
+				Kty: "OKP",
+				Kid: key.id,
+				Use: "sig",
+				Alg: key.method.Alg(),
+				Crv: "Ed25519",
+				X:   base64.RawURLEncoding.EncodeToString(pub),
+			})
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].Kid < keys[j].Kid })
+	return map[string][]jwk{"keys": keys}
+}
+
+// JWKSHandler serves the public keys at /.well-known/jwks.json
+func JWKSHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if keySet == nil {
+		http.Error(w, "JWT keys are not configured", http.StatusServiceUnavailable)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	json.NewEncoder(w).Encode(keySet.jwks())
+}
@@ -0,0 +1,208 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/yeboahd24/personal-finance-manager/internal/model"
+)
+
+const (
+	SessionIDContextKey contextKey = "session_id"
+
+	authCookieName    = "authToken"
+	refreshCookieName = "refreshToken"
+
+	// maxUserAgentLength bounds the user agent stored with a session
+	maxUserAgentLength = 512
+)
+
+// SessionStore checks and renews the sessions access tokens are issued for
+type SessionStore interface {
+	ValidateSession(ctx context.Context, userID, sessionID string) error
+	Refresh(ctx context.Context, refreshToken, userAgent, ipAddress string) (*model.Session, string, error)
+}
+
+// sessions is set by ConfigureSessions
+var sessions SessionStore
+
+// ConfigureSessions sets the store AuthMiddleware checks sessions against and
+// renews them with. It must be called before serving requests.
+func ConfigureSessions(store SessionStore) {
+	sessions = store
+}
+
+// IssueTokens signs an access token for a session and sets it and the refresh
+// token as cookies for browser clients
+func IssueTokens(w http.ResponseWriter, session *model.Session, refreshToken string) (string, error) {
+	token, err := GenerateToken(session.UserID, session.ID)
+	if err != nil {
+		return "", err
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     authCookieName,
+		Value:    token,
+		Path:     "/",
+		MaxAge:   int(model.AccessTokenTTL.Seconds()),
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+	http.SetCookie(w, &http.Cookie{
+		Name:     refreshCookieName,
+		Value:    refreshToken,
+		Path:     "/",
+		Expires:  session.ExpiresAt,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+	return token, nil
+}
+
+// ClearTokens removes the auth and refresh cookies
+func ClearTokens(w http.ResponseWriter) {
+	for _, name := range []string{authCookieName, refreshCookieName} {
+		http.SetCookie(w, &http.Cookie{
+			Name:     name,
+			Value:    "",
+			Path:     "/",
+			Expires:  time.Now().Add(-24 * time.Hour),
+			HttpOnly: true,
+			SameSite: http.SameSiteLaxMode,
+		})
+	}
+}
+
+// RefreshTokenFromCookie returns the refresh token cookie's value, if any
+func RefreshTokenFromCookie(r *http.Request) string {
+	cookie, err := r.Cookie(refreshCookieName)
+	if err != nil {
+		return ""
+	}
+	return cookie.Value
+}
+
+// refreshFromCookie renews the session of a browser client whose access token
+// is missing or expired, using its refresh token cookie. It returns the new
+// access token's claims, or nil if the session couldn't be renewed.
+func refreshFromCookie(w http.ResponseWriter, r *http.Request) *Claims {
+	refreshToken := RefreshTokenFromCookie(r)
+	if refreshToken == "" || sessions == nil {
+		return nil
+	}
+
+	session, newRefreshToken, err := sessions.Refresh(r.Context(), refreshToken, UserAgent(r), ClientIP(r))
+	if err != nil {
+		log.Printf("Session refresh error: %v", err)
+		ClearTokens(w)
+		return nil
+	}
+	if _, err := IssueTokens(w, session, newRefreshToken); err != nil {
+		log.Printf("Error issuing tokens for session %s: %v", session.ID, err)
+		return nil
+	}
+
+	log.Printf("Refreshed session %s for user: %s", session.ID, session.UserID)
+	return &Claims{UserID: session.UserID, SessionID: session.ID}
+}
+
+// trustedProxies is set by ConfigureTrustedProxies
+var trustedProxies []*net.IPNet
+
+// ConfigureTrustedProxies sets the proxies, as IP addresses or CIDR ranges,
+// whose X-Forwarded-For and X-Real-IP headers ClientIP believes. With none
+// configured the headers are ignored.
+func ConfigureTrustedProxies(proxies []string) error {
+	nets := make([]*net.IPNet, 0, len(proxies))
+	for _, proxy := range proxies {
+		if !strings.Contains(proxy, "/") {
+			ip := net.ParseIP(proxy)
+			if ip == nil {
+				return fmt.Errorf("invalid trusted proxy %q", proxy)
+			}
+			bits := 8 * net.IPv6len
+			if ip4 := ip.To4(); ip4 != nil {
+				ip, bits = ip4, 8*net.IPv4len
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, ipNet, err := net.ParseCIDR(proxy)
+		if err != nil {
+			return fmt.Errorf("invalid trusted proxy %q: %w", proxy, err)
+		}
+		nets = append(nets, ipNet)
+	}
+	trustedProxies = nets
+	return nil
+}
+
+// isTrustedProxy reports whether ip belongs to a configured trusted proxy
+func isTrustedProxy(ip net.IP) bool {
+	for _, ipNet := range trustedProxies {
+		if ipNet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// ClientIP returns the address a request came from. Forwarding headers are
+// only believed when the connection comes from a trusted proxy, and then the
+// right-most X-Forwarded-For hop that isn't one of our proxies is taken, as
+// everything to its left was supplied by the client.
+func ClientIP(r *http.Request) string {
+	remote, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		remote = r.RemoteAddr
+	}
+	remoteIP := net.ParseIP(remote)
+	if remoteIP == nil || !isTrustedProxy(remoteIP) {
+		return remote
+	}
+
+	if forwarded := r.Header.Values("X-Forwarded-For"); len(forwarded) > 0 {
+		hops := strings.Split(strings.Join(forwarded, ","), ",")
+		client := remote
+		for i := len(hops) - 1; i >= 0; i-- {
+			ip := net.ParseIP(strings.TrimSpace(hops[i]))
+			if ip == nil {
+				break
+			}
+			client = ip.String()
+			if !isTrustedProxy(ip) {
+				break
+			}
+		}
+		return client
+	}
+
+	if ip := net.ParseIP(strings.TrimSpace(r.Header.Get("X-Real-IP"))); ip != nil {
+		return ip.String()
+	}
+	return remote
+}
+
+// UserAgent returns the request's user agent, truncated to what is stored
+// with a session
+func UserAgent(r *http.Request) string {
+	ua := r.UserAgent()
+	if len(ua) > maxUserAgentLength {
+		ua = ua[:maxUserAgentLength]
+	}
+	return strings.ToValidUTF8(ua, "")
+}
+
+// GetSessionID retrieves the session ID from the context
+func GetSessionID(ctx context.Context) (string, error) {
+	sessionID, ok := ctx.Value(SessionIDContextKey).(string)
+	if !ok {
+		return "", fmt.Errorf("session ID not found in context")
+	}
+	return sessionID, nil
+}
@@ -0,0 +1,72 @@
+package middleware
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestClientIP(t *testing.T) {
+	if err := ConfigureTrustedProxies([]string{"10.0.0.0/8", "192.0.2.10", "2001:db8::1"}); err != nil {
+		t.Fatalf("ConfigureTrustedProxies returned error: %v", err)
+	}
+	t.Cleanup(func() { trustedProxies = nil })
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		forwarded  []string
+		realIP     string
+		want       string
+	}{
+		{"direct", "203.0.113.7:5000", nil, "", "203.0.113.7"},
+		{"untrusted peer forwarding", "203.0.113.7:5000", []string{"198.51.100.1"}, "198.51.100.2", "203.0.113.7"},
+		{"trusted proxy", "10.1.2.3:443", []string{"198.51.100.1"}, "", "198.51.100.1"},
+		{"spoofed left-most hop", "10.1.2.3:443", []string{"1.2.3.4, 198.51.100.1"}, "", "198.51.100.1"},
+		{"chain of proxies", "10.1.2.3:443", []string{"198.51.100.1, 192.0.2.10, 10.9.9.9"}, "", "198.51.100.1"},
+		{"repeated headers", "10.1.2.3:443", []string{"1.2.3.4", "198.51.100.1"}, "", "198.51.100.1"},
+		{"every hop trusted", "10.1.2.3:443", []string{"10.4.4.4"}, "", "10.4.4.4"},
+		{"garbage hop", "10.1.2.3:443", []string{"198.51.100.1, not-an-ip"}, "", "10.1.2.3"},
+		{"real IP from proxy", "192.0.2.10:443", nil, "198.51.100.3", "198.51.100.3"},
+		{"invalid real IP", "192.0.2.10:443", nil, "bogus", "192.0.2.10"},
+		{"IPv6 proxy", "[2001:db8::1]:443", []string{"2001:db8::99"}, "", "2001:db8::99"},
+		{"no port", "203.0.113.7", []string{"198.51.100.1"}, "", "203.0.113.7"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/", nil)
+			r.RemoteAddr = tt.remoteAddr
+			for _, value := range tt.forwarded {
+				r.Header.Add("X-Forwarded-For", value)
+			}
+			if tt.realIP != "" {
+				r.Header.Set("X-Real-IP", tt.realIP)
+			}
+			if got := ClientIP(r); got != tt.want {
+				t.Errorf("ClientIP = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestClientIPWithoutTrustedProxies(t *testing.T) {
+	trustedProxies = nil
+
+	r := httptest.NewRequest("GET", "/", nil)
+	r.RemoteAddr = "127.0.0.1:5000"
+	r.Header.Set("X-Forwarded-For", "198.51.100.1")
+	r.Header.Set("X-Real-IP", "198.51.100.2")
+	if got := ClientIP(r); got != "127.0.0.1" {
+		t.Errorf("ClientIP = %q, want the connecting address", got)
+	}
+}
+
+func TestConfigureTrustedProxiesRejectsInvalid(t *testing.T) {
+	t.Cleanup(func() { trustedProxies = nil })
+
+	for _, proxy := range []string{"proxy.internal", "10.0.0.0/33", "300.1.1.1"} {
+		if err := ConfigureTrustedProxies([]string{proxy}); err == nil {
+			t.Errorf("ConfigureTrustedProxies accepted %q", proxy)
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package model
+
+import (
+	"time"
+)
+
+// AnomalyKind is what a spending anomaly compares with its baseline
+type AnomalyKind string
+
+const (
+	AnomalyCategorySpend   AnomalyKind = "category_spend"   // A category's spend this period against its usual spend per period
+	AnomalyTransactionSize AnomalyKind = "transaction_size" // A debit this period against the usual debit in its category
+)
+
+// AnomalyPeriod is the length of the periods spending is grouped into
+type AnomalyPeriod string
+
+const (
+	AnomalyPeriodWeek  AnomalyPeriod = "week"
+	AnomalyPeriodMonth AnomalyPeriod = "month"
+)
+
+// Baseline and sensitivity of the anomaly detector
+const (
+	DefaultAnomalyLookback = 12 // Past periods in the baseline
+	MinAnomalyLookback     = 4
+	MaxAnomalyLookback     = 52
+
+	// DefaultAnomalyThreshold is the modified z-score, the distance from the
+	// median in robust standard deviations, above which spending is flagged
+	DefaultAnomalyThreshold = 3.5
+	MinAnomalyThreshold     = 1
+)
+
+// AnomalyOptions controls what spending is compared and how far from the
+// baseline it has to be
+type AnomalyOptions struct {
+	Period    AnomalyPeriod `json:"period"`
+	Lookback  int           `json:"lookback"`
+	Threshold float64       `json:"threshold"`
+}
+
+// SpendingAnomaly is spending in the current period well above a category's
+// historical baseline
+type SpendingAnomaly struct {
+	Kind          AnomalyKind   `json:"kind"`
+	CategoryID    string        `json:"category_id"`
+	CategoryName  string        `json:"category_name"`
+	TransactionID string        `json:"transaction_id,omitempty"` // Set for transaction_size anomalies
+	Description   string        `json:"description,omitempty"`
+	Date          *time.Time    `json:"date,omitempty"`
+	Period        AnomalyPeriod `json:"period"`
+	PeriodStart   time.Time     `json:"period_start"`
+	Amount        float64       `json:"amount"`   // Spend so far this period, or the debit's size
+	Baseline      float64       `json:"baseline"` // Median of the historical values
+	Ratio         float64       `json:"ratio"`    // Amount as a multiple of Baseline
+	Score         float64       `json:"score"`    // Modified z-score
+	Explanation   string        `json:"explanation"`
+}
+
+// Key identifies the anomaly so it is notified once: per category and period
+// for category spend, per transaction for transaction sizes
+func (a *SpendingAnomaly) Key() string {
+	if a.Kind == AnomalyTransactionSize {
+		return string(a.Kind) + ":" + a.TransactionID
+	}
+	return string(a.Kind) + ":" + a.CategoryID + ":" + a.PeriodStart.Format("2006-01-02")
+}
+
+// CategoryPeriodSpend is a category's total debits in one period
+type CategoryPeriodSpend struct {
+	CategoryID   string
+	CategoryName string
+	PeriodStart  time.Time
+	Amount       float64
+}
+
+// CategoryDebit is a single categorized debit, as a positive amount
+type CategoryDebit struct {
+	TransactionID string
+	CategoryID    string
+	CategoryName  string
+	Description   string
+	Date          time.Time
+	Amount        float64
+}
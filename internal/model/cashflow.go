@@ -0,0 +1,79 @@
+package model
+
+import "time"
+
+// Cash flow projection limits
+const (
+	DefaultCashFlowDays = 60
+	MaxCashFlowDays     = 366
+)
+
+// CashAccountTypes are the account types whose balances are spent from and
+// checked against the minimum balance
+var CashAccountTypes = map[string]bool{
+	"checking": true,
+	"savings":  true,
+}
+
+// CashFlowCalendar projects account balances day by day from the current
+// balances and the user's active recurring transactions
+type CashFlowCalendar struct {
+	From           time.Time          `json:"from"`
+	To             time.Time          `json:"to"`
+	MinimumBalance float64            `json:"minimum_balance"`
+	Accounts       []CashFlowAccount  `json:"accounts"`
+	Days           []CashFlowDay      `json:"days"`
+	SafeToSpend    SafeToSpend        `json:"safe_to_spend"`
+	LowBalance     *LowBalanceWarning `json:"low_balance,omitempty"` // First day an account drops below the minimum
+}
+
+// CashFlowAccount is an account's starting and lowest projected balance
+type CashFlowAccount struct {
+	ID              string    `json:"id"`
+	Name            string    `json:"name"`
+	Type            string    `json:"type"`
+	Currency        string    `json:"currency"`
+	Balance         float64   `json:"balance"`
+	LowestBalance   float64   `json:"lowest_balance"`
+	LowestBalanceOn time.Time `json:"lowest_balance_on"`
+}
+
+// CashFlowDay is one day of the projection. Balances are end of day, keyed by
+// account ID.
+type CashFlowDay struct {
+	Date        string             `json:"date"` // YYYY-MM-DD
+	Inflows     float64            `json:"inflows"`
+	Outflows    float64            `json:"outflows"` // Positive total of money going out
+	Net         float64            `json:"net"`
+	Occurrences []Occurrence       `json:"occurrences"`
+	Balances    map[string]float64 `json:"balances"`
+}
+
+// SafeToSpend is how much can be spent from cash accounts before the next
+// payday without any of them dropping below the minimum balance
+type SafeToSpend struct {
+	Amount     float64    `json:"amount"`
+	NextPayday *time.Time `json:"next_payday,omitempty"` // Unset when no income is scheduled within the projection
+}
+
+// LowBalanceWarning is a projected balance below the minimum
+type LowBalanceWarning struct {
+	Date        time.Time `json:"date"`
+	AccountID   string    `json:"account_id"`
+	AccountName string    `json:"account_name"`
+	Balance     float64   `json:"balance"`
+	Minimum     float64   `json:"minimum"`
+}
+
+// LowBalancePrediction is a recurring charge projected to take a cash
+// account below the minimum balance, with a suggested transfer to cover the
+// shortfall for the rest of the horizon
+type LowBalancePrediction struct {
+	Account        *Account   `json:"account"`
+	Date           time.Time  `json:"date"`
+	Balance        float64    `json:"balance"` // Balance after the charge
+	Minimum        float64    `json:"minimum"`
+	Charge         Occurrence `json:"charge"`
+	TransferAmount float64    `json:"transfer_amount"`
+	TransferFrom   *Account   `json:"transfer_from,omitempty"` // Unset when no other account can cover the transfer
+}
@@ -0,0 +1,109 @@
+package model
+
+import (
+	"fmt"
+	"time"
+)
+
+// DigestFrequency is how often notification emails are sent
+type DigestFrequency string
+
+const (
+	DigestImmediate DigestFrequency = "immediate" // One email per notification
+	DigestDaily     DigestFrequency = "daily"
+	DigestWeekly    DigestFrequency = "weekly"
+)
+
+// Defaults for when and where digests are sent
+const (
+	DefaultDigestTime = "08:00"
+	DefaultDigestDay  = time.Monday
+	DefaultTimezone   = "UTC"
+)
+
+// DigestTimeFormat is the layout of NotificationPreferences.DigestTime
+const DigestTimeFormat = "15:04"
+
+// Location returns the user's time zone, or UTC if it isn't set or known
+func (p *NotificationPreferences) Location() *time.Location {
+	if p.Timezone == "" {
+		return time.UTC
+	}
+	loc, err := time.LoadLocation(p.Timezone)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
+
+// Digests reports whether notification emails are batched into a digest
+func (p *NotificationPreferences) Digests() bool {
+	return p.EmailDigest == DigestDaily || p.EmailDigest == DigestWeekly
+}
+
+// DigestDue returns the local date of the digest due at now, if one is. A
+// digest is due from its scheduled time until the end of that day, so one
+// missed while the server was down is still sent.
+func (p *NotificationPreferences) DigestDue(now time.Time) (time.Time, bool) {
+	if !p.Digests() {
+		return time.Time{}, false
+	}
+
+	local := now.In(p.Location())
+	if p.EmailDigest == DigestWeekly && local.Weekday() != p.DigestDay {
+		return time.Time{}, false
+	}
+
+	at, err := time.Parse(DigestTimeFormat, p.DigestTime)
+	if err != nil {
+		at, _ = time.Parse(DigestTimeFormat, DefaultDigestTime)
+	}
+	day := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, time.UTC)
+	if local.Hour()*60+local.Minute() < at.Hour()*60+at.Minute() {
+		return time.Time{}, false
+	}
+	return day, true
+}
+
+// DigestPeriod is how far back a digest looks when there is no earlier one
+func (p *NotificationPreferences) DigestPeriod() time.Duration {
+	if p.EmailDigest == DigestWeekly {
+		return 7 * 24 * time.Hour
+	}
+	return 24 * time.Hour
+}
+
+// NotificationDigest is the content of a digest email
+type NotificationDigest struct {
+	User          *User
+	Frequency     DigestFrequency
+	Since         time.Time
+	Until         time.Time
+	Location      *time.Location
+	Notifications []*Notification
+	TopCategories []SpendingByCategory
+	TotalSpent    float64
+	Budgets       []*Budget
+	UpcomingBills []Occurrence
+}
+
+// Empty reports whether the digest has nothing worth sending
+func (d *NotificationDigest) Empty() bool {
+	return len(d.Notifications) == 0 && len(d.TopCategories) == 0 && len(d.UpcomingBills) == 0
+}
+
+// Subject returns the digest email's subject line
+func (d *NotificationDigest) Subject() string {
+	period := "Daily"
+	if d.Frequency == DigestWeekly {
+		period = "Weekly"
+	}
+	switch n := len(d.Notifications); n {
+	case 0:
+	case 1:
+		return fmt.Sprintf("Your %s Summary: 1 new notification", period)
+	default:
+		return fmt.Sprintf("Your %s Summary: %d new notifications", period, n)
+	}
+	return fmt.Sprintf("Your %s Summary", period)
+}
@@ -0,0 +1,30 @@
+package model
+
+import (
+	"time"
+)
+
+type EmailStatus string
+
+const (
+	EmailPending EmailStatus = "pending" // Waiting for its next attempt
+	EmailSent    EmailStatus = "sent"
+	EmailFailed  EmailStatus = "failed" // Out of attempts
+)
+
+// Email is a rendered message in the outbox
+type Email struct {
+	ID            string      `json:"id"`
+	To            string      `json:"to"`
+	Subject       string      `json:"subject"`
+	Template      string      `json:"template"` // Name of the template it was rendered from
+	Text          string      `json:"text"`
+	HTML          string      `json:"html"`
+	Status        EmailStatus `json:"status"`
+	Attempts      int         `json:"attempts"`
+	NextAttemptAt time.Time   `json:"next_attempt_at"`
+	LastError     string      `json:"last_error,omitempty"`
+	SentAt        *time.Time  `json:"sent_at,omitempty"`
+	CreatedAt     time.Time   `json:"created_at"`
+	UpdatedAt     time.Time   `json:"updated_at"`
+}
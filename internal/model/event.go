@@ -0,0 +1,32 @@
+package model
+
+import (
+	"encoding/json"
+	"time"
+)
+
+type EventType string
+
+const (
+	EventNotification           EventType = "notification"
+	EventNotificationUnsnoozed  EventType = "notification_unsnoozed" // A snoozed notification is back
+	EventSyncCompleted          EventType = "sync_completed"
+	EventTransactionCreated     EventType = "transaction_created"
+	EventTransactionUpdated     EventType = "transaction_updated"
+	EventTransactionImported    EventType = "transaction_imported"
+	EventBudgetThresholdCrossed EventType = "budget_threshold_crossed"
+)
+
+// Event is a live update pushed to a user's notification stream. IDs
+// increase, so a client can resume from the last one it saw.
+type Event struct {
+	ID        int64           `json:"id"`
+	UserID    string          `json:"user_id"`
+	Type      EventType       `json:"type"`
+	Data      json.RawMessage `json:"data"`
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+// BudgetThresholds are the percentages of a budget that raise an event when
+// spending crosses them
+var BudgetThresholds = []float64{80, 100}
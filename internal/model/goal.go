@@ -1,17 +1,330 @@
 package model
 
 import (
+	"math"
+	"strings"
 	"time"
 )
 
+type GoalKind string
+
+const (
+	GoalKindSavings     GoalKind = "savings"
+	GoalKindSinkingFund GoalKind = "sinking_fund" // Saving up for a known, usually repeating, future expense
+)
+
 // Goal represents a financial goal
 type Goal struct {
-	ID          string    `json:"id"`
-	UserID      string    `json:"user_id"`
-	Name        string    `json:"name"`
-	TargetAmount float64   `json:"target_amount"`
-	CurrentAmount float64  `json:"current_amount"`
-	Deadline    time.Time `json:"deadline"`
-	CreatedAt   time.Time `json:"created_at"`
-	UpdatedAt   time.Time `json:"updated_at"`
+	ID            string    `json:"id"`
+	UserID        string    `json:"user_id"`
+	AccountID     *string   `json:"account_id,omitempty"` // Designated account for linked contributions
+	Kind          GoalKind  `json:"kind"`
+	Name          string    `json:"name"`
+	TargetAmount  float64   `json:"target_amount"`
+	CurrentAmount float64   `json:"current_amount"`
+	Deadline      time.Time `json:"deadline"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+
+	// Sinking fund fields
+	ExpenseMatch             string              `json:"expense_match,omitempty"` // Text matched against the expense's description or merchant
+	Recurrence               *RecurrenceInterval `json:"recurrence,omitempty"`    // How often the expense repeats; nil for one-off
+	CycleStart               *time.Time          `json:"cycle_start,omitempty"`   // Contributions before this belong to a previous cycle
+	LastMatchedTransactionID *string             `json:"last_matched_transaction_id,omitempty"`
+	FundingAccountID         *string             `json:"funding_account_id,omitempty"` // Account the monthly transfer into the fund is taken from
+
+	// Accounts backing the goal; when set, progress follows their balances
+	Accounts []GoalAccount `json:"accounts,omitempty"`
+
+	// Populated fields
+	Progress *GoalProgress `json:"progress,omitempty"`
+}
+
+// GoalAccount links a goal to an account, counting Fraction of its balance
+type GoalAccount struct {
+	AccountID string  `json:"account_id"`
+	Fraction  float64 `json:"fraction"`
+
+	// Populated fields
+	AccountName string  `json:"account_name,omitempty"`
+	Balance     float64 `json:"balance"`
+}
+
+// IsAccountBacked reports whether the goal's progress follows linked account balances
+func (g *Goal) IsAccountBacked() bool {
+	return len(g.Accounts) > 0
+}
+
+// InCycle reports whether a contribution date falls in the goal's current cycle
+func (g *Goal) InCycle(date time.Time) bool {
+	return g.CycleStart == nil || !date.Before(*g.CycleStart)
+}
+
+// MatchesExpense reports whether a transaction looks like the sinking fund's target expense
+func (g *Goal) MatchesExpense(tx *Transaction) bool {
+	if g.Kind != GoalKindSinkingFund || g.ExpenseMatch == "" || tx.Amount >= 0 {
+		return false
+	}
+	if g.CycleStart != nil && tx.Date.Before(*g.CycleStart) {
+		return false
+	}
+
+	match := strings.ToLower(g.ExpenseMatch)
+	text := strings.ToLower(tx.Description)
+	if tx.MerchantName != nil {
+		text += " " + strings.ToLower(*tx.MerchantName)
+	}
+	if !strings.Contains(text, match) {
+		return false
+	}
+
+	// Allow the actual bill to come in somewhat under the saved target
+	return -tx.Amount >= g.TargetAmount*SinkingFundMatchTolerance
+}
+
+// SinkingFundMatchTolerance is the minimum fraction of the target an expense must reach to count as the match
+const SinkingFundMatchTolerance = 0.8
+
+// NextCycle starts a fresh cycle at the given time and moves a recurring
+// sinking fund's deadline to the next occurrence. One-off funds keep their deadline.
+func (g *Goal) NextCycle(start time.Time) {
+	g.CycleStart = &start
+	g.CurrentAmount = 0
+	if g.Recurrence == nil {
+		return
+	}
+
+	// The matched expense settles the current deadline, even if paid early
+	g.Deadline = g.nextDeadline()
+	for !g.Deadline.After(start) {
+		g.Deadline = g.nextDeadline()
+	}
+}
+
+func (g *Goal) nextDeadline() time.Time {
+	switch *g.Recurrence {
+	case RecurrenceDaily:
+		return g.Deadline.AddDate(0, 0, 1)
+	case RecurrenceWeekly:
+		return g.Deadline.AddDate(0, 0, 7)
+	case RecurrenceMonthly:
+		return g.Deadline.AddDate(0, 1, 0)
+	default:
+		return g.Deadline.AddDate(1, 0, 0)
+	}
+}
+
+// TransferAccountID returns the account money is saved into: the designated
+// account, or otherwise the first backing account
+func (g *Goal) TransferAccountID() string {
+	if g.AccountID != nil {
+		return *g.AccountID
+	}
+	if len(g.Accounts) > 0 {
+		return g.Accounts[0].AccountID
+	}
+	return ""
+}
+
+// PlanTransfer works out the monthly transfer from the funding account that
+// would fully fund a sinking fund by its deadline, starting next month. It
+// returns nil for other goals and for funds without both accounts. The goal
+// must have its progress populated.
+func (g *Goal) PlanTransfer(now time.Time) *SinkingFundTransfer {
+	if g.Kind != GoalKindSinkingFund || g.FundingAccountID == nil || g.TransferAccountID() == "" || g.Progress == nil {
+		return nil
+	}
+
+	amount := 0.0
+	if g.Progress.RemainingAmount > 0 {
+		amount = math.Ceil(g.Progress.RequiredMonthly*100) / 100
+	}
+
+	return &SinkingFundTransfer{
+		GoalID:        g.ID,
+		UserID:        g.UserID,
+		FromAccountID: *g.FundingAccountID,
+		ToAccountID:   g.TransferAccountID(),
+		Amount:        amount,
+		StartDate:     NextTransferDate(now),
+		EndDate:       g.Deadline,
+	}
+}
+
+// SinkingFundTransferRRule is the schedule of a sinking fund's transfer
+const SinkingFundTransferRRule = "FREQ=MONTHLY;BYMONTHDAY=1"
+
+// NextTransferDate returns the first of the month after now, when a newly
+// set up transfer first runs
+func NextTransferDate(now time.Time) time.Time {
+	return time.Date(now.Year(), now.Month()+1, 1, 0, 0, 0, 0, time.UTC)
+}
+
+// SinkingFundTransfer is the monthly transfer suggested for a sinking fund,
+// moving money from its funding account into the fund's account. Accepting
+// it creates two recurring transactions, a debit and a credit, so the money
+// leaves one account as it arrives in the other.
+type SinkingFundTransfer struct {
+	GoalID            string    `json:"goal_id"`
+	UserID            string    `json:"user_id"`
+	FromAccountID     string    `json:"from_account_id"`
+	ToAccountID       string    `json:"to_account_id"`
+	Amount            float64   `json:"amount"` // Moved each month; 0 once the fund is fully funded
+	StartDate         time.Time `json:"start_date"`
+	EndDate           time.Time `json:"end_date"`
+	DebitRecurringID  *string   `json:"debit_recurring_id,omitempty"` // Set once accepted
+	CreditRecurringID *string   `json:"credit_recurring_id,omitempty"`
+	UpdatedAt         time.Time `json:"updated_at"`
+
+	// Populated fields
+	Debit  *RecurringTransaction `json:"debit,omitempty"`
+	Credit *RecurringTransaction `json:"credit,omitempty"`
+}
+
+// Accepted reports whether the transfer's recurring transactions have been created
+func (t *SinkingFundTransfer) Accepted() bool {
+	return t.DebitRecurringID != nil || t.CreditRecurringID != nil
+}
+
+// Legs builds the unsaved recurring debit from the funding account and
+// credit into the fund that carry out the transfer
+func (t *SinkingFundTransfer) Legs(categoryID, description string) (debit, credit *RecurringTransaction) {
+	leg := func(accountID string, amount float64) *RecurringTransaction {
+		end := t.EndDate
+		return &RecurringTransaction{
+			UserID:      t.UserID,
+			AccountID:   accountID,
+			CategoryID:  categoryID,
+			Amount:      amount,
+			Description: description,
+			RRule:       SinkingFundTransferRRule,
+			StartDate:   t.StartDate,
+			EndDate:     &end,
+		}
+	}
+	return leg(t.FromAccountID, -t.Amount), leg(t.ToAccountID, t.Amount)
+}
+
+// GoalContribution is a single amount saved towards a goal, either entered
+// manually or linked to a transaction into the goal's designated account
+type GoalContribution struct {
+	ID            string    `json:"id"`
+	GoalID        string    `json:"goal_id"`
+	UserID        string    `json:"user_id"`
+	TransactionID *string   `json:"transaction_id,omitempty"`
+	Amount        float64   `json:"amount"`
+	Date          time.Time `json:"date"`
+	Note          string    `json:"note,omitempty"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+// GoalProgress summarises how a goal is tracking against its deadline
+type GoalProgress struct {
+	PercentComplete     float64    `json:"percent_complete"`
+	RemainingAmount     float64    `json:"remaining_amount"`
+	RequiredMonthly     float64    `json:"required_monthly"`               // Saving needed per month to hit the deadline
+	RecentMonthlyPace   float64    `json:"recent_monthly_pace"`            // Average monthly saving over the pace window
+	ProjectedCompletion *time.Time `json:"projected_completion,omitempty"` // Nil without a pace or beyond the projection horizon
+	OnTrack             bool       `json:"on_track"`
+}
+
+// GoalMilestones are the percentages of the target that trigger a notification
+var GoalMilestones = []int{25, 50, 75, 100}
+
+// ReachedMilestone returns the highest milestone the progress has passed, or 0
+func (p *GoalProgress) ReachedMilestone() int {
+	reached := 0
+	for _, m := range GoalMilestones {
+		if p.PercentComplete >= float64(m) {
+			reached = m
+		}
+	}
+	return reached
+}
+
+// AtRisk reports whether saving continues but too slowly to finish by the
+// deadline. This includes a pace so slow that ProjectedCompletion is nil.
+func (p *GoalProgress) AtRisk() bool {
+	return p.RemainingAmount > 0 && p.RecentMonthlyPace > 0 && !p.OnTrack
+}
+
+// GoalNotificationState records which goal notifications have already been sent
+type GoalNotificationState struct {
+	GoalID               string     `json:"goal_id"`
+	Milestone            int        `json:"milestone"` // Highest milestone notified in the current cycle
+	DeadlineRiskNotified bool       `json:"deadline_risk_notified"`
+	LastReminderAt       *time.Time `json:"last_reminder_at,omitempty"`
+	UpdatedAt            time.Time  `json:"updated_at"`
+}
+
+// GoalPaceWindow is how far back contributions are averaged to project completion
+const GoalPaceWindow = 90 * 24 * time.Hour
+
+// GoalProjectionHorizonDays caps how far ahead completion is projected; a
+// slower pace leaves ProjectedCompletion nil
+const GoalProjectionHorizonDays = 100 * 365.25
+
+const daysPerMonth = 365.25 / 12
+
+// CalculateProgress derives the goal's progress from its contributions as of now.
+// CurrentAmount is expected to already reflect the sum of contributions.
+func (g *Goal) CalculateProgress(contributions []*GoalContribution, now time.Time) *GoalProgress {
+	windowStart := now.Add(-GoalPaceWindow)
+	var recent float64
+	for _, c := range contributions {
+		if !g.InCycle(c.Date) {
+			continue
+		}
+		if !c.Date.Before(windowStart) && !c.Date.After(now) {
+			recent += c.Amount
+		}
+	}
+
+	return g.ProgressAtPace(recent, now)
+}
+
+// ProgressAtPace derives the goal's progress as of now from the amount saved
+// over the pace window. Account-backed goals pass their accounts' net change.
+func (g *Goal) ProgressAtPace(recent float64, now time.Time) *GoalProgress {
+	p := &GoalProgress{}
+
+	remaining := g.TargetAmount - g.CurrentAmount
+	if remaining < 0 {
+		remaining = 0
+	}
+	p.RemainingAmount = remaining
+
+	if g.TargetAmount > 0 {
+		p.PercentComplete = g.CurrentAmount / g.TargetAmount * 100
+		if p.PercentComplete > 100 {
+			p.PercentComplete = 100
+		}
+	}
+
+	if remaining == 0 {
+		p.OnTrack = true
+		return p
+	}
+
+	// Required monthly saving to reach the target by the deadline
+	monthsLeft := g.Deadline.Sub(now).Hours() / 24 / daysPerMonth
+	if monthsLeft < 1 {
+		p.RequiredMonthly = remaining
+	} else {
+		p.RequiredMonthly = remaining / monthsLeft
+	}
+
+	p.RecentMonthlyPace = recent / (GoalPaceWindow.Hours() / 24 / daysPerMonth)
+
+	if p.RecentMonthlyPace > 0 {
+		// Compare in days; a slow pace overflows time.Duration
+		days := remaining / p.RecentMonthlyPace * daysPerMonth
+		p.OnTrack = days <= g.Deadline.Sub(now).Hours()/24
+		if days <= GoalProjectionHorizonDays {
+			projected := now.Add(time.Duration(days * 24 * float64(time.Hour)))
+			p.ProjectedCompletion = &projected
+		}
+	}
+
+	return p
 }
@@ -0,0 +1,80 @@
+package model
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/yeboahd24/personal-finance-manager/internal/holiday"
+)
+
+// HolidayCalendar is a user defined list of holidays, optionally on top of a
+// bundled calendar such as "US" or "UK"
+type HolidayCalendar struct {
+	ID        string       `json:"id"`
+	UserID    string       `json:"user_id"`
+	Name      string       `json:"name"`
+	Base      string       `json:"base,omitempty"` // Bundled calendar whose holidays are included
+	Dates     HolidayDates `json:"dates"`
+	CreatedAt time.Time    `json:"created_at"`
+	UpdatedAt time.Time    `json:"updated_at"`
+}
+
+type HolidayDate struct {
+	Date string `json:"date"` // YYYY-MM-DD
+	Name string `json:"name,omitempty"`
+}
+
+// HolidayDates is stored as a JSON array
+type HolidayDates []HolidayDate
+
+// Scan implements sql.Scanner
+func (d *HolidayDates) Scan(src interface{}) error {
+	var b []byte
+	switch v := src.(type) {
+	case nil:
+		*d = nil
+		return nil
+	case string:
+		b = []byte(v)
+	case []byte:
+		b = v
+	default:
+		return fmt.Errorf("cannot scan %T into HolidayDates", src)
+	}
+	return json.Unmarshal(b, d)
+}
+
+// Value implements driver.Valuer
+func (d HolidayDates) Value() (driver.Value, error) {
+	if d == nil {
+		return "[]", nil
+	}
+	b, err := json.Marshal(d)
+	if err != nil {
+		return nil, err
+	}
+	return string(b), nil
+}
+
+// Calendar builds the business day calendar for c
+func (c *HolidayCalendar) Calendar() (holiday.Calendar, error) {
+	dates := holiday.NewDates(c.Name)
+	for _, d := range c.Dates {
+		day, err := time.Parse(OccurrenceDateFormat, d.Date)
+		if err != nil {
+			return nil, fmt.Errorf("%q is not a date", d.Date)
+		}
+		dates.Add(day, d.Name)
+	}
+
+	if c.Base == "" {
+		return dates, nil
+	}
+	base, ok := holiday.Bundled(c.Base)
+	if !ok {
+		return nil, fmt.Errorf("unknown calendar %q", c.Base)
+	}
+	return holiday.Combine(base, dates), nil
+}
@@ -11,8 +11,30 @@ const (
 	NotificationTypeRecurringRetry     NotificationType = "recurring_retry"
 	NotificationTypePermanentFail      NotificationType = "permanent_fail"
 	NotificationTypeRecurringUpcoming  NotificationType = "recurring_upcoming"
+	NotificationTypeRecurringMissed    NotificationType = "recurring_missed"
+	NotificationTypeGoalMilestone      NotificationType = "goal_milestone"
+	NotificationTypeGoalDeadlineRisk   NotificationType = "goal_deadline_risk"
+	NotificationTypeGoalReminder       NotificationType = "goal_contribution_reminder"
+	NotificationTypeLowBalance         NotificationType = "low_balance_predicted"
+	NotificationTypeTransactionAlert   NotificationType = "transaction_alert"
+	NotificationTypeSpendingAnomaly    NotificationType = "spending_anomaly"
 )
 
+// NotificationTypes are the types that can be routed to channels
+var NotificationTypes = []NotificationType{
+	NotificationTypeRecurringFailed,
+	NotificationTypeRecurringRetry,
+	NotificationTypePermanentFail,
+	NotificationTypeRecurringUpcoming,
+	NotificationTypeRecurringMissed,
+	NotificationTypeGoalMilestone,
+	NotificationTypeGoalDeadlineRisk,
+	NotificationTypeGoalReminder,
+	NotificationTypeLowBalance,
+	NotificationTypeTransactionAlert,
+	NotificationTypeSpendingAnomaly,
+}
+
 type NotificationPriority string
 
 const (
@@ -30,6 +52,7 @@ type Notification struct {
 	Message     string              `json:"message"`
 	Data        map[string]interface{} `json:"data"`
 	Read        bool                `json:"read"`
+	SnoozedUntil *time.Time         `json:"snoozed_until,omitempty"` // Hidden from the list until then
 	CreatedAt   time.Time          `json:"created_at"`
 	UpdatedAt   time.Time          `json:"updated_at"`
 }
@@ -43,6 +66,37 @@ type NotificationPreferences struct {
 	MinPriority        NotificationPriority `json:"min_priority"`
 	RecurringFailures  bool   `json:"recurring_failures"`
 	UpcomingRecurring  bool   `json:"upcoming_recurring"`
+	UpcomingRecurringDays int `json:"upcoming_recurring_days"` // Days before a recurring payment to send a reminder
+	GoalMilestones     bool   `json:"goal_milestones"`
+	GoalDeadlineRisk   bool   `json:"goal_deadline_risk"`
+	GoalReminders      bool   `json:"goal_reminders"`
+	GoalReminderDays   int    `json:"goal_reminder_days"` // Days without a contribution before a reminder
+	MinimumBalance     float64 `json:"minimum_balance"`   // Projected cash account balances below this are flagged
+	LowBalanceAlerts   bool    `json:"low_balance_alerts"`
+	LowBalanceDays     int     `json:"low_balance_days"` // How far ahead to look for low balances
+	SpendingAnomalies  bool    `json:"spending_anomalies"` // Notify about unusual spending, off by default
+	EmailDigest        DigestFrequency `json:"email_digest"`
+	DigestTime         string          `json:"digest_time"` // HH:MM in Timezone
+	DigestDay          time.Weekday    `json:"digest_day"`  // Day weekly digests are sent, 0 is Sunday
+	Timezone           string          `json:"timezone"`    // IANA name such as "Europe/London"
+	Channels           map[NotificationType][]NotificationChannel `json:"channels"` // Overrides the global switches for the listed types
+	QuietHoursStart    string          `json:"quiet_hours_start,omitempty"` // HH:MM in Timezone, empty when quiet hours are off
+	QuietHoursEnd      string          `json:"quiet_hours_end,omitempty"`
 	CreatedAt          time.Time `json:"created_at"`
 	UpdatedAt          time.Time `json:"updated_at"`
 }
+
+// DefaultGoalReminderDays is used when a user hasn't chosen a reminder interval
+const DefaultGoalReminderDays = 30
+
+// Lead time for upcoming recurring transaction reminders
+const (
+	DefaultUpcomingRecurringDays = 3
+	MaxUpcomingRecurringDays     = 30
+)
+
+// Horizon for predicted low balance alerts
+const (
+	DefaultLowBalanceDays = 14
+	MaxLowBalanceDays     = 60
+)
@@ -1,7 +1,13 @@
 package model
 
 import (
+	"fmt"
+	"strconv"
+	"strings"
 	"time"
+
+	"github.com/yeboahd24/personal-finance-manager/internal/holiday"
+	"github.com/yeboahd24/personal-finance-manager/internal/rrule"
 )
 
 type RecurrenceInterval string
@@ -13,27 +19,112 @@ const (
 	RecurrenceYearly  RecurrenceInterval = "yearly"
 )
 
+// BackfillPolicy decides what happens to occurrences that were missed, e.g.
+// while the server was down
+type BackfillPolicy string
+
+const (
+	BackfillAll    BackfillPolicy = "all"    // Post every missed occurrence
+	BackfillLatest BackfillPolicy = "latest" // Post only the most recent occurrence
+	BackfillSkip   BackfillPolicy = "skip"   // Post none of them and notify the user
+)
+
+// Valid reports whether p is a known policy
+func (p BackfillPolicy) Valid() bool {
+	switch p {
+	case BackfillAll, BackfillLatest, BackfillSkip:
+		return true
+	}
+	return false
+}
+
+// BusinessDayAdjustment decides where an occurrence that falls on a weekend
+// or holiday posts
+type BusinessDayAdjustment string
+
+const (
+	AdjustNone              BusinessDayAdjustment = "none"               // Post on the scheduled day
+	AdjustPrevious          BusinessDayAdjustment = "previous"           // Post on the business day before
+	AdjustNext              BusinessDayAdjustment = "next"               // Post on the business day after
+	AdjustModifiedFollowing BusinessDayAdjustment = "modified_following" // Post on the business day after, unless that is next month
+)
+
+// Valid reports whether a is a known adjustment
+func (a BusinessDayAdjustment) Valid() bool {
+	switch a {
+	case AdjustNone, AdjustPrevious, AdjustNext, AdjustModifiedFollowing:
+		return true
+	}
+	return false
+}
+
 type RecurringTransaction struct {
-	ID          string             `json:"id"`
-	UserID      string             `json:"user_id"`
-	AccountID   string             `json:"account_id"`
-	CategoryID  string             `json:"category_id"`
-	Amount      float64            `json:"amount"`
-	Description string             `json:"description"`
-	Interval    RecurrenceInterval `json:"interval"`
-	DayOfMonth  *int              `json:"day_of_month,omitempty"` // For monthly recurrence
-	DayOfWeek   *int              `json:"day_of_week,omitempty"`  // For weekly recurrence (0 = Sunday)
-	StartDate   time.Time         `json:"start_date"`
-	EndDate     *time.Time        `json:"end_date,omitempty"`
-	LastRun     *time.Time        `json:"last_run,omitempty"`
-	NextRun     time.Time         `json:"next_run"`
-	Active      bool              `json:"active"`
-	CreatedAt   time.Time         `json:"created_at"`
-	UpdatedAt   time.Time         `json:"updated_at"`
+	ID             string         `json:"id"`
+	UserID         string         `json:"user_id"`
+	AccountID      string         `json:"account_id"`
+	CategoryID     string         `json:"category_id"`
+	Amount         float64        `json:"amount"`
+	Description    string         `json:"description"`
+	RRule          string         `json:"rrule"`             // RFC 5545 recurrence rule, e.g. "FREQ=MONTHLY;BYMONTHDAY=1,15"
+	ExDates        rrule.DateList `json:"exdates,omitempty"` // Dates skipped by the rule
+	BackfillPolicy BackfillPolicy `json:"backfill_policy"`
+	StartDate      time.Time      `json:"start_date"`
+	EndDate        *time.Time     `json:"end_date,omitempty"`
+	LastRun        *time.Time     `json:"last_run,omitempty"`
+	NextRun        time.Time      `json:"next_run"`
+	Active         bool           `json:"active"`
+	CreatedAt      time.Time      `json:"created_at"`
+	UpdatedAt      time.Time      `json:"updated_at"`
+
+	// Per-occurrence changes and pauses. They are managed through their own
+	// endpoints and left alone by updates.
+	Overrides OccurrenceOverrides `json:"overrides,omitempty"`
+	PausedAt  *time.Time          `json:"paused_at,omitempty"`
+	ResumeAt  *time.Time          `json:"resume_at,omitempty"` // Unset while paused until resumed by hand
+
+	// Occurrences on weekends and holidays move to a business day. The
+	// holiday calendar is "US", "UK" or the ID of one of the user's calendars;
+	// when it is unset only weekends are avoided.
+	BusinessDayAdjustment BusinessDayAdjustment `json:"business_day_adjustment"`
+	HolidayCalendar       string                `json:"holiday_calendar,omitempty"`
+
+	// Deprecated: simple schedules accepted on create and update in place of
+	// RRule, and converted to an equivalent rule. They are not stored.
+	Interval   RecurrenceInterval `json:"interval,omitempty"`
+	DayOfMonth *int               `json:"day_of_month,omitempty"` // For monthly recurrence
+	DayOfWeek  *int               `json:"day_of_week,omitempty"`  // For weekly recurrence (0 = Sunday)
 
 	// Populated fields
-	Account  *Account  `json:"account,omitempty"`
-	Category *Category `json:"category,omitempty"`
+	Account  *Account         `json:"account,omitempty"`
+	Category *Category        `json:"category,omitempty"`
+	Calendar holiday.Calendar `json:"-"` // A user holiday calendar, loaded by the service
+}
+
+// BackfillReport describes what a processing run posted for each recurring
+// transaction it found due
+type BackfillReport struct {
+	StartedAt time.Time        `json:"started_at"`
+	Entries   []*BackfillEntry `json:"entries"`
+}
+
+type BackfillEntry struct {
+	RecurringID string         `json:"recurring_id"`
+	UserID      string         `json:"user_id"`
+	Description string         `json:"description"`
+	Policy      BackfillPolicy `json:"policy"`
+	Posted      []Occurrence   `json:"posted"`            // Occurrences posted with their own dates
+	Skipped     []Occurrence   `json:"skipped,omitempty"` // Missed occurrences left out by the policy
+	Failed      []Occurrence   `json:"failed,omitempty"`  // Occurrences handed to the retry queue
+}
+
+// Counts returns the number of occurrences posted, skipped and failed
+func (r *BackfillReport) Counts() (posted, skipped, failed int) {
+	for _, e := range r.Entries {
+		posted += len(e.Posted)
+		skipped += len(e.Skipped)
+		failed += len(e.Failed)
+	}
+	return posted, skipped, failed
 }
 
 type RecurringTransactionFilter struct {
@@ -43,72 +134,107 @@ type RecurringTransactionFilter struct {
 	Active     *bool
 }
 
-// CalculateNextRun calculates the next run date based on the interval and last run
-func (r *RecurringTransaction) CalculateNextRun(from time.Time) time.Time {
-	if r.LastRun == nil {
-		return r.StartDate
-	}
-
-	var next time.Time
+// IntervalRRule converts the deprecated interval and day fields to an
+// equivalent RRULE. Days of the month past the 28th fall back to the last
+// day in shorter months, and yearly rules from Feb 29 to Feb 28.
+func (r *RecurringTransaction) IntervalRRule() (string, error) {
 	switch r.Interval {
 	case RecurrenceDaily:
-		next = r.LastRun.AddDate(0, 0, 1)
+		return "FREQ=DAILY", nil
 
 	case RecurrenceWeekly:
-		next = r.LastRun.AddDate(0, 0, 7)
-		if r.DayOfWeek != nil {
-			// Adjust to the specified day of week
-			for next.Weekday() != time.Weekday(*r.DayOfWeek) {
-				next = next.AddDate(0, 0, 1)
-			}
+		if r.DayOfWeek == nil {
+			return "FREQ=WEEKLY", nil
+		}
+		if *r.DayOfWeek < 0 || *r.DayOfWeek > 6 {
+			return "", fmt.Errorf("day of week must be between 0 (Sunday) and 6 (Saturday)")
 		}
+		day := rrule.Weekday{Day: time.Weekday(*r.DayOfWeek)}
+		return "FREQ=WEEKLY;BYDAY=" + day.String(), nil
 
 	case RecurrenceMonthly:
-		next = r.LastRun.AddDate(0, 1, 0)
+		day := r.StartDate.Day()
 		if r.DayOfMonth != nil {
-			// Adjust to the specified day of month
-			day := *r.DayOfMonth
-			if day > 28 {
-				// Handle months with different number of days
-				lastDay := time.Date(next.Year(), next.Month()+1, 0, 0, 0, 0, 0, time.UTC).Day()
-				if day > lastDay {
-					day = lastDay
-				}
-			}
-			next = time.Date(next.Year(), next.Month(), day, next.Hour(), next.Minute(), next.Second(), next.Nanosecond(), next.Location())
+			day = *r.DayOfMonth
+		}
+		if day < 1 || day > 31 {
+			return "", fmt.Errorf("day of month must be between 1 and 31")
 		}
+		if day <= 28 {
+			return fmt.Sprintf("FREQ=MONTHLY;BYMONTHDAY=%d", day), nil
+		}
+		days := make([]string, 0, day-27)
+		for d := 28; d <= day; d++ {
+			days = append(days, strconv.Itoa(d))
+		}
+		return "FREQ=MONTHLY;BYMONTHDAY=" + strings.Join(days, ",") + ";BYSETPOS=-1", nil
 
 	case RecurrenceYearly:
-		next = r.LastRun.AddDate(1, 0, 0)
+		if r.StartDate.Month() == time.February && r.StartDate.Day() == 29 {
+			return "FREQ=YEARLY;BYMONTH=2;BYMONTHDAY=28,29;BYSETPOS=-1", nil
+		}
+		return "FREQ=YEARLY", nil
+
+	default:
+		return "", fmt.Errorf("invalid interval")
+	}
+}
+
+// Schedule parses the recurrence rule into a set anchored at the start date
+func (r *RecurringTransaction) Schedule() (*rrule.Set, error) {
+	rule, err := rrule.Parse(r.RRule)
+	if err != nil {
+		return nil, err
 	}
+	return rrule.NewSet(rule, r.StartDate, r.ExDates), nil
+}
 
-	// If next run is before the from date (which could happen if we missed some runs),
-	// keep advancing until we get a future date
-	for next.Before(from) {
-		next = r.CalculateNextRun(next)
+// CalculateNextRun returns the first occurrence after both the last run and
+// from. Before the first run it is the first occurrence on or after the
+// start date. Moved, skipped and paused occurrences are taken into account.
+// The zero time is returned once the schedule has ended.
+func (r *RecurringTransaction) CalculateNextRun(from time.Time) time.Time {
+	var next Occurrence
+	var ok bool
+	if r.LastRun == nil {
+		next, ok = r.NextOccurrence(r.StartDate, true)
+	} else {
+		after := from
+		if r.LastRun.After(after) {
+			after = *r.LastRun
+		}
+		next, ok = r.NextOccurrence(after, false)
 	}
 
-	// If we have an end date and the next run would be after it, return zero time
-	if r.EndDate != nil && next.After(*r.EndDate) {
+	if !ok {
 		return time.Time{}
 	}
+	return next.Date
+}
 
-	return next
+// DueOccurrences returns the occurrences from the next run up to now that
+// haven't been posted yet
+func (r *RecurringTransaction) DueOccurrences(now time.Time) []Occurrence {
+	if r.NextRun.IsZero() || r.NextRun.After(now) {
+		return nil
+	}
+	return r.Occurrences(r.NextRun, now)
 }
 
-// IsDue checks if the recurring transaction is due to run
+// IsDue checks if the recurring transaction has an occurrence between its
+// last run and now
 func (r *RecurringTransaction) IsDue(now time.Time) bool {
 	if !r.Active {
 		return false
 	}
 
-	if r.EndDate != nil && now.After(*r.EndDate) {
-		return false
-	}
-
+	var next Occurrence
+	var ok bool
 	if r.LastRun == nil {
-		return !now.Before(r.StartDate)
+		next, ok = r.NextOccurrence(r.StartDate, true)
+	} else {
+		next, ok = r.NextOccurrence(*r.LastRun, false)
 	}
 
-	return !now.Before(r.NextRun)
+	return ok && !now.Before(next.Date)
 }
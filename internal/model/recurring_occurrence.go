@@ -0,0 +1,345 @@
+package model
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/yeboahd24/personal-finance-manager/internal/holiday"
+	"github.com/yeboahd24/personal-finance-manager/internal/rrule"
+)
+
+// OccurrenceDateFormat is how a single occurrence is identified, by its
+// scheduled calendar date in the rule's start date location
+const OccurrenceDateFormat = "2006-01-02"
+
+// maxAdjustDays bounds how far a business day adjustment moves an
+// occurrence. Scheduled dates this far outside a range are checked for
+// occurrences adjusted into it.
+const maxAdjustDays = 14
+
+// OccurrenceOverride changes a single occurrence of a recurring transaction:
+// it can move it to another date and change its amount or description.
+// Skipped occurrences are stored as exdates instead.
+type OccurrenceOverride struct {
+	Date        string     `json:"date"`                  // Scheduled date, YYYY-MM-DD
+	MoveTo      *time.Time `json:"move_to,omitempty"`     // Posts at this time instead
+	Amount      *float64   `json:"amount,omitempty"`      // Posts this amount instead
+	Description *string    `json:"description,omitempty"` // Posts this description instead
+}
+
+// OccurrenceOverrides is stored as a JSON array
+type OccurrenceOverrides []OccurrenceOverride
+
+// Scan implements sql.Scanner
+func (o *OccurrenceOverrides) Scan(src interface{}) error {
+	var b []byte
+	switch v := src.(type) {
+	case nil:
+		*o = nil
+		return nil
+	case string:
+		b = []byte(v)
+	case []byte:
+		b = v
+	default:
+		return fmt.Errorf("cannot scan %T into OccurrenceOverrides", src)
+	}
+	return json.Unmarshal(b, o)
+}
+
+// Value implements driver.Valuer
+func (o OccurrenceOverrides) Value() (driver.Value, error) {
+	if o == nil {
+		return "[]", nil
+	}
+	b, err := json.Marshal(o)
+	if err != nil {
+		return nil, err
+	}
+	return string(b), nil
+}
+
+// Occurrence is a single run of a recurring transaction with its skips,
+// moves, overrides and pauses applied
+type Occurrence struct {
+	RecurringID   string    `json:"recurring_id"`
+	AccountID     string    `json:"account_id"`
+	Date          time.Time `json:"date"`           // When it posts
+	ScheduledDate time.Time `json:"scheduled_date"` // When the rule schedules it
+	Amount        float64   `json:"amount"`
+	Description   string    `json:"description"`
+	Adjusted      bool      `json:"adjusted,omitempty"` // Moved off a weekend or holiday
+	Moved         bool      `json:"moved,omitempty"`
+	Overridden    bool      `json:"overridden,omitempty"` // Amount or description changed
+}
+
+// adjusts reports whether occurrences are moved off weekends and holidays
+func (r *RecurringTransaction) adjusts() bool {
+	return r.BusinessDayAdjustment != "" && r.BusinessDayAdjustment != AdjustNone
+}
+
+// calendar returns the rule's holiday calendar. A user calendar must have
+// been loaded into Calendar; otherwise a bundled one is looked up by name,
+// and weekends alone are used if there is none.
+func (r *RecurringTransaction) calendar() holiday.Calendar {
+	if r.Calendar != nil {
+		return r.Calendar
+	}
+	if cal, ok := holiday.Bundled(r.HolidayCalendar); ok {
+		return cal
+	}
+	return holiday.Weekends
+}
+
+// adjust moves an occurrence at t to a business day per the rule's
+// adjustment, keeping its time of day
+func (r *RecurringTransaction) adjust(t time.Time) time.Time {
+	if !r.adjusts() {
+		return t
+	}
+
+	cal := r.calendar()
+	local := t.In(r.StartDate.Location())
+	if cal.IsBusinessDay(local) {
+		return t
+	}
+
+	switch r.BusinessDayAdjustment {
+	case AdjustPrevious:
+		return nearestBusinessDay(cal, local, -1)
+	case AdjustNext:
+		return nearestBusinessDay(cal, local, 1)
+	case AdjustModifiedFollowing:
+		next := nearestBusinessDay(cal, local, 1)
+		if next.Month() != local.Month() {
+			return nearestBusinessDay(cal, local, -1)
+		}
+		return next
+	}
+	return t
+}
+
+// nearestBusinessDay steps from t a day at a time in direction step until it
+// finds a business day. t is returned if there is none within maxAdjustDays.
+func nearestBusinessDay(cal holiday.Calendar, t time.Time, step int) time.Time {
+	for i := 1; i <= maxAdjustDays; i++ {
+		day := t.AddDate(0, 0, step*i)
+		if cal.IsBusinessDay(day) {
+			return day
+		}
+	}
+	return t
+}
+
+// Paused reports whether the rule is paused at t
+func (r *RecurringTransaction) Paused(t time.Time) bool {
+	return r.PausedAt != nil && (r.ResumeAt == nil || r.ResumeAt.After(t))
+}
+
+// inPause reports whether an occurrence at t falls in the pause window and
+// is dropped
+func (r *RecurringTransaction) inPause(t time.Time) bool {
+	if r.PausedAt == nil || t.Before(*r.PausedAt) {
+		return false
+	}
+	return r.ResumeAt == nil || t.Before(*r.ResumeAt)
+}
+
+// OccurrenceKey returns the date that identifies the occurrence scheduled at
+// t. A floating date from a date-only EXDATE is already that date.
+func (r *RecurringTransaction) OccurrenceKey(t time.Time) string {
+	if rrule.IsFloating(t) {
+		return t.Format(OccurrenceDateFormat)
+	}
+	return t.In(r.StartDate.Location()).Format(OccurrenceDateFormat)
+}
+
+// Override returns the override for the occurrence scheduled on date, if any
+func (r *RecurringTransaction) Override(date string) *OccurrenceOverride {
+	for i := range r.Overrides {
+		if r.Overrides[i].Date == date {
+			return &r.Overrides[i]
+		}
+	}
+	return nil
+}
+
+// ScheduledOn returns the occurrence the rule schedules on date (YYYY-MM-DD in
+// the start date's location). Skipped dates have no occurrence.
+func (r *RecurringTransaction) ScheduledOn(date string) (time.Time, bool) {
+	day, err := time.ParseInLocation(OccurrenceDateFormat, date, r.StartDate.Location())
+	if err != nil {
+		return time.Time{}, false
+	}
+	schedule, err := r.Schedule()
+	if err != nil {
+		return time.Time{}, false
+	}
+
+	occurrences := schedule.Between(day, day.AddDate(0, 0, 1).Add(-time.Nanosecond))
+	if len(occurrences) == 0 {
+		return time.Time{}, false
+	}
+	if r.EndDate != nil && occurrences[0].After(*r.EndDate) {
+		return time.Time{}, false
+	}
+	return occurrences[0], true
+}
+
+// Occurrence resolves the occurrence scheduled at t. It reports false if t
+// isn't scheduled or the occurrence is skipped or paused.
+func (r *RecurringTransaction) Occurrence(scheduled time.Time) (Occurrence, bool) {
+	at, ok := r.ScheduledOn(r.OccurrenceKey(scheduled))
+	if !ok || !at.Equal(scheduled) {
+		return Occurrence{}, false
+	}
+	occ := r.resolve(scheduled)
+	if r.inPause(occ.Date) {
+		return Occurrence{}, false
+	}
+	return occ, true
+}
+
+// resolve applies the business day adjustment and any override to the
+// occurrence scheduled at t
+func (r *RecurringTransaction) resolve(scheduled time.Time) Occurrence {
+	occ := Occurrence{
+		RecurringID:   r.ID,
+		AccountID:     r.AccountID,
+		Date:          r.adjust(scheduled),
+		ScheduledDate: scheduled,
+		Amount:        r.Amount,
+		Description:   r.Description,
+	}
+	occ.Adjusted = !occ.Date.Equal(scheduled)
+
+	o := r.Override(r.OccurrenceKey(scheduled))
+	if o == nil {
+		return occ
+	}
+	if o.MoveTo != nil {
+		occ.Date = *o.MoveTo
+		occ.Adjusted = false
+		occ.Moved = true
+	}
+	if o.Amount != nil {
+		occ.Amount = *o.Amount
+		occ.Overridden = true
+	}
+	if o.Description != nil {
+		occ.Description = *o.Description
+		occ.Overridden = true
+	}
+	return occ
+}
+
+// Occurrences returns the occurrences that post from start to end, including
+// both ends, in date order. Occurrences moved into the range are included and
+// those moved out of it are not.
+func (r *RecurringTransaction) Occurrences(start, end time.Time) []Occurrence {
+	schedule, err := r.Schedule()
+	if err != nil {
+		return nil
+	}
+
+	from, to := start, end
+	if r.adjusts() {
+		from, to = start.AddDate(0, 0, -maxAdjustDays), end.AddDate(0, 0, maxAdjustDays)
+	}
+
+	var occurrences []Occurrence
+	for _, scheduled := range schedule.Between(from, to) {
+		if r.EndDate != nil && scheduled.After(*r.EndDate) {
+			break
+		}
+		occ := r.resolve(scheduled)
+		if occ.Moved || r.inPause(occ.Date) || occ.Date.Before(start) || occ.Date.After(end) {
+			continue
+		}
+		occurrences = append(occurrences, occ)
+	}
+
+	for _, occ := range r.movedOccurrences() {
+		if !occ.Date.Before(start) && !occ.Date.After(end) {
+			occurrences = append(occurrences, occ)
+		}
+	}
+
+	sort.SliceStable(occurrences, func(i, j int) bool {
+		return occurrences[i].Date.Before(occurrences[j].Date)
+	})
+	return occurrences
+}
+
+// NextOccurrence returns the first occurrence that posts after t, or at t
+// when inclusive is set. It reports false once the schedule has ended.
+func (r *RecurringTransaction) NextOccurrence(t time.Time, inclusive bool) (Occurrence, bool) {
+	schedule, err := r.Schedule()
+	if err != nil {
+		return Occurrence{}, false
+	}
+
+	// Adjusted occurrences keep their order, so the first one after t is the
+	// earliest, but it may be scheduled a little before t
+	after, incl := t, inclusive
+	if r.adjusts() {
+		after, incl = t.AddDate(0, 0, -maxAdjustDays), true
+	}
+
+	var next Occurrence
+	found := false
+	for {
+		scheduled := schedule.After(after, incl)
+		if scheduled.IsZero() || (r.EndDate != nil && scheduled.After(*r.EndDate)) {
+			break
+		}
+		after, incl = scheduled, false
+
+		occ := r.resolve(scheduled)
+		if !occ.Moved && !r.inPause(occ.Date) && (occ.Date.After(t) || (inclusive && occ.Date.Equal(t))) {
+			next, found = occ, true
+			break
+		}
+		// Nothing is left once a pause with no end has started
+		if r.PausedAt != nil && r.ResumeAt == nil && scheduled.After(r.PausedAt.AddDate(0, 0, maxAdjustDays)) {
+			break
+		}
+	}
+
+	for _, occ := range r.movedOccurrences() {
+		if occ.Date.Before(t) || (!inclusive && occ.Date.Equal(t)) {
+			continue
+		}
+		if !found || occ.Date.Before(next.Date) {
+			next, found = occ, true
+		}
+	}
+
+	if !found {
+		return Occurrence{}, false
+	}
+	return next, true
+}
+
+// movedOccurrences returns the occurrences that were moved to another date
+// and still post
+func (r *RecurringTransaction) movedOccurrences() []Occurrence {
+	var occurrences []Occurrence
+	for _, o := range r.Overrides {
+		if o.MoveTo == nil {
+			continue
+		}
+		scheduled, ok := r.ScheduledOn(o.Date)
+		if !ok {
+			continue
+		}
+		occ := r.resolve(scheduled)
+		if !r.inPause(occ.Date) {
+			occurrences = append(occurrences, occ)
+		}
+	}
+	return occurrences
+}
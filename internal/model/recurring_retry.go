@@ -0,0 +1,35 @@
+package model
+
+import (
+	"time"
+)
+
+type RecurringRetryStatus string
+
+const (
+	RecurringRetryPending   RecurringRetryStatus = "pending"   // Waiting for its next attempt
+	RecurringRetryFailed    RecurringRetryStatus = "failed"    // Out of attempts
+	RecurringRetryDismissed RecurringRetryStatus = "dismissed" // Abandoned by the user
+)
+
+// RecurringRetry is a recurring transaction occurrence that failed to post
+type RecurringRetry struct {
+	ID            string               `json:"id"`
+	RecurringID   string               `json:"recurring_id"`
+	UserID        string               `json:"user_id"`
+	Occurrence    time.Time            `json:"occurrence"`
+	Attempts      int                  `json:"attempts"`
+	LastError     string               `json:"last_error"`
+	Status        RecurringRetryStatus `json:"status"`
+	NextAttemptAt time.Time            `json:"next_attempt_at"`
+	CreatedAt     time.Time            `json:"created_at"`
+	UpdatedAt     time.Time            `json:"updated_at"`
+
+	// Populated fields
+	RecurringTransaction *RecurringTransaction `json:"recurring_transaction,omitempty"`
+}
+
+type RecurringRetryFilter struct {
+	UserID string
+	Status RecurringRetryStatus
+}
@@ -0,0 +1,106 @@
+package model
+
+import (
+	"time"
+)
+
+// NotificationChannel is a way a notification reaches the user
+type NotificationChannel string
+
+const (
+	ChannelInApp NotificationChannel = "in_app" // The live notification stream
+	ChannelEmail NotificationChannel = "email"
+	ChannelPush  NotificationChannel = "push"
+)
+
+// NotificationChannels lists every channel
+var NotificationChannels = []NotificationChannel{ChannelInApp, ChannelEmail, ChannelPush}
+
+// MaxNotificationSnooze is how far ahead a notification can be snoozed
+const MaxNotificationSnooze = 30 * 24 * time.Hour
+
+// MaxBulkNotifications bounds the IDs in a bulk request
+const MaxBulkNotifications = 500
+
+// ChannelEnabled reports whether notifications of type t go to channel c.
+// The type's entry in Channels wins; types without one use the global
+// switch for the channel.
+func (p *NotificationPreferences) ChannelEnabled(t NotificationType, c NotificationChannel) bool {
+	if channels, ok := p.Channels[t]; ok {
+		for _, channel := range channels {
+			if channel == c {
+				return true
+			}
+		}
+		return false
+	}
+
+	switch c {
+	case ChannelInApp:
+		return p.InAppEnabled
+	case ChannelEmail:
+		return p.EmailEnabled
+	case ChannelPush:
+		return p.PushEnabled
+	default:
+		return false
+	}
+}
+
+// QuietUntil returns when the user's quiet hours end, if now falls inside
+// them. Quiet hours may span midnight, e.g. 22:00 to 07:00.
+func (p *NotificationPreferences) QuietUntil(now time.Time) (time.Time, bool) {
+	if p.QuietHoursStart == "" || p.QuietHoursEnd == "" {
+		return time.Time{}, false
+	}
+	start, err := time.Parse(DigestTimeFormat, p.QuietHoursStart)
+	if err != nil {
+		return time.Time{}, false
+	}
+	end, err := time.Parse(DigestTimeFormat, p.QuietHoursEnd)
+	if err != nil {
+		return time.Time{}, false
+	}
+
+	local := now.In(p.Location())
+	minute := local.Hour()*60 + local.Minute()
+	from := start.Hour()*60 + start.Minute()
+	to := end.Hour()*60 + end.Minute()
+
+	var quiet bool
+	if from < to {
+		quiet = minute >= from && minute < to
+	} else {
+		quiet = minute >= from || minute < to
+	}
+	if !quiet {
+		return time.Time{}, false
+	}
+
+	until := time.Date(local.Year(), local.Month(), local.Day(), end.Hour(), end.Minute(), 0, 0, local.Location())
+	if !until.After(local) {
+		until = until.AddDate(0, 0, 1)
+	}
+	return until, true
+}
+
+// NotificationDelivery is an email or push delivery of a notification held
+// back until DeliverAt
+type NotificationDelivery struct {
+	NotificationID string              `json:"notification_id"`
+	Channel        NotificationChannel `json:"channel"`
+	DeliverAt      time.Time           `json:"deliver_at"`
+	CreatedAt      time.Time           `json:"created_at"`
+}
+
+// NotificationBulkRequest selects notifications for a bulk action, either
+// by ID or all of the user's
+type NotificationBulkRequest struct {
+	IDs []string `json:"ids"`
+	All bool     `json:"all"`
+}
+
+// NotificationSnooze is the body of a snooze request
+type NotificationSnooze struct {
+	Until time.Time `json:"until"`
+}
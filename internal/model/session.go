@@ -0,0 +1,57 @@
+package model
+
+import (
+	"time"
+)
+
+// Token lifetimes
+const (
+	AccessTokenTTL  = 15 * time.Minute
+	RefreshTokenTTL = 30 * 24 * time.Hour // A session ends when it goes this long without a refresh
+
+	// RefreshReuseGrace is how long a replaced refresh token can still be
+	// used, so concurrent requests refreshing at once don't end the session
+	RefreshReuseGrace = 10 * time.Second
+)
+
+// SessionRevocation is why a session was ended
+type SessionRevocation string
+
+const (
+	SessionLogout    SessionRevocation = "logout"     // Logged out on this device
+	SessionLogoutAll SessionRevocation = "logout_all" // Logged out of all devices
+	SessionRevoked   SessionRevocation = "revoked"    // Revoked from the sessions list
+	SessionReuse     SessionRevocation = "reuse"      // A replaced refresh token was used again
+
+	SessionPasswordChange SessionRevocation = "password_change" // The password was changed or reset
+)
+
+// Session is one login on one device, renewed with rotating refresh tokens
+type Session struct {
+	ID            string            `json:"id"`
+	UserID        string            `json:"user_id"`
+	UserAgent     string            `json:"user_agent"`
+	IPAddress     string            `json:"ip_address"`
+	CreatedAt     time.Time         `json:"created_at"`
+	LastUsedAt    time.Time         `json:"last_used_at"`
+	ExpiresAt     time.Time         `json:"expires_at"`
+	RevokedAt     *time.Time        `json:"revoked_at,omitempty"`
+	RevokedReason SessionRevocation `json:"revoked_reason,omitempty"`
+	Current       bool              `json:"current"` // The session the request was made with
+}
+
+// Active reports whether the session can still be used at now
+func (s *Session) Active(now time.Time) bool {
+	return s.RevokedAt == nil && now.Before(s.ExpiresAt)
+}
+
+// RefreshToken is a stored refresh token. UsedAt is set once it has been
+// exchanged for a new one.
+type RefreshToken struct {
+	ID        string
+	SessionID string
+	TokenHash string
+	CreatedAt time.Time
+	ExpiresAt time.Time
+	UsedAt    *time.Time
+}
@@ -0,0 +1,115 @@
+package model
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/yeboahd24/personal-finance-manager/internal/rrule"
+)
+
+type SubscriptionPeriod string
+
+const (
+	SubscriptionWeekly   SubscriptionPeriod = "weekly"
+	SubscriptionBiweekly SubscriptionPeriod = "biweekly"
+	SubscriptionMonthly  SubscriptionPeriod = "monthly"
+	SubscriptionAnnual   SubscriptionPeriod = "annual"
+)
+
+// Days returns the nominal length of the period in days
+func (p SubscriptionPeriod) Days() float64 {
+	switch p {
+	case SubscriptionWeekly:
+		return 7
+	case SubscriptionBiweekly:
+		return 14
+	case SubscriptionMonthly:
+		return 365.25 / 12
+	default:
+		return 365.25
+	}
+}
+
+// Tolerance returns how many days a charge may drift from the period and
+// still count as regular
+func (p SubscriptionPeriod) Tolerance() float64 {
+	switch p {
+	case SubscriptionWeekly:
+		return 1
+	case SubscriptionBiweekly:
+		return 2
+	case SubscriptionMonthly:
+		return 4
+	default:
+		return 15
+	}
+}
+
+// Subscription is a recurring payment detected from a user's transaction history
+type Subscription struct {
+	ID               string             `json:"id"` // Stable identifier derived from the merchant and period
+	UserID           string             `json:"user_id"`
+	AccountID        string             `json:"account_id"`
+	CategoryID       *string            `json:"category_id,omitempty"`
+	Merchant         string             `json:"merchant"`
+	MerchantKey      string             `json:"merchant_key"` // Normalized merchant used for grouping
+	Period           SubscriptionPeriod `json:"period"`
+	Confidence       float64            `json:"confidence"` // 0 to 1
+	Amount           float64            `json:"amount"`     // Most recent charge
+	AverageAmount    float64            `json:"average_amount"`
+	Occurrences      int                `json:"occurrences"`
+	FirstDate        time.Time          `json:"first_date"`
+	LastDate         time.Time          `json:"last_date"`
+	NextExpectedDate time.Time          `json:"next_expected_date"`
+	TransactionIDs   []string           `json:"transaction_ids"`
+
+	// Flags
+	PriceIncrease  bool    `json:"price_increase"`
+	PreviousAmount float64 `json:"previous_amount,omitempty"` // Charge before the increase
+	PriceChange    float64 `json:"price_change,omitempty"`    // Percentage change from the previous charge
+	Stopped        bool    `json:"stopped"`                   // No charge since well after the expected date
+
+	// Set once the subscription is tracked as a recurring transaction
+	RecurringTransactionID *string `json:"recurring_transaction_id,omitempty"`
+}
+
+// RRule returns the recurrence rule matching the subscription's charges,
+// anchored on the day of its last charge
+func (s *Subscription) RRule() (string, error) {
+	last := s.LastDate
+	day := rrule.Weekday{Day: last.Weekday()}
+
+	switch s.Period {
+	case SubscriptionWeekly:
+		return "FREQ=WEEKLY;BYDAY=" + day.String(), nil
+	case SubscriptionBiweekly:
+		return "FREQ=WEEKLY;INTERVAL=2;BYDAY=" + day.String(), nil
+	case SubscriptionMonthly:
+		monthly := &RecurringTransaction{Interval: RecurrenceMonthly, StartDate: last}
+		return monthly.IntervalRRule()
+	case SubscriptionAnnual:
+		monthDay := last.Day()
+		if last.Month() == time.February && monthDay == 29 {
+			monthDay = -1
+		}
+		return fmt.Sprintf("FREQ=YEARLY;BYMONTH=%d;BYMONTHDAY=%d", int(last.Month()), monthDay), nil
+	default:
+		return "", fmt.Errorf("invalid period")
+	}
+}
+
+type SubscriptionDecisionStatus string
+
+const (
+	SubscriptionAccepted  SubscriptionDecisionStatus = "accepted"
+	SubscriptionDismissed SubscriptionDecisionStatus = "dismissed"
+)
+
+// SubscriptionDecision records what a user did with a suggested subscription
+type SubscriptionDecision struct {
+	UserID                 string                     `json:"user_id"`
+	SubscriptionID         string                     `json:"subscription_id"`
+	Status                 SubscriptionDecisionStatus `json:"status"`
+	RecurringTransactionID *string                    `json:"recurring_transaction_id,omitempty"`
+	CreatedAt              time.Time                  `json:"created_at"`
+}
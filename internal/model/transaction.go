@@ -16,8 +16,11 @@ type Transaction struct {
 	Status          string    `json:"status"`
 	PlaidTransactionID *string   `json:"plaid_transaction_id,omitempty"`
 	MerchantName    *string   `json:"merchant_name,omitempty"`
+	Currency        string    `json:"currency,omitempty"` // ISO code, the account's currency when empty
 	Categories      []string  `json:"categories,omitempty"`
 	Location        *TransactionLocation `json:"location,omitempty"`
+	RecurringID     *string   `json:"recurring_id,omitempty"`     // Set when posted from a recurring transaction
+	OccurrenceDate  *time.Time `json:"occurrence_date,omitempty"` // Scheduled date of that occurrence
 	CreatedAt       time.Time `json:"created_at"`
 	UpdatedAt       time.Time `json:"updated_at"`
 
@@ -0,0 +1,48 @@
+package model
+
+import (
+	"time"
+)
+
+// TransactionAlertType is the kind of activity a transaction alert watches for
+type TransactionAlertType string
+
+const (
+	AlertLargeDebit         TransactionAlertType = "large_debit"         // Any debit over MinAmount
+	AlertNewMerchant        TransactionAlertType = "new_merchant"        // First debit at a merchant
+	AlertForeignCurrency    TransactionAlertType = "foreign_currency"    // Debit in another currency than its account
+	AlertUnbudgetedCategory TransactionAlertType = "unbudgeted_category" // Debit in a category without a current budget
+)
+
+// TransactionAlertTypes lists every alert type
+var TransactionAlertTypes = []TransactionAlertType{
+	AlertLargeDebit,
+	AlertNewMerchant,
+	AlertForeignCurrency,
+	AlertUnbudgetedCategory,
+}
+
+// TransactionAlert is a user defined rule that raises a notification when a
+// new debit looks unusual
+type TransactionAlert struct {
+	ID        string               `json:"id"`
+	UserID    string               `json:"user_id"`
+	Type      TransactionAlertType `json:"type"`
+	MinAmount float64              `json:"min_amount"`           // Only debits larger than this trigger the alert
+	AccountID *string              `json:"account_id,omitempty"` // Limits the alert to one account
+	Active    bool                 `json:"active"`
+	CreatedAt time.Time            `json:"created_at"`
+	UpdatedAt time.Time            `json:"updated_at"`
+}
+
+// Applies reports whether the alert watches tx's account and amount. Only
+// debits are checked.
+func (a *TransactionAlert) Applies(tx *Transaction) bool {
+	if !a.Active || tx.Amount >= 0 {
+		return false
+	}
+	if a.AccountID != nil && *a.AccountID != tx.AccountID {
+		return false
+	}
+	return -tx.Amount > a.MinAmount
+}
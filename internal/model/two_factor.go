@@ -0,0 +1,56 @@
+package model
+
+import (
+	"time"
+)
+
+const (
+	// LoginChallengeTTL is how long a user has to enter their code after
+	// their password
+	LoginChallengeTTL = 5 * time.Minute
+
+	// MaxLoginChallengeAttempts is how many codes can be tried against one
+	// login challenge
+	MaxLoginChallengeAttempts = 5
+
+	// RecoveryCodeCount is how many recovery codes are issued at a time
+	RecoveryCodeCount = 10
+)
+
+// TwoFactor is a user's TOTP enrolment. It is pending until EnabledAt is set.
+type TwoFactor struct {
+	UserID          string
+	SecretEncrypted string
+	EnabledAt       *time.Time
+	LastUsedStep    int64 // The last time step a code was accepted for
+	CreatedAt       time.Time
+}
+
+// Enabled reports whether the enrolment was confirmed
+func (t *TwoFactor) Enabled() bool {
+	return t != nil && t.EnabledAt != nil
+}
+
+// TwoFactorStatus is whether a user has two-factor authentication on
+type TwoFactorStatus struct {
+	Enabled                bool       `json:"enabled"`
+	EnabledAt              *time.Time `json:"enabled_at,omitempty"`
+	RecoveryCodesRemaining int        `json:"recovery_codes_remaining"`
+}
+
+// TwoFactorSetup is what an authenticator app needs to enrol. URI is the
+// otpauth:// URI to show as a QR code; Secret is for entering by hand.
+type TwoFactorSetup struct {
+	Secret string `json:"secret"`
+	URI    string `json:"uri"`
+}
+
+// LoginChallenge is a login waiting for its second factor
+type LoginChallenge struct {
+	ID        string
+	UserID    string
+	TokenHash string
+	Attempts  int
+	ExpiresAt time.Time
+	CreatedAt time.Time
+}
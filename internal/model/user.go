@@ -4,6 +4,8 @@ import (
 	"time"
 )
 
+// User is an account holder. EmailVerifiedAt is set once they prove they own
+// Email; unverified users can't link bank accounts.
 type User struct {
 	ID           string    `json:"id"`
 	Email        string    `json:"email"`
@@ -13,4 +15,11 @@ type User struct {
 	LastName     string    `json:"last_name"`
 	CreatedAt    time.Time `json:"created_at"`
 	UpdatedAt    time.Time `json:"updated_at"`
+
+	EmailVerifiedAt *time.Time `json:"email_verified_at"`
+}
+
+// EmailVerified reports whether the user verified their email address
+func (u *User) EmailVerified() bool {
+	return u.EmailVerifiedAt != nil
 }
@@ -0,0 +1,37 @@
+package model
+
+import (
+	"time"
+)
+
+// UserTokenPurpose is what an emailed token can be used for
+type UserTokenPurpose string
+
+const (
+	TokenEmailVerification UserTokenPurpose = "email_verification"
+	TokenPasswordReset     UserTokenPurpose = "password_reset"
+)
+
+const (
+	EmailVerificationTTL = 48 * time.Hour
+	PasswordResetTTL     = time.Hour
+
+	// MaxUserTokensPerHour limits how many emails of each kind a user can
+	// be sent in an hour
+	MaxUserTokensPerHour = 3
+
+	MinPasswordLength = 8
+	MaxPasswordLength = 72 // bcrypt ignores anything longer
+)
+
+// UserToken is a single-use token emailed to a user, stored as a hash
+type UserToken struct {
+	ID        string
+	UserID    string
+	Purpose   UserTokenPurpose
+	TokenHash string
+	Email     string // The address the token was sent to
+	ExpiresAt time.Time
+	UsedAt    *time.Time
+	CreatedAt time.Time
+}
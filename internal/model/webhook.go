@@ -0,0 +1,91 @@
+package model
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// WebhookEvent is an event type a webhook can subscribe to
+type WebhookEvent string
+
+const (
+	WebhookTransactionCreated     WebhookEvent = "transaction.created"
+	WebhookTransactionUpdated     WebhookEvent = "transaction.updated"
+	WebhookBudgetThresholdCrossed WebhookEvent = "budget.threshold_crossed"
+	WebhookNotificationCreated    WebhookEvent = "notification.created"
+	WebhookSyncCompleted          WebhookEvent = "sync.completed"
+)
+
+// WebhookEvents lists the event types a webhook can subscribe to
+var WebhookEvents = []WebhookEvent{
+	WebhookTransactionCreated,
+	WebhookTransactionUpdated,
+	WebhookBudgetThresholdCrossed,
+	WebhookNotificationCreated,
+	WebhookSyncCompleted,
+}
+
+// webhookEvents maps live events to the webhook event they are delivered as
+var webhookEvents = map[EventType]WebhookEvent{
+	EventTransactionCreated:     WebhookTransactionCreated,
+	EventTransactionImported:    WebhookTransactionCreated,
+	EventTransactionUpdated:     WebhookTransactionUpdated,
+	EventBudgetThresholdCrossed: WebhookBudgetThresholdCrossed,
+	EventNotification:           WebhookNotificationCreated,
+	EventSyncCompleted:          WebhookSyncCompleted,
+}
+
+// WebhookEventFor returns the webhook event a live event is delivered as
+func WebhookEventFor(eventType EventType) (WebhookEvent, bool) {
+	event, ok := webhookEvents[eventType]
+	return event, ok
+}
+
+// Webhook is a user registered HTTPS endpoint that receives signed payloads
+// for the events it subscribes to
+type Webhook struct {
+	ID          string         `json:"id"`
+	UserID      string         `json:"user_id"`
+	URL         string         `json:"url"`
+	Description string         `json:"description,omitempty"`
+	Secret      string         `json:"secret,omitempty"` // Only returned when created or rotated
+	Events      []WebhookEvent `json:"events"`
+	Active      bool           `json:"active"`
+	CreatedAt   time.Time      `json:"created_at"`
+	UpdatedAt   time.Time      `json:"updated_at"`
+}
+
+type WebhookDeliveryStatus string
+
+const (
+	WebhookDeliveryPending   WebhookDeliveryStatus = "pending"   // Waiting for its next attempt
+	WebhookDeliveryDelivered WebhookDeliveryStatus = "delivered" // Accepted with a 2xx response
+	WebhookDeliveryFailed    WebhookDeliveryStatus = "failed"    // Out of attempts
+)
+
+// WebhookDelivery is a payload sent, or waiting to be sent, to a webhook
+type WebhookDelivery struct {
+	ID            string                `json:"id"`
+	WebhookID     string                `json:"webhook_id"`
+	UserID        string                `json:"user_id"`
+	Event         WebhookEvent          `json:"event"`
+	Payload       json.RawMessage       `json:"payload"`
+	Status        WebhookDeliveryStatus `json:"status"`
+	Attempts      int                   `json:"attempts"`
+	NextAttemptAt time.Time             `json:"next_attempt_at"`
+	ResponseCode  *int                  `json:"response_code,omitempty"`
+	LatencyMS     *int                  `json:"latency_ms,omitempty"` // How long the last response took
+	LastError     string                `json:"last_error,omitempty"`
+	ReplayOf      *string               `json:"replay_of,omitempty"`
+	DeliveredAt   *time.Time            `json:"delivered_at,omitempty"`
+	CreatedAt     time.Time             `json:"created_at"`
+	UpdatedAt     time.Time             `json:"updated_at"`
+}
+
+// WebhookPayload is the JSON body posted to a webhook
+type WebhookPayload struct {
+	ID        string          `json:"id"` // Unchanged across retries and replays
+	Event     WebhookEvent    `json:"event"`
+	CreatedAt time.Time       `json:"created_at"`
+	Data      json.RawMessage `json:"data"`
+}
@@ -3,27 +3,26 @@ package queue
 import (
 	"context"
 	"log"
-	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/yeboahd24/personal-finance-manager/internal/model"
-	"github.com/yeboahd24/personal-finance-manager/internal/service"
+	"github.com/yeboahd24/personal-finance-manager/internal/repository"
 )
 
-type RetryItem struct {
-	Transaction     *model.RecurringTransaction
-	RetryCount     int
-	NextRetryTime  time.Time
-	LastError      error
-	LastRetryTime  time.Time
+// Notifier tells users about recurring transactions that failed to post
+type Notifier interface {
+	NotifyRecurringTransactionFailure(ctx context.Context, userID string, tx *model.RecurringTransaction, err error, retryCount int) error
+	NotifyPermanentFailure(ctx context.Context, userID string, tx *model.RecurringTransaction, err error) error
 }
 
+// RetryQueue schedules failed recurring transaction occurrences for another
+// attempt. Retries are stored in the database so they survive restarts.
 type RetryQueue struct {
-	items            map[string]*RetryItem // key is transaction ID
-	maxRetry         int
-	mu               sync.RWMutex
-	metrics          *RetryQueueMetrics
-	notificationSvc  *service.NotificationService
+	repo     repository.Repository
+	maxRetry int
+	metrics  *RetryQueueMetrics
+	notifier Notifier
 }
 
 type RetryQueueMetrics struct {
@@ -33,109 +32,108 @@ type RetryQueueMetrics struct {
 	PermanentFails int64
 }
 
-func NewRetryQueue(maxRetry int, notificationSvc *service.NotificationService) *RetryQueue {
+func NewRetryQueue(repo repository.Repository, maxRetry int, notifier Notifier) *RetryQueue {
 	if maxRetry <= 0 {
 		maxRetry = 3
 	}
 	return &RetryQueue{
-		items:           make(map[string]*RetryItem),
-		maxRetry:        maxRetry,
-		metrics:         &RetryQueueMetrics{},
-		notificationSvc: notificationSvc,
+		repo:     repo,
+		maxRetry: maxRetry,
+		metrics:  &RetryQueueMetrics{},
+		notifier: notifier,
 	}
 }
 
-func (q *RetryQueue) Add(tx *model.RecurringTransaction, err error) {
-	q.mu.Lock()
-	defer q.mu.Unlock()
-
-	item, exists := q.items[tx.ID]
-	if !exists {
-		item = &RetryItem{
-			Transaction: tx,
-			RetryCount: 0,
+// Add records a failed attempt at an occurrence and schedules the next one.
+// Once the occurrence is out of attempts it is marked as failed and is only
+// retried on request.
+func (q *RetryQueue) Add(ctx context.Context, tx *model.RecurringTransaction, occurrence time.Time, err error) (*model.RecurringRetry, error) {
+	item, getErr := q.repo.GetRecurringRetry(ctx, tx.ID, occurrence)
+	if getErr != nil {
+		return nil, getErr
+	}
+	if item == nil {
+		item = &model.RecurringRetry{
+			RecurringID: tx.ID,
+			UserID:      tx.UserID,
+			Occurrence:  occurrence,
 		}
-		q.items[tx.ID] = item
-		q.metrics.CurrentSize++
 	}
 
-	item.LastError = err
-	item.LastRetryTime = time.Now()
-	item.RetryCount++
-	item.NextRetryTime = q.calculateNextRetryTime(item.RetryCount)
-	q.metrics.TotalRetries++
+	item.LastError = err.Error()
+	item.Attempts++
+	item.Status = model.RecurringRetryPending
+	item.NextAttemptAt = q.calculateNextRetryTime(item.Attempts)
+	if item.Attempts > q.maxRetry {
+		item.Status = model.RecurringRetryFailed
+	}
+
+	if saveErr := q.repo.SaveRecurringRetry(ctx, item); saveErr != nil {
+		return nil, saveErr
+	}
+
+	atomic.AddInt64(&q.metrics.TotalRetries, 1)
 
 	// Notify about the failure
-	ctx := context.Background()
-	if item.RetryCount > q.maxRetry {
-		// Permanent failure notification
-		if q.notificationSvc != nil {
-			if err := q.notificationSvc.NotifyPermanentFailure(ctx, tx.UserID, tx, err); err != nil {
+	if q.notifier != nil {
+		if item.Status == model.RecurringRetryFailed {
+			if err := q.notifier.NotifyPermanentFailure(ctx, tx.UserID, tx, err); err != nil {
 				// Log the error but don't fail the operation
 				log.Printf("Failed to send permanent failure notification: %v", err)
 			}
-		}
-	} else {
-		// Regular failure notification
-		if q.notificationSvc != nil {
-			if err := q.notificationSvc.NotifyRecurringTransactionFailure(ctx, tx.UserID, tx, err, item.RetryCount); err != nil {
+		} else {
+			if err := q.notifier.NotifyRecurringTransactionFailure(ctx, tx.UserID, tx, err, item.Attempts); err != nil {
 				log.Printf("Failed to send failure notification: %v", err)
 			}
 		}
 	}
-}
 
-func (q *RetryQueue) Remove(txID string) {
-	q.mu.Lock()
-	defer q.mu.Unlock()
+	return item, nil
+}
 
-	if _, exists := q.items[txID]; exists {
-		delete(q.items, txID)
-		q.metrics.CurrentSize--
-		q.metrics.SuccessCount++
+// Remove deletes a retry whose occurrence has since posted
+func (q *RetryQueue) Remove(ctx context.Context, id string) error {
+	if err := q.repo.DeleteRecurringRetry(ctx, id); err != nil {
+		return err
 	}
+
+	atomic.AddInt64(&q.metrics.SuccessCount, 1)
+	return nil
 }
 
-func (q *RetryQueue) GetDueItems(now time.Time) []*RetryItem {
-	q.mu.RLock()
-	defer q.mu.RUnlock()
-
-	var dueItems []*RetryItem
-	for _, item := range q.items {
-		if item.RetryCount > q.maxRetry {
-			// Mark as permanently failed
-			q.metrics.PermanentFails++
-			delete(q.items, item.Transaction.ID)
-			q.metrics.CurrentSize--
-			continue
-		}
+// WithRepo returns a queue that stores retries through repo, e.g. one bound
+// to a database transaction. Metrics are shared with q.
+func (q *RetryQueue) WithRepo(repo repository.Repository) *RetryQueue {
+	c := *q
+	c.repo = repo
+	return &c
+}
 
-		if now.After(item.NextRetryTime) {
-			dueItems = append(dueItems, item)
-		}
+// GetMetrics returns the queue's size and permanent failures from the
+// database, and retry counts since this process started
+func (q *RetryQueue) GetMetrics(ctx context.Context) (RetryQueueMetrics, error) {
+	counts, err := q.repo.CountRecurringRetries(ctx)
+	if err != nil {
+		return RetryQueueMetrics{}, err
 	}
-	return dueItems
-}
 
-func (q *RetryQueue) GetMetrics() RetryQueueMetrics {
-	q.mu.RLock()
-	defer q.mu.RUnlock()
-	return *q.metrics
+	metrics := RetryQueueMetrics{
+		TotalRetries: atomic.LoadInt64(&q.metrics.TotalRetries),
+		SuccessCount: atomic.LoadInt64(&q.metrics.SuccessCount),
+	}
+	metrics.CurrentSize = counts[model.RecurringRetryPending]
+	metrics.PermanentFails = int64(counts[model.RecurringRetryFailed])
+	return metrics, nil
 }
 
 func (q *RetryQueue) calculateNextRetryTime(retryCount int) time.Time {
 	// Exponential backoff: 1min, 2min, 4min, 8min, etc.
+	if retryCount > 7 {
+		retryCount = 7
+	}
 	delay := time.Duration(1<<uint(retryCount-1)) * time.Minute
 	if delay > 1*time.Hour {
 		delay = 1 * time.Hour // Cap at 1 hour
 	}
 	return time.Now().Add(delay)
 }
-
-func (q *RetryQueue) GetItemStatus(txID string) (*RetryItem, bool) {
-	q.mu.RLock()
-	defer q.mu.RUnlock()
-
-	item, exists := q.items[txID]
-	return item, exists
-}
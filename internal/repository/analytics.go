@@ -30,6 +30,8 @@ type AnalyticsRepository interface {
 	GetTotalExpenses(ctx context.Context) (float64, error)
 	GetAverageDailyExpenses(ctx context.Context) (float64, error)
 	GetUserCount(ctx context.Context) (int64, error)
+	GetCategorySpendingByPeriod(ctx context.Context, filter model.AnalyticsFilter, period model.AnomalyPeriod) ([]model.CategoryPeriodSpend, error)
+	GetCategoryDebits(ctx context.Context, filter model.AnalyticsFilter) ([]model.CategoryDebit, error)
 }
 
 type AnalyticsSQL struct {
@@ -56,7 +58,7 @@ func (r *AnalyticsSQL) GetSpendingByCategory(ctx context.Context, filter model.A
 				AND t.user_id::text = $1::text
 				AND t.date >= $2 
 				AND t.date <= $3
-				AND ($4::text IS NULL OR c.id::text = $4::text)
+				AND (NULLIF($4::text, '') IS NULL OR c.id::text = $4::text)
 			WHERE c.type = 'expense'
 				AND (c.user_id IS NULL OR c.user_id::text = $1::text)  -- Include both default and user-specific categories
 			GROUP BY c.id, c.name
@@ -692,3 +694,84 @@ func (r *AnalyticsSQL) GetUserCount(ctx context.Context) (int64, error) {
 	}
 	return count, nil
 }
+
+// GetCategorySpendingByPeriod totals the user's categorized debits per
+// category and week or month between the filter's dates. Periods start at
+// midnight UTC, weeks on Monday, and periods without spending are left out.
+func (r *AnalyticsSQL) GetCategorySpendingByPeriod(ctx context.Context, filter model.AnalyticsFilter, period model.AnomalyPeriod) ([]model.CategoryPeriodSpend, error) {
+	query := `
+		SELECT
+			c.id,
+			c.name,
+			date_trunc($4::text, t.date AT TIME ZONE 'UTC') AT TIME ZONE 'UTC' as period_start,
+			ABS(SUM(t.amount)) as amount
+		FROM transactions t
+		JOIN categories c ON c.id = t.category_id
+		WHERE t.user_id = $1
+			AND t.date >= $2
+			AND t.date <= $3
+			AND t.amount < 0
+		GROUP BY c.id, c.name, period_start
+		ORDER BY period_start, c.name`
+
+	rows, err := r.query().QueryContext(ctx, query, filter.UserID, filter.StartDate, filter.EndDate, string(period))
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to get category spending by period", http.StatusInternalServerError)
+	}
+	defer rows.Close()
+
+	var spending []model.CategoryPeriodSpend
+	for rows.Next() {
+		var s model.CategoryPeriodSpend
+		if err := rows.Scan(&s.CategoryID, &s.CategoryName, &s.PeriodStart, &s.Amount); err != nil {
+			return nil, errors.Wrap(err, "Failed to scan category spending", http.StatusInternalServerError)
+		}
+		s.PeriodStart = s.PeriodStart.UTC()
+		spending = append(spending, s)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "Failed to iterate category spending", http.StatusInternalServerError)
+	}
+
+	return spending, nil
+}
+
+// GetCategoryDebits returns the user's categorized debits between the
+// filter's dates, oldest first, with their amounts made positive
+func (r *AnalyticsSQL) GetCategoryDebits(ctx context.Context, filter model.AnalyticsFilter) ([]model.CategoryDebit, error) {
+	query := `
+		SELECT
+			t.id,
+			c.id,
+			c.name,
+			COALESCE(NULLIF(t.merchant_name, ''), t.description),
+			t.date,
+			ABS(t.amount)
+		FROM transactions t
+		JOIN categories c ON c.id = t.category_id
+		WHERE t.user_id = $1
+			AND t.date >= $2
+			AND t.date <= $3
+			AND t.amount < 0
+		ORDER BY t.date`
+
+	rows, err := r.query().QueryContext(ctx, query, filter.UserID, filter.StartDate, filter.EndDate)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to get category debits", http.StatusInternalServerError)
+	}
+	defer rows.Close()
+
+	var debits []model.CategoryDebit
+	for rows.Next() {
+		var d model.CategoryDebit
+		if err := rows.Scan(&d.TransactionID, &d.CategoryID, &d.CategoryName, &d.Description, &d.Date, &d.Amount); err != nil {
+			return nil, errors.Wrap(err, "Failed to scan category debit", http.StatusInternalServerError)
+		}
+		debits = append(debits, d)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "Failed to iterate category debits", http.StatusInternalServerError)
+	}
+
+	return debits, nil
+}
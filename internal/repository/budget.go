@@ -63,6 +63,7 @@ func (r *BudgetSQL) GetBudgetByID(ctx context.Context, id string) (*model.Budget
 		FROM budgets b
 		LEFT JOIN categories c ON b.category_id = c.id
 		LEFT JOIN transactions t ON t.category_id = c.id 
+			AND t.user_id = b.user_id
 			AND t.date >= b.period_start 
 			AND t.date <= b.period_end
 		WHERE b.id = $1
@@ -113,10 +114,11 @@ func (r *BudgetSQL) GetBudgets(ctx context.Context, filter model.BudgetFilter) (
 		FROM budgets b
 		LEFT JOIN categories c ON b.category_id = c.id
 		LEFT JOIN transactions t ON t.category_id = c.id 
+			AND t.user_id = b.user_id
 			AND t.date >= b.period_start 
 			AND t.date <= b.period_end
 		WHERE b.user_id = $1
-			AND ($2::uuid IS NULL OR b.category_id = $2)
+			AND (NULLIF($2::text, '') IS NULL OR b.category_id::text = $2::text)
 			AND ($3::timestamp IS NULL OR b.period_end >= $3)
 			AND ($4::timestamp IS NULL OR b.period_start <= $4)
 		GROUP BY b.id, c.id
@@ -230,6 +232,7 @@ func (r *BudgetSQL) GetBudgetSummary(ctx context.Context, userID string, start,
 				), 0) as total_spent
 			FROM budgets b
 			LEFT JOIN transactions t ON t.category_id = b.category_id 
+				AND t.user_id = b.user_id
 				AND t.date >= b.period_start 
 				AND t.date <= b.period_end
 			WHERE b.user_id = $1
@@ -0,0 +1,152 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/yeboahd24/personal-finance-manager/internal/errors"
+	"github.com/yeboahd24/personal-finance-manager/internal/model"
+)
+
+type EmailRepository interface {
+	CreateEmail(ctx context.Context, email *model.Email) error
+	ClaimDueEmail(ctx context.Context, before time.Time, lease time.Duration) (*model.Email, error)
+	UpdateEmail(ctx context.Context, email *model.Email) error
+	DeleteEmailsBefore(ctx context.Context, before time.Time) (int64, error)
+}
+
+type EmailSQL struct {
+	db *sql.DB
+	tx *sql.Tx
+}
+
+func (r *EmailSQL) query() QueryExecutor {
+	if r.tx != nil {
+		return r.tx
+	}
+	return r.db
+}
+
+const emailColumns = `id, to_address, subject, template, text_body, html_body, status, attempts,
+	next_attempt_at, last_error, sent_at, created_at, updated_at`
+
+func scanEmail(row interface{ Scan(...interface{}) error }) (*model.Email, error) {
+	email := &model.Email{}
+	var lastError sql.NullString
+	var sentAt sql.NullTime
+	err := row.Scan(
+		&email.ID,
+		&email.To,
+		&email.Subject,
+		&email.Template,
+		&email.Text,
+		&email.HTML,
+		&email.Status,
+		&email.Attempts,
+		&email.NextAttemptAt,
+		&lastError,
+		&sentAt,
+		&email.CreatedAt,
+		&email.UpdatedAt,
+	)
+	email.LastError = lastError.String
+	if sentAt.Valid {
+		email.SentAt = &sentAt.Time
+	}
+	return email, err
+}
+
+// CreateEmail adds an email to the outbox, to be sent at its NextAttemptAt
+func (r *EmailSQL) CreateEmail(ctx context.Context, email *model.Email) error {
+	query := `
+		INSERT INTO email_outbox (to_address, subject, template, text_body, html_body, status, next_attempt_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING id, created_at, updated_at`
+
+	err := r.query().QueryRowContext(ctx, query,
+		email.To,
+		email.Subject,
+		email.Template,
+		email.Text,
+		email.HTML,
+		email.Status,
+		email.NextAttemptAt,
+	).Scan(&email.ID, &email.CreatedAt, &email.UpdatedAt)
+	if err != nil {
+		return errors.Wrap(err, "Failed to queue email", 500)
+	}
+	return nil
+}
+
+// ClaimDueEmail takes the oldest pending email due by before and pushes its
+// next attempt back by lease, so no other worker sends it meanwhile. It
+// returns nil when nothing is due.
+func (r *EmailSQL) ClaimDueEmail(ctx context.Context, before time.Time, lease time.Duration) (*model.Email, error) {
+	query := `
+		UPDATE email_outbox
+		SET next_attempt_at = $2
+		WHERE id = (
+			SELECT id
+			FROM email_outbox
+			WHERE status = 'pending' AND next_attempt_at <= $1
+			ORDER BY next_attempt_at ASC
+			LIMIT 1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING ` + emailColumns
+
+	email, err := scanEmail(r.query().QueryRowContext(ctx, query, before, before.Add(lease)))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to claim email", 500)
+	}
+	return email, nil
+}
+
+// UpdateEmail records the outcome of a send attempt
+func (r *EmailSQL) UpdateEmail(ctx context.Context, email *model.Email) error {
+	query := `
+		UPDATE email_outbox
+		SET status = $2,
+			attempts = $3,
+			next_attempt_at = $4,
+			last_error = NULLIF($5, ''),
+			sent_at = $6,
+			updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1
+		RETURNING updated_at`
+
+	err := r.query().QueryRowContext(ctx, query,
+		email.ID,
+		email.Status,
+		email.Attempts,
+		email.NextAttemptAt,
+		email.LastError,
+		email.SentAt,
+	).Scan(&email.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return errors.ErrNotFound
+	}
+	if err != nil {
+		return errors.Wrap(err, "Failed to update email", 500)
+	}
+	return nil
+}
+
+// DeleteEmailsBefore removes sent and failed emails last updated before the
+// given time and returns how many were removed
+func (r *EmailSQL) DeleteEmailsBefore(ctx context.Context, before time.Time) (int64, error) {
+	result, err := r.query().ExecContext(ctx, "DELETE FROM email_outbox WHERE status <> 'pending' AND updated_at < $1", before)
+	if err != nil {
+		return 0, errors.Wrap(err, "Failed to delete emails", 500)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return 0, errors.Wrap(err, "Failed to get rows affected", 500)
+	}
+	return rowsAffected, nil
+}
@@ -0,0 +1,123 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/yeboahd24/personal-finance-manager/internal/errors"
+	"github.com/yeboahd24/personal-finance-manager/internal/model"
+)
+
+type EventRepository interface {
+	CreateEvent(ctx context.Context, event *model.Event) error
+	GetEventByID(ctx context.Context, id int64) (*model.Event, error)
+	GetEventsAfter(ctx context.Context, userID string, afterID int64, limit int) ([]*model.Event, error)
+	DeleteEventsBefore(ctx context.Context, before time.Time) (int64, error)
+}
+
+type EventSQL struct {
+	db *sql.DB
+	tx *sql.Tx
+}
+
+func (r *EventSQL) query() QueryExecutor {
+	if r.tx != nil {
+		return r.tx
+	}
+	return r.db
+}
+
+const eventColumns = `id, user_id, type, data, created_at`
+
+func scanEvent(row interface{ Scan(...interface{}) error }) (*model.Event, error) {
+	event := &model.Event{}
+	var data []byte
+	err := row.Scan(
+		&event.ID,
+		&event.UserID,
+		&event.Type,
+		&data,
+		&event.CreatedAt,
+	)
+	event.Data = data
+	return event, err
+}
+
+// CreateEvent stores an event. A trigger announces it on the user_events
+// channel once the insert commits.
+func (r *EventSQL) CreateEvent(ctx context.Context, event *model.Event) error {
+	query := `
+		INSERT INTO user_events (user_id, type, data)
+		VALUES ($1, $2, $3)
+		RETURNING id, created_at`
+
+	data := []byte(event.Data)
+	if len(data) == 0 {
+		data = []byte("{}")
+	}
+
+	err := r.query().QueryRowContext(ctx, query, event.UserID, event.Type, data).Scan(&event.ID, &event.CreatedAt)
+	if err != nil {
+		return errors.Wrap(err, "Failed to create event", 500)
+	}
+	return nil
+}
+
+func (r *EventSQL) GetEventByID(ctx context.Context, id int64) (*model.Event, error) {
+	query := `SELECT ` + eventColumns + ` FROM user_events WHERE id = $1`
+
+	event, err := scanEvent(r.query().QueryRowContext(ctx, query, id))
+	if err == sql.ErrNoRows {
+		return nil, errors.ErrNotFound
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to get event", 500)
+	}
+	return event, nil
+}
+
+// GetEventsAfter returns up to limit of the user's events with IDs above
+// afterID, oldest first
+func (r *EventSQL) GetEventsAfter(ctx context.Context, userID string, afterID int64, limit int) ([]*model.Event, error) {
+	query := `
+		SELECT ` + eventColumns + `
+		FROM user_events
+		WHERE user_id = $1 AND id > $2
+		ORDER BY id
+		LIMIT $3`
+
+	rows, err := r.query().QueryContext(ctx, query, userID, afterID, limit)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to get events", 500)
+	}
+	defer rows.Close()
+
+	var events []*model.Event
+	for rows.Next() {
+		event, err := scanEvent(rows)
+		if err != nil {
+			return nil, errors.Wrap(err, "Failed to scan event", 500)
+		}
+		events = append(events, event)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "Failed to iterate events", 500)
+	}
+	return events, nil
+}
+
+// DeleteEventsBefore removes events created before the given time and
+// returns how many were removed
+func (r *EventSQL) DeleteEventsBefore(ctx context.Context, before time.Time) (int64, error) {
+	result, err := r.query().ExecContext(ctx, "DELETE FROM user_events WHERE created_at < $1", before)
+	if err != nil {
+		return 0, errors.Wrap(err, "Failed to delete events", 500)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return 0, errors.Wrap(err, "Failed to get rows affected", 500)
+	}
+	return rowsAffected, nil
+}
@@ -7,6 +7,7 @@ import (
 
 	"github.com/google/uuid"
 
+	"github.com/yeboahd24/personal-finance-manager/internal/errors"
 	"github.com/yeboahd24/personal-finance-manager/internal/model"
 )
 
@@ -17,6 +18,17 @@ type GoalRepository interface {
 	GetUserGoals(ctx context.Context, userID string) ([]*model.Goal, error)
 	UpdateGoal(ctx context.Context, goal *model.Goal) error
 	DeleteGoal(ctx context.Context, id string, userID string) error
+	CreateGoalContribution(ctx context.Context, contribution *model.GoalContribution) error
+	GetGoalContributions(ctx context.Context, goalID string) ([]*model.GoalContribution, error)
+	DeleteGoalContribution(ctx context.Context, id string, goalID string) error
+	GetGoalAccounts(ctx context.Context, goalID string) ([]model.GoalAccount, error)
+	GetGoalAccountsChange(ctx context.Context, goalID string, from, to time.Time) (float64, error)
+	SetGoalAccounts(ctx context.Context, goalID string, accounts []model.GoalAccount) error
+	GetAllGoals(ctx context.Context) ([]*model.Goal, error)
+	GetGoalNotificationState(ctx context.Context, goalID string) (*model.GoalNotificationState, error)
+	ClaimGoalNotificationState(ctx context.Context, current, next *model.GoalNotificationState) (bool, error)
+	GetSinkingFundTransfer(ctx context.Context, goalID string) (*model.SinkingFundTransfer, error)
+	SaveSinkingFundTransfer(ctx context.Context, transfer *model.SinkingFundTransfer) error
 }
 
 // GoalSQL handles goal-related database operations
@@ -42,8 +54,11 @@ func (r *GoalSQL) CreateGoal(ctx context.Context, goal *model.Goal) error {
 	goal.UpdatedAt = now
 
 	query := `
-		INSERT INTO goals (id, user_id, name, target_amount, current_amount, deadline, created_at, updated_at)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		INSERT INTO goals (
+			id, user_id, account_id, kind, name, target_amount, current_amount, deadline,
+			expense_match, recurrence, cycle_start, funding_account_id, created_at, updated_at
+		)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, NULLIF($9, ''), $10, $11, $12, $13, $14)
 	`
 
 	var executor SQLExecutor
@@ -56,10 +71,16 @@ func (r *GoalSQL) CreateGoal(ctx context.Context, goal *model.Goal) error {
 	_, err := executor.ExecContext(ctx, query,
 		goal.ID,
 		goal.UserID,
+		goal.AccountID,
+		goal.Kind,
 		goal.Name,
 		goal.TargetAmount,
 		goal.CurrentAmount,
 		goal.Deadline,
+		goal.ExpenseMatch,
+		goal.Recurrence,
+		goal.CycleStart,
+		goal.FundingAccountID,
 		goal.CreatedAt,
 		goal.UpdatedAt,
 	)
@@ -69,7 +90,9 @@ func (r *GoalSQL) CreateGoal(ctx context.Context, goal *model.Goal) error {
 // GetGoalByID retrieves a goal by its ID
 func (r *GoalSQL) GetGoalByID(ctx context.Context, id string) (*model.Goal, error) {
 	query := `
-		SELECT id, user_id, name, target_amount, current_amount, deadline, created_at, updated_at
+		SELECT id, user_id, account_id, kind, name, target_amount, current_amount, deadline,
+			COALESCE(expense_match, ''), recurrence, cycle_start, last_matched_transaction_id,
+			funding_account_id, created_at, updated_at
 		FROM goals
 		WHERE id = $1
 	`
@@ -85,10 +108,17 @@ func (r *GoalSQL) GetGoalByID(ctx context.Context, id string) (*model.Goal, erro
 	err := executor.QueryRowContext(ctx, query, id).Scan(
 		&goal.ID,
 		&goal.UserID,
+		&goal.AccountID,
+		&goal.Kind,
 		&goal.Name,
 		&goal.TargetAmount,
 		&goal.CurrentAmount,
 		&goal.Deadline,
+		&goal.ExpenseMatch,
+		&goal.Recurrence,
+		&goal.CycleStart,
+		&goal.LastMatchedTransactionID,
+		&goal.FundingAccountID,
 		&goal.CreatedAt,
 		&goal.UpdatedAt,
 	)
@@ -101,7 +131,9 @@ func (r *GoalSQL) GetGoalByID(ctx context.Context, id string) (*model.Goal, erro
 // GetUserGoals retrieves all goals for a user
 func (r *GoalSQL) GetUserGoals(ctx context.Context, userID string) ([]*model.Goal, error) {
 	query := `
-		SELECT id, user_id, name, target_amount, current_amount, deadline, created_at, updated_at
+		SELECT id, user_id, account_id, kind, name, target_amount, current_amount, deadline,
+			COALESCE(expense_match, ''), recurrence, cycle_start, last_matched_transaction_id,
+			funding_account_id, created_at, updated_at
 		FROM goals
 		WHERE user_id = $1
 		ORDER BY created_at DESC
@@ -126,10 +158,68 @@ func (r *GoalSQL) GetUserGoals(ctx context.Context, userID string) ([]*model.Goa
 		err := rows.Scan(
 			&goal.ID,
 			&goal.UserID,
+			&goal.AccountID,
+			&goal.Kind,
+			&goal.Name,
+			&goal.TargetAmount,
+			&goal.CurrentAmount,
+			&goal.Deadline,
+			&goal.ExpenseMatch,
+			&goal.Recurrence,
+			&goal.CycleStart,
+			&goal.LastMatchedTransactionID,
+			&goal.FundingAccountID,
+			&goal.CreatedAt,
+			&goal.UpdatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		goals = append(goals, goal)
+	}
+	return goals, rows.Err()
+}
+
+// GetAllGoals retrieves every user's goals, for background evaluation
+func (r *GoalSQL) GetAllGoals(ctx context.Context) ([]*model.Goal, error) {
+	query := `
+		SELECT id, user_id, account_id, kind, name, target_amount, current_amount, deadline,
+			COALESCE(expense_match, ''), recurrence, cycle_start, last_matched_transaction_id,
+			funding_account_id, created_at, updated_at
+		FROM goals
+		ORDER BY user_id, created_at
+	`
+
+	var executor SQLExecutor
+	if r.tx != nil {
+		executor = r.tx
+	} else {
+		executor = r.db
+	}
+
+	rows, err := executor.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var goals []*model.Goal
+	for rows.Next() {
+		goal := &model.Goal{}
+		err := rows.Scan(
+			&goal.ID,
+			&goal.UserID,
+			&goal.AccountID,
+			&goal.Kind,
 			&goal.Name,
 			&goal.TargetAmount,
 			&goal.CurrentAmount,
 			&goal.Deadline,
+			&goal.ExpenseMatch,
+			&goal.Recurrence,
+			&goal.CycleStart,
+			&goal.LastMatchedTransactionID,
+			&goal.FundingAccountID,
 			&goal.CreatedAt,
 			&goal.UpdatedAt,
 		)
@@ -151,8 +241,15 @@ func (r *GoalSQL) UpdateGoal(ctx context.Context, goal *model.Goal) error {
 			target_amount = $2,
 			current_amount = $3,
 			deadline = $4,
-			updated_at = $5
-		WHERE id = $6 AND user_id = $7
+			account_id = $5,
+			kind = $6,
+			expense_match = NULLIF($7, ''),
+			recurrence = $8,
+			cycle_start = $9,
+			last_matched_transaction_id = $10,
+			funding_account_id = $11,
+			updated_at = $12
+		WHERE id = $13 AND user_id = $14
 	`
 
 	var executor SQLExecutor
@@ -167,6 +264,13 @@ func (r *GoalSQL) UpdateGoal(ctx context.Context, goal *model.Goal) error {
 		goal.TargetAmount,
 		goal.CurrentAmount,
 		goal.Deadline,
+		goal.AccountID,
+		goal.Kind,
+		goal.ExpenseMatch,
+		goal.Recurrence,
+		goal.CycleStart,
+		goal.LastMatchedTransactionID,
+		goal.FundingAccountID,
 		goal.UpdatedAt,
 		goal.ID,
 		goal.UserID,
@@ -188,3 +292,372 @@ func (r *GoalSQL) DeleteGoal(ctx context.Context, id string, userID string) erro
 	_, err := executor.ExecContext(ctx, query, id, userID)
 	return err
 }
+
+// CreateGoalContribution records a contribution towards a goal. Linking a
+// transaction that is already linked to the goal returns errors.ErrDuplicateResource.
+func (r *GoalSQL) CreateGoalContribution(ctx context.Context, contribution *model.GoalContribution) error {
+	if contribution.ID == "" {
+		contribution.ID = uuid.New().String()
+	}
+	contribution.CreatedAt = time.Now()
+
+	query := `
+		INSERT INTO goal_contributions (id, goal_id, user_id, transaction_id, amount, date, note, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		ON CONFLICT ON CONSTRAINT unique_goal_transaction DO NOTHING
+	`
+
+	var executor SQLExecutor
+	if r.tx != nil {
+		executor = r.tx
+	} else {
+		executor = r.db
+	}
+
+	result, err := executor.ExecContext(ctx, query,
+		contribution.ID,
+		contribution.GoalID,
+		contribution.UserID,
+		contribution.TransactionID,
+		contribution.Amount,
+		contribution.Date,
+		contribution.Note,
+		contribution.CreatedAt,
+	)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return errors.ErrDuplicateResource
+	}
+	return nil
+}
+
+// GetGoalContributions retrieves all contributions for a goal, newest first
+func (r *GoalSQL) GetGoalContributions(ctx context.Context, goalID string) ([]*model.GoalContribution, error) {
+	query := `
+		SELECT id, goal_id, user_id, transaction_id, amount, date, COALESCE(note, ''), created_at
+		FROM goal_contributions
+		WHERE goal_id = $1
+		ORDER BY date DESC
+	`
+
+	var executor SQLExecutor
+	if r.tx != nil {
+		executor = r.tx
+	} else {
+		executor = r.db
+	}
+
+	rows, err := executor.QueryContext(ctx, query, goalID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var contributions []*model.GoalContribution
+	for rows.Next() {
+		contribution := &model.GoalContribution{}
+		err := rows.Scan(
+			&contribution.ID,
+			&contribution.GoalID,
+			&contribution.UserID,
+			&contribution.TransactionID,
+			&contribution.Amount,
+			&contribution.Date,
+			&contribution.Note,
+			&contribution.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		contributions = append(contributions, contribution)
+	}
+	return contributions, rows.Err()
+}
+
+// DeleteGoalContribution removes a contribution from a goal, returning
+// errors.ErrNotFound when the goal has no such contribution
+func (r *GoalSQL) DeleteGoalContribution(ctx context.Context, id string, goalID string) error {
+	query := `DELETE FROM goal_contributions WHERE id = $1 AND goal_id = $2`
+
+	var executor SQLExecutor
+	if r.tx != nil {
+		executor = r.tx
+	} else {
+		executor = r.db
+	}
+
+	result, err := executor.ExecContext(ctx, query, id, goalID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return errors.ErrNotFound
+	}
+	return nil
+}
+
+// GetGoalAccounts retrieves the accounts backing a goal along with their current balances
+func (r *GoalSQL) GetGoalAccounts(ctx context.Context, goalID string) ([]model.GoalAccount, error) {
+	query := `
+		SELECT ga.account_id, ga.fraction, a.name, a.balance
+		FROM goal_accounts ga
+		JOIN accounts a ON ga.account_id = a.id
+		WHERE ga.goal_id = $1
+		ORDER BY ga.created_at ASC
+	`
+
+	var executor SQLExecutor
+	if r.tx != nil {
+		executor = r.tx
+	} else {
+		executor = r.db
+	}
+
+	rows, err := executor.QueryContext(ctx, query, goalID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var accounts []model.GoalAccount
+	for rows.Next() {
+		var account model.GoalAccount
+		err := rows.Scan(
+			&account.AccountID,
+			&account.Fraction,
+			&account.AccountName,
+			&account.Balance,
+		)
+		if err != nil {
+			return nil, err
+		}
+		accounts = append(accounts, account)
+	}
+	return accounts, rows.Err()
+}
+
+// GetGoalAccountsChange returns the net movement of the goal's backing
+// accounts between from and to, each account weighted by its fraction
+func (r *GoalSQL) GetGoalAccountsChange(ctx context.Context, goalID string, from, to time.Time) (float64, error) {
+	query := `
+		SELECT COALESCE(SUM(t.amount * ga.fraction), 0)
+		FROM goal_accounts ga
+		JOIN transactions t ON t.account_id = ga.account_id
+		WHERE ga.goal_id = $1 AND t.date >= $2 AND t.date <= $3
+	`
+
+	var executor SQLExecutor
+	if r.tx != nil {
+		executor = r.tx
+	} else {
+		executor = r.db
+	}
+
+	var change float64
+	err := executor.QueryRowContext(ctx, query, goalID, from, to).Scan(&change)
+	return change, err
+}
+
+// SetGoalAccounts replaces the accounts backing a goal
+func (r *GoalSQL) SetGoalAccounts(ctx context.Context, goalID string, accounts []model.GoalAccount) error {
+	if r.tx != nil {
+		return setGoalAccounts(ctx, r.tx, goalID, accounts)
+	}
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := setGoalAccounts(ctx, tx, goalID, accounts); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func setGoalAccounts(ctx context.Context, executor SQLExecutor, goalID string, accounts []model.GoalAccount) error {
+	if _, err := executor.ExecContext(ctx, `DELETE FROM goal_accounts WHERE goal_id = $1`, goalID); err != nil {
+		return err
+	}
+
+	query := `
+		INSERT INTO goal_accounts (goal_id, account_id, fraction)
+		VALUES ($1, $2, $3)
+	`
+	for _, account := range accounts {
+		if _, err := executor.ExecContext(ctx, query, goalID, account.AccountID, account.Fraction); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetGoalNotificationState retrieves what has been notified for a goal.
+// A goal that has never been evaluated gets an empty state.
+func (r *GoalSQL) GetGoalNotificationState(ctx context.Context, goalID string) (*model.GoalNotificationState, error) {
+	query := `
+		SELECT goal_id, milestone, deadline_risk_notified, last_reminder_at, updated_at
+		FROM goal_notification_state
+		WHERE goal_id = $1
+	`
+
+	var executor SQLExecutor
+	if r.tx != nil {
+		executor = r.tx
+	} else {
+		executor = r.db
+	}
+
+	state := &model.GoalNotificationState{}
+	err := executor.QueryRowContext(ctx, query, goalID).Scan(
+		&state.GoalID,
+		&state.Milestone,
+		&state.DeadlineRiskNotified,
+		&state.LastReminderAt,
+		&state.UpdatedAt,
+	)
+	if err == sql.ErrNoRows {
+		return &model.GoalNotificationState{GoalID: goalID}, nil
+	}
+	return state, err
+}
+
+// ClaimGoalNotificationState moves a goal's notification state from current
+// to next, provided nobody else has changed it since current was read. It
+// returns false if they have, in which case whatever next records is theirs
+// to send.
+func (r *GoalSQL) ClaimGoalNotificationState(ctx context.Context, current, next *model.GoalNotificationState) (bool, error) {
+	next.UpdatedAt = time.Now()
+
+	query := `
+		INSERT INTO goal_notification_state (goal_id, milestone, deadline_risk_notified, last_reminder_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (goal_id) DO UPDATE
+		SET milestone = $2,
+			deadline_risk_notified = $3,
+			last_reminder_at = $4,
+			updated_at = $5
+		WHERE goal_notification_state.milestone = $6
+			AND goal_notification_state.deadline_risk_notified = $7
+			AND goal_notification_state.last_reminder_at IS NOT DISTINCT FROM $8
+	`
+
+	var executor SQLExecutor
+	if r.tx != nil {
+		executor = r.tx
+	} else {
+		executor = r.db
+	}
+
+	result, err := executor.ExecContext(ctx, query,
+		next.GoalID,
+		next.Milestone,
+		next.DeadlineRiskNotified,
+		next.LastReminderAt,
+		next.UpdatedAt,
+		current.Milestone,
+		current.DeadlineRiskNotified,
+		current.LastReminderAt,
+	)
+	if err != nil {
+		return false, err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return rowsAffected > 0, nil
+}
+
+// GetSinkingFundTransfer retrieves a sinking fund's suggested transfer, or nil
+// if none has been worked out yet
+func (r *GoalSQL) GetSinkingFundTransfer(ctx context.Context, goalID string) (*model.SinkingFundTransfer, error) {
+	query := `
+		SELECT goal_id, user_id, from_account_id, to_account_id, amount, start_date, end_date,
+			debit_recurring_id, credit_recurring_id, updated_at
+		FROM sinking_fund_transfers
+		WHERE goal_id = $1
+	`
+
+	var executor SQLExecutor
+	if r.tx != nil {
+		executor = r.tx
+	} else {
+		executor = r.db
+	}
+
+	transfer := &model.SinkingFundTransfer{}
+	err := executor.QueryRowContext(ctx, query, goalID).Scan(
+		&transfer.GoalID,
+		&transfer.UserID,
+		&transfer.FromAccountID,
+		&transfer.ToAccountID,
+		&transfer.Amount,
+		&transfer.StartDate,
+		&transfer.EndDate,
+		&transfer.DebitRecurringID,
+		&transfer.CreditRecurringID,
+		&transfer.UpdatedAt,
+	)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return transfer, err
+}
+
+// SaveSinkingFundTransfer creates or replaces a sinking fund's suggested transfer
+func (r *GoalSQL) SaveSinkingFundTransfer(ctx context.Context, transfer *model.SinkingFundTransfer) error {
+	transfer.UpdatedAt = time.Now()
+
+	query := `
+		INSERT INTO sinking_fund_transfers (
+			goal_id, user_id, from_account_id, to_account_id, amount, start_date, end_date,
+			debit_recurring_id, credit_recurring_id, updated_at
+		)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+		ON CONFLICT (goal_id) DO UPDATE
+		SET from_account_id = $3,
+			to_account_id = $4,
+			amount = $5,
+			start_date = $6,
+			end_date = $7,
+			debit_recurring_id = $8,
+			credit_recurring_id = $9,
+			updated_at = $10
+	`
+
+	var executor SQLExecutor
+	if r.tx != nil {
+		executor = r.tx
+	} else {
+		executor = r.db
+	}
+
+	_, err := executor.ExecContext(ctx, query,
+		transfer.GoalID,
+		transfer.UserID,
+		transfer.FromAccountID,
+		transfer.ToAccountID,
+		transfer.Amount,
+		transfer.StartDate,
+		transfer.EndDate,
+		transfer.DebitRecurringID,
+		transfer.CreditRecurringID,
+		transfer.UpdatedAt,
+	)
+	return err
+}
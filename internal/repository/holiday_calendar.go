@@ -0,0 +1,144 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/yeboahd24/personal-finance-manager/internal/errors"
+	"github.com/yeboahd24/personal-finance-manager/internal/model"
+)
+
+type HolidayCalendarRepository interface {
+	CreateHolidayCalendar(ctx context.Context, calendar *model.HolidayCalendar) error
+	GetHolidayCalendarByID(ctx context.Context, id string) (*model.HolidayCalendar, error)
+	GetHolidayCalendars(ctx context.Context, userID string) ([]*model.HolidayCalendar, error)
+	UpdateHolidayCalendar(ctx context.Context, calendar *model.HolidayCalendar) error
+	DeleteHolidayCalendar(ctx context.Context, id string) error
+}
+
+type HolidayCalendarSQL struct {
+	db *sql.DB
+	tx *sql.Tx
+}
+
+func (r *HolidayCalendarSQL) query() QueryExecutor {
+	if r.tx != nil {
+		return r.tx
+	}
+	return r.db
+}
+
+const holidayCalendarColumns = `id, user_id, name, base, dates, created_at, updated_at`
+
+func scanHolidayCalendar(row interface{ Scan(...interface{}) error }) (*model.HolidayCalendar, error) {
+	calendar := &model.HolidayCalendar{}
+	var base sql.NullString
+	err := row.Scan(
+		&calendar.ID,
+		&calendar.UserID,
+		&calendar.Name,
+		&base,
+		&calendar.Dates,
+		&calendar.CreatedAt,
+		&calendar.UpdatedAt,
+	)
+	calendar.Base = base.String
+	return calendar, err
+}
+
+func (r *HolidayCalendarSQL) CreateHolidayCalendar(ctx context.Context, calendar *model.HolidayCalendar) error {
+	query := `
+		INSERT INTO holiday_calendars (user_id, name, base, dates)
+		VALUES ($1, $2, NULLIF($3, ''), $4)
+		RETURNING id, created_at, updated_at`
+
+	err := r.query().QueryRowContext(ctx, query,
+		calendar.UserID,
+		calendar.Name,
+		calendar.Base,
+		calendar.Dates,
+	).Scan(&calendar.ID, &calendar.CreatedAt, &calendar.UpdatedAt)
+	if err != nil {
+		return errors.Wrap(err, "Failed to create holiday calendar", 500)
+	}
+	return nil
+}
+
+func (r *HolidayCalendarSQL) GetHolidayCalendarByID(ctx context.Context, id string) (*model.HolidayCalendar, error) {
+	query := `SELECT ` + holidayCalendarColumns + ` FROM holiday_calendars WHERE id = $1`
+
+	calendar, err := scanHolidayCalendar(r.query().QueryRowContext(ctx, query, id))
+	if err == sql.ErrNoRows {
+		return nil, errors.ErrNotFound
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to get holiday calendar", 500)
+	}
+	return calendar, nil
+}
+
+func (r *HolidayCalendarSQL) GetHolidayCalendars(ctx context.Context, userID string) ([]*model.HolidayCalendar, error) {
+	query := `SELECT ` + holidayCalendarColumns + ` FROM holiday_calendars WHERE user_id = $1 ORDER BY name`
+
+	rows, err := r.query().QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to get holiday calendars", 500)
+	}
+	defer rows.Close()
+
+	var calendars []*model.HolidayCalendar
+	for rows.Next() {
+		calendar, err := scanHolidayCalendar(rows)
+		if err != nil {
+			return nil, errors.Wrap(err, "Failed to scan holiday calendar", 500)
+		}
+		calendars = append(calendars, calendar)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "Failed to iterate holiday calendars", 500)
+	}
+	return calendars, nil
+}
+
+func (r *HolidayCalendarSQL) UpdateHolidayCalendar(ctx context.Context, calendar *model.HolidayCalendar) error {
+	query := `
+		UPDATE holiday_calendars
+		SET name = $2,
+			base = NULLIF($3, ''),
+			dates = $4,
+			updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1
+		RETURNING updated_at`
+
+	err := r.query().QueryRowContext(ctx, query,
+		calendar.ID,
+		calendar.Name,
+		calendar.Base,
+		calendar.Dates,
+	).Scan(&calendar.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return errors.ErrNotFound
+	}
+	if err != nil {
+		return errors.Wrap(err, "Failed to update holiday calendar", 500)
+	}
+	return nil
+}
+
+func (r *HolidayCalendarSQL) DeleteHolidayCalendar(ctx context.Context, id string) error {
+	result, err := r.query().ExecContext(ctx, "DELETE FROM holiday_calendars WHERE id = $1", id)
+	if err != nil {
+		return errors.Wrap(err, "Failed to delete holiday calendar", 500)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return errors.Wrap(err, "Failed to get rows affected", 500)
+	}
+
+	if rowsAffected == 0 {
+		return errors.ErrNotFound
+	}
+
+	return nil
+}
@@ -4,7 +4,9 @@ import (
 	"context"
 	"database/sql"
 	"encoding/json"
+	"time"
 
+	"github.com/lib/pq"
 	"github.com/yeboahd24/personal-finance-manager/internal/errors"
 	"github.com/yeboahd24/personal-finance-manager/internal/model"
 )
@@ -55,17 +57,15 @@ func (r *NotificationSQL) CreateNotification(ctx context.Context, notification *
 	return nil
 }
 
-func (r *NotificationSQL) GetNotificationByID(ctx context.Context, id string) (*model.Notification, error) {
-	query := `
-		SELECT 
-			id, user_id, type, priority, title, message, data, read, created_at, updated_at
-		FROM notifications
-		WHERE id = $1`
+const notificationColumns = `
+	id, user_id, type, priority, title, message, data, read, snoozed_until, created_at, updated_at`
 
+func scanNotification(row interface{ Scan(...interface{}) error }) (*model.Notification, error) {
 	notification := &model.Notification{}
 	var data []byte
+	var snoozedUntil sql.NullTime
 
-	err := r.query().QueryRowContext(ctx, query, id).Scan(
+	err := row.Scan(
 		&notification.ID,
 		&notification.UserID,
 		&notification.Type,
@@ -74,10 +74,27 @@ func (r *NotificationSQL) GetNotificationByID(ctx context.Context, id string) (*
 		&notification.Message,
 		&data,
 		&notification.Read,
+		&snoozedUntil,
 		&notification.CreatedAt,
 		&notification.UpdatedAt,
 	)
+	if err != nil {
+		return nil, err
+	}
+	if snoozedUntil.Valid {
+		notification.SnoozedUntil = &snoozedUntil.Time
+	}
 
+	if err := json.Unmarshal(data, &notification.Data); err != nil {
+		return nil, errors.Wrap(err, "Failed to unmarshal notification data", 500)
+	}
+	return notification, nil
+}
+
+func (r *NotificationSQL) GetNotificationByID(ctx context.Context, id string) (*model.Notification, error) {
+	query := `SELECT ` + notificationColumns + ` FROM notifications WHERE id = $1`
+
+	notification, err := scanNotification(r.query().QueryRowContext(ctx, query, id))
 	if err == sql.ErrNoRows {
 		return nil, errors.ErrNotFound
 	}
@@ -85,23 +102,21 @@ func (r *NotificationSQL) GetNotificationByID(ctx context.Context, id string) (*
 		return nil, errors.Wrap(err, "Failed to get notification", 500)
 	}
 
-	if err := json.Unmarshal(data, &notification.Data); err != nil {
-		return nil, errors.Wrap(err, "Failed to unmarshal notification data", 500)
-	}
-
 	return notification, nil
 }
 
-func (r *NotificationSQL) GetUserNotifications(ctx context.Context, userID string, unreadOnly bool) ([]*model.Notification, error) {
+// GetUserNotifications lists the user's notifications, newest first.
+// Notifications snoozed until later are left out unless includeSnoozed is set.
+func (r *NotificationSQL) GetUserNotifications(ctx context.Context, userID string, unreadOnly, includeSnoozed bool) ([]*model.Notification, error) {
 	query := `
-		SELECT 
-			id, user_id, type, priority, title, message, data, read, created_at, updated_at
+		SELECT ` + notificationColumns + `
 		FROM notifications
 		WHERE user_id = $1
 		AND ($2 = false OR read = false)
+		AND ($3 = true OR snoozed_until IS NULL OR snoozed_until <= CURRENT_TIMESTAMP)
 		ORDER BY created_at DESC`
 
-	rows, err := r.query().QueryContext(ctx, query, userID, unreadOnly)
+	rows, err := r.query().QueryContext(ctx, query, userID, unreadOnly, includeSnoozed)
 	if err != nil {
 		return nil, errors.Wrap(err, "Failed to get user notifications", 500)
 	}
@@ -109,29 +124,10 @@ func (r *NotificationSQL) GetUserNotifications(ctx context.Context, userID strin
 
 	var notifications []*model.Notification
 	for rows.Next() {
-		notification := &model.Notification{}
-		var data []byte
-
-		err := rows.Scan(
-			&notification.ID,
-			&notification.UserID,
-			&notification.Type,
-			&notification.Priority,
-			&notification.Title,
-			&notification.Message,
-			&data,
-			&notification.Read,
-			&notification.CreatedAt,
-			&notification.UpdatedAt,
-		)
+		notification, err := scanNotification(rows)
 		if err != nil {
 			return nil, errors.Wrap(err, "Failed to scan notification", 500)
 		}
-
-		if err := json.Unmarshal(data, &notification.Data); err != nil {
-			return nil, errors.Wrap(err, "Failed to unmarshal notification data", 500)
-		}
-
 		notifications = append(notifications, notification)
 	}
 
@@ -182,17 +178,167 @@ func (r *NotificationSQL) DeleteNotification(ctx context.Context, id string) err
 	return nil
 }
 
-func (r *NotificationSQL) GetNotificationPreferences(ctx context.Context, userID string) (*model.NotificationPreferences, error) {
+// MarkNotificationsAsRead marks the user's notifications with the given IDs,
+// or all of them, as read and returns how many changed
+func (r *NotificationSQL) MarkNotificationsAsRead(ctx context.Context, userID string, ids []string, all bool) (int64, error) {
 	query := `
-		SELECT 
-			id, user_id, email_enabled, push_enabled, in_app_enabled,
-			min_priority, recurring_failures, upcoming_recurring,
-			created_at, updated_at
-		FROM notification_preferences
-		WHERE user_id = $1`
+		UPDATE notifications
+		SET read = true,
+			updated_at = CURRENT_TIMESTAMP
+		WHERE user_id = $1 AND read = false
+		AND ($2 OR id = ANY($3::uuid[]))`
+
+	result, err := r.query().ExecContext(ctx, query, userID, all, pq.Array(ids))
+	if err != nil {
+		return 0, errors.Wrap(err, "Failed to mark notifications as read", 500)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return 0, errors.Wrap(err, "Failed to get rows affected", 500)
+	}
+	return rowsAffected, nil
+}
+
+// DeleteNotifications deletes the user's notifications with the given IDs,
+// or all of them, and returns how many were deleted
+func (r *NotificationSQL) DeleteNotifications(ctx context.Context, userID string, ids []string, all bool) (int64, error) {
+	query := `
+		DELETE FROM notifications
+		WHERE user_id = $1
+		AND ($2 OR id = ANY($3::uuid[]))`
+
+	result, err := r.query().ExecContext(ctx, query, userID, all, pq.Array(ids))
+	if err != nil {
+		return 0, errors.Wrap(err, "Failed to delete notifications", 500)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return 0, errors.Wrap(err, "Failed to get rows affected", 500)
+	}
+	return rowsAffected, nil
+}
+
+// SnoozeNotification hides the user's notification until the given time, or
+// brings it back when until is nil
+func (r *NotificationSQL) SnoozeNotification(ctx context.Context, userID, notificationID string, until *time.Time) error {
+	query := `
+		UPDATE notifications
+		SET snoozed_until = $3,
+			updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1 AND user_id = $2`
 
+	result, err := r.query().ExecContext(ctx, query, notificationID, userID, until)
+	if err != nil {
+		return errors.Wrap(err, "Failed to snooze notification", 500)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return errors.Wrap(err, "Failed to get rows affected", 500)
+	}
+
+	if rowsAffected == 0 {
+		return errors.ErrNotFound
+	}
+
+	return nil
+}
+
+// ReleaseSnoozedNotifications clears the snooze of notifications snoozed
+// until before the given time and returns them. Each is returned only once.
+func (r *NotificationSQL) ReleaseSnoozedNotifications(ctx context.Context, before time.Time) ([]*model.Notification, error) {
+	query := `
+		UPDATE notifications
+		SET snoozed_until = NULL,
+			updated_at = CURRENT_TIMESTAMP
+		WHERE snoozed_until <= $1
+		RETURNING ` + notificationColumns
+
+	rows, err := r.query().QueryContext(ctx, query, before)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to release snoozed notifications", 500)
+	}
+	defer rows.Close()
+
+	var notifications []*model.Notification
+	for rows.Next() {
+		notification, err := scanNotification(rows)
+		if err != nil {
+			return nil, errors.Wrap(err, "Failed to scan notification", 500)
+		}
+		notifications = append(notifications, notification)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "Failed to iterate notifications", 500)
+	}
+	return notifications, nil
+}
+
+// CreateNotificationDelivery holds back a notification's delivery on a
+// channel until its DeliverAt. A delivery already held back is moved.
+func (r *NotificationSQL) CreateNotificationDelivery(ctx context.Context, delivery *model.NotificationDelivery) error {
+	query := `
+		INSERT INTO notification_deliveries (notification_id, channel, deliver_at)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (notification_id, channel) DO UPDATE SET deliver_at = EXCLUDED.deliver_at
+		RETURNING created_at`
+
+	err := r.query().QueryRowContext(ctx, query, delivery.NotificationID, delivery.Channel, delivery.DeliverAt).Scan(&delivery.CreatedAt)
+	if err != nil {
+		return errors.Wrap(err, "Failed to defer notification delivery", 500)
+	}
+	return nil
+}
+
+// ClaimDueNotificationDeliveries removes and returns up to limit deliveries
+// due by before. Concurrent callers get different deliveries.
+func (r *NotificationSQL) ClaimDueNotificationDeliveries(ctx context.Context, before time.Time, limit int) ([]*model.NotificationDelivery, error) {
+	query := `
+		DELETE FROM notification_deliveries
+		WHERE (notification_id, channel) IN (
+			SELECT notification_id, channel
+			FROM notification_deliveries
+			WHERE deliver_at <= $1
+			ORDER BY deliver_at ASC
+			LIMIT $2
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING notification_id, channel, deliver_at, created_at`
+
+	rows, err := r.query().QueryContext(ctx, query, before, limit)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to claim notification deliveries", 500)
+	}
+	defer rows.Close()
+
+	var deliveries []*model.NotificationDelivery
+	for rows.Next() {
+		delivery := &model.NotificationDelivery{}
+		if err := rows.Scan(&delivery.NotificationID, &delivery.Channel, &delivery.DeliverAt, &delivery.CreatedAt); err != nil {
+			return nil, errors.Wrap(err, "Failed to scan notification delivery", 500)
+		}
+		deliveries = append(deliveries, delivery)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "Failed to iterate notification deliveries", 500)
+	}
+	return deliveries, nil
+}
+
+const notificationPreferencesColumns = `
+	id, user_id, email_enabled, push_enabled, in_app_enabled,
+	min_priority, recurring_failures, upcoming_recurring, upcoming_recurring_days,
+	goal_milestones, goal_deadline_risk, goal_reminders, goal_reminder_days,
+	minimum_balance, low_balance_alerts, low_balance_days, spending_anomalies,
+	email_digest, digest_time, digest_day, timezone,
+	channels, COALESCE(quiet_hours_start, ''), COALESCE(quiet_hours_end, ''), created_at, updated_at`
+
+func scanNotificationPreferences(row interface{ Scan(...interface{}) error }) (*model.NotificationPreferences, error) {
 	prefs := &model.NotificationPreferences{}
-	err := r.query().QueryRowContext(ctx, query, userID).Scan(
+	var channels []byte
+	err := row.Scan(
 		&prefs.ID,
 		&prefs.UserID,
 		&prefs.EmailEnabled,
@@ -201,10 +347,38 @@ func (r *NotificationSQL) GetNotificationPreferences(ctx context.Context, userID
 		&prefs.MinPriority,
 		&prefs.RecurringFailures,
 		&prefs.UpcomingRecurring,
+		&prefs.UpcomingRecurringDays,
+		&prefs.GoalMilestones,
+		&prefs.GoalDeadlineRisk,
+		&prefs.GoalReminders,
+		&prefs.GoalReminderDays,
+		&prefs.MinimumBalance,
+		&prefs.LowBalanceAlerts,
+		&prefs.LowBalanceDays,
+		&prefs.SpendingAnomalies,
+		&prefs.EmailDigest,
+		&prefs.DigestTime,
+		&prefs.DigestDay,
+		&prefs.Timezone,
+		&channels,
+		&prefs.QuietHoursStart,
+		&prefs.QuietHoursEnd,
 		&prefs.CreatedAt,
 		&prefs.UpdatedAt,
 	)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(channels, &prefs.Channels); err != nil {
+		return nil, errors.Wrap(err, "Failed to unmarshal notification channels", 500)
+	}
+	return prefs, nil
+}
+
+func (r *NotificationSQL) GetNotificationPreferences(ctx context.Context, userID string) (*model.NotificationPreferences, error) {
+	query := `SELECT ` + notificationPreferencesColumns + ` FROM notification_preferences WHERE user_id = $1`
 
+	prefs, err := scanNotificationPreferences(r.query().QueryRowContext(ctx, query, userID))
 	if err == sql.ErrNoRows {
 		// Return default preferences
 		return &model.NotificationPreferences{
@@ -214,6 +388,18 @@ func (r *NotificationSQL) GetNotificationPreferences(ctx context.Context, userID
 			MinPriority:       model.NotificationPriorityLow,
 			RecurringFailures: true,
 			UpcomingRecurring: true,
+			UpcomingRecurringDays: model.DefaultUpcomingRecurringDays,
+			GoalMilestones:    true,
+			GoalDeadlineRisk:  true,
+			GoalReminders:     true,
+			GoalReminderDays:  model.DefaultGoalReminderDays,
+			LowBalanceAlerts:  true,
+			LowBalanceDays:    model.DefaultLowBalanceDays,
+			EmailDigest:       model.DigestImmediate,
+			DigestTime:        model.DefaultDigestTime,
+			DigestDay:         model.DefaultDigestDay,
+			Timezone:          model.DefaultTimezone,
+			Channels:          map[model.NotificationType][]model.NotificationChannel{},
 		}, nil
 	}
 	if err != nil {
@@ -223,13 +409,56 @@ func (r *NotificationSQL) GetNotificationPreferences(ctx context.Context, userID
 	return prefs, nil
 }
 
+// GetDigestPreferences returns the preferences of users who get their email
+// notifications as a daily or weekly digest
+func (r *NotificationSQL) GetDigestPreferences(ctx context.Context) ([]*model.NotificationPreferences, error) {
+	query := `
+		SELECT ` + notificationPreferencesColumns + `
+		FROM notification_preferences
+		WHERE email_digest <> 'immediate'
+		AND (email_enabled = true OR jsonb_path_exists(channels, '$.*[*] ? (@ == "email")'))`
+
+	rows, err := r.query().QueryContext(ctx, query)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to get digest preferences", 500)
+	}
+	defer rows.Close()
+
+	var prefs []*model.NotificationPreferences
+	for rows.Next() {
+		p, err := scanNotificationPreferences(rows)
+		if err != nil {
+			return nil, errors.Wrap(err, "Failed to scan notification preferences", 500)
+		}
+		prefs = append(prefs, p)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "Failed to iterate notification preferences", 500)
+	}
+	return prefs, nil
+}
+
 func (r *NotificationSQL) UpdateNotificationPreferences(ctx context.Context, prefs *model.NotificationPreferences) error {
+	channels := prefs.Channels
+	if channels == nil {
+		channels = map[model.NotificationType][]model.NotificationChannel{}
+	}
+	channelData, err := json.Marshal(channels)
+	if err != nil {
+		return errors.Wrap(err, "Failed to marshal notification channels", 500)
+	}
+
 	query := `
 		INSERT INTO notification_preferences (
 			user_id, email_enabled, push_enabled, in_app_enabled,
-			min_priority, recurring_failures, upcoming_recurring
+			min_priority, recurring_failures, upcoming_recurring,
+			goal_milestones, goal_deadline_risk, goal_reminders, goal_reminder_days,
+			upcoming_recurring_days, minimum_balance, low_balance_alerts, low_balance_days,
+			email_digest, digest_time, digest_day, timezone,
+			channels, quiet_hours_start, quiet_hours_end, spending_anomalies
 		) VALUES (
-			$1, $2, $3, $4, $5, $6, $7
+			$1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19,
+			$20, NULLIF($21, ''), NULLIF($22, ''), $23
 		)
 		ON CONFLICT (user_id) DO UPDATE
 		SET
@@ -239,10 +468,26 @@ func (r *NotificationSQL) UpdateNotificationPreferences(ctx context.Context, pre
 			min_priority = $5,
 			recurring_failures = $6,
 			upcoming_recurring = $7,
+			goal_milestones = $8,
+			goal_deadline_risk = $9,
+			goal_reminders = $10,
+			goal_reminder_days = $11,
+			upcoming_recurring_days = $12,
+			minimum_balance = $13,
+			low_balance_alerts = $14,
+			low_balance_days = $15,
+			email_digest = $16,
+			digest_time = $17,
+			digest_day = $18,
+			timezone = $19,
+			channels = $20,
+			quiet_hours_start = NULLIF($21, ''),
+			quiet_hours_end = NULLIF($22, ''),
+			spending_anomalies = $23,
 			updated_at = CURRENT_TIMESTAMP
 		RETURNING id, created_at, updated_at`
 
-	err := r.query().QueryRowContext(
+	err = r.query().QueryRowContext(
 		ctx,
 		query,
 		prefs.UserID,
@@ -252,6 +497,22 @@ func (r *NotificationSQL) UpdateNotificationPreferences(ctx context.Context, pre
 		prefs.MinPriority,
 		prefs.RecurringFailures,
 		prefs.UpcomingRecurring,
+		prefs.GoalMilestones,
+		prefs.GoalDeadlineRisk,
+		prefs.GoalReminders,
+		prefs.GoalReminderDays,
+		prefs.UpcomingRecurringDays,
+		prefs.MinimumBalance,
+		prefs.LowBalanceAlerts,
+		prefs.LowBalanceDays,
+		prefs.EmailDigest,
+		prefs.DigestTime,
+		prefs.DigestDay,
+		prefs.Timezone,
+		channelData,
+		prefs.QuietHoursStart,
+		prefs.QuietHoursEnd,
+		prefs.SpendingAnomalies,
 	).Scan(&prefs.ID, &prefs.CreatedAt, &prefs.UpdatedAt)
 
 	if err != nil {
@@ -259,3 +520,130 @@ func (r *NotificationSQL) UpdateNotificationPreferences(ctx context.Context, pre
 	}
 	return nil
 }
+
+// ClaimLowBalanceAlert records that an alert is being sent for an account's
+// predicted low balance date. It returns false if one was already recorded.
+func (r *NotificationSQL) ClaimLowBalanceAlert(ctx context.Context, accountID string, date time.Time) (bool, error) {
+	query := `
+		INSERT INTO low_balance_alerts (account_id, predicted_date)
+		VALUES ($1, $2)
+		ON CONFLICT (account_id, predicted_date) DO NOTHING`
+
+	result, err := r.query().ExecContext(ctx, query, accountID, date)
+	if err != nil {
+		return false, errors.Wrap(err, "Failed to record low balance alert", 500)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, errors.Wrap(err, "Failed to get rows affected", 500)
+	}
+
+	return rowsAffected > 0, nil
+}
+
+// ReleaseLowBalanceAlert removes a claimed alert so it can be sent again
+func (r *NotificationSQL) ReleaseLowBalanceAlert(ctx context.Context, accountID string, date time.Time) error {
+	query := "DELETE FROM low_balance_alerts WHERE account_id = $1 AND predicted_date = $2"
+	if _, err := r.query().ExecContext(ctx, query, accountID, date); err != nil {
+		return errors.Wrap(err, "Failed to release low balance alert", 500)
+	}
+	return nil
+}
+
+// GetSpendingAnomalyUserIDs returns the users who want to be notified about
+// unusual spending
+func (r *NotificationSQL) GetSpendingAnomalyUserIDs(ctx context.Context) ([]string, error) {
+	rows, err := r.query().QueryContext(ctx, "SELECT user_id FROM notification_preferences WHERE spending_anomalies = true")
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to get spending anomaly users", 500)
+	}
+	defer rows.Close()
+
+	var userIDs []string
+	for rows.Next() {
+		var userID string
+		if err := rows.Scan(&userID); err != nil {
+			return nil, errors.Wrap(err, "Failed to scan user ID", 500)
+		}
+		userIDs = append(userIDs, userID)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "Failed to iterate spending anomaly users", 500)
+	}
+	return userIDs, nil
+}
+
+// ClaimSpendingAnomalyAlert records that the user is being notified about an
+// anomaly. It returns false if they already were.
+func (r *NotificationSQL) ClaimSpendingAnomalyAlert(ctx context.Context, userID, key string) (bool, error) {
+	query := `
+		INSERT INTO spending_anomaly_alerts (user_id, anomaly_key)
+		VALUES ($1, $2)
+		ON CONFLICT (user_id, anomaly_key) DO NOTHING`
+
+	result, err := r.query().ExecContext(ctx, query, userID, key)
+	if err != nil {
+		return false, errors.Wrap(err, "Failed to record spending anomaly alert", 500)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, errors.Wrap(err, "Failed to get rows affected", 500)
+	}
+
+	return rowsAffected > 0, nil
+}
+
+// ReleaseSpendingAnomalyAlert removes a claimed alert so it can be sent again
+func (r *NotificationSQL) ReleaseSpendingAnomalyAlert(ctx context.Context, userID, key string) error {
+	query := "DELETE FROM spending_anomaly_alerts WHERE user_id = $1 AND anomaly_key = $2"
+	if _, err := r.query().ExecContext(ctx, query, userID, key); err != nil {
+		return errors.Wrap(err, "Failed to release spending anomaly alert", 500)
+	}
+	return nil
+}
+
+// LastNotificationDigest returns when the user's last digest was sent, or nil
+// if none has been
+func (r *NotificationSQL) LastNotificationDigest(ctx context.Context, userID string) (*time.Time, error) {
+	var sentAt sql.NullTime
+	err := r.query().QueryRowContext(ctx, "SELECT MAX(sent_at) FROM notification_digests WHERE user_id = $1", userID).Scan(&sentAt)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to get last notification digest", 500)
+	}
+	if !sentAt.Valid {
+		return nil, nil
+	}
+	return &sentAt.Time, nil
+}
+
+// ClaimNotificationDigest records that the user's digest for a local date is
+// being sent. It returns false if one was already recorded.
+func (r *NotificationSQL) ClaimNotificationDigest(ctx context.Context, userID string, date time.Time) (bool, error) {
+	query := `
+		INSERT INTO notification_digests (user_id, digest_date)
+		VALUES ($1, $2)
+		ON CONFLICT (user_id, digest_date) DO NOTHING`
+
+	result, err := r.query().ExecContext(ctx, query, userID, date)
+	if err != nil {
+		return false, errors.Wrap(err, "Failed to record notification digest", 500)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, errors.Wrap(err, "Failed to get rows affected", 500)
+	}
+
+	return rowsAffected > 0, nil
+}
+
+// ReleaseNotificationDigest removes a claimed digest so it can be sent again
+func (r *NotificationSQL) ReleaseNotificationDigest(ctx context.Context, userID string, date time.Time) error {
+	query := "DELETE FROM notification_digests WHERE user_id = $1 AND digest_date = $2"
+	if _, err := r.query().ExecContext(ctx, query, userID, date); err != nil {
+		return errors.Wrap(err, "Failed to release notification digest", 500)
+	}
+	return nil
+}
@@ -5,6 +5,7 @@ import (
 	"database/sql"
 	"time"
 
+	"github.com/lib/pq"
 	"github.com/yeboahd24/personal-finance-manager/internal/errors"
 	"github.com/yeboahd24/personal-finance-manager/internal/model"
 )
@@ -16,7 +17,11 @@ type RecurringTransactionRepository interface {
 	UpdateRecurringTransaction(ctx context.Context, tx *model.RecurringTransaction) error
 	DeleteRecurringTransaction(ctx context.Context, id string) error
 	GetDueRecurringTransactions(ctx context.Context, before time.Time) ([]*model.RecurringTransaction, error)
+	ClaimDueRecurringTransaction(ctx context.Context, before time.Time, skip []string) (*model.RecurringTransaction, error)
 	UpdateLastRun(ctx context.Context, id string, lastRun, nextRun time.Time) error
+	UpdateNextRun(ctx context.Context, id string, nextRun time.Time) error
+	ClaimRecurringReminder(ctx context.Context, recurringID, occurrenceDate string) (bool, error)
+	ReleaseRecurringReminder(ctx context.Context, recurringID, occurrenceDate string) error
 }
 
 type RecurringTransactionSQL struct {
@@ -35,10 +40,12 @@ func (r *RecurringTransactionSQL) CreateRecurringTransaction(ctx context.Context
 	query := `
 		INSERT INTO recurring_transactions (
 			user_id, account_id, category_id, amount, description,
-			interval, day_of_month, day_of_week, start_date, end_date,
-			last_run, next_run, active
+			rrule, exdates, start_date, end_date,
+			last_run, next_run, active, backfill_policy,
+			overrides, paused_at, resume_at,
+			business_day_adjustment, holiday_calendar
 		) VALUES (
-			$1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13
+			$1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, NULLIF($18, '')
 		)
 		RETURNING id, created_at, updated_at`
 
@@ -50,14 +57,19 @@ func (r *RecurringTransactionSQL) CreateRecurringTransaction(ctx context.Context
 		tx.CategoryID,
 		tx.Amount,
 		tx.Description,
-		tx.Interval,
-		tx.DayOfMonth,
-		tx.DayOfWeek,
+		tx.RRule,
+		tx.ExDates,
 		tx.StartDate,
 		tx.EndDate,
 		tx.LastRun,
 		tx.NextRun,
 		tx.Active,
+		tx.BackfillPolicy,
+		tx.Overrides,
+		tx.PausedAt,
+		tx.ResumeAt,
+		tx.BusinessDayAdjustment,
+		tx.HolidayCalendar,
 	).Scan(&tx.ID, &tx.CreatedAt, &tx.UpdatedAt)
 
 	if err != nil {
@@ -71,8 +83,9 @@ func (r *RecurringTransactionSQL) GetRecurringTransactionByID(ctx context.Contex
 	query := `
 		SELECT 
 			rt.id, rt.user_id, rt.account_id, rt.category_id,
-			rt.amount, rt.description, rt.interval,
-			rt.day_of_month, rt.day_of_week,
+			rt.amount, rt.description, rt.rrule, rt.exdates, rt.backfill_policy,
+			rt.overrides, rt.paused_at, rt.resume_at,
+			rt.business_day_adjustment, COALESCE(rt.holiday_calendar, ''),
 			rt.start_date, rt.end_date, rt.last_run,
 			rt.next_run, rt.active, rt.created_at, rt.updated_at,
 			a.name as account_name, a.type as account_type,
@@ -91,9 +104,14 @@ func (r *RecurringTransactionSQL) GetRecurringTransactionByID(ctx context.Contex
 		&tx.CategoryID,
 		&tx.Amount,
 		&tx.Description,
-		&tx.Interval,
-		&tx.DayOfMonth,
-		&tx.DayOfWeek,
+		&tx.RRule,
+		&tx.ExDates,
+		&tx.BackfillPolicy,
+		&tx.Overrides,
+		&tx.PausedAt,
+		&tx.ResumeAt,
+		&tx.BusinessDayAdjustment,
+		&tx.HolidayCalendar,
 		&tx.StartDate,
 		&tx.EndDate,
 		&tx.LastRun,
@@ -123,8 +141,9 @@ func (r *RecurringTransactionSQL) GetRecurringTransactions(ctx context.Context,
 	query := `
 		SELECT 
 			rt.id, rt.user_id, rt.account_id, rt.category_id,
-			rt.amount, rt.description, rt.interval,
-			rt.day_of_month, rt.day_of_week,
+			rt.amount, rt.description, rt.rrule, rt.exdates, rt.backfill_policy,
+			rt.overrides, rt.paused_at, rt.resume_at,
+			rt.business_day_adjustment, COALESCE(rt.holiday_calendar, ''),
 			rt.start_date, rt.end_date, rt.last_run,
 			rt.next_run, rt.active, rt.created_at, rt.updated_at,
 			a.name as account_name, a.type as account_type,
@@ -164,9 +183,14 @@ func (r *RecurringTransactionSQL) GetRecurringTransactions(ctx context.Context,
 			&tx.CategoryID,
 			&tx.Amount,
 			&tx.Description,
-			&tx.Interval,
-			&tx.DayOfMonth,
-			&tx.DayOfWeek,
+			&tx.RRule,
+			&tx.ExDates,
+			&tx.BackfillPolicy,
+			&tx.Overrides,
+			&tx.PausedAt,
+			&tx.ResumeAt,
+			&tx.BusinessDayAdjustment,
+			&tx.HolidayCalendar,
 			&tx.StartDate,
 			&tx.EndDate,
 			&tx.LastRun,
@@ -198,12 +222,18 @@ func (r *RecurringTransactionSQL) UpdateRecurringTransaction(ctx context.Context
 			category_id = $3,
 			amount = $4,
 			description = $5,
-			interval = $6,
-			day_of_month = $7,
-			day_of_week = $8,
-			start_date = $9,
-			end_date = $10,
+			rrule = $6,
+			exdates = $7,
+			start_date = $8,
+			end_date = $9,
+			next_run = $10,
 			active = $11,
+			backfill_policy = $12,
+			overrides = $13,
+			paused_at = $14,
+			resume_at = $15,
+			business_day_adjustment = $16,
+			holiday_calendar = NULLIF($17, ''),
 			updated_at = CURRENT_TIMESTAMP
 		WHERE id = $1
 		RETURNING updated_at`
@@ -216,12 +246,18 @@ func (r *RecurringTransactionSQL) UpdateRecurringTransaction(ctx context.Context
 		tx.CategoryID,
 		tx.Amount,
 		tx.Description,
-		tx.Interval,
-		tx.DayOfMonth,
-		tx.DayOfWeek,
+		tx.RRule,
+		tx.ExDates,
 		tx.StartDate,
 		tx.EndDate,
+		tx.NextRun,
 		tx.Active,
+		tx.BackfillPolicy,
+		tx.Overrides,
+		tx.PausedAt,
+		tx.ResumeAt,
+		tx.BusinessDayAdjustment,
+		tx.HolidayCalendar,
 	).Scan(&tx.UpdatedAt)
 
 	if err == sql.ErrNoRows {
@@ -256,8 +292,9 @@ func (r *RecurringTransactionSQL) GetDueRecurringTransactions(ctx context.Contex
 	query := `
 		SELECT 
 			rt.id, rt.user_id, rt.account_id, rt.category_id,
-			rt.amount, rt.description, rt.interval,
-			rt.day_of_month, rt.day_of_week,
+			rt.amount, rt.description, rt.rrule, rt.exdates, rt.backfill_policy,
+			rt.overrides, rt.paused_at, rt.resume_at,
+			rt.business_day_adjustment, COALESCE(rt.holiday_calendar, ''),
 			rt.start_date, rt.end_date, rt.last_run,
 			rt.next_run, rt.active, rt.created_at, rt.updated_at,
 			a.name as account_name, a.type as account_type,
@@ -268,6 +305,7 @@ func (r *RecurringTransactionSQL) GetDueRecurringTransactions(ctx context.Contex
 		WHERE rt.active = true
 			AND rt.next_run <= $1
 			AND (rt.end_date IS NULL OR rt.next_run <= rt.end_date)
+			AND (rt.paused_at IS NULL OR rt.resume_at IS NOT NULL)
 		ORDER BY rt.next_run ASC`
 
 	rows, err := r.query().QueryContext(ctx, query, before)
@@ -289,9 +327,14 @@ func (r *RecurringTransactionSQL) GetDueRecurringTransactions(ctx context.Contex
 			&tx.CategoryID,
 			&tx.Amount,
 			&tx.Description,
-			&tx.Interval,
-			&tx.DayOfMonth,
-			&tx.DayOfWeek,
+			&tx.RRule,
+			&tx.ExDates,
+			&tx.BackfillPolicy,
+			&tx.Overrides,
+			&tx.PausedAt,
+			&tx.ResumeAt,
+			&tx.BusinessDayAdjustment,
+			&tx.HolidayCalendar,
 			&tx.StartDate,
 			&tx.EndDate,
 			&tx.LastRun,
@@ -316,15 +359,98 @@ func (r *RecurringTransactionSQL) GetDueRecurringTransactions(ctx context.Contex
 	return transactions, nil
 }
 
+// ClaimDueRecurringTransaction locks the next active recurring transaction
+// that is due, leaving out those in skip and any locked by another instance,
+// so replicas never process the same one at once. It returns nil when there
+// are none. The lock is held until the surrounding transaction ends.
+func (r *RecurringTransactionSQL) ClaimDueRecurringTransaction(ctx context.Context, before time.Time, skip []string) (*model.RecurringTransaction, error) {
+	query := `
+		SELECT 
+			rt.id, rt.user_id, rt.account_id, rt.category_id,
+			rt.amount, rt.description, rt.rrule, rt.exdates, rt.backfill_policy,
+			rt.overrides, rt.paused_at, rt.resume_at,
+			rt.business_day_adjustment, COALESCE(rt.holiday_calendar, ''),
+			rt.start_date, rt.end_date, rt.last_run,
+			rt.next_run, rt.active, rt.created_at, rt.updated_at,
+			a.name as account_name, a.type as account_type,
+			c.name as category_name, c.type as category_type
+		FROM recurring_transactions rt
+		LEFT JOIN accounts a ON rt.account_id = a.id
+		LEFT JOIN categories c ON rt.category_id = c.id
+		WHERE rt.active = true
+			AND rt.next_run <= $1
+			AND (rt.end_date IS NULL OR rt.next_run <= rt.end_date)
+			AND (rt.paused_at IS NULL OR rt.resume_at IS NOT NULL)
+			AND NOT (rt.id = ANY($2::uuid[]))
+		ORDER BY rt.next_run ASC
+		LIMIT 1
+		FOR UPDATE OF rt SKIP LOCKED`
+
+	if skip == nil {
+		skip = []string{}
+	}
+
+	tx := &model.RecurringTransaction{}
+	var account model.Account
+	var category model.Category
+
+	err := r.query().QueryRowContext(ctx, query, before, pq.Array(skip)).Scan(
+		&tx.ID,
+		&tx.UserID,
+		&tx.AccountID,
+		&tx.CategoryID,
+		&tx.Amount,
+		&tx.Description,
+		&tx.RRule,
+		&tx.ExDates,
+		&tx.BackfillPolicy,
+		&tx.Overrides,
+		&tx.PausedAt,
+		&tx.ResumeAt,
+		&tx.BusinessDayAdjustment,
+		&tx.HolidayCalendar,
+		&tx.StartDate,
+		&tx.EndDate,
+		&tx.LastRun,
+		&tx.NextRun,
+		&tx.Active,
+		&tx.CreatedAt,
+		&tx.UpdatedAt,
+		&account.Name,
+		&account.Type,
+		&category.Name,
+		&category.Type,
+	)
+
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to claim due recurring transaction", 500)
+	}
+
+	tx.Account = &account
+	tx.Category = &category
+	return tx, nil
+}
+
+// UpdateLastRun records a run. A zero next run means the schedule has ended,
+// so the recurring transaction is deactivated instead.
 func (r *RecurringTransactionSQL) UpdateLastRun(ctx context.Context, id string, lastRun, nextRun time.Time) error {
 	query := `
 		UPDATE recurring_transactions
 		SET last_run = $2,
-			next_run = $3,
+			next_run = COALESCE($3::timestamptz, next_run),
+			active = active AND $3::timestamptz IS NOT NULL,
 			updated_at = CURRENT_TIMESTAMP
 		WHERE id = $1`
 
-	result, err := r.query().ExecContext(ctx, query, id, lastRun, nextRun)
+	var next interface{} = nextRun
+	if nextRun.IsZero() {
+		next = nil
+	}
+
+	result, err := r.query().ExecContext(ctx, query, id, lastRun, next)
 	if err != nil {
 		return errors.Wrap(err, "Failed to update last run", 500)
 	}
@@ -340,3 +466,66 @@ func (r *RecurringTransactionSQL) UpdateLastRun(ctx context.Context, id string,
 
 	return nil
 }
+
+// UpdateNextRun moves a schedule past a run without recording it as run. A
+// zero next run deactivates the recurring transaction, as in UpdateLastRun.
+func (r *RecurringTransactionSQL) UpdateNextRun(ctx context.Context, id string, nextRun time.Time) error {
+	query := `
+		UPDATE recurring_transactions
+		SET next_run = COALESCE($2::timestamptz, next_run),
+			active = active AND $2::timestamptz IS NOT NULL,
+			updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1`
+
+	var next interface{} = nextRun
+	if nextRun.IsZero() {
+		next = nil
+	}
+
+	result, err := r.query().ExecContext(ctx, query, id, next)
+	if err != nil {
+		return errors.Wrap(err, "Failed to update next run", 500)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return errors.Wrap(err, "Failed to get rows affected", 500)
+	}
+
+	if rowsAffected == 0 {
+		return errors.ErrNotFound
+	}
+
+	return nil
+}
+
+// ClaimRecurringReminder records that a reminder is being sent for the
+// occurrence scheduled on occurrenceDate. It returns false if one was already
+// recorded.
+func (r *RecurringTransactionSQL) ClaimRecurringReminder(ctx context.Context, recurringID, occurrenceDate string) (bool, error) {
+	query := `
+		INSERT INTO recurring_reminders (recurring_id, occurrence_date)
+		VALUES ($1, $2)
+		ON CONFLICT (recurring_id, occurrence_date) DO NOTHING`
+
+	result, err := r.query().ExecContext(ctx, query, recurringID, occurrenceDate)
+	if err != nil {
+		return false, errors.Wrap(err, "Failed to record recurring reminder", 500)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, errors.Wrap(err, "Failed to get rows affected", 500)
+	}
+
+	return rowsAffected > 0, nil
+}
+
+// ReleaseRecurringReminder removes a claimed reminder so it can be sent again
+func (r *RecurringTransactionSQL) ReleaseRecurringReminder(ctx context.Context, recurringID, occurrenceDate string) error {
+	query := "DELETE FROM recurring_reminders WHERE recurring_id = $1 AND occurrence_date = $2"
+	if _, err := r.query().ExecContext(ctx, query, recurringID, occurrenceDate); err != nil {
+		return errors.Wrap(err, "Failed to release recurring reminder", 500)
+	}
+	return nil
+}
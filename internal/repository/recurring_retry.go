@@ -0,0 +1,212 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/yeboahd24/personal-finance-manager/internal/errors"
+	"github.com/yeboahd24/personal-finance-manager/internal/model"
+)
+
+type RecurringRetryRepository interface {
+	SaveRecurringRetry(ctx context.Context, retry *model.RecurringRetry) error
+	GetRecurringRetryByID(ctx context.Context, id string) (*model.RecurringRetry, error)
+	GetRecurringRetry(ctx context.Context, recurringID string, occurrence time.Time) (*model.RecurringRetry, error)
+	GetRecurringRetries(ctx context.Context, filter model.RecurringRetryFilter) ([]*model.RecurringRetry, error)
+	ClaimDueRecurringRetry(ctx context.Context, before time.Time, skip []string) (*model.RecurringRetry, error)
+	DeleteRecurringRetry(ctx context.Context, id string) error
+	CountRecurringRetries(ctx context.Context) (map[model.RecurringRetryStatus]int, error)
+}
+
+type RecurringRetrySQL struct {
+	db *sql.DB
+	tx *sql.Tx
+}
+
+func (r *RecurringRetrySQL) query() QueryExecutor {
+	if r.tx != nil {
+		return r.tx
+	}
+	return r.db
+}
+
+const recurringRetryColumns = `
+	id, recurring_id, user_id, occurrence, attempts, last_error,
+	status, next_attempt_at, created_at, updated_at`
+
+func scanRecurringRetry(row interface{ Scan(...interface{}) error }) (*model.RecurringRetry, error) {
+	retry := &model.RecurringRetry{}
+	err := row.Scan(
+		&retry.ID,
+		&retry.RecurringID,
+		&retry.UserID,
+		&retry.Occurrence,
+		&retry.Attempts,
+		&retry.LastError,
+		&retry.Status,
+		&retry.NextAttemptAt,
+		&retry.CreatedAt,
+		&retry.UpdatedAt,
+	)
+	return retry, err
+}
+
+// SaveRecurringRetry creates or updates the retry for an occurrence
+func (r *RecurringRetrySQL) SaveRecurringRetry(ctx context.Context, retry *model.RecurringRetry) error {
+	query := `
+		INSERT INTO recurring_retries (
+			recurring_id, user_id, occurrence, attempts, last_error, status, next_attempt_at
+		) VALUES ($1, $2, $3, $4, $5, $6, $7)
+		ON CONFLICT (recurring_id, occurrence) DO UPDATE
+		SET attempts = $4,
+			last_error = $5,
+			status = $6,
+			next_attempt_at = $7,
+			updated_at = CURRENT_TIMESTAMP
+		RETURNING id, created_at, updated_at`
+
+	err := r.query().QueryRowContext(
+		ctx,
+		query,
+		retry.RecurringID,
+		retry.UserID,
+		retry.Occurrence,
+		retry.Attempts,
+		retry.LastError,
+		retry.Status,
+		retry.NextAttemptAt,
+	).Scan(&retry.ID, &retry.CreatedAt, &retry.UpdatedAt)
+
+	if err != nil {
+		return errors.Wrap(err, "Failed to save recurring retry", 500)
+	}
+	return nil
+}
+
+func (r *RecurringRetrySQL) GetRecurringRetryByID(ctx context.Context, id string) (*model.RecurringRetry, error) {
+	query := `SELECT ` + recurringRetryColumns + ` FROM recurring_retries WHERE id = $1`
+
+	retry, err := scanRecurringRetry(r.query().QueryRowContext(ctx, query, id))
+	if err == sql.ErrNoRows {
+		return nil, errors.ErrNotFound
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to get recurring retry", 500)
+	}
+	return retry, nil
+}
+
+// GetRecurringRetry returns the retry for an occurrence, or nil if it has none
+func (r *RecurringRetrySQL) GetRecurringRetry(ctx context.Context, recurringID string, occurrence time.Time) (*model.RecurringRetry, error) {
+	query := `SELECT ` + recurringRetryColumns + ` FROM recurring_retries WHERE recurring_id = $1 AND occurrence = $2`
+
+	retry, err := scanRecurringRetry(r.query().QueryRowContext(ctx, query, recurringID, occurrence))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to get recurring retry", 500)
+	}
+	return retry, nil
+}
+
+func (r *RecurringRetrySQL) GetRecurringRetries(ctx context.Context, filter model.RecurringRetryFilter) ([]*model.RecurringRetry, error) {
+	query := `
+		SELECT ` + recurringRetryColumns + `
+		FROM recurring_retries
+		WHERE user_id = $1
+			AND (NULLIF($2, '') IS NULL OR status = $2)
+		ORDER BY occurrence DESC`
+
+	return r.list(ctx, query, filter.UserID, string(filter.Status))
+}
+
+// ClaimDueRecurringRetry locks the next pending retry that is due, leaving
+// out those in skip and any locked by another instance. It returns nil when
+// there are none. The lock is held until the surrounding transaction ends.
+func (r *RecurringRetrySQL) ClaimDueRecurringRetry(ctx context.Context, before time.Time, skip []string) (*model.RecurringRetry, error) {
+	query := `
+		SELECT ` + recurringRetryColumns + `
+		FROM recurring_retries
+		WHERE status = 'pending' AND next_attempt_at <= $1
+			AND NOT (id = ANY($2::uuid[]))
+		ORDER BY next_attempt_at ASC
+		LIMIT 1
+		FOR UPDATE SKIP LOCKED`
+
+	if skip == nil {
+		skip = []string{}
+	}
+
+	retry, err := scanRecurringRetry(r.query().QueryRowContext(ctx, query, before, pq.Array(skip)))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to claim recurring retry", 500)
+	}
+	return retry, nil
+}
+
+func (r *RecurringRetrySQL) list(ctx context.Context, query string, args ...interface{}) ([]*model.RecurringRetry, error) {
+	rows, err := r.query().QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to get recurring retries", 500)
+	}
+	defer rows.Close()
+
+	retries := []*model.RecurringRetry{}
+	for rows.Next() {
+		retry, err := scanRecurringRetry(rows)
+		if err != nil {
+			return nil, errors.Wrap(err, "Failed to scan recurring retry", 500)
+		}
+		retries = append(retries, retry)
+	}
+
+	return retries, rows.Err()
+}
+
+func (r *RecurringRetrySQL) DeleteRecurringRetry(ctx context.Context, id string) error {
+	query := "DELETE FROM recurring_retries WHERE id = $1"
+	result, err := r.query().ExecContext(ctx, query, id)
+	if err != nil {
+		return errors.Wrap(err, "Failed to delete recurring retry", 500)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return errors.Wrap(err, "Failed to get rows affected", 500)
+	}
+
+	if rowsAffected == 0 {
+		return errors.ErrNotFound
+	}
+
+	return nil
+}
+
+// CountRecurringRetries returns the number of retries in each status
+func (r *RecurringRetrySQL) CountRecurringRetries(ctx context.Context) (map[model.RecurringRetryStatus]int, error) {
+	query := "SELECT status, COUNT(*) FROM recurring_retries GROUP BY status"
+
+	rows, err := r.query().QueryContext(ctx, query)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to count recurring retries", 500)
+	}
+	defer rows.Close()
+
+	counts := make(map[model.RecurringRetryStatus]int)
+	for rows.Next() {
+		var status model.RecurringRetryStatus
+		var count int
+		if err := rows.Scan(&status, &count); err != nil {
+			return nil, errors.Wrap(err, "Failed to scan recurring retry count", 500)
+		}
+		counts[status] = count
+	}
+
+	return counts, rows.Err()
+}
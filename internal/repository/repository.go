@@ -5,19 +5,32 @@ import (
 	"database/sql"
 	"time"
 
+	"github.com/yeboahd24/personal-finance-manager/internal/errors"
 	"github.com/yeboahd24/personal-finance-manager/internal/model"
 )
 
 // Repository defines the interface for all repository operations
 type Repository interface {
+	// InTx runs fn with a repository bound to a database transaction
+	InTx(ctx context.Context, fn func(repo Repository) error) error
+
 	// User methods
 	CreateUser(ctx context.Context, user *model.User) error
 	GetUserByID(ctx context.Context, id string) (*model.User, error)
 	GetUserByEmail(ctx context.Context, email string) (*model.User, error)
 	GetUserByUsername(ctx context.Context, username string) (*model.User, error)
 	UpdateUser(ctx context.Context, user *model.User) error
+	UpdatePassword(ctx context.Context, userID, passwordHash string) error
+	SetEmailVerified(ctx context.Context, userID, email string) (bool, error)
 	DeleteUser(ctx context.Context, id string) error
 
+	// User token methods
+	CreateUserToken(ctx context.Context, token *model.UserToken) error
+	GetUserTokenByHash(ctx context.Context, purpose model.UserTokenPurpose, hash string) (*model.UserToken, error)
+	UseUserToken(ctx context.Context, id string, usedAt time.Time) (bool, error)
+	RevokeUserTokens(ctx context.Context, userID string, purpose model.UserTokenPurpose) error
+	CountUserTokensSince(ctx context.Context, userID string, purpose model.UserTokenPurpose, since time.Time) (int, error)
+
 	// Account methods
 	CreateAccount(ctx context.Context, account *model.Account) error
 	GetAccountByID(ctx context.Context, id string) (*model.Account, error)
@@ -38,6 +51,7 @@ type Repository interface {
 	GetTransactions(ctx context.Context, filter model.TransactionFilter) ([]*model.Transaction, error)
 	UpdateTransaction(ctx context.Context, transaction *model.Transaction) error
 	DeleteTransaction(ctx context.Context, id string) error
+	HasMerchantTransaction(ctx context.Context, userID, merchant, excludeID string) (bool, error)
 
 	// Budget methods
 	CreateBudget(ctx context.Context, budget *model.Budget) error
@@ -54,15 +68,41 @@ type Repository interface {
 	GetGoalsByUserID(ctx context.Context, userID string) ([]*model.Goal, error)
 	UpdateGoal(ctx context.Context, goal *model.Goal) error
 	DeleteGoal(ctx context.Context, id string, userID string) error
+	CreateGoalContribution(ctx context.Context, contribution *model.GoalContribution) error
+	GetGoalContributions(ctx context.Context, goalID string) ([]*model.GoalContribution, error)
+	DeleteGoalContribution(ctx context.Context, id string, goalID string) error
+	GetGoalAccounts(ctx context.Context, goalID string) ([]model.GoalAccount, error)
+	GetGoalAccountsChange(ctx context.Context, goalID string, from, to time.Time) (float64, error)
+	SetGoalAccounts(ctx context.Context, goalID string, accounts []model.GoalAccount) error
+	GetAllGoals(ctx context.Context) ([]*model.Goal, error)
+	GetGoalNotificationState(ctx context.Context, goalID string) (*model.GoalNotificationState, error)
+	ClaimGoalNotificationState(ctx context.Context, current, next *model.GoalNotificationState) (bool, error)
+	GetSinkingFundTransfer(ctx context.Context, goalID string) (*model.SinkingFundTransfer, error)
+	SaveSinkingFundTransfer(ctx context.Context, transfer *model.SinkingFundTransfer) error
 
 	// Notification methods
 	CreateNotification(ctx context.Context, notification *model.Notification) error
 	GetNotificationByID(ctx context.Context, id string) (*model.Notification, error)
-	GetUserNotifications(ctx context.Context, userID string, unreadOnly bool) ([]*model.Notification, error)
+	GetUserNotifications(ctx context.Context, userID string, unreadOnly, includeSnoozed bool) ([]*model.Notification, error)
 	MarkNotificationAsRead(ctx context.Context, userID string, notificationID string) error
 	DeleteNotification(ctx context.Context, id string) error
+	MarkNotificationsAsRead(ctx context.Context, userID string, ids []string, all bool) (int64, error)
+	DeleteNotifications(ctx context.Context, userID string, ids []string, all bool) (int64, error)
+	SnoozeNotification(ctx context.Context, userID, notificationID string, until *time.Time) error
+	ReleaseSnoozedNotifications(ctx context.Context, before time.Time) ([]*model.Notification, error)
+	CreateNotificationDelivery(ctx context.Context, delivery *model.NotificationDelivery) error
+	ClaimDueNotificationDeliveries(ctx context.Context, before time.Time, limit int) ([]*model.NotificationDelivery, error)
 	GetNotificationPreferences(ctx context.Context, userID string) (*model.NotificationPreferences, error)
 	UpdateNotificationPreferences(ctx context.Context, prefs *model.NotificationPreferences) error
+	ClaimLowBalanceAlert(ctx context.Context, accountID string, date time.Time) (bool, error)
+	ReleaseLowBalanceAlert(ctx context.Context, accountID string, date time.Time) error
+	GetSpendingAnomalyUserIDs(ctx context.Context) ([]string, error)
+	ClaimSpendingAnomalyAlert(ctx context.Context, userID, key string) (bool, error)
+	ReleaseSpendingAnomalyAlert(ctx context.Context, userID, key string) error
+	GetDigestPreferences(ctx context.Context) ([]*model.NotificationPreferences, error)
+	LastNotificationDigest(ctx context.Context, userID string) (*time.Time, error)
+	ClaimNotificationDigest(ctx context.Context, userID string, date time.Time) (bool, error)
+	ReleaseNotificationDigest(ctx context.Context, userID string, date time.Time) error
 
 	// Category methods
 	GetCategoryByID(ctx context.Context, id string) (*model.Category, error)
@@ -79,7 +119,92 @@ type Repository interface {
 	UpdateRecurringTransaction(ctx context.Context, transaction *model.RecurringTransaction) error
 	DeleteRecurringTransaction(ctx context.Context, id string) error
 	GetDueRecurringTransactions(ctx context.Context, before time.Time) ([]*model.RecurringTransaction, error)
+	ClaimDueRecurringTransaction(ctx context.Context, before time.Time, skip []string) (*model.RecurringTransaction, error)
 	UpdateLastRun(ctx context.Context, id string, lastRun, nextRun time.Time) error
+	ClaimRecurringReminder(ctx context.Context, recurringID, occurrenceDate string) (bool, error)
+	ReleaseRecurringReminder(ctx context.Context, recurringID, occurrenceDate string) error
+	UpdateNextRun(ctx context.Context, id string, nextRun time.Time) error
+
+	// Recurring retry methods
+	SaveRecurringRetry(ctx context.Context, retry *model.RecurringRetry) error
+	GetRecurringRetryByID(ctx context.Context, id string) (*model.RecurringRetry, error)
+	GetRecurringRetry(ctx context.Context, recurringID string, occurrence time.Time) (*model.RecurringRetry, error)
+	GetRecurringRetries(ctx context.Context, filter model.RecurringRetryFilter) ([]*model.RecurringRetry, error)
+	ClaimDueRecurringRetry(ctx context.Context, before time.Time, skip []string) (*model.RecurringRetry, error)
+	DeleteRecurringRetry(ctx context.Context, id string) error
+	CountRecurringRetries(ctx context.Context) (map[model.RecurringRetryStatus]int, error)
+
+	// Holiday calendar methods
+	CreateHolidayCalendar(ctx context.Context, calendar *model.HolidayCalendar) error
+	GetHolidayCalendarByID(ctx context.Context, id string) (*model.HolidayCalendar, error)
+	GetHolidayCalendars(ctx context.Context, userID string) ([]*model.HolidayCalendar, error)
+	UpdateHolidayCalendar(ctx context.Context, calendar *model.HolidayCalendar) error
+	DeleteHolidayCalendar(ctx context.Context, id string) error
+
+	// Event methods
+	CreateEvent(ctx context.Context, event *model.Event) error
+	GetEventByID(ctx context.Context, id int64) (*model.Event, error)
+	GetEventsAfter(ctx context.Context, userID string, afterID int64, limit int) ([]*model.Event, error)
+	DeleteEventsBefore(ctx context.Context, before time.Time) (int64, error)
+
+	// Transaction alert methods
+	CreateTransactionAlert(ctx context.Context, alert *model.TransactionAlert) error
+	GetTransactionAlertByID(ctx context.Context, id string) (*model.TransactionAlert, error)
+	GetTransactionAlerts(ctx context.Context, userID string, activeOnly bool) ([]*model.TransactionAlert, error)
+	UpdateTransactionAlert(ctx context.Context, alert *model.TransactionAlert) error
+	DeleteTransactionAlert(ctx context.Context, id string) error
+
+	// Session methods
+	CreateSession(ctx context.Context, session *model.Session) error
+	GetSessionByID(ctx context.Context, id string) (*model.Session, error)
+	GetSessions(ctx context.Context, userID string, activeOnly bool) ([]*model.Session, error)
+	TouchSession(ctx context.Context, session *model.Session) error
+	RevokeSession(ctx context.Context, userID, id string, reason model.SessionRevocation) error
+	RevokeUserSessions(ctx context.Context, userID, exceptID string, reason model.SessionRevocation) (int64, error)
+	DeleteStaleSessions(ctx context.Context, userID string, before time.Time) (int64, error)
+	CreateRefreshToken(ctx context.Context, token *model.RefreshToken) error
+	GetRefreshTokenByHash(ctx context.Context, hash string) (*model.RefreshToken, error)
+	MarkRefreshTokenUsed(ctx context.Context, id string, usedAt time.Time) error
+	DeleteExpiredRefreshTokens(ctx context.Context, sessionID string, before time.Time) (int64, error)
+
+	// Two-factor methods
+	GetTwoFactor(ctx context.Context, userID string) (*model.TwoFactor, error)
+	SaveTwoFactor(ctx context.Context, twoFactor *model.TwoFactor) error
+	EnableTwoFactor(ctx context.Context, userID string, step int64) error
+	UseTwoFactorStep(ctx context.Context, userID string, step int64) (bool, error)
+	DeleteTwoFactor(ctx context.Context, userID string) error
+	ReplaceRecoveryCodes(ctx context.Context, userID string, hashes []string) error
+	UseRecoveryCode(ctx context.Context, userID, hash string) (bool, error)
+	CountRecoveryCodes(ctx context.Context, userID string) (int, error)
+	CreateLoginChallenge(ctx context.Context, challenge *model.LoginChallenge) error
+	GetLoginChallengeByHash(ctx context.Context, hash string) (*model.LoginChallenge, error)
+	AttemptLoginChallenge(ctx context.Context, id string, maxAttempts int) (bool, error)
+	DeleteLoginChallenge(ctx context.Context, id string) (bool, error)
+	DeleteExpiredLoginChallenges(ctx context.Context, userID string, before time.Time) (int64, error)
+
+	// Email outbox methods
+	CreateEmail(ctx context.Context, email *model.Email) error
+	ClaimDueEmail(ctx context.Context, before time.Time, lease time.Duration) (*model.Email, error)
+	UpdateEmail(ctx context.Context, email *model.Email) error
+	DeleteEmailsBefore(ctx context.Context, before time.Time) (int64, error)
+
+	// Webhook methods
+	CreateWebhook(ctx context.Context, webhook *model.Webhook) error
+	GetWebhookByID(ctx context.Context, id string) (*model.Webhook, error)
+	GetWebhooks(ctx context.Context, userID string) ([]*model.Webhook, error)
+	GetSubscribedWebhooks(ctx context.Context, userID string, event model.WebhookEvent) ([]*model.Webhook, error)
+	UpdateWebhook(ctx context.Context, webhook *model.Webhook) error
+	UpdateWebhookSecret(ctx context.Context, id, secret string) error
+	DeleteWebhook(ctx context.Context, id string) error
+	CreateWebhookDelivery(ctx context.Context, delivery *model.WebhookDelivery) error
+	GetWebhookDeliveryByID(ctx context.Context, id string) (*model.WebhookDelivery, error)
+	GetWebhookDeliveries(ctx context.Context, webhookID string, limit int) ([]*model.WebhookDelivery, error)
+	ClaimDueWebhookDelivery(ctx context.Context, before time.Time, lease time.Duration) (*model.WebhookDelivery, error)
+	UpdateWebhookDelivery(ctx context.Context, delivery *model.WebhookDelivery) error
+
+	// Subscription methods
+	GetSubscriptionDecisions(ctx context.Context, userID string) ([]*model.SubscriptionDecision, error)
+	SaveSubscriptionDecision(ctx context.Context, decision *model.SubscriptionDecision) error
 
 	// Analytics methods
 	GetTotalIncome(ctx context.Context) (float64, error)
@@ -100,11 +225,14 @@ type Repository interface {
 	GetEmergencyFundBalanceByUser(ctx context.Context, userID string) (float64, error)
 	GetAverageMonthlyExpenses(ctx context.Context) (float64, error)
 	GetAverageMonthlyExpensesByUser(ctx context.Context, userID string) (float64, error)
+	GetCategorySpendingByPeriod(ctx context.Context, filter model.AnalyticsFilter, period model.AnomalyPeriod) ([]model.CategoryPeriodSpend, error)
+	GetCategoryDebits(ctx context.Context, filter model.AnalyticsFilter) ([]model.CategoryDebit, error)
 }
 
 // SQLRepository struct
 type SQLRepository struct {
 	db           *sql.DB
+	tx           *sql.Tx
 	user         *UserSQL
 	account      *AccountSQL
 	transaction  *TransactionSQL
@@ -115,6 +243,16 @@ type SQLRepository struct {
 	category     *CategorySQL
 	recurring    *RecurringTransactionSQL
 	recurringTx  *RecurringTransactionSQL
+	subscription *SubscriptionSQL
+	retry        *RecurringRetrySQL
+	holidays     *HolidayCalendarSQL
+	events       *EventSQL
+	webhooks     *WebhookSQL
+	emails       *EmailSQL
+	alerts       *TransactionAlertSQL
+	sessions     *SessionSQL
+	twoFactor    *TwoFactorSQL
+	userTokens   *UserTokenSQL
 }
 
 // NewRepository creates a new SQLRepository
@@ -131,6 +269,16 @@ func NewRepository(db *sql.DB) *SQLRepository {
 		category:     &CategorySQL{db: db},
 		recurring:    &RecurringTransactionSQL{db: db},
 		recurringTx:  &RecurringTransactionSQL{db: db},
+		subscription: &SubscriptionSQL{db: db},
+		retry:        &RecurringRetrySQL{db: db},
+		holidays:     &HolidayCalendarSQL{db: db},
+		events:       &EventSQL{db: db},
+		webhooks:     &WebhookSQL{db: db},
+		emails:       &EmailSQL{db: db},
+		alerts:       &TransactionAlertSQL{db: db},
+		sessions:     &SessionSQL{db: db},
+		twoFactor:    &TwoFactorSQL{db: db},
+		userTokens:   &UserTokenSQL{db: db},
 	}
 }
 
@@ -138,6 +286,7 @@ func NewRepository(db *sql.DB) *SQLRepository {
 func (r *SQLRepository) WithTx(tx *sql.Tx) *SQLRepository {
 	return &SQLRepository{
 		db:           r.db,
+		tx:           tx,
 		user:         &UserSQL{db: r.db, tx: tx},
 		account:      &AccountSQL{db: r.db, tx: tx},
 		transaction:  &TransactionSQL{db: r.db, tx: tx},
@@ -148,7 +297,41 @@ func (r *SQLRepository) WithTx(tx *sql.Tx) *SQLRepository {
 		category:     &CategorySQL{db: r.db, tx: tx},
 		recurring:    &RecurringTransactionSQL{db: r.db, tx: tx},
 		recurringTx:  &RecurringTransactionSQL{db: r.db, tx: tx},
+		subscription: &SubscriptionSQL{db: r.db, tx: tx},
+		retry:        &RecurringRetrySQL{db: r.db, tx: tx},
+		holidays:     &HolidayCalendarSQL{db: r.db, tx: tx},
+		events:       &EventSQL{db: r.db, tx: tx},
+		webhooks:     &WebhookSQL{db: r.db, tx: tx},
+		emails:       &EmailSQL{db: r.db, tx: tx},
+		alerts:       &TransactionAlertSQL{db: r.db, tx: tx},
+		sessions:     &SessionSQL{db: r.db, tx: tx},
+		twoFactor:    &TwoFactorSQL{db: r.db, tx: tx},
+		userTokens:   &UserTokenSQL{db: r.db, tx: tx},
+	}
+}
+
+// InTx runs fn with a repository bound to a new database transaction,
+// committing if fn succeeds and rolling back otherwise. A repository that
+// is already in a transaction runs fn in it.
+func (r *SQLRepository) InTx(ctx context.Context, fn func(repo Repository) error) error {
+	if r.tx != nil {
+		return fn(r)
+	}
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return errors.Wrap(err, "Failed to begin transaction", 500)
+	}
+	defer tx.Rollback()
+
+	if err := fn(r.WithTx(tx)); err != nil {
+		return err
 	}
+
+	if err := tx.Commit(); err != nil {
+		return errors.Wrap(err, "Failed to commit transaction", 500)
+	}
+	return nil
 }
 
 // User methods
@@ -172,10 +355,39 @@ func (r *SQLRepository) UpdateUser(ctx context.Context, user *model.User) error
 	return r.user.UpdateUser(ctx, user)
 }
 
+func (r *SQLRepository) UpdatePassword(ctx context.Context, userID, passwordHash string) error {
+	return r.user.UpdatePassword(ctx, userID, passwordHash)
+}
+
+func (r *SQLRepository) SetEmailVerified(ctx context.Context, userID, email string) (bool, error) {
+	return r.user.SetEmailVerified(ctx, userID, email)
+}
+
 func (r *SQLRepository) DeleteUser(ctx context.Context, id string) error {
 	return r.user.DeleteUser(ctx, id)
 }
 
+// User token methods
+func (r *SQLRepository) CreateUserToken(ctx context.Context, token *model.UserToken) error {
+	return r.userTokens.CreateUserToken(ctx, token)
+}
+
+func (r *SQLRepository) GetUserTokenByHash(ctx context.Context, purpose model.UserTokenPurpose, hash string) (*model.UserToken, error) {
+	return r.userTokens.GetUserTokenByHash(ctx, purpose, hash)
+}
+
+func (r *SQLRepository) UseUserToken(ctx context.Context, id string, usedAt time.Time) (bool, error) {
+	return r.userTokens.UseUserToken(ctx, id, usedAt)
+}
+
+func (r *SQLRepository) RevokeUserTokens(ctx context.Context, userID string, purpose model.UserTokenPurpose) error {
+	return r.userTokens.RevokeUserTokens(ctx, userID, purpose)
+}
+
+func (r *SQLRepository) CountUserTokensSince(ctx context.Context, userID string, purpose model.UserTokenPurpose, since time.Time) (int, error) {
+	return r.userTokens.CountUserTokensSince(ctx, userID, purpose, since)
+}
+
 // Account methods
 func (r *SQLRepository) CreateAccount(ctx context.Context, account *model.Account) error {
 	return r.account.CreateAccount(ctx, account)
@@ -273,6 +485,10 @@ func (r *SQLRepository) DeleteTransaction(ctx context.Context, id string) error
 	return r.transaction.DeleteTransaction(ctx, id)
 }
 
+func (r *SQLRepository) HasMerchantTransaction(ctx context.Context, userID, merchant, excludeID string) (bool, error) {
+	return r.transaction.HasMerchantTransaction(ctx, userID, merchant, excludeID)
+}
+
 // Budget methods
 func (r *SQLRepository) CreateBudget(ctx context.Context, budget *model.Budget) error {
 	return r.budget.CreateBudget(ctx, budget)
@@ -331,6 +547,50 @@ func (r *SQLRepository) DeleteGoal(ctx context.Context, id string, userID string
 	return r.goal.DeleteGoal(ctx, id, userID)
 }
 
+func (r *SQLRepository) CreateGoalContribution(ctx context.Context, contribution *model.GoalContribution) error {
+	return r.goal.CreateGoalContribution(ctx, contribution)
+}
+
+func (r *SQLRepository) GetGoalContributions(ctx context.Context, goalID string) ([]*model.GoalContribution, error) {
+	return r.goal.GetGoalContributions(ctx, goalID)
+}
+
+func (r *SQLRepository) DeleteGoalContribution(ctx context.Context, id string, goalID string) error {
+	return r.goal.DeleteGoalContribution(ctx, id, goalID)
+}
+
+func (r *SQLRepository) GetGoalAccounts(ctx context.Context, goalID string) ([]model.GoalAccount, error) {
+	return r.goal.GetGoalAccounts(ctx, goalID)
+}
+
+func (r *SQLRepository) GetGoalAccountsChange(ctx context.Context, goalID string, from, to time.Time) (float64, error) {
+	return r.goal.GetGoalAccountsChange(ctx, goalID, from, to)
+}
+
+func (r *SQLRepository) SetGoalAccounts(ctx context.Context, goalID string, accounts []model.GoalAccount) error {
+	return r.goal.SetGoalAccounts(ctx, goalID, accounts)
+}
+
+func (r *SQLRepository) GetAllGoals(ctx context.Context) ([]*model.Goal, error) {
+	return r.goal.GetAllGoals(ctx)
+}
+
+func (r *SQLRepository) GetGoalNotificationState(ctx context.Context, goalID string) (*model.GoalNotificationState, error) {
+	return r.goal.GetGoalNotificationState(ctx, goalID)
+}
+
+func (r *SQLRepository) ClaimGoalNotificationState(ctx context.Context, current, next *model.GoalNotificationState) (bool, error) {
+	return r.goal.ClaimGoalNotificationState(ctx, current, next)
+}
+
+func (r *SQLRepository) GetSinkingFundTransfer(ctx context.Context, goalID string) (*model.SinkingFundTransfer, error) {
+	return r.goal.GetSinkingFundTransfer(ctx, goalID)
+}
+
+func (r *SQLRepository) SaveSinkingFundTransfer(ctx context.Context, transfer *model.SinkingFundTransfer) error {
+	return r.goal.SaveSinkingFundTransfer(ctx, transfer)
+}
+
 // Notification methods
 func (r *SQLRepository) CreateNotification(ctx context.Context, notification *model.Notification) error {
 	return r.notification.CreateNotification(ctx, notification)
@@ -340,8 +600,8 @@ func (r *SQLRepository) GetNotificationByID(ctx context.Context, id string) (*mo
 	return r.notification.GetNotificationByID(ctx, id)
 }
 
-func (r *SQLRepository) GetUserNotifications(ctx context.Context, userID string, unreadOnly bool) ([]*model.Notification, error) {
-	return r.notification.GetUserNotifications(ctx, userID, unreadOnly)
+func (r *SQLRepository) GetUserNotifications(ctx context.Context, userID string, unreadOnly, includeSnoozed bool) ([]*model.Notification, error) {
+	return r.notification.GetUserNotifications(ctx, userID, unreadOnly, includeSnoozed)
 }
 
 func (r *SQLRepository) MarkNotificationAsRead(ctx context.Context, userID string, notificationID string) error {
@@ -352,6 +612,30 @@ func (r *SQLRepository) DeleteNotification(ctx context.Context, id string) error
 	return r.notification.DeleteNotification(ctx, id)
 }
 
+func (r *SQLRepository) MarkNotificationsAsRead(ctx context.Context, userID string, ids []string, all bool) (int64, error) {
+	return r.notification.MarkNotificationsAsRead(ctx, userID, ids, all)
+}
+
+func (r *SQLRepository) DeleteNotifications(ctx context.Context, userID string, ids []string, all bool) (int64, error) {
+	return r.notification.DeleteNotifications(ctx, userID, ids, all)
+}
+
+func (r *SQLRepository) SnoozeNotification(ctx context.Context, userID, notificationID string, until *time.Time) error {
+	return r.notification.SnoozeNotification(ctx, userID, notificationID, until)
+}
+
+func (r *SQLRepository) ReleaseSnoozedNotifications(ctx context.Context, before time.Time) ([]*model.Notification, error) {
+	return r.notification.ReleaseSnoozedNotifications(ctx, before)
+}
+
+func (r *SQLRepository) CreateNotificationDelivery(ctx context.Context, delivery *model.NotificationDelivery) error {
+	return r.notification.CreateNotificationDelivery(ctx, delivery)
+}
+
+func (r *SQLRepository) ClaimDueNotificationDeliveries(ctx context.Context, before time.Time, limit int) ([]*model.NotificationDelivery, error) {
+	return r.notification.ClaimDueNotificationDeliveries(ctx, before, limit)
+}
+
 func (r *SQLRepository) GetNotificationPreferences(ctx context.Context, userID string) (*model.NotificationPreferences, error) {
 	return r.notification.GetNotificationPreferences(ctx, userID)
 }
@@ -360,6 +644,42 @@ func (r *SQLRepository) UpdateNotificationPreferences(ctx context.Context, prefs
 	return r.notification.UpdateNotificationPreferences(ctx, prefs)
 }
 
+func (r *SQLRepository) ClaimLowBalanceAlert(ctx context.Context, accountID string, date time.Time) (bool, error) {
+	return r.notification.ClaimLowBalanceAlert(ctx, accountID, date)
+}
+
+func (r *SQLRepository) ReleaseLowBalanceAlert(ctx context.Context, accountID string, date time.Time) error {
+	return r.notification.ReleaseLowBalanceAlert(ctx, accountID, date)
+}
+
+func (r *SQLRepository) GetSpendingAnomalyUserIDs(ctx context.Context) ([]string, error) {
+	return r.notification.GetSpendingAnomalyUserIDs(ctx)
+}
+
+func (r *SQLRepository) ClaimSpendingAnomalyAlert(ctx context.Context, userID, key string) (bool, error) {
+	return r.notification.ClaimSpendingAnomalyAlert(ctx, userID, key)
+}
+
+func (r *SQLRepository) ReleaseSpendingAnomalyAlert(ctx context.Context, userID, key string) error {
+	return r.notification.ReleaseSpendingAnomalyAlert(ctx, userID, key)
+}
+
+func (r *SQLRepository) GetDigestPreferences(ctx context.Context) ([]*model.NotificationPreferences, error) {
+	return r.notification.GetDigestPreferences(ctx)
+}
+
+func (r *SQLRepository) LastNotificationDigest(ctx context.Context, userID string) (*time.Time, error) {
+	return r.notification.LastNotificationDigest(ctx, userID)
+}
+
+func (r *SQLRepository) ClaimNotificationDigest(ctx context.Context, userID string, date time.Time) (bool, error) {
+	return r.notification.ClaimNotificationDigest(ctx, userID, date)
+}
+
+func (r *SQLRepository) ReleaseNotificationDigest(ctx context.Context, userID string, date time.Time) error {
+	return r.notification.ReleaseNotificationDigest(ctx, userID, date)
+}
+
 // Category methods
 func (r *SQLRepository) GetCategoryByID(ctx context.Context, id string) (*model.Category, error) {
 	return r.category.GetCategoryByID(ctx, id)
@@ -410,10 +730,287 @@ func (r *SQLRepository) GetDueRecurringTransactions(ctx context.Context, before
 	return r.recurring.GetDueRecurringTransactions(ctx, before)
 }
 
+func (r *SQLRepository) ClaimDueRecurringTransaction(ctx context.Context, before time.Time, skip []string) (*model.RecurringTransaction, error) {
+	return r.recurring.ClaimDueRecurringTransaction(ctx, before, skip)
+}
+
 func (r *SQLRepository) UpdateLastRun(ctx context.Context, id string, lastRun, nextRun time.Time) error {
 	return r.recurring.UpdateLastRun(ctx, id, lastRun, nextRun)
 }
 
+func (r *SQLRepository) ClaimRecurringReminder(ctx context.Context, recurringID, occurrenceDate string) (bool, error) {
+	return r.recurring.ClaimRecurringReminder(ctx, recurringID, occurrenceDate)
+}
+
+func (r *SQLRepository) ReleaseRecurringReminder(ctx context.Context, recurringID, occurrenceDate string) error {
+	return r.recurring.ReleaseRecurringReminder(ctx, recurringID, occurrenceDate)
+}
+
+func (r *SQLRepository) UpdateNextRun(ctx context.Context, id string, nextRun time.Time) error {
+	return r.recurring.UpdateNextRun(ctx, id, nextRun)
+}
+
+// Recurring retry methods
+func (r *SQLRepository) SaveRecurringRetry(ctx context.Context, retry *model.RecurringRetry) error {
+	return r.retry.SaveRecurringRetry(ctx, retry)
+}
+
+func (r *SQLRepository) GetRecurringRetryByID(ctx context.Context, id string) (*model.RecurringRetry, error) {
+	return r.retry.GetRecurringRetryByID(ctx, id)
+}
+
+func (r *SQLRepository) GetRecurringRetry(ctx context.Context, recurringID string, occurrence time.Time) (*model.RecurringRetry, error) {
+	return r.retry.GetRecurringRetry(ctx, recurringID, occurrence)
+}
+
+func (r *SQLRepository) GetRecurringRetries(ctx context.Context, filter model.RecurringRetryFilter) ([]*model.RecurringRetry, error) {
+	return r.retry.GetRecurringRetries(ctx, filter)
+}
+
+func (r *SQLRepository) ClaimDueRecurringRetry(ctx context.Context, before time.Time, skip []string) (*model.RecurringRetry, error) {
+	return r.retry.ClaimDueRecurringRetry(ctx, before, skip)
+}
+
+func (r *SQLRepository) DeleteRecurringRetry(ctx context.Context, id string) error {
+	return r.retry.DeleteRecurringRetry(ctx, id)
+}
+
+func (r *SQLRepository) CountRecurringRetries(ctx context.Context) (map[model.RecurringRetryStatus]int, error) {
+	return r.retry.CountRecurringRetries(ctx)
+}
+
+// Holiday calendar methods
+func (r *SQLRepository) CreateHolidayCalendar(ctx context.Context, calendar *model.HolidayCalendar) error {
+	return r.holidays.CreateHolidayCalendar(ctx, calendar)
+}
+
+func (r *SQLRepository) GetHolidayCalendarByID(ctx context.Context, id string) (*model.HolidayCalendar, error) {
+	return r.holidays.GetHolidayCalendarByID(ctx, id)
+}
+
+func (r *SQLRepository) GetHolidayCalendars(ctx context.Context, userID string) ([]*model.HolidayCalendar, error) {
+	return r.holidays.GetHolidayCalendars(ctx, userID)
+}
+
+func (r *SQLRepository) UpdateHolidayCalendar(ctx context.Context, calendar *model.HolidayCalendar) error {
+	return r.holidays.UpdateHolidayCalendar(ctx, calendar)
+}
+
+func (r *SQLRepository) DeleteHolidayCalendar(ctx context.Context, id string) error {
+	return r.holidays.DeleteHolidayCalendar(ctx, id)
+}
+
+// Event methods
+func (r *SQLRepository) CreateEvent(ctx context.Context, event *model.Event) error {
+	return r.events.CreateEvent(ctx, event)
+}
+
+func (r *SQLRepository) GetEventByID(ctx context.Context, id int64) (*model.Event, error) {
+	return r.events.GetEventByID(ctx, id)
+}
+
+func (r *SQLRepository) GetEventsAfter(ctx context.Context, userID string, afterID int64, limit int) ([]*model.Event, error) {
+	return r.events.GetEventsAfter(ctx, userID, afterID, limit)
+}
+
+func (r *SQLRepository) DeleteEventsBefore(ctx context.Context, before time.Time) (int64, error) {
+	return r.events.DeleteEventsBefore(ctx, before)
+}
+
+// Transaction alert methods
+func (r *SQLRepository) CreateTransactionAlert(ctx context.Context, alert *model.TransactionAlert) error {
+	return r.alerts.CreateTransactionAlert(ctx, alert)
+}
+
+func (r *SQLRepository) GetTransactionAlertByID(ctx context.Context, id string) (*model.TransactionAlert, error) {
+	return r.alerts.GetTransactionAlertByID(ctx, id)
+}
+
+func (r *SQLRepository) GetTransactionAlerts(ctx context.Context, userID string, activeOnly bool) ([]*model.TransactionAlert, error) {
+	return r.alerts.GetTransactionAlerts(ctx, userID, activeOnly)
+}
+
+func (r *SQLRepository) UpdateTransactionAlert(ctx context.Context, alert *model.TransactionAlert) error {
+	return r.alerts.UpdateTransactionAlert(ctx, alert)
+}
+
+func (r *SQLRepository) DeleteTransactionAlert(ctx context.Context, id string) error {
+	return r.alerts.DeleteTransactionAlert(ctx, id)
+}
+
+// Session methods
+func (r *SQLRepository) CreateSession(ctx context.Context, session *model.Session) error {
+	return r.sessions.CreateSession(ctx, session)
+}
+
+func (r *SQLRepository) GetSessionByID(ctx context.Context, id string) (*model.Session, error) {
+	return r.sessions.GetSessionByID(ctx, id)
+}
+
+func (r *SQLRepository) GetSessions(ctx context.Context, userID string, activeOnly bool) ([]*model.Session, error) {
+	return r.sessions.GetSessions(ctx, userID, activeOnly)
+}
+
+func (r *SQLRepository) TouchSession(ctx context.Context, session *model.Session) error {
+	return r.sessions.TouchSession(ctx, session)
+}
+
+func (r *SQLRepository) RevokeSession(ctx context.Context, userID, id string, reason model.SessionRevocation) error {
+	return r.sessions.RevokeSession(ctx, userID, id, reason)
+}
+
+func (r *SQLRepository) RevokeUserSessions(ctx context.Context, userID, exceptID string, reason model.SessionRevocation) (int64, error) {
+	return r.sessions.RevokeUserSessions(ctx, userID, exceptID, reason)
+}
+
+func (r *SQLRepository) DeleteStaleSessions(ctx context.Context, userID string, before time.Time) (int64, error) {
+	return r.sessions.DeleteStaleSessions(ctx, userID, before)
+}
+
+func (r *SQLRepository) CreateRefreshToken(ctx context.Context, token *model.RefreshToken) error {
+	return r.sessions.CreateRefreshToken(ctx, token)
+}
+
+func (r *SQLRepository) GetRefreshTokenByHash(ctx context.Context, hash string) (*model.RefreshToken, error) {
+	return r.sessions.GetRefreshTokenByHash(ctx, hash)
+}
+
+func (r *SQLRepository) MarkRefreshTokenUsed(ctx context.Context, id string, usedAt time.Time) error {
+	return r.sessions.MarkRefreshTokenUsed(ctx, id, usedAt)
+}
+
+func (r *SQLRepository) DeleteExpiredRefreshTokens(ctx context.Context, sessionID string, before time.Time) (int64, error) {
+	return r.sessions.DeleteExpiredRefreshTokens(ctx, sessionID, before)
+}
+
+// Two-factor methods
+func (r *SQLRepository) GetTwoFactor(ctx context.Context, userID string) (*model.TwoFactor, error) {
+	return r.twoFactor.GetTwoFactor(ctx, userID)
+}
+
+func (r *SQLRepository) SaveTwoFactor(ctx context.Context, twoFactor *model.TwoFactor) error {
+	return r.twoFactor.SaveTwoFactor(ctx, twoFactor)
+}
+
+func (r *SQLRepository) EnableTwoFactor(ctx context.Context, userID string, step int64) error {
+	return r.twoFactor.EnableTwoFactor(ctx, userID, step)
+}
+
+func (r *SQLRepository) UseTwoFactorStep(ctx context.Context, userID string, step int64) (bool, error) {
+	return r.twoFactor.UseTwoFactorStep(ctx, userID, step)
+}
+
+func (r *SQLRepository) DeleteTwoFactor(ctx context.Context, userID string) error {
+	return r.twoFactor.DeleteTwoFactor(ctx, userID)
+}
+
+func (r *SQLRepository) ReplaceRecoveryCodes(ctx context.Context, userID string, hashes []string) error {
+	return r.twoFactor.ReplaceRecoveryCodes(ctx, userID, hashes)
+}
+
+func (r *SQLRepository) UseRecoveryCode(ctx context.Context, userID, hash string) (bool, error) {
+	return r.twoFactor.UseRecoveryCode(ctx, userID, hash)
+}
+
+func (r *SQLRepository) CountRecoveryCodes(ctx context.Context, userID string) (int, error) {
+	return r.twoFactor.CountRecoveryCodes(ctx, userID)
+}
+
+func (r *SQLRepository) CreateLoginChallenge(ctx context.Context, challenge *model.LoginChallenge) error {
+	return r.twoFactor.CreateLoginChallenge(ctx, challenge)
+}
+
+func (r *SQLRepository) GetLoginChallengeByHash(ctx context.Context, hash string) (*model.LoginChallenge, error) {
+	return r.twoFactor.GetLoginChallengeByHash(ctx, hash)
+}
+
+func (r *SQLRepository) AttemptLoginChallenge(ctx context.Context, id string, maxAttempts int) (bool, error) {
+	return r.twoFactor.AttemptLoginChallenge(ctx, id, maxAttempts)
+}
+
+func (r *SQLRepository) DeleteLoginChallenge(ctx context.Context, id string) (bool, error) {
+	return r.twoFactor.DeleteLoginChallenge(ctx, id)
+}
+
+func (r *SQLRepository) DeleteExpiredLoginChallenges(ctx context.Context, userID string, before time.Time) (int64, error) {
+	return r.twoFactor.DeleteExpiredLoginChallenges(ctx, userID, before)
+}
+
+// Email outbox methods
+func (r *SQLRepository) CreateEmail(ctx context.Context, email *model.Email) error {
+	return r.emails.CreateEmail(ctx, email)
+}
+
+func (r *SQLRepository) ClaimDueEmail(ctx context.Context, before time.Time, lease time.Duration) (*model.Email, error) {
+	return r.emails.ClaimDueEmail(ctx, before, lease)
+}
+
+func (r *SQLRepository) UpdateEmail(ctx context.Context, email *model.Email) error {
+	return r.emails.UpdateEmail(ctx, email)
+}
+
+func (r *SQLRepository) DeleteEmailsBefore(ctx context.Context, before time.Time) (int64, error) {
+	return r.emails.DeleteEmailsBefore(ctx, before)
+}
+
+// Webhook methods
+func (r *SQLRepository) CreateWebhook(ctx context.Context, webhook *model.Webhook) error {
+	return r.webhooks.CreateWebhook(ctx, webhook)
+}
+
+func (r *SQLRepository) GetWebhookByID(ctx context.Context, id string) (*model.Webhook, error) {
+	return r.webhooks.GetWebhookByID(ctx, id)
+}
+
+func (r *SQLRepository) GetWebhooks(ctx context.Context, userID string) ([]*model.Webhook, error) {
+	return r.webhooks.GetWebhooks(ctx, userID)
+}
+
+func (r *SQLRepository) GetSubscribedWebhooks(ctx context.Context, userID string, event model.WebhookEvent) ([]*model.Webhook, error) {
+	return r.webhooks.GetSubscribedWebhooks(ctx, userID, event)
+}
+
+func (r *SQLRepository) UpdateWebhook(ctx context.Context, webhook *model.Webhook) error {
+	return r.webhooks.UpdateWebhook(ctx, webhook)
+}
+
+func (r *SQLRepository) UpdateWebhookSecret(ctx context.Context, id, secret string) error {
+	return r.webhooks.UpdateWebhookSecret(ctx, id, secret)
+}
+
+func (r *SQLRepository) DeleteWebhook(ctx context.Context, id string) error {
+	return r.webhooks.DeleteWebhook(ctx, id)
+}
+
+func (r *SQLRepository) CreateWebhookDelivery(ctx context.Context, delivery *model.WebhookDelivery) error {
+	return r.webhooks.CreateWebhookDelivery(ctx, delivery)
+}
+
+func (r *SQLRepository) GetWebhookDeliveryByID(ctx context.Context, id string) (*model.WebhookDelivery, error) {
+	return r.webhooks.GetWebhookDeliveryByID(ctx, id)
+}
+
+func (r *SQLRepository) GetWebhookDeliveries(ctx context.Context, webhookID string, limit int) ([]*model.WebhookDelivery, error) {
+	return r.webhooks.GetWebhookDeliveries(ctx, webhookID, limit)
+}
+
+func (r *SQLRepository) ClaimDueWebhookDelivery(ctx context.Context, before time.Time, lease time.Duration) (*model.WebhookDelivery, error) {
+	return r.webhooks.ClaimDueWebhookDelivery(ctx, before, lease)
+}
+
+func (r *SQLRepository) UpdateWebhookDelivery(ctx context.Context, delivery *model.WebhookDelivery) error {
+	return r.webhooks.UpdateWebhookDelivery(ctx, delivery)
+}
+
+// Subscription methods
+func (r *SQLRepository) GetSubscriptionDecisions(ctx context.Context, userID string) ([]*model.SubscriptionDecision, error) {
+	return r.subscription.GetSubscriptionDecisions(ctx, userID)
+}
+
+func (r *SQLRepository) SaveSubscriptionDecision(ctx context.Context, decision *model.SubscriptionDecision) error {
+	return r.subscription.SaveSubscriptionDecision(ctx, decision)
+}
+
 // Analytics methods
 func (r *SQLRepository) GetTotalIncome(ctx context.Context) (float64, error) {
 	return r.analytics.GetTotalIncome(ctx)
@@ -486,3 +1083,11 @@ func (r *SQLRepository) GetAverageMonthlyExpenses(ctx context.Context) (float64,
 func (r *SQLRepository) GetAverageMonthlyExpensesByUser(ctx context.Context, userID string) (float64, error) {
 	return r.analytics.GetAverageMonthlyExpensesByUser(ctx, userID)
 }
+
+func (r *SQLRepository) GetCategorySpendingByPeriod(ctx context.Context, filter model.AnalyticsFilter, period model.AnomalyPeriod) ([]model.CategoryPeriodSpend, error) {
+	return r.analytics.GetCategorySpendingByPeriod(ctx, filter, period)
+}
+
+func (r *SQLRepository) GetCategoryDebits(ctx context.Context, filter model.AnalyticsFilter) ([]model.CategoryDebit, error) {
+	return r.analytics.GetCategoryDebits(ctx, filter)
+}
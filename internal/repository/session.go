@@ -0,0 +1,286 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/yeboahd24/personal-finance-manager/internal/errors"
+	"github.com/yeboahd24/personal-finance-manager/internal/model"
+)
+
+type SessionRepository interface {
+	CreateSession(ctx context.Context, session *model.Session) error
+	GetSessionByID(ctx context.Context, id string) (*model.Session, error)
+	GetSessions(ctx context.Context, userID string, activeOnly bool) ([]*model.Session, error)
+	TouchSession(ctx context.Context, session *model.Session) error
+	RevokeSession(ctx context.Context, userID, id string, reason model.SessionRevocation) error
+	RevokeUserSessions(ctx context.Context, userID, exceptID string, reason model.SessionRevocation) (int64, error)
+	DeleteStaleSessions(ctx context.Context, userID string, before time.Time) (int64, error)
+
+	CreateRefreshToken(ctx context.Context, token *model.RefreshToken) error
+	GetRefreshTokenByHash(ctx context.Context, hash string) (*model.RefreshToken, error)
+	MarkRefreshTokenUsed(ctx context.Context, id string, usedAt time.Time) error
+	DeleteExpiredRefreshTokens(ctx context.Context, sessionID string, before time.Time) (int64, error)
+}
+
+type SessionSQL struct {
+	db *sql.DB
+	tx *sql.Tx
+}
+
+func (r *SessionSQL) query() QueryExecutor {
+	if r.tx != nil {
+		return r.tx
+	}
+	return r.db
+}
+
+const sessionColumns = `
+	id, user_id, user_agent, ip_address, created_at, last_used_at, expires_at,
+	revoked_at, COALESCE(revoked_reason, '')`
+
+func scanSession(row interface{ Scan(...interface{}) error }) (*model.Session, error) {
+	session := &model.Session{}
+	var revokedAt sql.NullTime
+	err := row.Scan(
+		&session.ID,
+		&session.UserID,
+		&session.UserAgent,
+		&session.IPAddress,
+		&session.CreatedAt,
+		&session.LastUsedAt,
+		&session.ExpiresAt,
+		&revokedAt,
+		&session.RevokedReason,
+	)
+	if revokedAt.Valid {
+		session.RevokedAt = &revokedAt.Time
+	}
+	return session, err
+}
+
+func (r *SessionSQL) CreateSession(ctx context.Context, session *model.Session) error {
+	query := `
+		INSERT INTO sessions (user_id, user_agent, ip_address, expires_at)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id, created_at, last_used_at`
+
+	err := r.query().QueryRowContext(ctx, query,
+		session.UserID,
+		session.UserAgent,
+		session.IPAddress,
+		session.ExpiresAt,
+	).Scan(&session.ID, &session.CreatedAt, &session.LastUsedAt)
+	if err != nil {
+		return errors.Wrap(err, "Failed to create session", 500)
+	}
+	return nil
+}
+
+func (r *SessionSQL) GetSessionByID(ctx context.Context, id string) (*model.Session, error) {
+	query := `SELECT ` + sessionColumns + ` FROM sessions WHERE id = $1`
+
+	session, err := scanSession(r.query().QueryRowContext(ctx, query, id))
+	if err == sql.ErrNoRows {
+		return nil, errors.ErrNotFound
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to get session", 500)
+	}
+	return session, nil
+}
+
+// GetSessions returns the user's sessions, most recently used first
+func (r *SessionSQL) GetSessions(ctx context.Context, userID string, activeOnly bool) ([]*model.Session, error) {
+	query := `
+		SELECT ` + sessionColumns + `
+		FROM sessions
+		WHERE user_id = $1
+		AND (NOT $2 OR (revoked_at IS NULL AND expires_at > CURRENT_TIMESTAMP))
+		ORDER BY last_used_at DESC`
+
+	rows, err := r.query().QueryContext(ctx, query, userID, activeOnly)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to get sessions", 500)
+	}
+	defer rows.Close()
+
+	var sessions []*model.Session
+	for rows.Next() {
+		session, err := scanSession(rows)
+		if err != nil {
+			return nil, errors.Wrap(err, "Failed to scan session", 500)
+		}
+		sessions = append(sessions, session)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "Failed to iterate sessions", 500)
+	}
+	return sessions, nil
+}
+
+// TouchSession records a refresh: the device it came from, when, and the
+// session's new expiry
+func (r *SessionSQL) TouchSession(ctx context.Context, session *model.Session) error {
+	query := `
+		UPDATE sessions
+		SET user_agent = $2,
+			ip_address = $3,
+			expires_at = $4,
+			last_used_at = CURRENT_TIMESTAMP
+		WHERE id = $1
+		RETURNING last_used_at`
+
+	err := r.query().QueryRowContext(ctx, query,
+		session.ID,
+		session.UserAgent,
+		session.IPAddress,
+		session.ExpiresAt,
+	).Scan(&session.LastUsedAt)
+	if err == sql.ErrNoRows {
+		return errors.ErrNotFound
+	}
+	if err != nil {
+		return errors.Wrap(err, "Failed to update session", 500)
+	}
+	return nil
+}
+
+// RevokeSession ends one of the user's sessions. Revoking a session that has
+// already ended keeps its original reason.
+func (r *SessionSQL) RevokeSession(ctx context.Context, userID, id string, reason model.SessionRevocation) error {
+	query := `
+		UPDATE sessions
+		SET revoked_at = COALESCE(revoked_at, CURRENT_TIMESTAMP),
+			revoked_reason = COALESCE(revoked_reason, $3)
+		WHERE id = $1 AND user_id = $2`
+
+	result, err := r.query().ExecContext(ctx, query, id, userID, reason)
+	if err != nil {
+		return errors.Wrap(err, "Failed to revoke session", 500)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return errors.Wrap(err, "Failed to get rows affected", 500)
+	}
+	if rowsAffected == 0 {
+		return errors.ErrNotFound
+	}
+	return nil
+}
+
+// RevokeUserSessions ends every active session of the user except exceptID,
+// which may be empty, and returns how many there were
+func (r *SessionSQL) RevokeUserSessions(ctx context.Context, userID, exceptID string, reason model.SessionRevocation) (int64, error) {
+	query := `
+		UPDATE sessions
+		SET revoked_at = CURRENT_TIMESTAMP, revoked_reason = $2
+		WHERE user_id = $1 AND id::text <> $3
+		AND revoked_at IS NULL AND expires_at > CURRENT_TIMESTAMP`
+
+	result, err := r.query().ExecContext(ctx, query, userID, reason, exceptID)
+	if err != nil {
+		return 0, errors.Wrap(err, "Failed to revoke sessions", 500)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return 0, errors.Wrap(err, "Failed to get rows affected", 500)
+	}
+	return rowsAffected, nil
+}
+
+// DeleteStaleSessions deletes the user's sessions that expired or were
+// revoked before the given time, with their refresh tokens
+func (r *SessionSQL) DeleteStaleSessions(ctx context.Context, userID string, before time.Time) (int64, error) {
+	query := `
+		DELETE FROM sessions
+		WHERE user_id = $1 AND (expires_at < $2 OR revoked_at < $2)`
+
+	result, err := r.query().ExecContext(ctx, query, userID, before)
+	if err != nil {
+		return 0, errors.Wrap(err, "Failed to delete stale sessions", 500)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return 0, errors.Wrap(err, "Failed to get rows affected", 500)
+	}
+	return rowsAffected, nil
+}
+
+func (r *SessionSQL) CreateRefreshToken(ctx context.Context, token *model.RefreshToken) error {
+	query := `
+		INSERT INTO refresh_tokens (session_id, token_hash, expires_at)
+		VALUES ($1, $2, $3)
+		RETURNING id, created_at`
+
+	err := r.query().QueryRowContext(ctx, query,
+		token.SessionID,
+		token.TokenHash,
+		token.ExpiresAt,
+	).Scan(&token.ID, &token.CreatedAt)
+	if err != nil {
+		return errors.Wrap(err, "Failed to create refresh token", 500)
+	}
+	return nil
+}
+
+// GetRefreshTokenByHash looks up a refresh token and locks it until the end
+// of the transaction, so it can only be exchanged once
+func (r *SessionSQL) GetRefreshTokenByHash(ctx context.Context, hash string) (*model.RefreshToken, error) {
+	query := `
+		SELECT id, session_id, token_hash, created_at, expires_at, used_at
+		FROM refresh_tokens
+		WHERE token_hash = $1
+		FOR UPDATE`
+
+	token := &model.RefreshToken{}
+	var usedAt sql.NullTime
+	err := r.query().QueryRowContext(ctx, query, hash).Scan(
+		&token.ID,
+		&token.SessionID,
+		&token.TokenHash,
+		&token.CreatedAt,
+		&token.ExpiresAt,
+		&usedAt,
+	)
+	if err == sql.ErrNoRows {
+		return nil, errors.ErrNotFound
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to get refresh token", 500)
+	}
+	if usedAt.Valid {
+		token.UsedAt = &usedAt.Time
+	}
+	return token, nil
+}
+
+func (r *SessionSQL) MarkRefreshTokenUsed(ctx context.Context, id string, usedAt time.Time) error {
+	query := "UPDATE refresh_tokens SET used_at = $2 WHERE id = $1"
+	if _, err := r.query().ExecContext(ctx, query, id, usedAt); err != nil {
+		return errors.Wrap(err, "Failed to update refresh token", 500)
+	}
+	return nil
+}
+
+// DeleteExpiredRefreshTokens deletes a session's refresh tokens that expired
+// before the given time. Expired tokens are refused anyway, so they're no
+// longer needed to spot reuse.
+func (r *SessionSQL) DeleteExpiredRefreshTokens(ctx context.Context, sessionID string, before time.Time) (int64, error) {
+	query := "DELETE FROM refresh_tokens WHERE session_id = $1 AND expires_at < $2"
+
+	result, err := r.query().ExecContext(ctx, query, sessionID, before)
+	if err != nil {
+		return 0, errors.Wrap(err, "Failed to delete expired refresh tokens", 500)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return 0, errors.Wrap(err, "Failed to get rows affected", 500)
+	}
+	return rowsAffected, nil
+}
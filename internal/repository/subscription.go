@@ -0,0 +1,85 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/yeboahd24/personal-finance-manager/internal/errors"
+	"github.com/yeboahd24/personal-finance-manager/internal/model"
+)
+
+type SubscriptionRepository interface {
+	GetSubscriptionDecisions(ctx context.Context, userID string) ([]*model.SubscriptionDecision, error)
+	SaveSubscriptionDecision(ctx context.Context, decision *model.SubscriptionDecision) error
+}
+
+type SubscriptionSQL struct {
+	db *sql.DB
+	tx *sql.Tx
+}
+
+func (r *SubscriptionSQL) query() QueryExecutor {
+	if r.tx != nil {
+		return r.tx
+	}
+	return r.db
+}
+
+func (r *SubscriptionSQL) GetSubscriptionDecisions(ctx context.Context, userID string) ([]*model.SubscriptionDecision, error) {
+	query := `
+		SELECT user_id, subscription_id, status, recurring_transaction_id, created_at
+		FROM subscription_decisions
+		WHERE user_id = $1`
+
+	rows, err := r.query().QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to get subscription decisions", 500)
+	}
+	defer rows.Close()
+
+	var decisions []*model.SubscriptionDecision
+	for rows.Next() {
+		decision := &model.SubscriptionDecision{}
+		err := rows.Scan(
+			&decision.UserID,
+			&decision.SubscriptionID,
+			&decision.Status,
+			&decision.RecurringTransactionID,
+			&decision.CreatedAt,
+		)
+		if err != nil {
+			return nil, errors.Wrap(err, "Failed to scan subscription decision", 500)
+		}
+		decisions = append(decisions, decision)
+	}
+
+	return decisions, rows.Err()
+}
+
+func (r *SubscriptionSQL) SaveSubscriptionDecision(ctx context.Context, decision *model.SubscriptionDecision) error {
+	query := `
+		INSERT INTO subscription_decisions (
+			user_id, subscription_id, status, recurring_transaction_id
+		) VALUES (
+			$1, $2, $3, $4
+		)
+		ON CONFLICT (user_id, subscription_id) DO UPDATE
+		SET status = $3,
+			recurring_transaction_id = $4,
+			created_at = CURRENT_TIMESTAMP
+		RETURNING created_at`
+
+	err := r.query().QueryRowContext(
+		ctx,
+		query,
+		decision.UserID,
+		decision.SubscriptionID,
+		decision.Status,
+		decision.RecurringTransactionID,
+	).Scan(&decision.CreatedAt)
+
+	if err != nil {
+		return errors.Wrap(err, "Failed to save subscription decision", 500)
+	}
+	return nil
+}
@@ -17,6 +17,7 @@ type TransactionRepository interface {
 	GetTransactions(ctx context.Context, filter model.TransactionFilter) ([]*model.Transaction, error)
 	UpdateTransaction(ctx context.Context, tx *model.Transaction) error
 	DeleteTransaction(ctx context.Context, id string) error
+	HasMerchantTransaction(ctx context.Context, userID, merchant, excludeID string) (bool, error)
 	GetAccountsByUserID(ctx context.Context, userID string) ([]*model.Account, error)
 	GetCategoriesByUserID(ctx context.Context, userID string) ([]*model.Category, error)
 }
@@ -33,17 +34,27 @@ func (r *TransactionSQL) query() QueryExecutor {
 	return r.db
 }
 
+// CreateTransaction stores a transaction. A transaction for a recurring
+// occurrence that was already posted returns errors.ErrDuplicateResource.
 func (r *TransactionSQL) CreateTransaction(ctx context.Context, tx *model.Transaction) error {
 	query := `
 		INSERT INTO transactions (
 			user_id, account_id, category_id, amount, description, 
-			date, type, status
-		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+			date, type, status, recurring_id, occurrence_date,
+			merchant_name, currency
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, NULLIF($12, ''))
+		ON CONFLICT (recurring_id, occurrence_date) DO NOTHING
 		RETURNING id, created_at, updated_at`
 
 	log.Printf("Executing query: %s with values: user_id=%s, account_id=%s, category_id=%v, amount=%f, description=%s, date=%v, type=%s",
 		query, tx.UserID, tx.AccountID, tx.CategoryID, tx.Amount, tx.Description, tx.Date, tx.Type)
 
+	// The occurrence is keyed by its calendar date in the schedule's location
+	var occurrenceDate interface{}
+	if tx.OccurrenceDate != nil {
+		occurrenceDate = tx.OccurrenceDate.Format("2006-01-02")
+	}
+
 	err := r.query().QueryRowContext(
 		ctx,
 		query,
@@ -55,8 +66,15 @@ func (r *TransactionSQL) CreateTransaction(ctx context.Context, tx *model.Transa
 		tx.Date,
 		tx.Type,
 		"completed", // default status
+		tx.RecurringID,
+		occurrenceDate,
+		tx.MerchantName,
+		tx.Currency,
 	).Scan(&tx.ID, &tx.CreatedAt, &tx.UpdatedAt)
 
+	if err == sql.ErrNoRows {
+		return errors.ErrDuplicateResource
+	}
 	if err != nil {
 		log.Printf("Error executing transaction insert query: %+v", err)
 		return fmt.Errorf("failed to create transaction in database: %w", err)
@@ -267,6 +285,25 @@ func (r *TransactionSQL) DeleteTransaction(ctx context.Context, id string) error
 	return nil
 }
 
+// HasMerchantTransaction reports whether the user has a transaction other
+// than excludeID at merchant. Transactions without a merchant name are
+// matched on their description.
+func (r *TransactionSQL) HasMerchantTransaction(ctx context.Context, userID, merchant, excludeID string) (bool, error) {
+	query := `
+		SELECT EXISTS (
+			SELECT 1
+			FROM transactions
+			WHERE user_id = $1 AND id <> $2
+			AND lower(COALESCE(merchant_name, description)) = lower($3)
+		)`
+
+	var exists bool
+	if err := r.query().QueryRowContext(ctx, query, userID, excludeID, merchant).Scan(&exists); err != nil {
+		return false, errors.Wrap(err, "Failed to look up merchant transactions", 500)
+	}
+	return exists, nil
+}
+
 func (r *TransactionSQL) GetAccountsByUserID(ctx context.Context, userID string) ([]*model.Account, error) {
 	query := `
 		SELECT id, user_id, name, type, balance, currency, plaid_account_id, created_at, updated_at
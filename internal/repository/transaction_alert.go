@@ -0,0 +1,154 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/yeboahd24/personal-finance-manager/internal/errors"
+	"github.com/yeboahd24/personal-finance-manager/internal/model"
+)
+
+type TransactionAlertRepository interface {
+	CreateTransactionAlert(ctx context.Context, alert *model.TransactionAlert) error
+	GetTransactionAlertByID(ctx context.Context, id string) (*model.TransactionAlert, error)
+	GetTransactionAlerts(ctx context.Context, userID string, activeOnly bool) ([]*model.TransactionAlert, error)
+	UpdateTransactionAlert(ctx context.Context, alert *model.TransactionAlert) error
+	DeleteTransactionAlert(ctx context.Context, id string) error
+}
+
+type TransactionAlertSQL struct {
+	db *sql.DB
+	tx *sql.Tx
+}
+
+func (r *TransactionAlertSQL) query() QueryExecutor {
+	if r.tx != nil {
+		return r.tx
+	}
+	return r.db
+}
+
+const transactionAlertColumns = `id, user_id, type, min_amount, account_id, active, created_at, updated_at`
+
+func scanTransactionAlert(row interface{ Scan(...interface{}) error }) (*model.TransactionAlert, error) {
+	alert := &model.TransactionAlert{}
+	var accountID sql.NullString
+	err := row.Scan(
+		&alert.ID,
+		&alert.UserID,
+		&alert.Type,
+		&alert.MinAmount,
+		&accountID,
+		&alert.Active,
+		&alert.CreatedAt,
+		&alert.UpdatedAt,
+	)
+	if accountID.Valid {
+		alert.AccountID = &accountID.String
+	}
+	return alert, err
+}
+
+func (r *TransactionAlertSQL) CreateTransactionAlert(ctx context.Context, alert *model.TransactionAlert) error {
+	query := `
+		INSERT INTO transaction_alerts (user_id, type, min_amount, account_id, active)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, created_at, updated_at`
+
+	err := r.query().QueryRowContext(ctx, query,
+		alert.UserID,
+		alert.Type,
+		alert.MinAmount,
+		alert.AccountID,
+		alert.Active,
+	).Scan(&alert.ID, &alert.CreatedAt, &alert.UpdatedAt)
+	if err != nil {
+		return errors.Wrap(err, "Failed to create transaction alert", 500)
+	}
+	return nil
+}
+
+func (r *TransactionAlertSQL) GetTransactionAlertByID(ctx context.Context, id string) (*model.TransactionAlert, error) {
+	query := `SELECT ` + transactionAlertColumns + ` FROM transaction_alerts WHERE id = $1`
+
+	alert, err := scanTransactionAlert(r.query().QueryRowContext(ctx, query, id))
+	if err == sql.ErrNoRows {
+		return nil, errors.ErrNotFound
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to get transaction alert", 500)
+	}
+	return alert, nil
+}
+
+// GetTransactionAlerts returns the user's alerts, only the active ones when
+// activeOnly is set
+func (r *TransactionAlertSQL) GetTransactionAlerts(ctx context.Context, userID string, activeOnly bool) ([]*model.TransactionAlert, error) {
+	query := `
+		SELECT ` + transactionAlertColumns + `
+		FROM transaction_alerts
+		WHERE user_id = $1 AND ($2 = false OR active = true)
+		ORDER BY created_at`
+
+	rows, err := r.query().QueryContext(ctx, query, userID, activeOnly)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to get transaction alerts", 500)
+	}
+	defer rows.Close()
+
+	var alerts []*model.TransactionAlert
+	for rows.Next() {
+		alert, err := scanTransactionAlert(rows)
+		if err != nil {
+			return nil, errors.Wrap(err, "Failed to scan transaction alert", 500)
+		}
+		alerts = append(alerts, alert)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "Failed to iterate transaction alerts", 500)
+	}
+	return alerts, nil
+}
+
+func (r *TransactionAlertSQL) UpdateTransactionAlert(ctx context.Context, alert *model.TransactionAlert) error {
+	query := `
+		UPDATE transaction_alerts
+		SET type = $2,
+			min_amount = $3,
+			account_id = $4,
+			active = $5,
+			updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1
+		RETURNING updated_at`
+
+	err := r.query().QueryRowContext(ctx, query,
+		alert.ID,
+		alert.Type,
+		alert.MinAmount,
+		alert.AccountID,
+		alert.Active,
+	).Scan(&alert.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return errors.ErrNotFound
+	}
+	if err != nil {
+		return errors.Wrap(err, "Failed to update transaction alert", 500)
+	}
+	return nil
+}
+
+func (r *TransactionAlertSQL) DeleteTransactionAlert(ctx context.Context, id string) error {
+	result, err := r.query().ExecContext(ctx, "DELETE FROM transaction_alerts WHERE id = $1", id)
+	if err != nil {
+		return errors.Wrap(err, "Failed to delete transaction alert", 500)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return errors.Wrap(err, "Failed to get rows affected", 500)
+	}
+	if rowsAffected == 0 {
+		return errors.ErrNotFound
+	}
+	return nil
+}
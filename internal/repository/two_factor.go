@@ -0,0 +1,280 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/yeboahd24/personal-finance-manager/internal/errors"
+	"github.com/yeboahd24/personal-finance-manager/internal/model"
+)
+
+type TwoFactorRepository interface {
+	GetTwoFactor(ctx context.Context, userID string) (*model.TwoFactor, error)
+	SaveTwoFactor(ctx context.Context, twoFactor *model.TwoFactor) error
+	EnableTwoFactor(ctx context.Context, userID string, step int64) error
+	UseTwoFactorStep(ctx context.Context, userID string, step int64) (bool, error)
+	DeleteTwoFactor(ctx context.Context, userID string) error
+
+	ReplaceRecoveryCodes(ctx context.Context, userID string, hashes []string) error
+	UseRecoveryCode(ctx context.Context, userID, hash string) (bool, error)
+	CountRecoveryCodes(ctx context.Context, userID string) (int, error)
+
+	CreateLoginChallenge(ctx context.Context, challenge *model.LoginChallenge) error
+	GetLoginChallengeByHash(ctx context.Context, hash string) (*model.LoginChallenge, error)
+	AttemptLoginChallenge(ctx context.Context, id string, maxAttempts int) (bool, error)
+	DeleteLoginChallenge(ctx context.Context, id string) (bool, error)
+	DeleteExpiredLoginChallenges(ctx context.Context, userID string, before time.Time) (int64, error)
+}
+
+type TwoFactorSQL struct {
+	db *sql.DB
+	tx *sql.Tx
+}
+
+func (r *TwoFactorSQL) query() QueryExecutor {
+	if r.tx != nil {
+		return r.tx
+	}
+	return r.db
+}
+
+func (r *TwoFactorSQL) GetTwoFactor(ctx context.Context, userID string) (*model.TwoFactor, error) {
+	query := `
+		SELECT user_id, secret_encrypted, enabled_at, last_used_step, created_at
+		FROM two_factor
+		WHERE user_id = $1`
+
+	twoFactor := &model.TwoFactor{}
+	var enabledAt sql.NullTime
+	err := r.query().QueryRowContext(ctx, query, userID).Scan(
+		&twoFactor.UserID,
+		&twoFactor.SecretEncrypted,
+		&enabledAt,
+		&twoFactor.LastUsedStep,
+		&twoFactor.CreatedAt,
+	)
+	if err == sql.ErrNoRows {
+		return nil, errors.ErrNotFound
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to get two-factor settings", 500)
+	}
+	if enabledAt.Valid {
+		twoFactor.EnabledAt = &enabledAt.Time
+	}
+	return twoFactor, nil
+}
+
+// SaveTwoFactor stores a pending enrolment, replacing any earlier pending one.
+// An enabled enrolment is never replaced.
+func (r *TwoFactorSQL) SaveTwoFactor(ctx context.Context, twoFactor *model.TwoFactor) error {
+	query := `
+		INSERT INTO two_factor (user_id, secret_encrypted)
+		VALUES ($1, $2)
+		ON CONFLICT (user_id) DO UPDATE
+		SET secret_encrypted = EXCLUDED.secret_encrypted,
+			last_used_step = 0,
+			created_at = CURRENT_TIMESTAMP
+		WHERE two_factor.enabled_at IS NULL
+		RETURNING created_at`
+
+	err := r.query().QueryRowContext(ctx, query, twoFactor.UserID, twoFactor.SecretEncrypted).Scan(&twoFactor.CreatedAt)
+	if err == sql.ErrNoRows {
+		return errors.New("Two-factor authentication is already enabled", 409)
+	}
+	if err != nil {
+		return errors.Wrap(err, "Failed to save two-factor settings", 500)
+	}
+	return nil
+}
+
+// EnableTwoFactor confirms a pending enrolment, recording the step of the code
+// that confirmed it
+func (r *TwoFactorSQL) EnableTwoFactor(ctx context.Context, userID string, step int64) error {
+	query := `
+		UPDATE two_factor
+		SET enabled_at = CURRENT_TIMESTAMP, last_used_step = $2
+		WHERE user_id = $1 AND enabled_at IS NULL`
+
+	result, err := r.query().ExecContext(ctx, query, userID, step)
+	if err != nil {
+		return errors.Wrap(err, "Failed to enable two-factor authentication", 500)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return errors.Wrap(err, "Failed to get rows affected", 500)
+	}
+	if rowsAffected == 0 {
+		return errors.ErrNotFound
+	}
+	return nil
+}
+
+// UseTwoFactorStep records that a code for step was accepted. It returns false
+// if a code for this or a later step was already used, so each code works once.
+func (r *TwoFactorSQL) UseTwoFactorStep(ctx context.Context, userID string, step int64) (bool, error) {
+	query := `
+		UPDATE two_factor
+		SET last_used_step = $2
+		WHERE user_id = $1 AND last_used_step < $2`
+
+	result, err := r.query().ExecContext(ctx, query, userID, step)
+	if err != nil {
+		return false, errors.Wrap(err, "Failed to update two-factor settings", 500)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, errors.Wrap(err, "Failed to get rows affected", 500)
+	}
+	return rowsAffected == 1, nil
+}
+
+func (r *TwoFactorSQL) DeleteTwoFactor(ctx context.Context, userID string) error {
+	if _, err := r.query().ExecContext(ctx, "DELETE FROM two_factor WHERE user_id = $1", userID); err != nil {
+		return errors.Wrap(err, "Failed to delete two-factor settings", 500)
+	}
+	if _, err := r.query().ExecContext(ctx, "DELETE FROM recovery_codes WHERE user_id = $1", userID); err != nil {
+		return errors.Wrap(err, "Failed to delete recovery codes", 500)
+	}
+	return nil
+}
+
+// ReplaceRecoveryCodes swaps the user's recovery codes, used or not, for new
+// ones
+func (r *TwoFactorSQL) ReplaceRecoveryCodes(ctx context.Context, userID string, hashes []string) error {
+	if _, err := r.query().ExecContext(ctx, "DELETE FROM recovery_codes WHERE user_id = $1", userID); err != nil {
+		return errors.Wrap(err, "Failed to delete recovery codes", 500)
+	}
+
+	query := "INSERT INTO recovery_codes (user_id, code_hash) VALUES ($1, $2)"
+	for _, hash := range hashes {
+		if _, err := r.query().ExecContext(ctx, query, userID, hash); err != nil {
+			return errors.Wrap(err, "Failed to create recovery code", 500)
+		}
+	}
+	return nil
+}
+
+// UseRecoveryCode marks an unused recovery code as used, returning false if
+// the user has no such unused code
+func (r *TwoFactorSQL) UseRecoveryCode(ctx context.Context, userID, hash string) (bool, error) {
+	query := `
+		UPDATE recovery_codes
+		SET used_at = CURRENT_TIMESTAMP
+		WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL`
+
+	result, err := r.query().ExecContext(ctx, query, userID, hash)
+	if err != nil {
+		return false, errors.Wrap(err, "Failed to use recovery code", 500)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, errors.Wrap(err, "Failed to get rows affected", 500)
+	}
+	return rowsAffected == 1, nil
+}
+
+// CountRecoveryCodes returns how many unused recovery codes the user has
+func (r *TwoFactorSQL) CountRecoveryCodes(ctx context.Context, userID string) (int, error) {
+	var count int
+	query := "SELECT COUNT(*) FROM recovery_codes WHERE user_id = $1 AND used_at IS NULL"
+	if err := r.query().QueryRowContext(ctx, query, userID).Scan(&count); err != nil {
+		return 0, errors.Wrap(err, "Failed to count recovery codes", 500)
+	}
+	return count, nil
+}
+
+func (r *TwoFactorSQL) CreateLoginChallenge(ctx context.Context, challenge *model.LoginChallenge) error {
+	query := `
+		INSERT INTO login_challenges (user_id, token_hash, expires_at)
+		VALUES ($1, $2, $3)
+		RETURNING id, created_at`
+
+	err := r.query().QueryRowContext(ctx, query,
+		challenge.UserID,
+		challenge.TokenHash,
+		challenge.ExpiresAt,
+	).Scan(&challenge.ID, &challenge.CreatedAt)
+	if err != nil {
+		return errors.Wrap(err, "Failed to create login challenge", 500)
+	}
+	return nil
+}
+
+func (r *TwoFactorSQL) GetLoginChallengeByHash(ctx context.Context, hash string) (*model.LoginChallenge, error) {
+	query := `
+		SELECT id, user_id, token_hash, attempts, expires_at, created_at
+		FROM login_challenges
+		WHERE token_hash = $1`
+
+	challenge := &model.LoginChallenge{}
+	err := r.query().QueryRowContext(ctx, query, hash).Scan(
+		&challenge.ID,
+		&challenge.UserID,
+		&challenge.TokenHash,
+		&challenge.Attempts,
+		&challenge.ExpiresAt,
+		&challenge.CreatedAt,
+	)
+	if err == sql.ErrNoRows {
+		return nil, errors.ErrNotFound
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to get login challenge", 500)
+	}
+	return challenge, nil
+}
+
+// AttemptLoginChallenge counts an attempt at a challenge's code, returning
+// false once maxAttempts have been made
+func (r *TwoFactorSQL) AttemptLoginChallenge(ctx context.Context, id string, maxAttempts int) (bool, error) {
+	query := `
+		UPDATE login_challenges
+		SET attempts = attempts + 1
+		WHERE id = $1 AND attempts < $2`
+
+	result, err := r.query().ExecContext(ctx, query, id, maxAttempts)
+	if err != nil {
+		return false, errors.Wrap(err, "Failed to update login challenge", 500)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, errors.Wrap(err, "Failed to get rows affected", 500)
+	}
+	return rowsAffected == 1, nil
+}
+
+// DeleteLoginChallenge deletes a challenge, returning false if it was already
+// gone, so a challenge completes at most once
+func (r *TwoFactorSQL) DeleteLoginChallenge(ctx context.Context, id string) (bool, error) {
+	result, err := r.query().ExecContext(ctx, "DELETE FROM login_challenges WHERE id = $1", id)
+	if err != nil {
+		return false, errors.Wrap(err, "Failed to delete login challenge", 500)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, errors.Wrap(err, "Failed to get rows affected", 500)
+	}
+	return rowsAffected == 1, nil
+}
+
+func (r *TwoFactorSQL) DeleteExpiredLoginChallenges(ctx context.Context, userID string, before time.Time) (int64, error) {
+	query := "DELETE FROM login_challenges WHERE user_id = $1 AND expires_at < $2"
+
+	result, err := r.query().ExecContext(ctx, query, userID, before)
+	if err != nil {
+		return 0, errors.Wrap(err, "Failed to delete expired login challenges", 500)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return 0, errors.Wrap(err, "Failed to get rows affected", 500)
+	}
+	return rowsAffected, nil
+}
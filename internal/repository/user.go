@@ -13,6 +13,8 @@ type UserRepository interface {
 	GetUserByEmail(ctx context.Context, email string) (*model.User, error)
 	GetUserByUsername(ctx context.Context, username string) (*model.User, error)
 	UpdateUser(ctx context.Context, user *model.User) error
+	UpdatePassword(ctx context.Context, userID, passwordHash string) error
+	SetEmailVerified(ctx context.Context, userID, email string) (bool, error)
 	DeleteUser(ctx context.Context, id string) error
 	GetUserCount(ctx context.Context) (int64, error)
 }
@@ -49,7 +51,7 @@ func (r *UserSQL) CreateUser(ctx context.Context, user *model.User) error {
 func (r *UserSQL) GetUserByID(ctx context.Context, id string) (*model.User, error) {
 	user := &model.User{}
 	query := `
-		SELECT id, email, username, password_hash, first_name, last_name, created_at, updated_at
+		SELECT id, email, username, password_hash, first_name, last_name, created_at, updated_at, email_verified_at
 		FROM users
 		WHERE id = $1`
 	
@@ -62,6 +64,7 @@ func (r *UserSQL) GetUserByID(ctx context.Context, id string) (*model.User, erro
 		&user.LastName,
 		&user.CreatedAt,
 		&user.UpdatedAt,
+		&user.EmailVerifiedAt,
 	)
 	if err != nil {
 		return nil, err
@@ -72,7 +75,7 @@ func (r *UserSQL) GetUserByID(ctx context.Context, id string) (*model.User, erro
 func (r *UserSQL) GetUserByEmail(ctx context.Context, email string) (*model.User, error) {
 	user := &model.User{}
 	query := `
-		SELECT id, email, username, password_hash, first_name, last_name, created_at, updated_at
+		SELECT id, email, username, password_hash, first_name, last_name, created_at, updated_at, email_verified_at
 		FROM users
 		WHERE email = $1`
 	
@@ -85,6 +88,7 @@ func (r *UserSQL) GetUserByEmail(ctx context.Context, email string) (*model.User
 		&user.LastName,
 		&user.CreatedAt,
 		&user.UpdatedAt,
+		&user.EmailVerifiedAt,
 	)
 	if err != nil {
 		return nil, err
@@ -95,7 +99,7 @@ func (r *UserSQL) GetUserByEmail(ctx context.Context, email string) (*model.User
 func (r *UserSQL) GetUserByUsername(ctx context.Context, username string) (*model.User, error) {
 	user := &model.User{}
 	query := `
-		SELECT id, email, username, password_hash, first_name, last_name, created_at, updated_at
+		SELECT id, email, username, password_hash, first_name, last_name, created_at, updated_at, email_verified_at
 		FROM users
 		WHERE username = $1`
 	
@@ -108,6 +112,7 @@ func (r *UserSQL) GetUserByUsername(ctx context.Context, username string) (*mode
 		&user.LastName,
 		&user.CreatedAt,
 		&user.UpdatedAt,
+		&user.EmailVerifiedAt,
 	)
 	if err != nil {
 		return nil, err
@@ -131,6 +136,37 @@ func (r *UserSQL) UpdateUser(ctx context.Context, user *model.User) error {
 	).Scan(&user.UpdatedAt)
 }
 
+// UpdatePassword replaces the user's password hash
+func (r *UserSQL) UpdatePassword(ctx context.Context, userID, passwordHash string) error {
+	query := `
+		UPDATE users
+		SET password_hash = $2, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1`
+
+	_, err := r.query().ExecContext(ctx, query, userID, passwordHash)
+	return err
+}
+
+// SetEmailVerified marks the user's email verified if it is still email,
+// returning false if it has changed since the verification email was sent
+func (r *UserSQL) SetEmailVerified(ctx context.Context, userID, email string) (bool, error) {
+	query := `
+		UPDATE users
+		SET email_verified_at = COALESCE(email_verified_at, CURRENT_TIMESTAMP)
+		WHERE id = $1 AND email = $2`
+
+	result, err := r.query().ExecContext(ctx, query, userID, email)
+	if err != nil {
+		return false, err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return rowsAffected == 1, nil
+}
+
 func (r *UserSQL) DeleteUser(ctx context.Context, id string) error {
 	query := `DELETE FROM users WHERE id = $1`
 	result, err := r.query().ExecContext(ctx, query, id)
@@ -0,0 +1,124 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/yeboahd24/personal-finance-manager/internal/errors"
+	"github.com/yeboahd24/personal-finance-manager/internal/model"
+)
+
+type UserTokenRepository interface {
+	CreateUserToken(ctx context.Context, token *model.UserToken) error
+	GetUserTokenByHash(ctx context.Context, purpose model.UserTokenPurpose, hash string) (*model.UserToken, error)
+	UseUserToken(ctx context.Context, id string, usedAt time.Time) (bool, error)
+	RevokeUserTokens(ctx context.Context, userID string, purpose model.UserTokenPurpose) error
+	CountUserTokensSince(ctx context.Context, userID string, purpose model.UserTokenPurpose, since time.Time) (int, error)
+}
+
+type UserTokenSQL struct {
+	db *sql.DB
+	tx *sql.Tx
+}
+
+func (r *UserTokenSQL) query() QueryExecutor {
+	if r.tx != nil {
+		return r.tx
+	}
+	return r.db
+}
+
+func (r *UserTokenSQL) CreateUserToken(ctx context.Context, token *model.UserToken) error {
+	query := `
+		INSERT INTO user_tokens (user_id, purpose, token_hash, email, expires_at)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, created_at`
+
+	err := r.query().QueryRowContext(ctx, query,
+		token.UserID,
+		token.Purpose,
+		token.TokenHash,
+		token.Email,
+		token.ExpiresAt,
+	).Scan(&token.ID, &token.CreatedAt)
+	if err != nil {
+		return errors.Wrap(err, "Failed to create token", 500)
+	}
+	return nil
+}
+
+func (r *UserTokenSQL) GetUserTokenByHash(ctx context.Context, purpose model.UserTokenPurpose, hash string) (*model.UserToken, error) {
+	query := `
+		SELECT id, user_id, purpose, token_hash, email, expires_at, used_at, created_at
+		FROM user_tokens
+		WHERE purpose = $1 AND token_hash = $2`
+
+	token := &model.UserToken{}
+	var usedAt sql.NullTime
+	err := r.query().QueryRowContext(ctx, query, purpose, hash).Scan(
+		&token.ID,
+		&token.UserID,
+		&token.Purpose,
+		&token.TokenHash,
+		&token.Email,
+		&token.ExpiresAt,
+		&usedAt,
+		&token.CreatedAt,
+	)
+	if err == sql.ErrNoRows {
+		return nil, errors.ErrNotFound
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to get token", 500)
+	}
+	if usedAt.Valid {
+		token.UsedAt = &usedAt.Time
+	}
+	return token, nil
+}
+
+// UseUserToken marks a token used, returning false if it was already used or
+// has expired, so each token works once
+func (r *UserTokenSQL) UseUserToken(ctx context.Context, id string, usedAt time.Time) (bool, error) {
+	query := `
+		UPDATE user_tokens
+		SET used_at = $2
+		WHERE id = $1 AND used_at IS NULL AND expires_at > $2`
+
+	result, err := r.query().ExecContext(ctx, query, id, usedAt)
+	if err != nil {
+		return false, errors.Wrap(err, "Failed to use token", 500)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, errors.Wrap(err, "Failed to get rows affected", 500)
+	}
+	return rowsAffected == 1, nil
+}
+
+// RevokeUserTokens expires the user's unused tokens for purpose, so only the
+// latest one sent works
+func (r *UserTokenSQL) RevokeUserTokens(ctx context.Context, userID string, purpose model.UserTokenPurpose) error {
+	query := `
+		UPDATE user_tokens
+		SET expires_at = CURRENT_TIMESTAMP
+		WHERE user_id = $1 AND purpose = $2 AND used_at IS NULL AND expires_at > CURRENT_TIMESTAMP`
+
+	if _, err := r.query().ExecContext(ctx, query, userID, purpose); err != nil {
+		return errors.Wrap(err, "Failed to revoke tokens", 500)
+	}
+	return nil
+}
+
+// CountUserTokensSince returns how many tokens for purpose the user was sent
+// since the given time
+func (r *UserTokenSQL) CountUserTokensSince(ctx context.Context, userID string, purpose model.UserTokenPurpose, since time.Time) (int, error) {
+	var count int
+	query := "SELECT COUNT(*) FROM user_tokens WHERE user_id = $1 AND purpose = $2 AND created_at > $3"
+	if err := r.query().QueryRowContext(ctx, query, userID, purpose, since).Scan(&count); err != nil {
+		return 0, errors.Wrap(err, "Failed to count tokens", 500)
+	}
+	return count, nil
+}
@@ -0,0 +1,375 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/yeboahd24/personal-finance-manager/internal/errors"
+	"github.com/yeboahd24/personal-finance-manager/internal/model"
+)
+
+type WebhookRepository interface {
+	CreateWebhook(ctx context.Context, webhook *model.Webhook) error
+	GetWebhookByID(ctx context.Context, id string) (*model.Webhook, error)
+	GetWebhooks(ctx context.Context, userID string) ([]*model.Webhook, error)
+	GetSubscribedWebhooks(ctx context.Context, userID string, event model.WebhookEvent) ([]*model.Webhook, error)
+	UpdateWebhook(ctx context.Context, webhook *model.Webhook) error
+	UpdateWebhookSecret(ctx context.Context, id, secret string) error
+	DeleteWebhook(ctx context.Context, id string) error
+
+	CreateWebhookDelivery(ctx context.Context, delivery *model.WebhookDelivery) error
+	GetWebhookDeliveryByID(ctx context.Context, id string) (*model.WebhookDelivery, error)
+	GetWebhookDeliveries(ctx context.Context, webhookID string, limit int) ([]*model.WebhookDelivery, error)
+	ClaimDueWebhookDelivery(ctx context.Context, before time.Time, lease time.Duration) (*model.WebhookDelivery, error)
+	UpdateWebhookDelivery(ctx context.Context, delivery *model.WebhookDelivery) error
+}
+
+type WebhookSQL struct {
+	db *sql.DB
+	tx *sql.Tx
+}
+
+func (r *WebhookSQL) query() QueryExecutor {
+	if r.tx != nil {
+		return r.tx
+	}
+	return r.db
+}
+
+const webhookColumns = `id, user_id, url, description, secret, events, active, created_at, updated_at`
+
+func scanWebhook(row interface{ Scan(...interface{}) error }) (*model.Webhook, error) {
+	webhook := &model.Webhook{}
+	var description sql.NullString
+	var events []string
+	err := row.Scan(
+		&webhook.ID,
+		&webhook.UserID,
+		&webhook.URL,
+		&description,
+		&webhook.Secret,
+		pq.Array(&events),
+		&webhook.Active,
+		&webhook.CreatedAt,
+		&webhook.UpdatedAt,
+	)
+	webhook.Description = description.String
+	webhook.Events = make([]model.WebhookEvent, len(events))
+	for i, e := range events {
+		webhook.Events[i] = model.WebhookEvent(e)
+	}
+	return webhook, err
+}
+
+func webhookEventArray(events []model.WebhookEvent) interface{} {
+	values := make([]string, len(events))
+	for i, e := range events {
+		values[i] = string(e)
+	}
+	return pq.Array(values)
+}
+
+func (r *WebhookSQL) CreateWebhook(ctx context.Context, webhook *model.Webhook) error {
+	query := `
+		INSERT INTO webhooks (user_id, url, description, secret, events, active)
+		VALUES ($1, $2, NULLIF($3, ''), $4, $5, $6)
+		RETURNING id, created_at, updated_at`
+
+	err := r.query().QueryRowContext(ctx, query,
+		webhook.UserID,
+		webhook.URL,
+		webhook.Description,
+		webhook.Secret,
+		webhookEventArray(webhook.Events),
+		webhook.Active,
+	).Scan(&webhook.ID, &webhook.CreatedAt, &webhook.UpdatedAt)
+	if err != nil {
+		return errors.Wrap(err, "Failed to create webhook", 500)
+	}
+	return nil
+}
+
+func (r *WebhookSQL) GetWebhookByID(ctx context.Context, id string) (*model.Webhook, error) {
+	query := `SELECT ` + webhookColumns + ` FROM webhooks WHERE id = $1`
+
+	webhook, err := scanWebhook(r.query().QueryRowContext(ctx, query, id))
+	if err == sql.ErrNoRows {
+		return nil, errors.ErrNotFound
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to get webhook", 500)
+	}
+	return webhook, nil
+}
+
+func (r *WebhookSQL) GetWebhooks(ctx context.Context, userID string) ([]*model.Webhook, error) {
+	query := `SELECT ` + webhookColumns + ` FROM webhooks WHERE user_id = $1 ORDER BY created_at`
+	return r.list(ctx, query, userID)
+}
+
+// GetSubscribedWebhooks returns the user's active webhooks that receive event
+func (r *WebhookSQL) GetSubscribedWebhooks(ctx context.Context, userID string, event model.WebhookEvent) ([]*model.Webhook, error) {
+	query := `
+		SELECT ` + webhookColumns + `
+		FROM webhooks
+		WHERE user_id = $1 AND active = true AND $2 = ANY(events)`
+	return r.list(ctx, query, userID, string(event))
+}
+
+func (r *WebhookSQL) list(ctx context.Context, query string, args ...interface{}) ([]*model.Webhook, error) {
+	rows, err := r.query().QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to get webhooks", 500)
+	}
+	defer rows.Close()
+
+	var webhooks []*model.Webhook
+	for rows.Next() {
+		webhook, err := scanWebhook(rows)
+		if err != nil {
+			return nil, errors.Wrap(err, "Failed to scan webhook", 500)
+		}
+		webhooks = append(webhooks, webhook)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "Failed to iterate webhooks", 500)
+	}
+	return webhooks, nil
+}
+
+// UpdateWebhook saves a webhook's URL, description, events and active flag.
+// The secret only changes through UpdateWebhookSecret.
+func (r *WebhookSQL) UpdateWebhook(ctx context.Context, webhook *model.Webhook) error {
+	query := `
+		UPDATE webhooks
+		SET url = $2,
+			description = NULLIF($3, ''),
+			events = $4,
+			active = $5,
+			updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1
+		RETURNING updated_at`
+
+	err := r.query().QueryRowContext(ctx, query,
+		webhook.ID,
+		webhook.URL,
+		webhook.Description,
+		webhookEventArray(webhook.Events),
+		webhook.Active,
+	).Scan(&webhook.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return errors.ErrNotFound
+	}
+	if err != nil {
+		return errors.Wrap(err, "Failed to update webhook", 500)
+	}
+	return nil
+}
+
+func (r *WebhookSQL) UpdateWebhookSecret(ctx context.Context, id, secret string) error {
+	query := `UPDATE webhooks SET secret = $2, updated_at = CURRENT_TIMESTAMP WHERE id = $1`
+
+	result, err := r.query().ExecContext(ctx, query, id, secret)
+	if err != nil {
+		return errors.Wrap(err, "Failed to update webhook secret", 500)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return errors.Wrap(err, "Failed to get rows affected", 500)
+	}
+	if rowsAffected == 0 {
+		return errors.ErrNotFound
+	}
+	return nil
+}
+
+func (r *WebhookSQL) DeleteWebhook(ctx context.Context, id string) error {
+	result, err := r.query().ExecContext(ctx, "DELETE FROM webhooks WHERE id = $1", id)
+	if err != nil {
+		return errors.Wrap(err, "Failed to delete webhook", 500)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return errors.Wrap(err, "Failed to get rows affected", 500)
+	}
+	if rowsAffected == 0 {
+		return errors.ErrNotFound
+	}
+	return nil
+}
+
+const webhookDeliveryColumns = `id, webhook_id, user_id, event, payload, status, attempts, next_attempt_at,
+	response_code, latency_ms, last_error, replay_of, delivered_at, created_at, updated_at`
+
+func scanWebhookDelivery(row interface{ Scan(...interface{}) error }) (*model.WebhookDelivery, error) {
+	delivery := &model.WebhookDelivery{}
+	var payload []byte
+	var responseCode, latency sql.NullInt64
+	var lastError, replayOf sql.NullString
+	var deliveredAt sql.NullTime
+	err := row.Scan(
+		&delivery.ID,
+		&delivery.WebhookID,
+		&delivery.UserID,
+		&delivery.Event,
+		&payload,
+		&delivery.Status,
+		&delivery.Attempts,
+		&delivery.NextAttemptAt,
+		&responseCode,
+		&latency,
+		&lastError,
+		&replayOf,
+		&deliveredAt,
+		&delivery.CreatedAt,
+		&delivery.UpdatedAt,
+	)
+	delivery.Payload = payload
+	if responseCode.Valid {
+		code := int(responseCode.Int64)
+		delivery.ResponseCode = &code
+	}
+	if latency.Valid {
+		ms := int(latency.Int64)
+		delivery.LatencyMS = &ms
+	}
+	delivery.LastError = lastError.String
+	if replayOf.Valid {
+		delivery.ReplayOf = &replayOf.String
+	}
+	if deliveredAt.Valid {
+		delivery.DeliveredAt = &deliveredAt.Time
+	}
+	return delivery, err
+}
+
+// CreateWebhookDelivery queues a delivery to be sent at its NextAttemptAt
+func (r *WebhookSQL) CreateWebhookDelivery(ctx context.Context, delivery *model.WebhookDelivery) error {
+	query := `
+		INSERT INTO webhook_deliveries (webhook_id, user_id, event, payload, status, next_attempt_at, replay_of)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING id, created_at, updated_at`
+
+	err := r.query().QueryRowContext(ctx, query,
+		delivery.WebhookID,
+		delivery.UserID,
+		delivery.Event,
+		[]byte(delivery.Payload),
+		delivery.Status,
+		delivery.NextAttemptAt,
+		delivery.ReplayOf,
+	).Scan(&delivery.ID, &delivery.CreatedAt, &delivery.UpdatedAt)
+	if err != nil {
+		return errors.Wrap(err, "Failed to create webhook delivery", 500)
+	}
+	return nil
+}
+
+func (r *WebhookSQL) GetWebhookDeliveryByID(ctx context.Context, id string) (*model.WebhookDelivery, error) {
+	query := `SELECT ` + webhookDeliveryColumns + ` FROM webhook_deliveries WHERE id = $1`
+
+	delivery, err := scanWebhookDelivery(r.query().QueryRowContext(ctx, query, id))
+	if err == sql.ErrNoRows {
+		return nil, errors.ErrNotFound
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to get webhook delivery", 500)
+	}
+	return delivery, nil
+}
+
+// GetWebhookDeliveries returns up to limit of a webhook's deliveries, newest
+// first
+func (r *WebhookSQL) GetWebhookDeliveries(ctx context.Context, webhookID string, limit int) ([]*model.WebhookDelivery, error) {
+	query := `
+		SELECT ` + webhookDeliveryColumns + `
+		FROM webhook_deliveries
+		WHERE webhook_id = $1
+		ORDER BY created_at DESC
+		LIMIT $2`
+
+	rows, err := r.query().QueryContext(ctx, query, webhookID, limit)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to get webhook deliveries", 500)
+	}
+	defer rows.Close()
+
+	var deliveries []*model.WebhookDelivery
+	for rows.Next() {
+		delivery, err := scanWebhookDelivery(rows)
+		if err != nil {
+			return nil, errors.Wrap(err, "Failed to scan webhook delivery", 500)
+		}
+		deliveries = append(deliveries, delivery)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "Failed to iterate webhook deliveries", 500)
+	}
+	return deliveries, nil
+}
+
+// ClaimDueWebhookDelivery takes the oldest pending delivery due by before and
+// pushes its next attempt back by lease, so no other worker sends it while
+// this one does. A worker that dies mid-send leaves it to be retried once the
+// lease runs out. It returns nil when nothing is due.
+func (r *WebhookSQL) ClaimDueWebhookDelivery(ctx context.Context, before time.Time, lease time.Duration) (*model.WebhookDelivery, error) {
+	query := `
+		UPDATE webhook_deliveries
+		SET next_attempt_at = $2
+		WHERE id = (
+			SELECT id
+			FROM webhook_deliveries
+			WHERE status = 'pending' AND next_attempt_at <= $1
+			ORDER BY next_attempt_at ASC
+			LIMIT 1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING ` + webhookDeliveryColumns
+
+	delivery, err := scanWebhookDelivery(r.query().QueryRowContext(ctx, query, before, before.Add(lease)))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to claim webhook delivery", 500)
+	}
+	return delivery, nil
+}
+
+// UpdateWebhookDelivery records the outcome of a delivery attempt
+func (r *WebhookSQL) UpdateWebhookDelivery(ctx context.Context, delivery *model.WebhookDelivery) error {
+	query := `
+		UPDATE webhook_deliveries
+		SET status = $2,
+			attempts = $3,
+			next_attempt_at = $4,
+			response_code = $5,
+			latency_ms = $6,
+			last_error = NULLIF($7, ''),
+			delivered_at = $8,
+			updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1
+		RETURNING updated_at`
+
+	err := r.query().QueryRowContext(ctx, query,
+		delivery.ID,
+		delivery.Status,
+		delivery.Attempts,
+		delivery.NextAttemptAt,
+		delivery.ResponseCode,
+		delivery.LatencyMS,
+		delivery.LastError,
+		delivery.DeliveredAt,
+	).Scan(&delivery.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return errors.ErrNotFound
+	}
+	if err != nil {
+		return errors.Wrap(err, "Failed to update webhook delivery", 500)
+	}
+	return nil
+}
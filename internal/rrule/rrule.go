@@ -0,0 +1,283 @@
+// Package rrule parses and expands RFC 5545 recurrence rules.
+//
+// The DAILY, WEEKLY, MONTHLY and YEARLY frequencies are supported together
+// with the INTERVAL, COUNT, UNTIL, BYMONTH, BYMONTHDAY, BYDAY, BYSETPOS and
+// WKST parts, which covers schedules such as "every 2 weeks on Friday"
+// (FREQ=WEEKLY;INTERVAL=2;BYDAY=FR), "the 1st and 15th"
+// (FREQ=MONTHLY;BYMONTHDAY=1,15) or "the last business day of the month"
+// (FREQ=MONTHLY;BYDAY=MO,TU,WE,TH,FR;BYSETPOS=-1).
+package rrule
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type Frequency string
+
+const (
+	Daily   Frequency = "DAILY"
+	Weekly  Frequency = "WEEKLY"
+	Monthly Frequency = "MONTHLY"
+	Yearly  Frequency = "YEARLY"
+)
+
+// Weekday is a BYDAY entry. N selects the Nth occurrence of the day within
+// the month or year (negative counts from the end); 0 means every occurrence.
+type Weekday struct {
+	Day time.Weekday
+	N   int
+}
+
+// Rule is a parsed RRULE
+type Rule struct {
+	Freq       Frequency
+	Interval   int
+	Count      int
+	Until      *time.Time
+	ByMonth    []int
+	ByMonthDay []int
+	ByDay      []Weekday
+	BySetPos   []int
+	WeekStart  time.Weekday
+}
+
+var weekdayNames = [...]string{"SU", "MO", "TU", "WE", "TH", "FR", "SA"}
+
+const (
+	dateTimeFormat    = "20060102T150405Z"
+	localTimeFormat   = "20060102T150405"
+	dateOnlyFormat    = "20060102"
+	rrulePrefix       = "RRULE:"
+	maxAbsMonthDay    = 31
+	maxAbsSetPosition = 366
+)
+
+// Parse parses an RRULE value such as "FREQ=MONTHLY;BYMONTHDAY=1,15". A
+// leading "RRULE:" property name is accepted.
+func Parse(s string) (*Rule, error) {
+	s = strings.TrimSpace(s)
+	if len(s) >= len(rrulePrefix) && strings.EqualFold(s[:len(rrulePrefix)], rrulePrefix) {
+		s = s[len(rrulePrefix):]
+	}
+	if s == "" {
+		return nil, fmt.Errorf("empty rule")
+	}
+
+	r := &Rule{Interval: 1, WeekStart: time.Monday}
+	seen := make(map[string]bool)
+	for _, part := range strings.Split(s, ";") {
+		key, value, ok := strings.Cut(part, "=")
+		if !ok || value == "" {
+			return nil, fmt.Errorf("invalid rule part %q", part)
+		}
+		key = strings.ToUpper(strings.TrimSpace(key))
+		value = strings.ToUpper(strings.TrimSpace(value))
+		if seen[key] {
+			return nil, fmt.Errorf("%s given more than once", key)
+		}
+		seen[key] = true
+
+		var err error
+		switch key {
+		case "FREQ":
+			r.Freq = Frequency(value)
+		case "INTERVAL":
+			r.Interval, err = parsePositive(value)
+		case "COUNT":
+			r.Count, err = parsePositive(value)
+		case "UNTIL":
+			var until time.Time
+			until, err = parseUntil(value)
+			r.Until = &until
+		case "BYMONTH":
+			r.ByMonth, err = parseIntList(value, 1, 12, false)
+		case "BYMONTHDAY":
+			r.ByMonthDay, err = parseIntList(value, 1, maxAbsMonthDay, true)
+		case "BYDAY":
+			r.ByDay, err = parseWeekdayList(value)
+		case "BYSETPOS":
+			r.BySetPos, err = parseIntList(value, 1, maxAbsSetPosition, true)
+		case "WKST":
+			r.WeekStart, err = parseWeekday(value)
+		default:
+			return nil, fmt.Errorf("unsupported rule part %s", key)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s: %v", key, err)
+		}
+	}
+
+	if err := r.Validate(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Validate checks the rule's parts are consistent with each other
+func (r *Rule) Validate() error {
+	switch r.Freq {
+	case Daily, Weekly, Monthly, Yearly:
+	case "":
+		return fmt.Errorf("FREQ is required")
+	default:
+		return fmt.Errorf("unsupported frequency %s", r.Freq)
+	}
+
+	if r.Interval < 1 {
+		return fmt.Errorf("INTERVAL must be positive")
+	}
+	if r.Count > 0 && r.Until != nil {
+		return fmt.Errorf("COUNT and UNTIL cannot both be set")
+	}
+	if r.Freq == Weekly && len(r.ByMonthDay) > 0 {
+		return fmt.Errorf("BYMONTHDAY cannot be used with a weekly rule")
+	}
+	if len(r.BySetPos) > 0 && len(r.ByMonth)+len(r.ByMonthDay)+len(r.ByDay) == 0 {
+		return fmt.Errorf("BYSETPOS requires another BYxxx part")
+	}
+	for _, d := range r.ByDay {
+		if d.N == 0 {
+			continue
+		}
+		if r.Freq != Monthly && r.Freq != Yearly {
+			return fmt.Errorf("BYDAY ordinals are only allowed in monthly or yearly rules")
+		}
+		if r.Freq == Yearly && len(r.ByMonth) == 0 && (d.N > 53 || d.N < -53) {
+			return fmt.Errorf("BYDAY ordinal out of range")
+		}
+		if (r.Freq == Monthly || len(r.ByMonth) > 0) && (d.N > 5 || d.N < -5) {
+			return fmt.Errorf("BYDAY ordinal out of range")
+		}
+	}
+	return nil
+}
+
+// String formats the rule as an RRULE value, without the "RRULE:" prefix
+func (r *Rule) String() string {
+	parts := []string{"FREQ=" + string(r.Freq)}
+	if r.Interval > 1 {
+		parts = append(parts, "INTERVAL="+strconv.Itoa(r.Interval))
+	}
+	if r.Count > 0 {
+		parts = append(parts, "COUNT="+strconv.Itoa(r.Count))
+	}
+	if r.Until != nil {
+		parts = append(parts, "UNTIL="+r.Until.UTC().Format(dateTimeFormat))
+	}
+	if len(r.ByMonth) > 0 {
+		parts = append(parts, "BYMONTH="+formatIntList(r.ByMonth))
+	}
+	if len(r.ByMonthDay) > 0 {
+		parts = append(parts, "BYMONTHDAY="+formatIntList(r.ByMonthDay))
+	}
+	if len(r.ByDay) > 0 {
+		days := make([]string, len(r.ByDay))
+		for i, d := range r.ByDay {
+			days[i] = d.String()
+		}
+		parts = append(parts, "BYDAY="+strings.Join(days, ","))
+	}
+	if len(r.BySetPos) > 0 {
+		parts = append(parts, "BYSETPOS="+formatIntList(r.BySetPos))
+	}
+	if r.WeekStart != time.Monday {
+		parts = append(parts, "WKST="+weekdayNames[r.WeekStart])
+	}
+	return strings.Join(parts, ";")
+}
+
+func (d Weekday) String() string {
+	if d.N == 0 {
+		return weekdayNames[d.Day]
+	}
+	return strconv.Itoa(d.N) + weekdayNames[d.Day]
+}
+
+func parsePositive(s string) (int, error) {
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 1 {
+		return 0, fmt.Errorf("%q is not a positive number", s)
+	}
+	return n, nil
+}
+
+// parseIntList parses a comma separated list of values in [min, max], also
+// allowing [-max, -min] when negative is set
+func parseIntList(s string, min, max int, negative bool) ([]int, error) {
+	var values []int
+	for _, v := range strings.Split(s, ",") {
+		n, err := strconv.Atoi(strings.TrimSpace(v))
+		if err != nil {
+			return nil, fmt.Errorf("%q is not a number", v)
+		}
+		abs := n
+		if negative && n < 0 {
+			abs = -n
+		}
+		if abs < min || abs > max {
+			return nil, fmt.Errorf("%d is out of range", n)
+		}
+		values = append(values, n)
+	}
+	return values, nil
+}
+
+func formatIntList(values []int) string {
+	s := make([]string, len(values))
+	for i, v := range values {
+		s[i] = strconv.Itoa(v)
+	}
+	return strings.Join(s, ",")
+}
+
+func parseWeekday(s string) (time.Weekday, error) {
+	for i, name := range weekdayNames {
+		if s == name {
+			return time.Weekday(i), nil
+		}
+	}
+	return 0, fmt.Errorf("%q is not a weekday", s)
+}
+
+func parseWeekdayList(s string) ([]Weekday, error) {
+	var days []Weekday
+	for _, v := range strings.Split(s, ",") {
+		v = strings.TrimSpace(v)
+		if len(v) < 2 {
+			return nil, fmt.Errorf("%q is not a weekday", v)
+		}
+
+		day, err := parseWeekday(v[len(v)-2:])
+		if err != nil {
+			return nil, err
+		}
+
+		n := 0
+		if prefix := v[:len(v)-2]; prefix != "" {
+			n, err = strconv.Atoi(prefix)
+			if err != nil || n == 0 {
+				return nil, fmt.Errorf("%q is not a valid ordinal", prefix)
+			}
+		}
+		days = append(days, Weekday{Day: day, N: n})
+	}
+	return days, nil
+}
+
+// parseUntil accepts UTC and floating date-times, and dates. A date-only
+// UNTIL includes occurrences on that date.
+func parseUntil(s string) (time.Time, error) {
+	if t, err := time.Parse(dateTimeFormat, s); err == nil {
+		return t, nil
+	}
+	if t, err := time.Parse(localTimeFormat, s); err == nil {
+		return t, nil
+	}
+	if t, err := time.Parse(dateOnlyFormat, s); err == nil {
+		return t.Add(24*time.Hour - time.Second), nil
+	}
+	return time.Time{}, fmt.Errorf("%q is not a date or date-time", s)
+}
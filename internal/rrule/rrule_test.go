@@ -0,0 +1,145 @@
+package rrule
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	until := time.Date(2024, 3, 1, 9, 0, 0, 0, time.UTC)
+	untilDate := time.Date(2024, 3, 1, 23, 59, 59, 0, time.UTC)
+
+	tests := []struct {
+		name string
+		in   string
+		want *Rule
+	}{
+		{
+			name: "frequency only",
+			in:   "FREQ=DAILY",
+			want: &Rule{Freq: Daily, Interval: 1, WeekStart: time.Monday},
+		},
+		{
+			name: "property prefix and lower case",
+			in:   "rrule:freq=weekly;byday=mo,fr",
+			want: &Rule{Freq: Weekly, Interval: 1, WeekStart: time.Monday, ByDay: []Weekday{{Day: time.Monday}, {Day: time.Friday}}},
+		},
+		{
+			name: "interval and count",
+			in:   "FREQ=WEEKLY;INTERVAL=2;COUNT=10",
+			want: &Rule{Freq: Weekly, Interval: 2, Count: 10, WeekStart: time.Monday},
+		},
+		{
+			name: "UTC until",
+			in:   "FREQ=DAILY;UNTIL=20240301T090000Z",
+			want: &Rule{Freq: Daily, Interval: 1, Until: &until, WeekStart: time.Monday},
+		},
+		{
+			name: "date-only until includes the whole day",
+			in:   "FREQ=DAILY;UNTIL=20240301",
+			want: &Rule{Freq: Daily, Interval: 1, Until: &untilDate, WeekStart: time.Monday},
+		},
+		{
+			name: "ordinal weekdays",
+			in:   "FREQ=MONTHLY;BYDAY=2TU,-1FR",
+			want: &Rule{Freq: Monthly, Interval: 1, WeekStart: time.Monday, ByDay: []Weekday{{Day: time.Tuesday, N: 2}, {Day: time.Friday, N: -1}}},
+		},
+		{
+			name: "negative month days and set positions",
+			in:   "FREQ=MONTHLY;BYMONTHDAY=-1,-2;BYSETPOS=-1",
+			want: &Rule{Freq: Monthly, Interval: 1, WeekStart: time.Monday, ByMonthDay: []int{-1, -2}, BySetPos: []int{-1}},
+		},
+		{
+			name: "week start",
+			in:   "FREQ=WEEKLY;WKST=SU",
+			want: &Rule{Freq: Weekly, Interval: 1, WeekStart: time.Sunday},
+		},
+		{
+			name: "yearly by month",
+			in:   "FREQ=YEARLY;BYMONTH=2;BYMONTHDAY=28,29;BYSETPOS=-1",
+			want: &Rule{Freq: Yearly, Interval: 1, WeekStart: time.Monday, ByMonth: []int{2}, ByMonthDay: []int{28, 29}, BySetPos: []int{-1}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Parse(tt.in)
+			if err != nil {
+				t.Fatalf("Parse(%q) returned error: %v", tt.in, err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Parse(%q) = %+v, want %+v", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{"empty", "", "empty rule"},
+		{"prefix only", "RRULE:", "empty rule"},
+		{"missing frequency", "INTERVAL=2", "FREQ is required"},
+		{"unknown frequency", "FREQ=HOURLY", "unsupported frequency"},
+		{"part without value", "FREQ=DAILY;COUNT=", "invalid rule part"},
+		{"part without equals", "FREQ=DAILY;COUNT", "invalid rule part"},
+		{"repeated part", "FREQ=DAILY;FREQ=WEEKLY", "given more than once"},
+		{"unsupported part", "FREQ=DAILY;BYHOUR=9", "unsupported rule part BYHOUR"},
+		{"zero interval", "FREQ=DAILY;INTERVAL=0", "invalid INTERVAL"},
+		{"negative count", "FREQ=DAILY;COUNT=-1", "invalid COUNT"},
+		{"bad until", "FREQ=DAILY;UNTIL=tomorrow", "invalid UNTIL"},
+		{"count and until", "FREQ=DAILY;COUNT=3;UNTIL=20240301", "COUNT and UNTIL"},
+		{"month out of range", "FREQ=YEARLY;BYMONTH=13", "invalid BYMONTH"},
+		{"negative month", "FREQ=YEARLY;BYMONTH=-1", "invalid BYMONTH"},
+		{"month day zero", "FREQ=MONTHLY;BYMONTHDAY=0", "invalid BYMONTHDAY"},
+		{"month day out of range", "FREQ=MONTHLY;BYMONTHDAY=-32", "invalid BYMONTHDAY"},
+		{"weekly month day", "FREQ=WEEKLY;BYMONTHDAY=1", "BYMONTHDAY cannot be used with a weekly rule"},
+		{"bad weekday", "FREQ=WEEKLY;BYDAY=XX", "invalid BYDAY"},
+		{"zero ordinal", "FREQ=MONTHLY;BYDAY=0MO", "invalid BYDAY"},
+		{"weekly ordinal", "FREQ=WEEKLY;BYDAY=1MO", "only allowed in monthly or yearly rules"},
+		{"monthly ordinal out of range", "FREQ=MONTHLY;BYDAY=6MO", "ordinal out of range"},
+		{"yearly ordinal out of range", "FREQ=YEARLY;BYDAY=54MO", "ordinal out of range"},
+		{"yearly by month ordinal out of range", "FREQ=YEARLY;BYMONTH=1;BYDAY=-6MO", "ordinal out of range"},
+		{"set position alone", "FREQ=MONTHLY;BYSETPOS=1", "BYSETPOS requires another BYxxx part"},
+		{"set position zero", "FREQ=MONTHLY;BYDAY=MO;BYSETPOS=0", "invalid BYSETPOS"},
+		{"bad week start", "FREQ=WEEKLY;WKST=XX", "invalid WKST"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse(tt.in)
+			if err == nil {
+				t.Fatalf("Parse(%q) returned no error", tt.in)
+			}
+			if !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Parse(%q) error = %q, want it to contain %q", tt.in, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestRuleStringRoundTrip(t *testing.T) {
+	rules := []string{
+		"FREQ=DAILY",
+		"FREQ=WEEKLY;INTERVAL=2;BYDAY=FR",
+		"FREQ=MONTHLY;COUNT=6;BYMONTHDAY=1,15",
+		"FREQ=MONTHLY;BYDAY=MO,TU,WE,TH,FR;BYSETPOS=-1",
+		"FREQ=YEARLY;UNTIL=20301231T000000Z;BYMONTH=11;BYDAY=4TH",
+		"FREQ=WEEKLY;BYDAY=SA,SU;WKST=SU",
+	}
+
+	for _, s := range rules {
+		rule, err := Parse(s)
+		if err != nil {
+			t.Fatalf("Parse(%q) returned error: %v", s, err)
+		}
+		if got := rule.String(); got != s {
+			t.Errorf("Parse(%q).String() = %q", s, got)
+		}
+	}
+}
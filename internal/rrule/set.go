@@ -0,0 +1,455 @@
+package rrule
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// maxPeriods bounds expansion so a rule that can never match (e.g. the 30th
+// of February) terminates
+const maxPeriods = 100000
+
+// Set is a rule anchored at a start time, minus any excluded dates.
+// Occurrences take the start's time of day and location. The start only
+// anchors the rule; it is not an occurrence unless the rule matches it.
+type Set struct {
+	Rule    *Rule
+	Start   time.Time
+	ExDates DateList // Matched by calendar date in the start's location; floating dates as given
+}
+
+// NewSet creates a recurrence set
+func NewSet(rule *Rule, start time.Time, exdates DateList) *Set {
+	return &Set{Rule: rule, Start: start, ExDates: exdates}
+}
+
+// After returns the first occurrence after t, or at t when inclusive is set.
+// The zero time is returned when there are no more occurrences.
+func (s *Set) After(t time.Time, inclusive bool) time.Time {
+	var next time.Time
+	s.iterate(t, func(occ time.Time) bool {
+		if occ.After(t) || (inclusive && occ.Equal(t)) {
+			next = occ
+			return false
+		}
+		return true
+	})
+	return next
+}
+
+// Between returns the occurrences from start to end, including both ends
+func (s *Set) Between(start, end time.Time) []time.Time {
+	var occurrences []time.Time
+	s.iterate(start, func(occ time.Time) bool {
+		if occ.After(end) {
+			return false
+		}
+		if !occ.Before(start) {
+			occurrences = append(occurrences, occ)
+		}
+		return true
+	})
+	return occurrences
+}
+
+// Occurs reports whether t is an occurrence
+func (s *Set) Occurs(t time.Time) bool {
+	return s.After(t, true).Equal(t)
+}
+
+// iterate calls fn with each occurrence in order until it returns false.
+// Occurrences before from may be skipped.
+func (s *Set) iterate(from time.Time, fn func(time.Time) bool) {
+	r := s.Rule
+	loc := s.Start.Location()
+	hour, min, sec := s.Start.Clock()
+	nsec := s.Start.Nanosecond()
+
+	excluded := make(map[string]bool, len(s.ExDates))
+	for _, d := range s.ExDates {
+		excluded[LocalDate(d, loc)] = true
+	}
+
+	count := 0
+	period := r.firstPeriod(s.Start)
+	// COUNT has to see every earlier occurrence, otherwise start from the
+	// period containing from rather than expanding from the start
+	if r.Count == 0 && from.After(s.Start) {
+		period = r.periodContaining(period, from.In(loc))
+	}
+	for i := 0; i < maxPeriods; i++ {
+		for _, day := range r.expandPeriod(period, s.Start) {
+			occ := time.Date(day.Year(), day.Month(), day.Day(), hour, min, sec, nsec, loc)
+			if occ.Before(s.Start) {
+				continue
+			}
+			if r.Until != nil && occ.After(*r.Until) {
+				return
+			}
+
+			// Excluded dates still count towards COUNT
+			count++
+			if r.Count > 0 && count > r.Count {
+				return
+			}
+			if excluded[occ.Format(dateOnlyFormat)] {
+				continue
+			}
+			if !fn(occ) {
+				return
+			}
+		}
+		period = r.nextPeriod(period)
+	}
+}
+
+// Days are handled as midnight UTC dates so calendar arithmetic isn't
+// affected by daylight saving changes in the start's location
+
+func date(year int, month time.Month, day int) time.Time {
+	return time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+}
+
+func daysIn(year int, month time.Month) int {
+	return date(year, month+1, 0).Day()
+}
+
+// firstPeriod returns the first day of the period containing start
+func (r *Rule) firstPeriod(start time.Time) time.Time {
+	day := date(start.Year(), start.Month(), start.Day())
+	switch r.Freq {
+	case Weekly:
+		offset := (int(day.Weekday()) - int(r.WeekStart) + 7) % 7
+		return day.AddDate(0, 0, -offset)
+	case Monthly:
+		return date(day.Year(), day.Month(), 1)
+	case Yearly:
+		return date(day.Year(), time.January, 1)
+	default:
+		return day
+	}
+}
+
+// periodContaining returns the period, counted in INTERVAL steps from first,
+// that contains t's date
+func (r *Rule) periodContaining(first, t time.Time) time.Time {
+	day := date(t.Year(), t.Month(), t.Day())
+	if !day.After(first) {
+		return first
+	}
+
+	switch r.Freq {
+	case Weekly:
+		weeks := int(day.Sub(first).Hours()/24) / 7
+		return first.AddDate(0, 0, weeks/r.Interval*r.Interval*7)
+	case Monthly:
+		months := (day.Year()-first.Year())*12 + int(day.Month()-first.Month())
+		return date(first.Year(), first.Month()+time.Month(months/r.Interval*r.Interval), 1)
+	case Yearly:
+		years := day.Year() - first.Year()
+		return date(first.Year()+years/r.Interval*r.Interval, time.January, 1)
+	default:
+		days := int(day.Sub(first).Hours() / 24)
+		return first.AddDate(0, 0, days/r.Interval*r.Interval)
+	}
+}
+
+func (r *Rule) nextPeriod(period time.Time) time.Time {
+	switch r.Freq {
+	case Weekly:
+		return period.AddDate(0, 0, 7*r.Interval)
+	case Monthly:
+		return date(period.Year(), period.Month()+time.Month(r.Interval), 1)
+	case Yearly:
+		return date(period.Year()+r.Interval, time.January, 1)
+	default:
+		return period.AddDate(0, 0, r.Interval)
+	}
+}
+
+// expandPeriod returns the sorted days matching the rule within a period
+func (r *Rule) expandPeriod(period, start time.Time) []time.Time {
+	var days []time.Time
+	switch r.Freq {
+	case Daily:
+		if r.matchesMonth(period) && r.matchesMonthDay(period) && r.matchesWeekday(period) {
+			days = append(days, period)
+		}
+	case Weekly:
+		for i := 0; i < 7; i++ {
+			day := period.AddDate(0, 0, i)
+			if !r.matchesMonth(day) {
+				continue
+			}
+			if len(r.ByDay) == 0 && day.Weekday() != start.Weekday() {
+				continue
+			}
+			if r.matchesWeekday(day) {
+				days = append(days, day)
+			}
+		}
+	case Monthly:
+		if r.matchesMonth(period) {
+			days = r.expandMonth(period.Year(), period.Month(), start)
+		}
+	case Yearly:
+		days = r.expandYear(period.Year(), start)
+	}
+
+	days = unique(days)
+	if len(r.BySetPos) > 0 {
+		days = selectPositions(days, r.BySetPos)
+	}
+	return days
+}
+
+func (r *Rule) expandMonth(year int, month time.Month, start time.Time) []time.Time {
+	first := date(year, month, 1)
+	last := date(year, month, daysIn(year, month))
+
+	if len(r.ByDay) > 0 {
+		var days []time.Time
+		for _, day := range weekdaysBetween(first, last, r.ByDay) {
+			if r.matchesMonthDay(day) {
+				days = append(days, day)
+			}
+		}
+		return days
+	}
+
+	monthDays := r.ByMonthDay
+	if len(monthDays) == 0 {
+		monthDays = []int{start.Day()}
+	}
+
+	var days []time.Time
+	for _, md := range monthDays {
+		if day, ok := resolveMonthDay(year, month, md); ok {
+			days = append(days, day)
+		}
+	}
+	return days
+}
+
+func (r *Rule) expandYear(year int, start time.Time) []time.Time {
+	// Without BYMONTH, BYDAY ordinals count within the whole year
+	if len(r.ByMonth) == 0 && len(r.ByDay) > 0 {
+		var days []time.Time
+		for _, day := range weekdaysBetween(date(year, time.January, 1), date(year, time.December, 31), r.ByDay) {
+			if r.matchesMonthDay(day) {
+				days = append(days, day)
+			}
+		}
+		return days
+	}
+
+	var months []time.Month
+	switch {
+	case len(r.ByMonth) > 0:
+		for _, m := range r.ByMonth {
+			months = append(months, time.Month(m))
+		}
+	case len(r.ByMonthDay) > 0:
+		for m := time.January; m <= time.December; m++ {
+			months = append(months, m)
+		}
+	default:
+		months = []time.Month{start.Month()}
+	}
+
+	var days []time.Time
+	for _, m := range months {
+		days = append(days, r.expandMonth(year, m, start)...)
+	}
+	return days
+}
+
+func (r *Rule) matchesMonth(day time.Time) bool {
+	if len(r.ByMonth) == 0 {
+		return true
+	}
+	for _, m := range r.ByMonth {
+		if time.Month(m) == day.Month() {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *Rule) matchesMonthDay(day time.Time) bool {
+	if len(r.ByMonthDay) == 0 {
+		return true
+	}
+	for _, md := range r.ByMonthDay {
+		if resolved, ok := resolveMonthDay(day.Year(), day.Month(), md); ok && resolved.Equal(day) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchesWeekday checks BYDAY ignoring ordinals, which only apply when
+// expanding months and years
+func (r *Rule) matchesWeekday(day time.Time) bool {
+	if len(r.ByDay) == 0 {
+		return true
+	}
+	for _, d := range r.ByDay {
+		if d.Day == day.Weekday() {
+			return true
+		}
+	}
+	return false
+}
+
+// resolveMonthDay turns a BYMONTHDAY value into a date, counting negative
+// values back from the end of the month
+func resolveMonthDay(year int, month time.Month, md int) (time.Time, bool) {
+	n := daysIn(year, month)
+	if md < 0 {
+		md = n + md + 1
+	}
+	if md < 1 || md > n {
+		return time.Time{}, false
+	}
+	return date(year, month, md), true
+}
+
+// weekdaysBetween returns the days from first to last matching the BYDAY
+// entries, with ordinals counted within that range
+func weekdaysBetween(first, last time.Time, byDay []Weekday) []time.Time {
+	var days []time.Time
+	for _, d := range byDay {
+		var matches []time.Time
+		offset := (int(d.Day) - int(first.Weekday()) + 7) % 7
+		for day := first.AddDate(0, 0, offset); !day.After(last); day = day.AddDate(0, 0, 7) {
+			matches = append(matches, day)
+		}
+
+		switch {
+		case d.N == 0:
+			days = append(days, matches...)
+		case d.N > 0 && d.N <= len(matches):
+			days = append(days, matches[d.N-1])
+		case d.N < 0 && -d.N <= len(matches):
+			days = append(days, matches[len(matches)+d.N])
+		}
+	}
+	return days
+}
+
+func unique(days []time.Time) []time.Time {
+	sort.Slice(days, func(i, j int) bool { return days[i].Before(days[j]) })
+	out := days[:0]
+	for i, day := range days {
+		if i == 0 || !day.Equal(days[i-1]) {
+			out = append(out, day)
+		}
+	}
+	return out
+}
+
+// selectPositions applies BYSETPOS to a period's sorted days
+func selectPositions(days []time.Time, positions []int) []time.Time {
+	var selected []time.Time
+	for _, pos := range positions {
+		i := pos - 1
+		if pos < 0 {
+			i = len(days) + pos
+		}
+		if i >= 0 && i < len(days) {
+			selected = append(selected, days[i])
+		}
+	}
+	return unique(selected)
+}
+
+// Floating is the location of date-only values. They name a calendar date
+// wherever they are used rather than an instant.
+var Floating = time.FixedZone("floating", 0)
+
+// IsFloating reports whether t is a date-only value
+func IsFloating(t time.Time) bool {
+	return t.Location() == Floating
+}
+
+// LocalDate formats t's calendar date in loc as YYYYMMDD. Floating dates
+// keep their own date.
+func LocalDate(t time.Time, loc *time.Location) string {
+	if IsFloating(t) {
+		return t.Format(dateOnlyFormat)
+	}
+	return t.In(loc).Format(dateOnlyFormat)
+}
+
+// DateList is a list of dates stored as an RFC 5545 EXDATE value, e.g.
+// "20240115T090000Z,20240201". Dates without a time are floating.
+type DateList []time.Time
+
+// ParseDateList parses a comma separated list of UTC date-times or dates
+func ParseDateList(s string) (DateList, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return nil, nil
+	}
+
+	var dates DateList
+	for _, v := range strings.Split(s, ",") {
+		v = strings.TrimSpace(v)
+		t, err := time.Parse(dateTimeFormat, v)
+		if err != nil {
+			t, err = time.ParseInLocation(dateOnlyFormat, v, Floating)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%q is not a date or date-time", v)
+		}
+		dates = append(dates, t)
+	}
+	return dates, nil
+}
+
+func (l DateList) String() string {
+	s := make([]string, len(l))
+	for i, t := range l {
+		if IsFloating(t) {
+			s[i] = t.Format(dateOnlyFormat)
+		} else {
+			s[i] = t.UTC().Format(dateTimeFormat)
+		}
+	}
+	return strings.Join(s, ",")
+}
+
+// Scan implements sql.Scanner
+func (l *DateList) Scan(src interface{}) error {
+	var s string
+	switch v := src.(type) {
+	case nil:
+		*l = nil
+		return nil
+	case string:
+		s = v
+	case []byte:
+		s = string(v)
+	default:
+		return fmt.Errorf("cannot scan %T into DateList", src)
+	}
+
+	dates, err := ParseDateList(s)
+	if err != nil {
+		return err
+	}
+	*l = dates
+	return nil
+}
+
+// Value implements driver.Valuer
+func (l DateList) Value() (driver.Value, error) {
+	if len(l) == 0 {
+		return nil, nil
+	}
+	return l.String(), nil
+}
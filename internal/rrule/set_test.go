@@ -0,0 +1,467 @@
+package rrule
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func mustParse(t *testing.T, s string) *Rule {
+	t.Helper()
+	rule, err := Parse(s)
+	if err != nil {
+		t.Fatalf("Parse(%q) returned error: %v", s, err)
+	}
+	return rule
+}
+
+func mustLoadLocation(t *testing.T, name string) *time.Location {
+	t.Helper()
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		t.Skipf("time zone %s not available: %v", name, err)
+	}
+	return loc
+}
+
+func formatAll(times []time.Time, layout string) []string {
+	out := make([]string, len(times))
+	for i, t := range times {
+		out[i] = t.Format(layout)
+	}
+	return out
+}
+
+func TestSetBetween(t *testing.T) {
+	start := time.Date(2024, 1, 1, 9, 0, 0, 0, time.UTC) // A Monday
+	window := time.Date(2025, 12, 31, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name  string
+		rule  string
+		start time.Time
+		end   time.Time
+		want  []string
+	}{
+		{
+			name: "daily",
+			rule: "FREQ=DAILY;COUNT=3",
+			want: []string{"2024-01-01", "2024-01-02", "2024-01-03"},
+		},
+		{
+			name: "daily interval",
+			rule: "FREQ=DAILY;INTERVAL=10;COUNT=4",
+			want: []string{"2024-01-01", "2024-01-11", "2024-01-21", "2024-01-31"},
+		},
+		{
+			name: "weekly defaults to the start's weekday",
+			rule: "FREQ=WEEKLY;COUNT=3",
+			want: []string{"2024-01-01", "2024-01-08", "2024-01-15"},
+		},
+		{
+			name: "every other week on two days",
+			rule: "FREQ=WEEKLY;INTERVAL=2;BYDAY=TU,FR;COUNT=4",
+			want: []string{"2024-01-02", "2024-01-05", "2024-01-16", "2024-01-19"},
+		},
+		{
+			name: "weekly by month only keeps matching months",
+			rule: "FREQ=WEEKLY;BYMONTH=2;COUNT=2",
+			want: []string{"2024-02-05", "2024-02-12"},
+		},
+		{
+			name: "monthly defaults to the start's day",
+			rule: "FREQ=MONTHLY;COUNT=3",
+			want: []string{"2024-01-01", "2024-02-01", "2024-03-01"},
+		},
+		{
+			name:  "monthly 31st skips shorter months",
+			rule:  "FREQ=MONTHLY;COUNT=3",
+			start: time.Date(2024, 1, 31, 9, 0, 0, 0, time.UTC),
+			want:  []string{"2024-01-31", "2024-03-31", "2024-05-31"},
+		},
+		{
+			name: "quarterly interval",
+			rule: "FREQ=MONTHLY;INTERVAL=3;BYMONTHDAY=15;COUNT=3",
+			want: []string{"2024-01-15", "2024-04-15", "2024-07-15"},
+		},
+		{
+			name: "first and fifteenth",
+			rule: "FREQ=MONTHLY;BYMONTHDAY=1,15;COUNT=4",
+			want: []string{"2024-01-01", "2024-01-15", "2024-02-01", "2024-02-15"},
+		},
+		{
+			name: "last day of the month",
+			rule: "FREQ=MONTHLY;BYMONTHDAY=-1;COUNT=3",
+			want: []string{"2024-01-31", "2024-02-29", "2024-03-31"},
+		},
+		{
+			name: "second to last day of the month",
+			rule: "FREQ=MONTHLY;BYMONTHDAY=-2;COUNT=3",
+			want: []string{"2024-01-30", "2024-02-28", "2024-03-30"},
+		},
+		{
+			name: "negative month day past the start of the month is skipped",
+			rule: "FREQ=MONTHLY;BYMONTHDAY=-30;COUNT=3",
+			want: []string{"2024-01-02", "2024-03-02", "2024-04-01"},
+		},
+		{
+			name: "second Tuesday",
+			rule: "FREQ=MONTHLY;BYDAY=2TU;COUNT=3",
+			want: []string{"2024-01-09", "2024-02-13", "2024-03-12"},
+		},
+		{
+			name: "last Friday",
+			rule: "FREQ=MONTHLY;BYDAY=-1FR;COUNT=3",
+			want: []string{"2024-01-26", "2024-02-23", "2024-03-29"},
+		},
+		{
+			name: "fifth Monday only in months that have one",
+			rule: "FREQ=MONTHLY;BYDAY=5MO;COUNT=3",
+			want: []string{"2024-01-29", "2024-04-29", "2024-07-29"},
+		},
+		{
+			name: "Friday the 13th",
+			rule: "FREQ=MONTHLY;BYDAY=FR;BYMONTHDAY=13;COUNT=2",
+			want: []string{"2024-09-13", "2024-12-13"},
+		},
+		{
+			name: "last business day",
+			rule: "FREQ=MONTHLY;BYDAY=MO,TU,WE,TH,FR;BYSETPOS=-1;COUNT=4",
+			want: []string{"2024-01-31", "2024-02-29", "2024-03-29", "2024-04-30"},
+		},
+		{
+			name: "first and last business day",
+			rule: "FREQ=MONTHLY;BYDAY=MO,TU,WE,TH,FR;BYSETPOS=1,-1;COUNT=4",
+			want: []string{"2024-01-01", "2024-01-31", "2024-02-01", "2024-02-29"},
+		},
+		{
+			name: "set position out of range selects nothing",
+			rule: "FREQ=MONTHLY;BYMONTHDAY=1,2;BYSETPOS=3;COUNT=1",
+			end:  time.Date(2024, 12, 31, 0, 0, 0, 0, time.UTC),
+			want: []string{},
+		},
+		{
+			name:  "month end fallback",
+			rule:  "FREQ=MONTHLY;BYMONTHDAY=28,29,30,31;BYSETPOS=-1;COUNT=3",
+			start: time.Date(2024, 1, 31, 9, 0, 0, 0, time.UTC),
+			want:  []string{"2024-01-31", "2024-02-29", "2024-03-31"},
+		},
+		{
+			name: "yearly defaults to the start's date",
+			rule: "FREQ=YEARLY;COUNT=2",
+			want: []string{"2024-01-01", "2025-01-01"},
+		},
+		{
+			name:  "yearly Feb 29 falls back to Feb 28",
+			rule:  "FREQ=YEARLY;BYMONTH=2;BYMONTHDAY=28,29;BYSETPOS=-1;COUNT=5",
+			start: time.Date(2024, 2, 29, 9, 0, 0, 0, time.UTC),
+			end:   time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC),
+			want:  []string{"2024-02-29", "2025-02-28", "2026-02-28", "2027-02-28", "2028-02-29"},
+		},
+		{
+			name: "Thanksgiving",
+			rule: "FREQ=YEARLY;BYMONTH=11;BYDAY=4TH;COUNT=2",
+			want: []string{"2024-11-28", "2025-11-27"},
+		},
+		{
+			name: "yearly ordinal counts within the year",
+			rule: "FREQ=YEARLY;BYDAY=20MO;COUNT=2",
+			want: []string{"2024-05-13", "2025-05-19"},
+		},
+		{
+			name: "yearly last weekday of the year",
+			rule: "FREQ=YEARLY;BYDAY=-1SU;COUNT=2",
+			want: []string{"2024-12-29", "2025-12-28"},
+		},
+		{
+			name: "biennial interval",
+			rule: "FREQ=YEARLY;INTERVAL=2;BYMONTH=6;BYMONTHDAY=1;COUNT=2",
+			end:  time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC),
+			want: []string{"2024-06-01", "2026-06-01"},
+		},
+		{
+			name: "until is inclusive",
+			rule: "FREQ=DAILY;UNTIL=20240103T090000Z",
+			want: []string{"2024-01-01", "2024-01-02", "2024-01-03"},
+		},
+		{
+			name: "until before the time of day excludes that day",
+			rule: "FREQ=DAILY;UNTIL=20240103T080000Z",
+			want: []string{"2024-01-01", "2024-01-02"},
+		},
+		{
+			name: "date-only until includes that day",
+			rule: "FREQ=DAILY;UNTIL=20240103",
+			want: []string{"2024-01-01", "2024-01-02", "2024-01-03"},
+		},
+		{
+			name: "count counts from the start, not the window",
+			rule: "FREQ=DAILY;COUNT=5",
+			end:  window,
+			want: []string{"2024-01-01", "2024-01-02", "2024-01-03", "2024-01-04", "2024-01-05"},
+		},
+		{
+			name:  "start not matching the rule is not an occurrence",
+			rule:  "FREQ=MONTHLY;BYMONTHDAY=15;COUNT=2",
+			start: time.Date(2024, 1, 20, 9, 0, 0, 0, time.UTC),
+			want:  []string{"2024-02-15", "2024-03-15"},
+		},
+		{
+			name: "impossible date terminates",
+			rule: "FREQ=YEARLY;BYMONTH=2;BYMONTHDAY=30",
+			end:  time.Date(2100, 1, 1, 0, 0, 0, 0, time.UTC),
+			want: []string{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := tt.start
+			if s.IsZero() {
+				s = start
+			}
+			end := tt.end
+			if end.IsZero() {
+				end = window
+			}
+
+			set := NewSet(mustParse(t, tt.rule), s, nil)
+			got := formatAll(set.Between(s, end), "2006-01-02")
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Between = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSetCountIncludesExcludedDates(t *testing.T) {
+	start := time.Date(2024, 1, 1, 9, 0, 0, 0, time.UTC)
+	exdates, err := ParseDateList("20240102T090000Z")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	set := NewSet(mustParse(t, "FREQ=DAILY;COUNT=3"), start, exdates)
+	got := formatAll(set.Between(start, start.AddDate(0, 1, 0)), "2006-01-02")
+	want := []string{"2024-01-01", "2024-01-03"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Between = %v, want %v", got, want)
+	}
+}
+
+func TestSetExDates(t *testing.T) {
+	newYork := mustLoadLocation(t, "America/New_York")
+	tokyo := mustLoadLocation(t, "Asia/Tokyo")
+
+	tests := []struct {
+		name    string
+		start   time.Time
+		exdates string
+		want    []string
+	}{
+		{
+			name:    "UTC date-time",
+			start:   time.Date(2024, 2, 1, 9, 0, 0, 0, time.UTC),
+			exdates: "20240202T090000Z",
+			want:    []string{"2024-02-01", "2024-02-03"},
+		},
+		{
+			name:    "date-time matched by date in the start's location",
+			start:   time.Date(2024, 2, 1, 21, 0, 0, 0, newYork),
+			exdates: "20240203T020000Z", // Feb 2 21:00 in New York
+			want:    []string{"2024-02-01", "2024-02-03"},
+		},
+		{
+			name:    "date-only behind UTC",
+			start:   time.Date(2024, 2, 1, 9, 0, 0, 0, newYork),
+			exdates: "20240202",
+			want:    []string{"2024-02-01", "2024-02-03"},
+		},
+		{
+			name:    "date-only ahead of UTC",
+			start:   time.Date(2024, 2, 1, 9, 0, 0, 0, tokyo),
+			exdates: "20240202",
+			want:    []string{"2024-02-01", "2024-02-03"},
+		},
+		{
+			name:    "mixed list",
+			start:   time.Date(2024, 2, 1, 9, 0, 0, 0, newYork),
+			exdates: "20240201,20240203T140000Z",
+			want:    []string{"2024-02-02"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			exdates, err := ParseDateList(tt.exdates)
+			if err != nil {
+				t.Fatalf("ParseDateList(%q) returned error: %v", tt.exdates, err)
+			}
+
+			set := NewSet(mustParse(t, "FREQ=DAILY;COUNT=3"), tt.start, exdates)
+			got := formatAll(set.Between(tt.start, tt.start.AddDate(0, 0, 7)), "2006-01-02")
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Between = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDateListRoundTrip(t *testing.T) {
+	const in = "20240115T090000Z,20240201"
+	list, err := ParseDateList(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if IsFloating(list[0]) || !IsFloating(list[1]) {
+		t.Errorf("IsFloating = %v, %v, want false, true", IsFloating(list[0]), IsFloating(list[1]))
+	}
+	if got := list.String(); got != in {
+		t.Errorf("String() = %q, want %q", got, in)
+	}
+
+	var scanned DateList
+	if err := scanned.Scan([]byte(in)); err != nil {
+		t.Fatal(err)
+	}
+	if got := scanned.String(); got != in {
+		t.Errorf("Scan then String() = %q, want %q", got, in)
+	}
+
+	if _, err := ParseDateList("20240115,soon"); err == nil {
+		t.Error("ParseDateList accepted an invalid date")
+	}
+}
+
+func TestSetDSTKeepsLocalTime(t *testing.T) {
+	newYork := mustLoadLocation(t, "America/New_York")
+
+	tests := []struct {
+		name  string
+		rule  string
+		start time.Time
+		want  []string
+	}{
+		{
+			name:  "daily across spring forward",
+			rule:  "FREQ=DAILY;COUNT=3",
+			start: time.Date(2024, 3, 9, 9, 30, 0, 0, newYork),
+			want:  []string{"2024-03-09 09:30 EST", "2024-03-10 09:30 EDT", "2024-03-11 09:30 EDT"},
+		},
+		{
+			name:  "weekly across fall back",
+			rule:  "FREQ=WEEKLY;COUNT=2",
+			start: time.Date(2024, 10, 30, 8, 0, 0, 0, newYork),
+			want:  []string{"2024-10-30 08:00 EDT", "2024-11-06 08:00 EST"},
+		},
+		{
+			name:  "monthly across both changes",
+			rule:  "FREQ=MONTHLY;BYMONTHDAY=-1;COUNT=3",
+			start: time.Date(2024, 2, 1, 23, 0, 0, 0, newYork),
+			want:  []string{"2024-02-29 23:00 EST", "2024-03-31 23:00 EDT", "2024-04-30 23:00 EDT"},
+		},
+		{
+			name:  "late evening start stays on the local date",
+			rule:  "FREQ=DAILY;COUNT=2",
+			start: time.Date(2024, 11, 2, 23, 30, 0, 0, newYork),
+			want:  []string{"2024-11-02 23:30 EDT", "2024-11-03 23:30 EST"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			set := NewSet(mustParse(t, tt.rule), tt.start, nil)
+			got := formatAll(set.Between(tt.start, tt.start.AddDate(0, 6, 0)), "2006-01-02 15:04 MST")
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Between = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSetAfter(t *testing.T) {
+	start := time.Date(2024, 1, 1, 9, 0, 0, 0, time.UTC)
+	set := NewSet(mustParse(t, "FREQ=WEEKLY;BYDAY=MO"), start, nil)
+
+	tests := []struct {
+		name      string
+		t         time.Time
+		inclusive bool
+		want      time.Time
+	}{
+		{"before start", start.AddDate(0, 0, -3), false, start},
+		{"at occurrence exclusive", start, false, start.AddDate(0, 0, 7)},
+		{"at occurrence inclusive", start, true, start},
+		{"between occurrences", start.AddDate(0, 0, 3), false, start.AddDate(0, 0, 7)},
+		{"same day after the time", start.Add(time.Hour), true, start.AddDate(0, 0, 7)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := set.After(tt.t, tt.inclusive); !got.Equal(tt.want) {
+				t.Errorf("After(%v, %v) = %v, want %v", tt.t, tt.inclusive, got, tt.want)
+			}
+		})
+	}
+
+	ended := NewSet(mustParse(t, "FREQ=DAILY;COUNT=2"), start, nil)
+	if got := ended.After(start.AddDate(0, 0, 5), false); !got.IsZero() {
+		t.Errorf("After past the last occurrence = %v, want zero time", got)
+	}
+
+	if !set.Occurs(start.AddDate(0, 0, 14)) || set.Occurs(start.AddDate(0, 0, 15)) {
+		t.Error("Occurs did not match the schedule")
+	}
+}
+
+// Starting the expansion from the query's period must give the same results
+// as expanding from the start
+func TestSetAfterSkipsAheadByInterval(t *testing.T) {
+	start := time.Date(2000, 1, 3, 9, 0, 0, 0, time.UTC)
+	rules := []string{
+		"FREQ=DAILY",
+		"FREQ=DAILY;INTERVAL=3",
+		"FREQ=WEEKLY;INTERVAL=2;BYDAY=TU,FR",
+		"FREQ=WEEKLY;INTERVAL=3;WKST=SU",
+		"FREQ=MONTHLY;INTERVAL=5;BYMONTHDAY=-1",
+		"FREQ=MONTHLY;INTERVAL=2;BYDAY=MO,TU,WE,TH,FR;BYSETPOS=-1",
+		"FREQ=YEARLY;INTERVAL=3;BYMONTH=2;BYMONTHDAY=28,29;BYSETPOS=-1",
+		"FREQ=DAILY;UNTIL=20240301T000000Z",
+	}
+	queries := []time.Time{
+		time.Date(2024, 2, 15, 0, 0, 0, 0, time.UTC),
+		time.Date(2024, 2, 15, 9, 0, 0, 0, time.UTC),
+		time.Date(2031, 7, 1, 12, 0, 0, 0, time.UTC),
+	}
+
+	for _, s := range rules {
+		set := NewSet(mustParse(t, s), start, nil)
+		for _, q := range queries {
+			var want time.Time
+			set.iterate(start, func(occ time.Time) bool {
+				if occ.After(q) {
+					want = occ
+					return false
+				}
+				return true
+			})
+
+			if got := set.After(q, false); !got.Equal(want) {
+				t.Errorf("%s: After(%v) = %v, want %v", s, q, got, want)
+			}
+		}
+	}
+}
+
+func BenchmarkSetAfterDailySince2000(b *testing.B) {
+	rule, err := Parse("FREQ=DAILY")
+	if err != nil {
+		b.Fatal(err)
+	}
+	set := NewSet(rule, time.Date(2000, 1, 1, 9, 0, 0, 0, time.UTC), nil)
+	now := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+
+	for i := 0; i < b.N; i++ {
+		set.After(now, false)
+	}
+}
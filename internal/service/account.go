@@ -21,10 +21,17 @@ func NewAccountService(repo repository.Repository, plaid *PlaidService) *Account
 }
 
 func (s *AccountService) CreateLinkToken(ctx context.Context, userID string) (string, error) {
+	if err := requireVerifiedEmail(ctx, s.repo, userID); err != nil {
+		return "", err
+	}
 	return s.plaid.CreateLinkToken(ctx, userID)
 }
 
 func (s *AccountService) LinkAccount(ctx context.Context, userID string, publicToken string) error {
+	if err := requireVerifiedEmail(ctx, s.repo, userID); err != nil {
+		return err
+	}
+
 	// Exchange public token for access token
 	accessToken, itemID, err := s.plaid.ExchangePublicToken(ctx, publicToken)
 	if err != nil {
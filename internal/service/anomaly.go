@@ -0,0 +1,301 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/yeboahd24/personal-finance-manager/internal/errors"
+	"github.com/yeboahd24/personal-finance-manager/internal/model"
+	"github.com/yeboahd24/personal-finance-manager/internal/repository"
+)
+
+const (
+	// minAnomalyRatio keeps spending that is statistically unusual but only a
+	// little above the baseline from being flagged
+	minAnomalyRatio = 1.5
+
+	// minAnomalyTransactions is how many past debits a category needs before
+	// its transaction sizes are compared
+	minAnomalyTransactions = 5
+
+	// minAnomalySpread floors the spread as a fraction of the median, so very
+	// regular spending doesn't make every small change an anomaly
+	minAnomalySpread = 0.05
+)
+
+// GetSpendingAnomalies compares the current period's spend per category, and
+// each debit in it, with the same category over the previous periods. Values
+// whose modified z-score, (x - median) / (1.4826 * MAD), reaches the
+// threshold are returned, most unusual first.
+func (s *AnalyticsService) GetSpendingAnomalies(ctx context.Context, userID string, opts model.AnomalyOptions) ([]*model.SpendingAnomaly, error) {
+	if err := validateAnomalyOptions(&opts); err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	current := anomalyPeriodStart(now, opts.Period)
+	filter := model.AnalyticsFilter{
+		UserID:    userID,
+		StartDate: addAnomalyPeriods(current, opts.Period, -opts.Lookback),
+		EndDate:   now,
+	}
+
+	spending, err := s.repo.GetCategorySpendingByPeriod(ctx, filter, opts.Period)
+	if err != nil {
+		return nil, err
+	}
+	debits, err := s.repo.GetCategoryDebits(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	anomalies := detectCategorySpendAnomalies(spending, current, opts)
+	anomalies = append(anomalies, detectTransactionSizeAnomalies(debits, current, opts)...)
+	sort.SliceStable(anomalies, func(i, j int) bool {
+		return anomalies[i].Score > anomalies[j].Score
+	})
+	return anomalies, nil
+}
+
+// validateAnomalyOptions checks the period, lookback and threshold, filling
+// in defaults for those left out
+func validateAnomalyOptions(opts *model.AnomalyOptions) error {
+	switch opts.Period {
+	case "":
+		opts.Period = model.AnomalyPeriodWeek
+	case model.AnomalyPeriodWeek, model.AnomalyPeriodMonth:
+	default:
+		return errors.New("Period must be one of week, month", 400)
+	}
+
+	if opts.Lookback == 0 {
+		opts.Lookback = model.DefaultAnomalyLookback
+	}
+	if opts.Lookback < model.MinAnomalyLookback || opts.Lookback > model.MaxAnomalyLookback {
+		return errors.New(fmt.Sprintf("Lookback must be between %d and %d periods", model.MinAnomalyLookback, model.MaxAnomalyLookback), 400)
+	}
+
+	if opts.Threshold == 0 {
+		opts.Threshold = model.DefaultAnomalyThreshold
+	}
+	if opts.Threshold < model.MinAnomalyThreshold {
+		return errors.New(fmt.Sprintf("Threshold must be at least %d", model.MinAnomalyThreshold), 400)
+	}
+	return nil
+}
+
+// detectCategorySpendAnomalies flags categories whose spend so far in the
+// current period is well above their spend per period before it. Periods
+// without spending count as zero, so categories used in fewer than half the
+// periods have no baseline and are skipped.
+func detectCategorySpendAnomalies(spending []model.CategoryPeriodSpend, current time.Time, opts model.AnomalyOptions) []*model.SpendingAnomaly {
+	byCategory := make(map[string]map[time.Time]float64)
+	names := make(map[string]string)
+	var categoryIDs []string
+	for _, s := range spending {
+		if byCategory[s.CategoryID] == nil {
+			byCategory[s.CategoryID] = make(map[time.Time]float64)
+			names[s.CategoryID] = s.CategoryName
+			categoryIDs = append(categoryIDs, s.CategoryID)
+		}
+		byCategory[s.CategoryID][s.PeriodStart] += s.Amount
+	}
+
+	var anomalies []*model.SpendingAnomaly
+	for _, categoryID := range categoryIDs {
+		periods := byCategory[categoryID]
+		amount := periods[current]
+		if amount <= 0 {
+			continue
+		}
+
+		history := make([]float64, opts.Lookback)
+		for i := range history {
+			history[i] = periods[addAnomalyPeriods(current, opts.Period, -(i+1))]
+		}
+
+		baseline, score, ok := anomalyScore(amount, history, opts.Threshold)
+		if !ok {
+			continue
+		}
+		ratio := amount / baseline
+		anomalies = append(anomalies, &model.SpendingAnomaly{
+			Kind:         model.AnomalyCategorySpend,
+			CategoryID:   categoryID,
+			CategoryName: names[categoryID],
+			Period:       opts.Period,
+			PeriodStart:  current,
+			Amount:       roundCents(amount),
+			Baseline:     roundCents(baseline),
+			Ratio:        roundCents(ratio),
+			Score:        roundCents(score),
+			Explanation: fmt.Sprintf("%s is %.1f× your usual %s spend (%.2f so far this %s, usually %.2f)",
+				names[categoryID], ratio, anomalyPeriodAdjective(opts.Period), amount, opts.Period, baseline),
+		})
+	}
+	return anomalies
+}
+
+// detectTransactionSizeAnomalies flags debits in the current period that are
+// much larger than the category's debits before it
+func detectTransactionSizeAnomalies(debits []model.CategoryDebit, current time.Time, opts model.AnomalyOptions) []*model.SpendingAnomaly {
+	history := make(map[string][]float64)
+	for _, d := range debits {
+		if d.Date.Before(current) {
+			history[d.CategoryID] = append(history[d.CategoryID], d.Amount)
+		}
+	}
+
+	var anomalies []*model.SpendingAnomaly
+	for _, d := range debits {
+		if d.Date.Before(current) || len(history[d.CategoryID]) < minAnomalyTransactions {
+			continue
+		}
+
+		baseline, score, ok := anomalyScore(d.Amount, history[d.CategoryID], opts.Threshold)
+		if !ok {
+			continue
+		}
+		ratio := d.Amount / baseline
+		date := d.Date
+		anomalies = append(anomalies, &model.SpendingAnomaly{
+			Kind:          model.AnomalyTransactionSize,
+			CategoryID:    d.CategoryID,
+			CategoryName:  d.CategoryName,
+			TransactionID: d.TransactionID,
+			Description:   d.Description,
+			Date:          &date,
+			Period:        opts.Period,
+			PeriodStart:   current,
+			Amount:        roundCents(d.Amount),
+			Baseline:      roundCents(baseline),
+			Ratio:         roundCents(ratio),
+			Score:         roundCents(score),
+			Explanation: fmt.Sprintf("%s (%.2f) is %.1f× your usual %s transaction (%.2f)",
+				d.Description, d.Amount, ratio, d.CategoryName, baseline),
+		})
+	}
+	return anomalies
+}
+
+// anomalyScore returns the median of history and the modified z-score of x
+// against it, and whether x is far enough above the median to be an anomaly.
+// When the median absolute deviation is zero the mean absolute deviation is
+// used instead, and the spread is never taken as less than minAnomalySpread
+// of the median.
+func anomalyScore(x float64, history []float64, threshold float64) (float64, float64, bool) {
+	if len(history) == 0 {
+		return 0, 0, false
+	}
+	baseline := median(history)
+	if baseline <= 0 || x < baseline*minAnomalyRatio {
+		return baseline, 0, false
+	}
+
+	deviations := make([]float64, len(history))
+	var total float64
+	for i, v := range history {
+		deviations[i] = math.Abs(v - baseline)
+		total += deviations[i]
+	}
+	spread := 1.4826 * median(deviations)
+	if spread == 0 {
+		spread = 1.253314 * total / float64(len(deviations))
+	}
+	spread = math.Max(spread, baseline*minAnomalySpread)
+
+	score := (x - baseline) / spread
+	return baseline, score, score >= threshold
+}
+
+// anomalyPeriodStart returns the start of the UTC week, from Monday, or month
+// containing t, matching the periods the repository groups spending into
+func anomalyPeriodStart(t time.Time, period model.AnomalyPeriod) time.Time {
+	t = t.UTC()
+	if period == model.AnomalyPeriodMonth {
+		return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+	}
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	return day.AddDate(0, 0, -((int(day.Weekday()) + 6) % 7))
+}
+
+// addAnomalyPeriods moves a period start n weeks or months
+func addAnomalyPeriods(start time.Time, period model.AnomalyPeriod, n int) time.Time {
+	if period == model.AnomalyPeriodMonth {
+		return start.AddDate(0, n, 0)
+	}
+	return start.AddDate(0, 0, 7*n)
+}
+
+func anomalyPeriodAdjective(period model.AnomalyPeriod) string {
+	if period == model.AnomalyPeriodMonth {
+		return "monthly"
+	}
+	return "weekly"
+}
+
+// SpendingAnomalyService notifies users who opted in about unusual spending
+type SpendingAnomalyService struct {
+	repo                repository.Repository
+	analyticsService    *AnalyticsService
+	notificationService *NotificationService
+}
+
+func NewSpendingAnomalyService(repo repository.Repository, analyticsService *AnalyticsService, notificationService *NotificationService) *SpendingAnomalyService {
+	return &SpendingAnomalyService{
+		repo:                repo,
+		analyticsService:    analyticsService,
+		notificationService: notificationService,
+	}
+}
+
+// SendAnomalyAlerts checks this week's spending of every user with spending
+// anomaly notifications on and sends one notification per anomaly
+func (s *SpendingAnomalyService) SendAnomalyAlerts(ctx context.Context) error {
+	userIDs, err := s.repo.GetSpendingAnomalyUserIDs(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, userID := range userIDs {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		anomalies, err := s.analyticsService.GetSpendingAnomalies(ctx, userID, model.AnomalyOptions{})
+		if err != nil {
+			log.Printf("Error detecting spending anomalies for user %s: %v", userID, err)
+			continue
+		}
+		for _, anomaly := range anomalies {
+			if err := s.alert(ctx, userID, anomaly); err != nil {
+				log.Printf("Error sending spending anomaly alert for user %s: %v", userID, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// alert sends the notification for anomaly unless one was already sent. The
+// alert is claimed first so concurrent runs can't both send it.
+func (s *SpendingAnomalyService) alert(ctx context.Context, userID string, anomaly *model.SpendingAnomaly) error {
+	key := anomaly.Key()
+	claimed, err := s.repo.ClaimSpendingAnomalyAlert(ctx, userID, key)
+	if err != nil || !claimed {
+		return err
+	}
+
+	if err := s.notificationService.NotifySpendingAnomaly(ctx, userID, anomaly); err != nil {
+		if releaseErr := s.repo.ReleaseSpendingAnomalyAlert(ctx, userID, key); releaseErr != nil {
+			log.Printf("Error releasing spending anomaly alert %s for user %s: %v", key, userID, releaseErr)
+		}
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,208 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/yeboahd24/personal-finance-manager/internal/errors"
+	"github.com/yeboahd24/personal-finance-manager/internal/model"
+	"github.com/yeboahd24/personal-finance-manager/internal/repository"
+)
+
+// CashFlowService projects account balances forward from the user's active
+// recurring transactions
+type CashFlowService struct {
+	repo             repository.Repository
+	recurringService *RecurringTransactionService
+}
+
+func NewCashFlowService(repo repository.Repository, recurringService *RecurringTransactionService) *CashFlowService {
+	return &CashFlowService{
+		repo:             repo,
+		recurringService: recurringService,
+	}
+}
+
+// GetCalendar projects the next days days starting today. Overdue
+// occurrences that haven't posted yet are counted today. When minimum is nil
+// the user's minimum balance preference is used.
+func (s *CashFlowService) GetCalendar(ctx context.Context, userID string, days int, minimum *float64) (*model.CashFlowCalendar, error) {
+	if days < 1 || days > model.MaxCashFlowDays {
+		return nil, errors.New(fmt.Sprintf("Days must be between 1 and %d", model.MaxCashFlowDays), 400)
+	}
+
+	if minimum == nil {
+		prefs, err := s.repo.GetNotificationPreferences(ctx, userID)
+		if err != nil {
+			return nil, err
+		}
+		minimum = &prefs.MinimumBalance
+	}
+
+	accounts, err := s.repo.GetAccountsByUserID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	active := true
+	recurring, err := s.recurringService.GetRecurringTransactions(ctx, userID, model.RecurringTransactionFilter{Active: &active})
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	from := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	return projectCashFlow(from, days, *minimum, accounts, recurring), nil
+}
+
+// projectCashFlow builds the calendar from the accounts' current balances
+func projectCashFlow(from time.Time, days int, minimum float64, accounts []*model.Account, recurring []*model.RecurringTransaction) *model.CashFlowCalendar {
+	to := from.AddDate(0, 0, days-1)
+	cal := &model.CashFlowCalendar{
+		From:           from,
+		To:             to,
+		MinimumBalance: minimum,
+		Accounts:       make([]model.CashFlowAccount, 0, len(accounts)),
+		Days:           make([]model.CashFlowDay, days),
+	}
+
+	balances := make(map[string]float64, len(accounts))
+	for _, a := range accounts {
+		balances[a.ID] = a.Balance
+		cal.Accounts = append(cal.Accounts, model.CashFlowAccount{
+			ID:              a.ID,
+			Name:            a.Name,
+			Type:            a.Type,
+			Currency:        a.Currency,
+			Balance:         a.Balance,
+			LowestBalance:   a.Balance,
+			LowestBalanceOn: from,
+		})
+	}
+
+	// Bucket occurrences by day, overdue ones on the first day
+	income := make(map[string]bool, len(recurring))
+	byDay := make([][]model.Occurrence, days)
+	for _, rt := range recurring {
+		if _, ok := balances[rt.AccountID]; !ok {
+			continue
+		}
+		income[rt.ID] = isIncome(rt)
+		for _, occ := range upcomingOccurrences(rt, to.AddDate(0, 0, 1).Add(-time.Nanosecond)) {
+			i := int(occ.Date.Sub(from).Hours() / 24)
+			if i < 0 {
+				i = 0
+			}
+			if i < days {
+				byDay[i] = append(byDay[i], occ)
+			}
+		}
+	}
+
+	for i := range cal.Days {
+		date := from.AddDate(0, 0, i)
+		day := model.CashFlowDay{
+			Date:        date.Format(model.OccurrenceDateFormat),
+			Occurrences: byDay[i],
+			Balances:    make(map[string]float64, len(accounts)),
+		}
+		if day.Occurrences == nil {
+			day.Occurrences = []model.Occurrence{}
+		}
+		sort.SliceStable(day.Occurrences, func(a, b int) bool {
+			return day.Occurrences[a].Date.Before(day.Occurrences[b].Date)
+		})
+
+		for _, occ := range day.Occurrences {
+			if occ.Amount >= 0 {
+				day.Inflows += occ.Amount
+			} else {
+				day.Outflows -= occ.Amount
+			}
+			balances[occ.AccountID] += occ.Amount
+
+			if cal.SafeToSpend.NextPayday == nil && i > 0 && occ.Amount > 0 && income[occ.RecurringID] && isCashAccount(accounts, occ.AccountID) {
+				payday := date
+				cal.SafeToSpend.NextPayday = &payday
+			}
+		}
+		day.Inflows = roundCents(day.Inflows)
+		day.Outflows = roundCents(day.Outflows)
+		day.Net = roundCents(day.Inflows - day.Outflows)
+
+		for j, a := range accounts {
+			balance := roundCents(balances[a.ID])
+			day.Balances[a.ID] = balance
+			if balance < cal.Accounts[j].LowestBalance {
+				cal.Accounts[j].LowestBalance = balance
+				cal.Accounts[j].LowestBalanceOn = date
+			}
+			if cal.LowBalance == nil && model.CashAccountTypes[a.Type] && balance < minimum {
+				cal.LowBalance = &model.LowBalanceWarning{
+					Date:        date,
+					AccountID:   a.ID,
+					AccountName: a.Name,
+					Balance:     balance,
+					Minimum:     minimum,
+				}
+			}
+		}
+		cal.Days[i] = day
+	}
+
+	cal.SafeToSpend.Amount = safeToSpend(cal, accounts, minimum)
+	return cal
+}
+
+// safeToSpend is what each cash account can spare above the minimum at its
+// lowest point before the next payday, or within the whole projection if no
+// payday is scheduled
+func safeToSpend(cal *model.CashFlowCalendar, accounts []*model.Account, minimum float64) float64 {
+	until := cal.To.Format(model.OccurrenceDateFormat)
+	if cal.SafeToSpend.NextPayday != nil {
+		until = cal.SafeToSpend.NextPayday.AddDate(0, 0, -1).Format(model.OccurrenceDateFormat)
+	}
+
+	var total float64
+	for _, a := range accounts {
+		if !model.CashAccountTypes[a.Type] {
+			continue
+		}
+		lowest := a.Balance
+		for _, day := range cal.Days {
+			if day.Date > until {
+				break
+			}
+			lowest = math.Min(lowest, day.Balances[a.ID])
+		}
+		if spare := lowest - minimum; spare > 0 {
+			total += spare
+		}
+	}
+	return roundCents(total)
+}
+
+// isIncome reports whether rt brings money in, by its category when it has
+// one
+func isIncome(rt *model.RecurringTransaction) bool {
+	if rt.Category != nil && rt.Category.Type != "" {
+		return rt.Category.Type == model.CategoryTypeIncome
+	}
+	return rt.Amount > 0
+}
+
+func isCashAccount(accounts []*model.Account, id string) bool {
+	for _, a := range accounts {
+		if a.ID == id {
+			return model.CashAccountTypes[a.Type]
+		}
+	}
+	return false
+}
+
+func roundCents(v float64) float64 {
+	return math.Round(v*100) / 100
+}
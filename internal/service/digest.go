@@ -0,0 +1,162 @@
+package service
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/yeboahd24/personal-finance-manager/internal/model"
+	"github.com/yeboahd24/personal-finance-manager/internal/repository"
+)
+
+const (
+	// digestTopCategories is how many spending categories a digest lists
+	digestTopCategories = 5
+
+	// maxSpendingCategories bounds the categories totalled for a digest
+	maxSpendingCategories = 1000
+
+	// digestBillDays is how far ahead a digest lists upcoming bills
+	digestBillDays = 7
+)
+
+// DigestService batches users' unread notifications into a daily or weekly
+// email with a summary of their spending, budgets and upcoming bills
+type DigestService struct {
+	repo                repository.Repository
+	notificationService *NotificationService
+	recurringService    *RecurringTransactionService
+	emailService        *EmailService
+}
+
+func NewDigestService(repo repository.Repository, notificationService *NotificationService, recurringService *RecurringTransactionService, emailService *EmailService) *DigestService {
+	return &DigestService{
+		repo:                repo,
+		notificationService: notificationService,
+		recurringService:    recurringService,
+		emailService:        emailService,
+	}
+}
+
+// SendDigests sends each digest user the digest that is due at their local
+// time, once per local day
+func (s *DigestService) SendDigests(ctx context.Context) error {
+	prefs, err := s.repo.GetDigestPreferences(ctx)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	for _, p := range prefs {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		date, due := p.DigestDue(now)
+		if !due {
+			continue
+		}
+		if err := s.send(ctx, p, date, now); err != nil {
+			log.Printf("Error sending %s digest to user %s: %v", p.EmailDigest, p.UserID, err)
+		}
+	}
+	return nil
+}
+
+// send claims and sends the user's digest for a local date. An empty digest
+// is claimed but not sent. The claim is released if queueing fails, so the
+// next run tries again.
+func (s *DigestService) send(ctx context.Context, prefs *model.NotificationPreferences, date, now time.Time) error {
+	last, err := s.repo.LastNotificationDigest(ctx, prefs.UserID)
+	if err != nil {
+		return err
+	}
+
+	claimed, err := s.repo.ClaimNotificationDigest(ctx, prefs.UserID, date)
+	if err != nil || !claimed {
+		return err
+	}
+
+	since := now.Add(-prefs.DigestPeriod())
+	if last != nil && last.After(since) {
+		since = *last
+	}
+
+	digest, err := s.build(ctx, prefs, since, now)
+	if err == nil && !digest.Empty() {
+		err = s.emailService.QueueEmail(ctx, digest.User.Email, digest.Subject(), "digest", digest)
+	}
+	if err != nil {
+		if releaseErr := s.repo.ReleaseNotificationDigest(ctx, prefs.UserID, date); releaseErr != nil {
+			log.Printf("Error releasing digest for user %s: %v", prefs.UserID, releaseErr)
+		}
+		return err
+	}
+	return nil
+}
+
+// build gathers the digest content for notifications and spending since the
+// given time
+func (s *DigestService) build(ctx context.Context, prefs *model.NotificationPreferences, since, now time.Time) (*model.NotificationDigest, error) {
+	user, err := s.repo.GetUserByID(ctx, prefs.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	digest := &model.NotificationDigest{
+		User:      user,
+		Frequency: prefs.EmailDigest,
+		Since:     since,
+		Until:     now,
+		Location:  prefs.Location(),
+	}
+
+	notifications, err := s.repo.GetUserNotifications(ctx, prefs.UserID, true, false)
+	if err != nil {
+		return nil, err
+	}
+	for _, n := range notifications {
+		if n.CreatedAt.After(since) && s.notificationService.shouldSendNotification(n, prefs) && prefs.ChannelEnabled(n.Type, model.ChannelEmail) {
+			digest.Notifications = append(digest.Notifications, n)
+		}
+	}
+
+	spending, err := s.repo.GetSpendingByCategory(ctx, model.AnalyticsFilter{
+		UserID:    prefs.UserID,
+		StartDate: since,
+		EndDate:   now,
+		Limit:     maxSpendingCategories,
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, c := range spending {
+		digest.TotalSpent += c.Amount
+	}
+	if len(spending) > digestTopCategories {
+		spending = spending[:digestTopCategories]
+	}
+	digest.TopCategories = spending
+
+	budgets, err := s.repo.GetBudgets(ctx, prefs.UserID, model.BudgetFilter{
+		UserID:      prefs.UserID,
+		PeriodStart: now,
+		PeriodEnd:   now,
+	})
+	if err != nil {
+		return nil, err
+	}
+	digest.Budgets = budgets
+
+	upcoming, err := s.recurringService.GetUpcomingOccurrences(ctx, prefs.UserID, digestBillDays)
+	if err != nil {
+		return nil, err
+	}
+	for _, occ := range upcoming {
+		if occ.Amount < 0 {
+			digest.UpcomingBills = append(digest.UpcomingBills, occ)
+		}
+	}
+
+	return digest, nil
+}
@@ -2,47 +2,173 @@ package service
 
 import (
 	"context"
-	"fmt"
-	"net/smtp"
+	"log"
 	"os"
+	"time"
+
+	"github.com/yeboahd24/personal-finance-manager/internal/errors"
+	"github.com/yeboahd24/personal-finance-manager/internal/mailer"
+	"github.com/yeboahd24/personal-finance-manager/internal/model"
+	"github.com/yeboahd24/personal-finance-manager/internal/repository"
+)
+
+const (
+	// maxEmailAttempts is how many times an email is tried before it is
+	// marked failed
+	maxEmailAttempts = 8
+
+	// Retries back off from emailRetryBase, doubling up to emailRetryMax
+	emailRetryBase = time.Minute
+	emailRetryMax  = time.Hour
+
+	// emailSendTimeout bounds a single send
+	emailSendTimeout = 20 * time.Second
+
+	// emailLease is how long a claimed email is hidden from other workers
+	emailLease = 2 * time.Minute
+
+	// emailRetention is how long sent and failed emails are kept
+	emailRetention = 30 * 24 * time.Hour
+
+	defaultFromEmail = "Personal Finance Manager <no-reply@localhost>"
 )
 
-// EmailService handles sending emails
+// EmailService queues rendered emails in the outbox and sends them through a
+// mailer transport
 type EmailService struct {
-	smtpHost     string
-	smtpPort     string
-	smtpUsername string
-	smtpPassword string
-	fromEmail    string
+	repo      repository.Repository
+	transport mailer.Transport
+	fromEmail string
 }
 
 // NewEmailService creates a new EmailService instance
-func NewEmailService() *EmailService {
+func NewEmailService(repo repository.Repository, transport mailer.Transport) *EmailService {
+	fromEmail := os.Getenv("FROM_EMAIL")
+	if fromEmail == "" {
+		fromEmail = defaultFromEmail
+	}
 	return &EmailService{
-		smtpHost:     os.Getenv("SMTP_HOST"),
-		smtpPort:     os.Getenv("SMTP_PORT"),
-		smtpUsername: os.Getenv("SMTP_USERNAME"),
-		smtpPassword: os.Getenv("SMTP_PASSWORD"),
-		fromEmail:    os.Getenv("FROM_EMAIL"),
+		repo:      repo,
+		transport: transport,
+		fromEmail: fromEmail,
+	}
+}
+
+// QueueEmail renders the named template with data and adds the result to the
+// outbox. The email worker sends it.
+func (s *EmailService) QueueEmail(ctx context.Context, to, subject, template string, data interface{}) error {
+	if to == "" {
+		return errors.New("Email recipient is required", 400)
 	}
+
+	text, html, err := mailer.Render(template, data)
+	if err != nil {
+		return errors.Wrap(err, "Failed to render email", 500)
+	}
+
+	return s.repo.CreateEmail(ctx, &model.Email{
+		To:            to,
+		Subject:       subject,
+		Template:      template,
+		Text:          text,
+		HTML:          html,
+		Status:        model.EmailPending,
+		NextAttemptAt: time.Now(),
+	})
 }
 
-// SendEmail sends an email with the given subject and body to the specified recipient
-func (s *EmailService) SendEmail(ctx context.Context, to, subject, body string) error {
-	if s.smtpHost == "" || s.smtpPort == "" || s.smtpUsername == "" || s.smtpPassword == "" {
-		return fmt.Errorf("email service not properly configured")
+// QueueNotification queues an email for a notification, using the template
+// named after its type when there is one
+func (s *EmailService) QueueNotification(ctx context.Context, to string, notification *model.Notification) error {
+	template := string(notification.Type)
+	if !mailer.HasTemplate(template) {
+		template = "notification"
 	}
+	return s.QueueEmail(ctx, to, notification.Title, template, notification)
+}
 
-	auth := smtp.PlainAuth("", s.smtpUsername, s.smtpPassword, s.smtpHost)
-	
-	msg := []byte(fmt.Sprintf("From: %s\r\n"+
-		"To: %s\r\n"+
-		"Subject: %s\r\n"+
-		"MIME-Version: 1.0\r\n"+
-		"Content-Type: text/html; charset=UTF-8\r\n"+
-		"\r\n"+
-		"%s\r\n", s.fromEmail, to, subject, body))
+// ProcessOutbox sends the emails that are due and returns how many were
+// sent. It stops early when ctx is too close to its deadline for another
+// send.
+func (s *EmailService) ProcessOutbox(ctx context.Context) (int, error) {
+	sent := 0
+	for {
+		if err := ctx.Err(); err != nil {
+			return sent, err
+		}
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < emailSendTimeout {
+			break
+		}
 
-	addr := fmt.Sprintf("%s:%s", s.smtpHost, s.smtpPort)
-	return smtp.SendMail(addr, auth, s.fromEmail, []string{to}, msg)
+		email, err := s.repo.ClaimDueEmail(ctx, time.Now(), emailLease)
+		if err != nil {
+			return sent, err
+		}
+		if email == nil {
+			break
+		}
+
+		if s.send(ctx, email) {
+			sent++
+		}
+	}
+
+	deleted, err := s.repo.DeleteEmailsBefore(ctx, time.Now().Add(-emailRetention))
+	if err != nil {
+		return sent, err
+	}
+	if deleted > 0 {
+		log.Printf("Deleted %d old emails from the outbox", deleted)
+	}
+	return sent, nil
+}
+
+// send makes one attempt at a claimed email and records the outcome,
+// scheduling a retry or marking it failed when the transport returns an error
+func (s *EmailService) send(ctx context.Context, email *model.Email) bool {
+	sendCtx, cancel := context.WithTimeout(ctx, emailSendTimeout)
+	err := s.transport.Send(sendCtx, &mailer.Message{
+		ID:      email.ID,
+		From:    s.fromEmail,
+		To:      email.To,
+		Subject: email.Subject,
+		Text:    email.Text,
+		HTML:    email.HTML,
+		Date:    email.CreatedAt,
+	})
+	cancel()
+
+	now := time.Now()
+	email.Attempts++
+	if err == nil {
+		email.Status = model.EmailSent
+		email.SentAt = &now
+		email.LastError = ""
+	} else {
+		email.LastError = err.Error()
+		if email.Attempts >= maxEmailAttempts {
+			email.Status = model.EmailFailed
+			log.Printf("Giving up on email %s to %s after %d attempts: %v", email.ID, email.To, email.Attempts, err)
+		} else {
+			email.NextAttemptAt = now.Add(emailRetryDelay(email.Attempts))
+		}
+	}
+
+	if updateErr := s.repo.UpdateEmail(ctx, email); updateErr != nil {
+		log.Printf("Error recording email %s: %v", email.ID, updateErr)
+	}
+	return err == nil
+}
+
+// emailRetryDelay is the wait before the next attempt after the given number
+// of failed ones
+func emailRetryDelay(attempts int) time.Duration {
+	delay := emailRetryBase
+	for i := 1; i < attempts && delay < emailRetryMax; i++ {
+		delay *= 2
+	}
+	if delay > emailRetryMax {
+		delay = emailRetryMax
+	}
+	return delay
 }
@@ -0,0 +1,257 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/yeboahd24/personal-finance-manager/internal/mailer"
+	"github.com/yeboahd24/personal-finance-manager/internal/model"
+	"github.com/yeboahd24/personal-finance-manager/internal/repository"
+)
+
+// outboxRepo keeps the email outbox in memory
+type outboxRepo struct {
+	repository.Repository
+	mu     sync.Mutex
+	emails []*model.Email
+}
+
+func (r *outboxRepo) CreateEmail(ctx context.Context, email *model.Email) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	email.ID = fmt.Sprintf("email-%d", len(r.emails)+1)
+	email.CreatedAt = time.Now()
+	r.emails = append(r.emails, email)
+	return nil
+}
+
+func (r *outboxRepo) ClaimDueEmail(ctx context.Context, before time.Time, lease time.Duration) (*model.Email, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, email := range r.emails {
+		if email.Status == model.EmailPending && !email.NextAttemptAt.After(before) {
+			email.NextAttemptAt = before.Add(lease)
+			claimed := *email
+			return &claimed, nil
+		}
+	}
+	return nil, nil
+}
+
+func (r *outboxRepo) UpdateEmail(ctx context.Context, email *model.Email) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i, e := range r.emails {
+		if e.ID == email.ID {
+			updated := *email
+			r.emails[i] = &updated
+			return nil
+		}
+	}
+	return fmt.Errorf("email %s not found", email.ID)
+}
+
+func (r *outboxRepo) DeleteEmailsBefore(ctx context.Context, before time.Time) (int64, error) {
+	return 0, nil
+}
+
+func (r *outboxRepo) email(i int) model.Email {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return *r.emails[i]
+}
+
+// makeDue lets a scheduled retry be claimed straight away
+func (r *outboxRepo) makeDue() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, email := range r.emails {
+		email.NextAttemptAt = time.Now().Add(-time.Second)
+	}
+}
+
+func newTestEmailService(t *testing.T) (*EmailService, *outboxRepo, *mailer.MemoryTransport) {
+	t.Helper()
+	t.Setenv("FROM_EMAIL", "Finance <no-reply@finance.example.com>")
+	repo := &outboxRepo{}
+	transport := mailer.NewMemoryTransport()
+	return NewEmailService(repo, transport), repo, transport
+}
+
+func TestQueueNotificationRendersTemplate(t *testing.T) {
+	s, repo, transport := newTestEmailService(t)
+	ctx := context.Background()
+
+	notification := &model.Notification{
+		Type:    model.NotificationTypeGoalDeadlineRisk,
+		Title:   "Goal Behind Schedule",
+		Message: "At your current pace Holiday won't be reached by Jun 1, 2025",
+		Data:    map[string]interface{}{"remaining": 800.0, "required_monthly": 200.0},
+	}
+	if err := s.QueueNotification(ctx, "ama@example.com", notification); err != nil {
+		t.Fatalf("QueueNotification returned error: %v", err)
+	}
+
+	queued := repo.email(0)
+	if queued.Template != "goal_deadline_risk" || queued.Status != model.EmailPending {
+		t.Errorf("queued template %q with status %s", queued.Template, queued.Status)
+	}
+	if !strings.Contains(queued.Text, "Still to save: 800.00") || !strings.Contains(queued.HTML, "<td>Still to save</td>") {
+		t.Errorf("email was not rendered from its template:\n%s\n%s", queued.Text, queued.HTML)
+	}
+	if len(transport.Messages()) != 0 {
+		t.Error("queueing sent the email straight away")
+	}
+
+	// Types without their own template use the generic one
+	notification.Type = model.NotificationType("something_new")
+	if err := s.QueueNotification(ctx, "ama@example.com", notification); err != nil {
+		t.Fatalf("QueueNotification returned error: %v", err)
+	}
+	if got := repo.email(1).Template; got != "notification" {
+		t.Errorf("fallback template = %q, want notification", got)
+	}
+
+	if err := s.QueueEmail(ctx, "", "Subject", "notification", notification); err == nil {
+		t.Error("QueueEmail accepted an empty recipient")
+	}
+	if err := s.QueueEmail(ctx, "ama@example.com", "Subject", "no_such_template", notification); err == nil {
+		t.Error("QueueEmail accepted an unknown template")
+	}
+}
+
+func TestProcessOutboxSendsMultipartEmail(t *testing.T) {
+	s, repo, transport := newTestEmailService(t)
+	ctx := context.Background()
+
+	if err := s.QueueEmail(ctx, "ama@example.com", "Bill due", "notification", &model.Notification{Title: "Bill due", Message: "Rent is due"}); err != nil {
+		t.Fatal(err)
+	}
+
+	sent, err := s.ProcessOutbox(ctx)
+	if err != nil || sent != 1 {
+		t.Fatalf("ProcessOutbox = %d, %v; want 1 sent", sent, err)
+	}
+
+	messages := transport.Messages()
+	if len(messages) != 1 {
+		t.Fatalf("transport got %d messages, want 1", len(messages))
+	}
+	msg := messages[0]
+	queued := repo.email(0)
+	if msg.To != "ama@example.com" || msg.From != "Finance <no-reply@finance.example.com>" || msg.Subject != "Bill due" {
+		t.Errorf("message addressed %q -> %q with subject %q", msg.From, msg.To, msg.Subject)
+	}
+	if msg.ID != queued.ID || msg.Text != queued.Text || msg.HTML != queued.HTML {
+		t.Error("message does not carry the queued email")
+	}
+	raw, err := msg.Bytes()
+	if err != nil || !strings.Contains(string(raw), "multipart/alternative") {
+		t.Errorf("message is not multipart text and HTML (%v)", err)
+	}
+
+	if queued.Status != model.EmailSent || queued.Attempts != 1 || queued.SentAt == nil {
+		t.Errorf("email recorded as %s after %d attempts, sent at %v", queued.Status, queued.Attempts, queued.SentAt)
+	}
+
+	// Nothing is left to send
+	if sent, err := s.ProcessOutbox(ctx); err != nil || sent != 0 {
+		t.Errorf("second ProcessOutbox = %d, %v; want nothing sent", sent, err)
+	}
+}
+
+func TestProcessOutboxRetriesThenFails(t *testing.T) {
+	s, repo, transport := newTestEmailService(t)
+	ctx := context.Background()
+
+	if err := s.QueueEmail(ctx, "ama@example.com", "Bill due", "notification", &model.Notification{Title: "Bill due"}); err != nil {
+		t.Fatal(err)
+	}
+
+	failure := fmt.Errorf("smtp: 451 try again later")
+	transport.FailWith(failure)
+
+	before := time.Now()
+	if sent, err := s.ProcessOutbox(ctx); err != nil || sent != 0 {
+		t.Fatalf("ProcessOutbox = %d, %v; want nothing sent", sent, err)
+	}
+	email := repo.email(0)
+	if email.Status != model.EmailPending || email.Attempts != 1 || email.LastError != failure.Error() {
+		t.Errorf("after a failure: status %s, %d attempts, error %q", email.Status, email.Attempts, email.LastError)
+	}
+	if wait := email.NextAttemptAt.Sub(before); wait < emailRetryBase || wait > emailRetryBase+5*time.Second {
+		t.Errorf("retry in %v, want about %v", wait, emailRetryBase)
+	}
+
+	// The retry isn't due yet
+	if sent, _ := s.ProcessOutbox(ctx); sent != 0 || repo.email(0).Attempts != 1 {
+		t.Error("retry was attempted before it was due")
+	}
+
+	for i := 2; i <= maxEmailAttempts; i++ {
+		repo.makeDue()
+		if _, err := s.ProcessOutbox(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	email = repo.email(0)
+	if email.Status != model.EmailFailed || email.Attempts != maxEmailAttempts {
+		t.Errorf("after %d failures: status %s, %d attempts; want failed", maxEmailAttempts, email.Status, email.Attempts)
+	}
+
+	// A failed email is not tried again, even once the transport recovers
+	transport.FailWith(nil)
+	repo.makeDue()
+	if sent, _ := s.ProcessOutbox(ctx); sent != 0 || len(transport.Messages()) != 0 {
+		t.Error("failed email was sent again")
+	}
+}
+
+func TestProcessOutboxRecoversAfterRetry(t *testing.T) {
+	s, repo, transport := newTestEmailService(t)
+	ctx := context.Background()
+
+	if err := s.QueueEmail(ctx, "ama@example.com", "Bill due", "notification", &model.Notification{Title: "Bill due"}); err != nil {
+		t.Fatal(err)
+	}
+
+	transport.FailWith(fmt.Errorf("connection refused"))
+	s.ProcessOutbox(ctx)
+	transport.FailWith(nil)
+	repo.makeDue()
+
+	if sent, err := s.ProcessOutbox(ctx); err != nil || sent != 1 {
+		t.Fatalf("ProcessOutbox = %d, %v; want 1 sent", sent, err)
+	}
+	email := repo.email(0)
+	if email.Status != model.EmailSent || email.Attempts != 2 || email.LastError != "" {
+		t.Errorf("status %s, %d attempts, error %q; want sent on the second attempt", email.Status, email.Attempts, email.LastError)
+	}
+}
+
+func TestEmailRetryDelay(t *testing.T) {
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{1, time.Minute},
+		{2, 2 * time.Minute},
+		{4, 8 * time.Minute},
+		{6, 32 * time.Minute},
+		{7, time.Hour},
+		{20, time.Hour},
+	}
+
+	for _, tt := range tests {
+		if got := emailRetryDelay(tt.attempts); got != tt.want {
+			t.Errorf("emailRetryDelay(%d) = %v, want %v", tt.attempts, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,242 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/yeboahd24/personal-finance-manager/internal/errors"
+	"github.com/yeboahd24/personal-finance-manager/internal/model"
+	"github.com/yeboahd24/personal-finance-manager/internal/repository"
+)
+
+const (
+	// eventChannel is the Postgres channel new events are announced on
+	eventChannel = "user_events"
+
+	// MaxEventReplay bounds how many missed events are read at a time when a
+	// stream resumes
+	MaxEventReplay = 500
+
+	// eventRetention is how long events are kept for streams to resume from
+	eventRetention = 7 * 24 * time.Hour
+
+	// eventBuffer is how many events a slow stream can fall behind by before
+	// it is dropped. The client reconnects and resumes from its last event.
+	eventBuffer = 64
+)
+
+// EventService publishes live events to users' notification streams. Events
+// are stored so streams can resume, and fanned out to every server instance
+// through Postgres LISTEN/NOTIFY. Events with a webhook counterpart are also
+// queued for the user's webhooks.
+type EventService struct {
+	repo     repository.Repository
+	webhooks *WebhookService // Optional, queues webhook deliveries
+
+	mu          sync.Mutex
+	subscribers map[string]map[chan *model.Event]struct{}
+	lastID      int64 // Highest event ID announced to this instance
+}
+
+func NewEventService(repo repository.Repository, webhooks *WebhookService) *EventService {
+	return &EventService{
+		repo:        repo,
+		webhooks:    webhooks,
+		subscribers: make(map[string]map[chan *model.Event]struct{}),
+	}
+}
+
+// Publish stores an event for the user and queues it for their webhooks.
+// Streams receive it once it is announced on the event channel. A nil service
+// publishes nothing.
+func (s *EventService) Publish(ctx context.Context, userID string, eventType model.EventType, data interface{}) error {
+	return s.publish(ctx, userID, eventType, data, true)
+}
+
+// publish queues an event for the user's webhooks, and stores it for their
+// streams when live is set
+func (s *EventService) publish(ctx context.Context, userID string, eventType model.EventType, data interface{}, live bool) error {
+	if s == nil {
+		return nil
+	}
+
+	b, err := json.Marshal(data)
+	if err != nil {
+		return errors.Wrap(err, "Failed to marshal event data", 500)
+	}
+
+	event := &model.Event{
+		UserID:    userID,
+		Type:      eventType,
+		Data:      b,
+		CreatedAt: time.Now(),
+	}
+	if live {
+		if err := s.repo.CreateEvent(ctx, event); err != nil {
+			return err
+		}
+	}
+
+	return s.webhooks.Enqueue(ctx, event)
+}
+
+// Subscribe registers a stream for the user's events. The channel is closed
+// when the stream is unsubscribed or falls too far behind.
+func (s *EventService) Subscribe(userID string) (<-chan *model.Event, func()) {
+	ch := make(chan *model.Event, eventBuffer)
+
+	s.mu.Lock()
+	if s.subscribers[userID] == nil {
+		s.subscribers[userID] = make(map[chan *model.Event]struct{})
+	}
+	s.subscribers[userID][ch] = struct{}{}
+	s.mu.Unlock()
+
+	return ch, func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.remove(userID, ch)
+	}
+}
+
+// remove drops and closes a subscriber. The caller holds s.mu.
+func (s *EventService) remove(userID string, ch chan *model.Event) {
+	subs := s.subscribers[userID]
+	if _, ok := subs[ch]; !ok {
+		return
+	}
+	delete(subs, ch)
+	close(ch)
+	if len(subs) == 0 {
+		delete(s.subscribers, userID)
+	}
+}
+
+// EventsAfter returns up to MaxEventReplay of the user's events after
+// afterID, for a stream resuming from Last-Event-ID
+func (s *EventService) EventsAfter(ctx context.Context, userID string, afterID int64) ([]*model.Event, error) {
+	return s.repo.GetEventsAfter(ctx, userID, afterID, MaxEventReplay)
+}
+
+// Listen relays events announced on the event channel to this instance's
+// subscribers until ctx is cancelled, and prunes old events hourly. It
+// returns an error only if it can't start listening.
+func (s *EventService) Listen(ctx context.Context, dbURL string) error {
+	listener := pq.NewListener(dbURL, 10*time.Second, time.Minute, func(event pq.ListenerEventType, err error) {
+		if err != nil {
+			log.Printf("Event listener: %v", err)
+		}
+	})
+	defer listener.Close()
+
+	if err := listener.Listen(eventChannel); err != nil {
+		return errors.Wrap(err, "Failed to listen for events", 500)
+	}
+
+	ping := time.NewTicker(90 * time.Second)
+	defer ping.Stop()
+	prune := time.NewTicker(time.Hour)
+	defer prune.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case n := <-listener.Notify:
+			// A nil notification means the connection was re-established and
+			// announcements may have been missed
+			if n == nil {
+				s.catchUp(ctx)
+				continue
+			}
+			s.announce(ctx, n.Extra)
+		case <-ping.C:
+			go listener.Ping()
+		case <-prune.C:
+			if _, err := s.repo.DeleteEventsBefore(ctx, time.Now().Add(-eventRetention)); err != nil {
+				log.Printf("Error pruning events: %v", err)
+			}
+		}
+	}
+}
+
+// announce handles an "id:user_id" announcement, loading the event only if
+// this instance has a stream for the user
+func (s *EventService) announce(ctx context.Context, payload string) {
+	idStr, userID, ok := strings.Cut(payload, ":")
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if !ok || err != nil {
+		log.Printf("Ignoring malformed event announcement %q", payload)
+		return
+	}
+
+	s.mu.Lock()
+	if id > s.lastID {
+		s.lastID = id
+	}
+	_, subscribed := s.subscribers[userID]
+	s.mu.Unlock()
+	if !subscribed {
+		return
+	}
+
+	event, err := s.repo.GetEventByID(ctx, id)
+	if err != nil {
+		log.Printf("Error loading event %d: %v", id, err)
+		return
+	}
+	s.dispatch(event)
+}
+
+// catchUp delivers events stored since the last announcement to every
+// subscribed user. Streams skip events they have already sent. Until an
+// announcement has been seen there is no position to catch up from.
+func (s *EventService) catchUp(ctx context.Context) {
+	s.mu.Lock()
+	lastID := s.lastID
+	if lastID == 0 {
+		s.mu.Unlock()
+		return
+	}
+	users := make([]string, 0, len(s.subscribers))
+	for userID := range s.subscribers {
+		users = append(users, userID)
+	}
+	s.mu.Unlock()
+
+	for _, userID := range users {
+		events, err := s.EventsAfter(ctx, userID, lastID)
+		if err != nil {
+			log.Printf("Error catching up events for user %s: %v", userID, err)
+			continue
+		}
+		for _, event := range events {
+			s.dispatch(event)
+		}
+	}
+}
+
+// dispatch hands an event to the user's subscribers, dropping any that are
+// too far behind to take it
+func (s *EventService) dispatch(event *model.Event) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if event.ID > s.lastID {
+		s.lastID = event.ID
+	}
+	for ch := range s.subscribers[event.UserID] {
+		select {
+		case ch <- event:
+		default:
+			log.Printf("Dropping slow event stream for user %s", event.UserID)
+			s.remove(event.UserID, ch)
+		}
+	}
+}
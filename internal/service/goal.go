@@ -0,0 +1,686 @@
+package service
+
+import (
+	"context"
+	"log"
+	"math"
+	"time"
+
+	"github.com/yeboahd24/personal-finance-manager/internal/errors"
+	"github.com/yeboahd24/personal-finance-manager/internal/model"
+	"github.com/yeboahd24/personal-finance-manager/internal/repository"
+)
+
+type GoalService struct {
+	repo                repository.Repository
+	notificationService *NotificationService
+}
+
+func NewGoalService(repo repository.Repository, notificationService *NotificationService) *GoalService {
+	return &GoalService{
+		repo:                repo,
+		notificationService: notificationService,
+	}
+}
+
+func (s *GoalService) CreateGoal(ctx context.Context, userID string, goal *model.Goal) error {
+	if err := s.validateGoal(ctx, userID, goal); err != nil {
+		return err
+	}
+
+	goal.UserID = userID
+	// Current amount is derived from contributions or backing accounts
+	goal.CurrentAmount = 0
+	goal.CycleStart = nil
+	goal.LastMatchedTransactionID = nil
+
+	if err := s.repo.CreateGoal(ctx, goal); err != nil {
+		return errors.Wrap(err, "Failed to create goal", 500)
+	}
+
+	if goal.IsAccountBacked() {
+		if err := s.repo.SetGoalAccounts(ctx, goal.ID, goal.Accounts); err != nil {
+			return errors.Wrap(err, "Failed to link goal accounts", 500)
+		}
+	}
+
+	if err := s.populateGoal(ctx, goal); err != nil {
+		return err
+	}
+	return s.refreshTransferSuggestion(ctx, goal)
+}
+
+func (s *GoalService) GetGoalByID(ctx context.Context, userID, id string) (*model.Goal, error) {
+	goal, err := s.getUserGoal(ctx, userID, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.populateGoal(ctx, goal); err != nil {
+		return nil, err
+	}
+	return goal, nil
+}
+
+func (s *GoalService) GetGoals(ctx context.Context, userID string) ([]*model.Goal, error) {
+	goals, err := s.repo.GetGoalsByUserID(ctx, userID)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to get goals", 500)
+	}
+
+	for _, goal := range goals {
+		if err := s.populateGoal(ctx, goal); err != nil {
+			return nil, err
+		}
+	}
+
+	if goals == nil {
+		return []*model.Goal{}, nil
+	}
+	return goals, nil
+}
+
+func (s *GoalService) UpdateGoal(ctx context.Context, userID string, goal *model.Goal) error {
+	existing, err := s.getUserGoal(ctx, userID, goal.ID)
+	if err != nil {
+		return err
+	}
+
+	if err := s.validateGoal(ctx, userID, goal); err != nil {
+		return err
+	}
+
+	// Keep original user_id, derived current amount and cycle state
+	goal.UserID = existing.UserID
+	goal.CurrentAmount = existing.CurrentAmount
+	goal.CreatedAt = existing.CreatedAt
+	goal.CycleStart = existing.CycleStart
+	goal.LastMatchedTransactionID = existing.LastMatchedTransactionID
+
+	if err := s.repo.UpdateGoal(ctx, goal); err != nil {
+		return errors.Wrap(err, "Failed to update goal", 500)
+	}
+
+	if err := s.repo.SetGoalAccounts(ctx, goal.ID, goal.Accounts); err != nil {
+		return errors.Wrap(err, "Failed to link goal accounts", 500)
+	}
+
+	if err := s.syncCurrentAmount(ctx, goal); err != nil {
+		return err
+	}
+	return s.refreshTransferSuggestion(ctx, goal)
+}
+
+func (s *GoalService) DeleteGoal(ctx context.Context, userID, id string) error {
+	if _, err := s.getUserGoal(ctx, userID, id); err != nil {
+		return err
+	}
+
+	if err := s.repo.DeleteGoal(ctx, id, userID); err != nil {
+		return errors.Wrap(err, "Failed to delete goal", 500)
+	}
+	return nil
+}
+
+// AddContribution records a manual contribution, or links a transaction into
+// the goal's designated account when TransactionID is set
+func (s *GoalService) AddContribution(ctx context.Context, userID, goalID string, contribution *model.GoalContribution) error {
+	goal, err := s.getUserGoal(ctx, userID, goalID)
+	if err != nil {
+		return err
+	}
+
+	accounts, err := s.repo.GetGoalAccounts(ctx, goal.ID)
+	if err != nil {
+		return errors.Wrap(err, "Failed to get goal accounts", 500)
+	}
+	if len(accounts) > 0 {
+		return errors.New("Progress for this goal follows its linked account balances", 400)
+	}
+
+	if contribution.TransactionID != nil && *contribution.TransactionID != "" {
+		if goal.AccountID == nil {
+			return errors.New("Goal has no designated account to link transactions from", 400)
+		}
+
+		tx, err := s.repo.GetTransactionByID(ctx, *contribution.TransactionID)
+		if err != nil {
+			if err == errors.ErrNotFound {
+				return errors.New("Transaction not found", 400)
+			}
+			return err
+		}
+		if tx.UserID != userID {
+			return errors.New("Transaction not found", 400)
+		}
+		if tx.AccountID != *goal.AccountID {
+			return errors.New("Transaction is not into the goal's designated account", 400)
+		}
+		if tx.Amount <= 0 {
+			return errors.New("Only incoming transactions or transfers can be linked to a goal", 400)
+		}
+
+		contribution.Amount = tx.Amount
+		contribution.Date = tx.Date
+		if contribution.Note == "" {
+			contribution.Note = tx.Description
+		}
+	} else {
+		contribution.TransactionID = nil
+		if contribution.Amount == 0 {
+			return errors.New("Amount is required", 400)
+		}
+	}
+
+	if contribution.Date.IsZero() {
+		contribution.Date = time.Now().UTC()
+	}
+
+	contribution.GoalID = goal.ID
+	contribution.UserID = userID
+
+	if err := s.repo.CreateGoalContribution(ctx, contribution); err != nil {
+		if err == errors.ErrDuplicateResource {
+			return errors.New("Transaction is already linked to this goal", 409)
+		}
+		return errors.Wrap(err, "Failed to create goal contribution", 500)
+	}
+
+	return s.syncCurrentAmount(ctx, goal)
+}
+
+func (s *GoalService) GetContributions(ctx context.Context, userID, goalID string) ([]*model.GoalContribution, error) {
+	goal, err := s.getUserGoal(ctx, userID, goalID)
+	if err != nil {
+		return nil, err
+	}
+
+	contributions, err := s.repo.GetGoalContributions(ctx, goal.ID)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to get goal contributions", 500)
+	}
+
+	if contributions == nil {
+		return []*model.GoalContribution{}, nil
+	}
+	return contributions, nil
+}
+
+func (s *GoalService) DeleteContribution(ctx context.Context, userID, goalID, contributionID string) error {
+	goal, err := s.getUserGoal(ctx, userID, goalID)
+	if err != nil {
+		return err
+	}
+
+	if err := s.repo.DeleteGoalContribution(ctx, contributionID, goal.ID); err != nil {
+		if err == errors.ErrNotFound {
+			return err
+		}
+		return errors.Wrap(err, "Failed to delete goal contribution", 500)
+	}
+
+	return s.syncCurrentAmount(ctx, goal)
+}
+
+// MatchSinkingFundExpense resets any of the user's sinking funds whose target
+// expense is the given transaction, starting their next cycle and refreshing
+// their suggested transfer for it
+func (s *GoalService) MatchSinkingFundExpense(ctx context.Context, tx *model.Transaction) error {
+	goals, err := s.repo.GetGoalsByUserID(ctx, tx.UserID)
+	if err != nil {
+		return errors.Wrap(err, "Failed to get goals", 500)
+	}
+
+	for _, goal := range goals {
+		if !goal.MatchesExpense(tx) {
+			continue
+		}
+
+		goal.NextCycle(tx.Date)
+		txID := tx.ID
+		goal.LastMatchedTransactionID = &txID
+
+		if err := s.repo.UpdateGoal(ctx, goal); err != nil {
+			return errors.Wrap(err, "Failed to reset sinking fund", 500)
+		}
+
+		if err := s.populateGoal(ctx, goal); err != nil {
+			return err
+		}
+		if err := s.refreshTransferSuggestion(ctx, goal); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// GetTransferSuggestion returns a sinking fund's suggested monthly transfer.
+// The goal must have its progress populated.
+func (s *GoalService) GetTransferSuggestion(ctx context.Context, goal *model.Goal) (*model.SinkingFundTransfer, error) {
+	if goal.Kind != model.GoalKindSinkingFund {
+		return nil, errors.New("Transfer suggestions are only available for sinking funds", 400)
+	}
+	if goal.FundingAccountID == nil {
+		return nil, errors.New("Sinking fund has no funding account to transfer from", 400)
+	}
+	if goal.TransferAccountID() == "" {
+		return nil, errors.New("Sinking fund has no account to transfer into", 400)
+	}
+
+	transfer, err := s.repo.GetSinkingFundTransfer(ctx, goal.ID)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to get transfer suggestion", 500)
+	}
+	if transfer != nil {
+		return transfer, nil
+	}
+
+	// Funds set up before suggestions were stored get theirs now
+	if err := s.refreshTransferSuggestion(ctx, goal); err != nil {
+		return nil, err
+	}
+	transfer, err = s.repo.GetSinkingFundTransfer(ctx, goal.ID)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to get transfer suggestion", 500)
+	}
+	if transfer == nil {
+		return nil, errors.ErrNotFound
+	}
+	return transfer, nil
+}
+
+// refreshTransferSuggestion works out a sinking fund's monthly transfer again
+// from its progress. Once the transfer has been accepted its recurring debit
+// and credit are updated to match, so they go on funding the new target or
+// cycle.
+func (s *GoalService) refreshTransferSuggestion(ctx context.Context, goal *model.Goal) error {
+	now := time.Now().UTC()
+	transfer := goal.PlanTransfer(now)
+	if transfer == nil {
+		return nil
+	}
+
+	existing, err := s.repo.GetSinkingFundTransfer(ctx, goal.ID)
+	if err != nil {
+		return errors.Wrap(err, "Failed to get transfer suggestion", 500)
+	}
+	if existing != nil && existing.Accepted() {
+		transfer.StartDate = existing.StartDate
+		transfer.DebitRecurringID = existing.DebitRecurringID
+		transfer.CreditRecurringID = existing.CreditRecurringID
+
+		if err := s.updateTransferLeg(ctx, transfer.DebitRecurringID, transfer.FromAccountID, -transfer.Amount, transfer.EndDate, now); err != nil {
+			return err
+		}
+		if err := s.updateTransferLeg(ctx, transfer.CreditRecurringID, transfer.ToAccountID, transfer.Amount, transfer.EndDate, now); err != nil {
+			return err
+		}
+	}
+
+	if err := s.repo.SaveSinkingFundTransfer(ctx, transfer); err != nil {
+		return errors.Wrap(err, "Failed to save transfer suggestion", 500)
+	}
+	return nil
+}
+
+// updateTransferLeg points one recurring side of an accepted transfer at its
+// account, amount and end date. A leg with nothing left to move is
+// deactivated; one that had finished is picked up again.
+func (s *GoalService) updateTransferLeg(ctx context.Context, id *string, accountID string, amount float64, end, now time.Time) error {
+	if id == nil {
+		return nil
+	}
+
+	rt, err := s.repo.GetRecurringTransactionByID(ctx, *id)
+	if err != nil {
+		if err == errors.ErrNotFound {
+			return nil
+		}
+		return errors.Wrap(err, "Failed to get transfer", 500)
+	}
+
+	rt.AccountID = accountID
+	rt.EndDate = &end
+	if amount != 0 {
+		rt.Amount = amount
+	}
+	if rt.PausedAt == nil {
+		rt.NextRun = rt.CalculateNextRun(now)
+		rt.Active = amount != 0 && !rt.NextRun.IsZero()
+	}
+
+	if err := s.repo.UpdateRecurringTransaction(ctx, rt); err != nil {
+		return errors.Wrap(err, "Failed to update transfer", 500)
+	}
+	return nil
+}
+
+// EvaluateNotifications checks every goal for newly reached milestones, a
+// projected completion past its deadline, and a lapse in contributions
+func (s *GoalService) EvaluateNotifications(ctx context.Context) error {
+	goals, err := s.repo.GetAllGoals(ctx)
+	if err != nil {
+		return errors.Wrap(err, "Failed to get goals", 500)
+	}
+
+	now := time.Now().UTC()
+	prefsByUser := make(map[string]*model.NotificationPreferences)
+	for _, goal := range goals {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		prefs, ok := prefsByUser[goal.UserID]
+		if !ok {
+			prefs, err = s.repo.GetNotificationPreferences(ctx, goal.UserID)
+			if err != nil {
+				log.Printf("Error getting notification preferences for user %s: %v", goal.UserID, err)
+				continue
+			}
+			prefsByUser[goal.UserID] = prefs
+		}
+
+		if err := s.evaluateGoal(ctx, goal, prefs, now); err != nil {
+			log.Printf("Error evaluating notifications for goal %s: %v", goal.ID, err)
+		}
+	}
+
+	return nil
+}
+
+func (s *GoalService) evaluateGoal(ctx context.Context, goal *model.Goal, prefs *model.NotificationPreferences, now time.Time) error {
+	if err := s.populateGoal(ctx, goal); err != nil {
+		return err
+	}
+
+	state, err := s.repo.GetGoalNotificationState(ctx, goal.ID)
+	if err != nil {
+		return errors.Wrap(err, "Failed to get goal notification state", 500)
+	}
+
+	// Progress can also fall back, e.g. when a sinking fund starts a new
+	// cycle, so milestones are announced again when reached again
+	milestone := goal.Progress.ReachedMilestone()
+	if milestone != state.Milestone {
+		next := *state
+		next.Milestone = milestone
+
+		var send func() error
+		if milestone > state.Milestone && prefs.GoalMilestones {
+			send = func() error { return s.notificationService.NotifyGoalMilestone(ctx, goal, milestone) }
+		}
+		if state, err = s.advanceNotificationState(ctx, state, &next, send); err != nil || state == nil {
+			return err
+		}
+	}
+
+	atRisk := goal.Progress.AtRisk()
+	if atRisk != state.DeadlineRiskNotified {
+		next := *state
+		next.DeadlineRiskNotified = atRisk
+
+		var send func() error
+		if atRisk && prefs.GoalDeadlineRisk {
+			send = func() error { return s.notificationService.NotifyGoalDeadlineRisk(ctx, goal) }
+		}
+		if state, err = s.advanceNotificationState(ctx, state, &next, send); err != nil || state == nil {
+			return err
+		}
+	}
+
+	// Reminders only make sense for goals funded by contributions
+	if prefs.GoalReminders && goal.Progress.RemainingAmount > 0 && !goal.IsAccountBacked() {
+		days := prefs.GoalReminderDays
+		if days <= 0 {
+			days = model.DefaultGoalReminderDays
+		}
+
+		last, err := s.lastContributionActivity(ctx, goal)
+		if err != nil {
+			return err
+		}
+		if state.LastReminderAt != nil && state.LastReminderAt.After(last) {
+			last = *state.LastReminderAt
+		}
+
+		if now.Sub(last) >= time.Duration(days)*24*time.Hour {
+			next := *state
+			remindedAt := now.Truncate(time.Microsecond)
+			next.LastReminderAt = &remindedAt
+
+			send := func() error {
+				return s.notificationService.NotifyGoalContributionReminder(ctx, goal, int(now.Sub(last).Hours()/24))
+			}
+			if _, err := s.advanceNotificationState(ctx, state, &next, send); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// advanceNotificationState claims the move of a goal's notification state
+// from current to next before sending its notification, if any, so
+// concurrent evaluations can't both send it. The claim is handed back if
+// sending fails. It returns nil without an error when another evaluation got
+// there first.
+func (s *GoalService) advanceNotificationState(ctx context.Context, current, next *model.GoalNotificationState, send func() error) (*model.GoalNotificationState, error) {
+	claimed, err := s.repo.ClaimGoalNotificationState(ctx, current, next)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to claim goal notification", 500)
+	}
+	if !claimed {
+		return nil, nil
+	}
+
+	if send != nil {
+		if err := send(); err != nil {
+			if _, releaseErr := s.repo.ClaimGoalNotificationState(ctx, next, current); releaseErr != nil {
+				log.Printf("Error releasing notification state for goal %s: %v", current.GoalID, releaseErr)
+			}
+			return nil, err
+		}
+	}
+	return next, nil
+}
+
+// lastContributionActivity returns when the goal last received a contribution
+// in its current cycle, falling back to when the cycle or goal started
+func (s *GoalService) lastContributionActivity(ctx context.Context, goal *model.Goal) (time.Time, error) {
+	last := goal.CreatedAt
+	if goal.CycleStart != nil && goal.CycleStart.After(last) {
+		last = *goal.CycleStart
+	}
+
+	contributions, err := s.repo.GetGoalContributions(ctx, goal.ID)
+	if err != nil {
+		return last, errors.Wrap(err, "Failed to get goal contributions", 500)
+	}
+	for _, c := range contributions {
+		if goal.InCycle(c.Date) && c.Date.After(last) {
+			last = c.Date
+		}
+	}
+
+	return last, nil
+}
+
+// populateGoal loads the goal's backing accounts and contributions, refreshing
+// its current amount and progress. The stored amount is only rewritten when it
+// has drifted, e.g. after a backing account's balance changed.
+func (s *GoalService) populateGoal(ctx context.Context, goal *model.Goal) error {
+	changed, err := s.refreshCurrentAmount(ctx, goal)
+	if err != nil || !changed {
+		return err
+	}
+
+	if err := s.repo.UpdateGoal(ctx, goal); err != nil {
+		return errors.Wrap(err, "Failed to update goal", 500)
+	}
+	return nil
+}
+
+// refreshCurrentAmount derives the goal's current amount from its backing
+// account balances, or otherwise from contributions in the current cycle
+func (s *GoalService) refreshCurrentAmount(ctx context.Context, goal *model.Goal) (bool, error) {
+	accounts, err := s.repo.GetGoalAccounts(ctx, goal.ID)
+	if err != nil {
+		return false, errors.Wrap(err, "Failed to get goal accounts", 500)
+	}
+	goal.Accounts = accounts
+
+	contributions, err := s.repo.GetGoalContributions(ctx, goal.ID)
+	if err != nil {
+		return false, errors.Wrap(err, "Failed to get goal contributions", 500)
+	}
+
+	var total float64
+	if goal.IsAccountBacked() {
+		for _, a := range goal.Accounts {
+			total += a.Balance * a.Fraction
+		}
+	} else {
+		for _, c := range contributions {
+			if goal.InCycle(c.Date) {
+				total += c.Amount
+			}
+		}
+	}
+	total = math.Round(total*100) / 100
+
+	changed := total != goal.CurrentAmount
+	goal.CurrentAmount = total
+
+	now := time.Now().UTC()
+	if goal.IsAccountBacked() {
+		// Pace follows the backing accounts' movement over the window
+		start := now.Add(-model.GoalPaceWindow)
+		if goal.CycleStart != nil && goal.CycleStart.After(start) {
+			start = *goal.CycleStart
+		}
+		recent, err := s.repo.GetGoalAccountsChange(ctx, goal.ID, start, now)
+		if err != nil {
+			return false, errors.Wrap(err, "Failed to get goal account activity", 500)
+		}
+		goal.Progress = goal.ProgressAtPace(recent, now)
+	} else {
+		goal.Progress = goal.CalculateProgress(contributions, now)
+	}
+	return changed, nil
+}
+
+// syncCurrentAmount refreshes the goal's current amount and persists it
+func (s *GoalService) syncCurrentAmount(ctx context.Context, goal *model.Goal) error {
+	if _, err := s.refreshCurrentAmount(ctx, goal); err != nil {
+		return err
+	}
+
+	if err := s.repo.UpdateGoal(ctx, goal); err != nil {
+		return errors.Wrap(err, "Failed to update goal", 500)
+	}
+
+	return nil
+}
+
+func (s *GoalService) getUserGoal(ctx context.Context, userID, id string) (*model.Goal, error) {
+	goal, err := s.repo.GetGoalByID(ctx, id)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to get goal", 500)
+	}
+
+	if goal == nil || goal.UserID != userID {
+		return nil, errors.ErrNotFound
+	}
+
+	return goal, nil
+}
+
+func (s *GoalService) validateGoal(ctx context.Context, userID string, goal *model.Goal) error {
+	if goal.Name == "" {
+		return errors.New("Name is required", 400)
+	}
+
+	if goal.TargetAmount <= 0 {
+		return errors.New("Target amount must be greater than 0", 400)
+	}
+
+	if goal.Deadline.IsZero() {
+		return errors.New("Deadline is required", 400)
+	}
+
+	if goal.Kind == "" {
+		goal.Kind = model.GoalKindSavings
+	}
+
+	switch goal.Kind {
+	case model.GoalKindSavings:
+		goal.ExpenseMatch = ""
+		goal.Recurrence = nil
+	case model.GoalKindSinkingFund:
+		if goal.ExpenseMatch == "" {
+			return errors.New("Expense match is required for sinking funds", 400)
+		}
+		if goal.Recurrence != nil {
+			switch *goal.Recurrence {
+			case model.RecurrenceDaily, model.RecurrenceWeekly, model.RecurrenceMonthly, model.RecurrenceYearly:
+			default:
+				return errors.New("Invalid recurrence", 400)
+			}
+		}
+	default:
+		return errors.New("Invalid goal kind", 400)
+	}
+
+	if goal.AccountID != nil && *goal.AccountID == "" {
+		goal.AccountID = nil
+	}
+
+	// Verify backing accounts belong to user and fractions are sensible
+	seen := make(map[string]bool)
+	for i := range goal.Accounts {
+		a := &goal.Accounts[i]
+		if a.Fraction == 0 {
+			a.Fraction = 1
+		}
+		if a.Fraction < 0 || a.Fraction > 1 {
+			return errors.New("Account fraction must be between 0 and 1", 400)
+		}
+		if seen[a.AccountID] {
+			return errors.New("Account linked more than once", 400)
+		}
+		seen[a.AccountID] = true
+
+		account, err := s.repo.GetAccountByID(ctx, a.AccountID)
+		if err != nil || account.UserID != userID {
+			return errors.New("Account not found", 400)
+		}
+	}
+
+	if goal.FundingAccountID != nil && *goal.FundingAccountID == "" {
+		goal.FundingAccountID = nil
+	}
+	if goal.Kind != model.GoalKindSinkingFund {
+		goal.FundingAccountID = nil
+	}
+	if goal.FundingAccountID != nil {
+		if *goal.FundingAccountID == goal.TransferAccountID() {
+			return errors.New("Funding account must differ from the account the fund saves into", 400)
+		}
+		account, err := s.repo.GetAccountByID(ctx, *goal.FundingAccountID)
+		if err != nil || account.UserID != userID {
+			return errors.New("Funding account not found", 400)
+		}
+	}
+
+	// Verify designated account exists and belongs to user
+	if goal.AccountID != nil {
+		account, err := s.repo.GetAccountByID(ctx, *goal.AccountID)
+		if err != nil || account.UserID != userID {
+			return errors.New("Account not found", 400)
+		}
+	}
+
+	return nil
+}
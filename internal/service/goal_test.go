@@ -0,0 +1,348 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/yeboahd24/personal-finance-manager/internal/errors"
+	"github.com/yeboahd24/personal-finance-manager/internal/model"
+	"github.com/yeboahd24/personal-finance-manager/internal/repository"
+)
+
+// sinkingFundRepo keeps one user's goals, transfers and recurring
+// transactions in memory
+type sinkingFundRepo struct {
+	repository.Repository
+	goals     map[string]*model.Goal
+	transfers map[string]*model.SinkingFundTransfer
+	recurring map[string]*model.RecurringTransaction
+}
+
+func newSinkingFundRepo() *sinkingFundRepo {
+	return &sinkingFundRepo{
+		goals:     make(map[string]*model.Goal),
+		transfers: make(map[string]*model.SinkingFundTransfer),
+		recurring: make(map[string]*model.RecurringTransaction),
+	}
+}
+
+func (r *sinkingFundRepo) GetAccountByID(ctx context.Context, id string) (*model.Account, error) {
+	return &model.Account{ID: id, UserID: "user"}, nil
+}
+
+func (r *sinkingFundRepo) CreateGoal(ctx context.Context, goal *model.Goal) error {
+	goal.ID = "goal"
+	goal.CreatedAt = time.Now()
+	stored := *goal
+	r.goals[goal.ID] = &stored
+	return nil
+}
+
+func (r *sinkingFundRepo) UpdateGoal(ctx context.Context, goal *model.Goal) error {
+	stored := *goal
+	r.goals[goal.ID] = &stored
+	return nil
+}
+
+func (r *sinkingFundRepo) GetGoalsByUserID(ctx context.Context, userID string) ([]*model.Goal, error) {
+	var goals []*model.Goal
+	for _, g := range r.goals {
+		goal := *g
+		goals = append(goals, &goal)
+	}
+	return goals, nil
+}
+
+func (r *sinkingFundRepo) GetGoalAccounts(ctx context.Context, goalID string) ([]model.GoalAccount, error) {
+	return nil, nil
+}
+
+func (r *sinkingFundRepo) GetGoalContributions(ctx context.Context, goalID string) ([]*model.GoalContribution, error) {
+	return nil, nil
+}
+
+func (r *sinkingFundRepo) GetSinkingFundTransfer(ctx context.Context, goalID string) (*model.SinkingFundTransfer, error) {
+	if t, ok := r.transfers[goalID]; ok {
+		transfer := *t
+		return &transfer, nil
+	}
+	return nil, nil
+}
+
+func (r *sinkingFundRepo) SaveSinkingFundTransfer(ctx context.Context, transfer *model.SinkingFundTransfer) error {
+	stored := *transfer
+	r.transfers[transfer.GoalID] = &stored
+	return nil
+}
+
+func (r *sinkingFundRepo) GetRecurringTransactionByID(ctx context.Context, id string) (*model.RecurringTransaction, error) {
+	if rt, ok := r.recurring[id]; ok {
+		stored := *rt
+		return &stored, nil
+	}
+	return nil, errors.ErrNotFound
+}
+
+func (r *sinkingFundRepo) UpdateRecurringTransaction(ctx context.Context, rt *model.RecurringTransaction) error {
+	stored := *rt
+	r.recurring[rt.ID] = &stored
+	return nil
+}
+
+func TestSinkingFundTransferSuggestedOnCreate(t *testing.T) {
+	repo := newSinkingFundRepo()
+	s := NewGoalService(repo, nil)
+
+	checking, savings := "checking", "savings"
+	now := time.Now().UTC()
+	goal := &model.Goal{
+		Kind:             model.GoalKindSinkingFund,
+		Name:             "Car insurance",
+		TargetAmount:     1200,
+		Deadline:         now.AddDate(0, 6, 0),
+		ExpenseMatch:     "insurance",
+		AccountID:        &savings,
+		FundingAccountID: &checking,
+	}
+	if err := s.CreateGoal(context.Background(), "user", goal); err != nil {
+		t.Fatalf("CreateGoal returned error: %v", err)
+	}
+
+	transfer := repo.transfers["goal"]
+	if transfer == nil {
+		t.Fatal("no transfer was suggested when the sinking fund was created")
+	}
+	if transfer.FromAccountID != checking || transfer.ToAccountID != savings {
+		t.Errorf("transfer from %s to %s, want checking to savings", transfer.FromAccountID, transfer.ToAccountID)
+	}
+	if transfer.Amount <= 0 || transfer.Accepted() {
+		t.Errorf("suggested %v accepted=%v, want a positive unaccepted amount", transfer.Amount, transfer.Accepted())
+	}
+	if !transfer.StartDate.Equal(model.NextTransferDate(now)) || !transfer.EndDate.Equal(goal.Deadline) {
+		t.Errorf("transfer runs %v to %v", transfer.StartDate, transfer.EndDate)
+	}
+
+	// Both legs move the same amount in opposite directions
+	debit, credit := transfer.Legs("transfer-category", "Sinking fund: Car insurance")
+	if debit.AccountID != checking || debit.Amount != -transfer.Amount {
+		t.Errorf("debit is %v on %s", debit.Amount, debit.AccountID)
+	}
+	if credit.AccountID != savings || credit.Amount != transfer.Amount {
+		t.Errorf("credit is %v on %s", credit.Amount, credit.AccountID)
+	}
+}
+
+func TestSinkingFundTransferRefreshedOnNewCycle(t *testing.T) {
+	repo := newSinkingFundRepo()
+	s := NewGoalService(repo, nil)
+
+	now := time.Now().UTC()
+	checking, savings := "checking", "savings"
+	monthly := model.RecurrenceMonthly
+	deadline := now.AddDate(0, 0, 3)
+	repo.goals["goal"] = &model.Goal{
+		ID:               "goal",
+		UserID:           "user",
+		Kind:             model.GoalKindSinkingFund,
+		Name:             "Rent reserve",
+		TargetAmount:     600,
+		Deadline:         deadline,
+		ExpenseMatch:     "rent",
+		Recurrence:       &monthly,
+		AccountID:        &savings,
+		FundingAccountID: &checking,
+		CreatedAt:        now.AddDate(0, -1, 0),
+	}
+
+	// The transfer was accepted for the cycle that is ending
+	debitID, creditID := "debit", "credit"
+	lastRun := now.AddDate(0, 0, -10)
+	for id, leg := range map[string]struct {
+		account string
+		amount  float64
+	}{debitID: {checking, -600}, creditID: {savings, 600}} {
+		repo.recurring[id] = &model.RecurringTransaction{
+			ID:          id,
+			UserID:      "user",
+			AccountID:   leg.account,
+			Amount:      leg.amount,
+			Description: "Sinking fund: Rent reserve",
+			RRule:       model.SinkingFundTransferRRule,
+			StartDate:   now.AddDate(0, -1, 0),
+			EndDate:     &deadline,
+			LastRun:     &lastRun,
+			Active:      true,
+		}
+	}
+	repo.transfers["goal"] = &model.SinkingFundTransfer{
+		GoalID:            "goal",
+		UserID:            "user",
+		FromAccountID:     checking,
+		ToAccountID:       savings,
+		Amount:            600,
+		StartDate:         now.AddDate(0, -1, 0),
+		EndDate:           deadline,
+		DebitRecurringID:  &debitID,
+		CreditRecurringID: &creditID,
+	}
+
+	rent := &model.Transaction{ID: "tx", UserID: "user", Amount: -600, Description: "Rent", Date: now}
+	if err := s.MatchSinkingFundExpense(context.Background(), rent); err != nil {
+		t.Fatalf("MatchSinkingFundExpense returned error: %v", err)
+	}
+
+	newDeadline := repo.goals["goal"].Deadline
+	if !newDeadline.After(deadline) {
+		t.Fatalf("deadline did not move on: %v", newDeadline)
+	}
+
+	transfer := repo.transfers["goal"]
+	if !transfer.EndDate.Equal(newDeadline) || !transfer.Accepted() {
+		t.Errorf("transfer ends %v accepted=%v, want the new deadline and still accepted", transfer.EndDate, transfer.Accepted())
+	}
+	if transfer.Amount <= 0 {
+		t.Errorf("refreshed amount = %v", transfer.Amount)
+	}
+
+	debit, credit := repo.recurring[debitID], repo.recurring[creditID]
+	if debit.Amount != -transfer.Amount || credit.Amount != transfer.Amount {
+		t.Errorf("legs move %v and %v, want -%v and %v", debit.Amount, credit.Amount, transfer.Amount, transfer.Amount)
+	}
+	for _, leg := range []*model.RecurringTransaction{debit, credit} {
+		if leg.EndDate == nil || !leg.EndDate.Equal(newDeadline) {
+			t.Errorf("leg %s ends %v, want %v", leg.ID, leg.EndDate, newDeadline)
+		}
+		if !leg.Active || leg.NextRun.IsZero() || leg.NextRun.Before(now) {
+			t.Errorf("leg %s active=%v next run %v", leg.ID, leg.Active, leg.NextRun)
+		}
+	}
+}
+
+// goalNotificationRepo keeps a goal's notification state in memory. With
+// stale set, reads keep returning the state first read, as seen by an
+// evaluation running alongside another.
+type goalNotificationRepo struct {
+	repository.Repository
+	mu            sync.Mutex
+	contributions []*model.GoalContribution
+	state         model.GoalNotificationState
+	staleRead     *model.GoalNotificationState
+	stale         bool
+	notifications int
+	failNotify    error
+}
+
+func (r *goalNotificationRepo) GetGoalAccounts(ctx context.Context, goalID string) ([]model.GoalAccount, error) {
+	return nil, nil
+}
+
+func (r *goalNotificationRepo) GetGoalContributions(ctx context.Context, goalID string) ([]*model.GoalContribution, error) {
+	return r.contributions, nil
+}
+
+func (r *goalNotificationRepo) UpdateGoal(ctx context.Context, goal *model.Goal) error {
+	return nil
+}
+
+func (r *goalNotificationRepo) GetGoalNotificationState(ctx context.Context, goalID string) (*model.GoalNotificationState, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.stale && r.staleRead != nil {
+		state := *r.staleRead
+		return &state, nil
+	}
+	state := r.state
+	state.GoalID = goalID
+	r.staleRead = &state
+	read := state
+	return &read, nil
+}
+
+func (r *goalNotificationRepo) ClaimGoalNotificationState(ctx context.Context, current, next *model.GoalNotificationState) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.state.Milestone != current.Milestone || r.state.DeadlineRiskNotified != current.DeadlineRiskNotified {
+		return false, nil
+	}
+	r.state = *next
+	return true, nil
+}
+
+func (r *goalNotificationRepo) CreateNotification(ctx context.Context, notification *model.Notification) error {
+	if r.failNotify != nil {
+		return r.failNotify
+	}
+	r.notifications++
+	return nil
+}
+
+func (r *goalNotificationRepo) GetNotificationPreferences(ctx context.Context, userID string) (*model.NotificationPreferences, error) {
+	return &model.NotificationPreferences{MinPriority: model.NotificationPriorityHigh}, nil
+}
+
+func newMilestoneGoal(repo *goalNotificationRepo) (*GoalService, *model.Goal) {
+	now := time.Now().UTC()
+	repo.contributions = []*model.GoalContribution{{Amount: 60, Date: now.AddDate(0, 0, -1)}}
+	goal := &model.Goal{
+		ID:           "goal",
+		UserID:       "user",
+		Kind:         model.GoalKindSavings,
+		Name:         "Laptop",
+		TargetAmount: 100,
+		Deadline:     now.AddDate(1, 0, 0),
+		CreatedAt:    now.AddDate(0, -1, 0),
+	}
+	return NewGoalService(repo, NewNotificationService(repo, nil, nil)), goal
+}
+
+func TestGoalMilestoneSentOnceAcrossConcurrentEvaluations(t *testing.T) {
+	repo := &goalNotificationRepo{}
+	s, goal := newMilestoneGoal(repo)
+	prefs := &model.NotificationPreferences{GoalMilestones: true}
+	ctx := context.Background()
+	now := time.Now().UTC()
+
+	if err := s.evaluateGoal(ctx, goal, prefs, now); err != nil {
+		t.Fatalf("evaluateGoal returned error: %v", err)
+	}
+	if repo.notifications != 1 || repo.state.Milestone != 50 {
+		t.Fatalf("sent %d notifications, milestone %d; want 1 and 50", repo.notifications, repo.state.Milestone)
+	}
+
+	// A second evaluation that read the state before the first claimed it
+	repo.stale = true
+	if err := s.evaluateGoal(ctx, goal, prefs, now); err != nil {
+		t.Fatalf("evaluateGoal returned error: %v", err)
+	}
+	if repo.notifications != 1 {
+		t.Errorf("milestone was sent %d times", repo.notifications)
+	}
+}
+
+func TestGoalMilestoneReleasedWhenSendFails(t *testing.T) {
+	repo := &goalNotificationRepo{failNotify: fmt.Errorf("database is down")}
+	s, goal := newMilestoneGoal(repo)
+	prefs := &model.NotificationPreferences{GoalMilestones: true}
+	ctx := context.Background()
+	now := time.Now().UTC()
+
+	if err := s.evaluateGoal(ctx, goal, prefs, now); err == nil {
+		t.Fatal("evaluateGoal hid the failed notification")
+	}
+	if repo.state.Milestone != 0 {
+		t.Fatalf("milestone %d kept after the notification failed", repo.state.Milestone)
+	}
+
+	repo.failNotify = nil
+	if err := s.evaluateGoal(ctx, goal, prefs, now); err != nil {
+		t.Fatalf("evaluateGoal returned error: %v", err)
+	}
+	if repo.notifications != 1 || repo.state.Milestone != 50 {
+		t.Errorf("sent %d notifications, milestone %d; want 1 and 50", repo.notifications, repo.state.Milestone)
+	}
+}
@@ -0,0 +1,221 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/yeboahd24/personal-finance-manager/internal/errors"
+	"github.com/yeboahd24/personal-finance-manager/internal/holiday"
+	"github.com/yeboahd24/personal-finance-manager/internal/model"
+	"github.com/yeboahd24/personal-finance-manager/internal/repository"
+)
+
+// maxHolidayDates bounds the size of a user holiday calendar
+const maxHolidayDates = 1000
+
+// HolidayCalendarService manages user defined holiday calendars used to move
+// recurring transactions off non-business days
+type HolidayCalendarService struct {
+	repo repository.Repository
+}
+
+func NewHolidayCalendarService(repo repository.Repository) *HolidayCalendarService {
+	return &HolidayCalendarService{repo: repo}
+}
+
+// BundledHolidays lists the holidays in a bundled calendar for a year
+func (s *HolidayCalendarService) BundledHolidays(name string, year int) ([]model.HolidayDate, error) {
+	cal, ok := holiday.Bundled(name)
+	if !ok {
+		return nil, errors.ErrNotFound
+	}
+
+	start := time.Date(year, time.January, 1, 0, 0, 0, 0, time.UTC)
+	holidays := []model.HolidayDate{}
+	for date, name := range cal.Between(start, start.AddDate(1, 0, -1)) {
+		holidays = append(holidays, model.HolidayDate{Date: date, Name: name})
+	}
+	sort.Slice(holidays, func(i, j int) bool { return holidays[i].Date < holidays[j].Date })
+	return holidays, nil
+}
+
+func (s *HolidayCalendarService) CreateHolidayCalendar(ctx context.Context, userID string, calendar *model.HolidayCalendar) error {
+	if err := validateHolidayCalendar(calendar); err != nil {
+		return err
+	}
+
+	calendar.UserID = userID
+	return s.repo.CreateHolidayCalendar(ctx, calendar)
+}
+
+func (s *HolidayCalendarService) GetHolidayCalendars(ctx context.Context, userID string) ([]*model.HolidayCalendar, error) {
+	calendars, err := s.repo.GetHolidayCalendars(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if calendars == nil {
+		calendars = []*model.HolidayCalendar{}
+	}
+	return calendars, nil
+}
+
+func (s *HolidayCalendarService) GetHolidayCalendarByID(ctx context.Context, userID, id string) (*model.HolidayCalendar, error) {
+	if _, err := uuid.Parse(id); err != nil {
+		return nil, errors.ErrNotFound
+	}
+
+	calendar, err := s.repo.GetHolidayCalendarByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if calendar.UserID != userID {
+		return nil, errors.ErrNotFound
+	}
+
+	return calendar, nil
+}
+
+// UpdateHolidayCalendar replaces a calendar's holidays and moves the next run
+// of each recurring transaction that uses it to match
+func (s *HolidayCalendarService) UpdateHolidayCalendar(ctx context.Context, userID string, calendar *model.HolidayCalendar) error {
+	existing, err := s.GetHolidayCalendarByID(ctx, userID, calendar.ID)
+	if err != nil {
+		return err
+	}
+
+	if err := validateHolidayCalendar(calendar); err != nil {
+		return err
+	}
+
+	calendar.UserID = existing.UserID
+	calendar.CreatedAt = existing.CreatedAt
+	if err := s.repo.UpdateHolidayCalendar(ctx, calendar); err != nil {
+		return err
+	}
+
+	recurring, err := s.usedBy(ctx, userID, calendar.ID)
+	if err != nil {
+		return err
+	}
+	cal, err := calendar.Calendar()
+	if err != nil {
+		return errors.Wrap(err, "Failed to build holiday calendar", 500)
+	}
+	for _, rt := range recurring {
+		rt.Calendar = cal
+		next := rt.CalculateNextRun(time.Time{})
+		if next.IsZero() || next.Equal(rt.NextRun) {
+			continue
+		}
+		if err := s.repo.UpdateNextRun(ctx, rt.ID, next); err != nil {
+			log.Printf("Error updating next run for recurring transaction %s: %v", rt.ID, err)
+		}
+	}
+
+	return nil
+}
+
+// DeleteHolidayCalendar deletes a calendar that no recurring transaction uses
+func (s *HolidayCalendarService) DeleteHolidayCalendar(ctx context.Context, userID, id string) error {
+	if _, err := s.GetHolidayCalendarByID(ctx, userID, id); err != nil {
+		return err
+	}
+
+	recurring, err := s.usedBy(ctx, userID, id)
+	if err != nil {
+		return err
+	}
+	if len(recurring) > 0 {
+		return errors.New("Holiday calendar is used by recurring transactions", 409)
+	}
+
+	return s.repo.DeleteHolidayCalendar(ctx, id)
+}
+
+// usedBy returns the user's active recurring transactions that use the
+// calendar
+func (s *HolidayCalendarService) usedBy(ctx context.Context, userID, id string) ([]*model.RecurringTransaction, error) {
+	active := true
+	recurring, err := s.repo.GetRecurringTransactions(ctx, model.RecurringTransactionFilter{UserID: userID, Active: &active})
+	if err != nil {
+		return nil, err
+	}
+
+	var using []*model.RecurringTransaction
+	for _, rt := range recurring {
+		if rt.HolidayCalendar == id {
+			using = append(using, rt)
+		}
+	}
+	return using, nil
+}
+
+// validateHolidayCalendar checks a calendar's name, base and dates, and sorts
+// the dates
+func validateHolidayCalendar(calendar *model.HolidayCalendar) error {
+	calendar.Name = strings.TrimSpace(calendar.Name)
+	if calendar.Name == "" {
+		return errors.New("Name is required", 400)
+	}
+
+	if calendar.Base != "" {
+		if _, ok := holiday.Bundled(calendar.Base); !ok {
+			return errors.New(fmt.Sprintf("Base must be one of %s", strings.Join(holiday.BundledNames(), ", ")), 400)
+		}
+	}
+
+	if len(calendar.Dates) > maxHolidayDates {
+		return errors.New(fmt.Sprintf("A calendar can have at most %d dates", maxHolidayDates), 400)
+	}
+	seen := make(map[string]bool, len(calendar.Dates))
+	for _, d := range calendar.Dates {
+		if _, err := time.Parse(model.OccurrenceDateFormat, d.Date); err != nil {
+			return errors.New(fmt.Sprintf("Invalid date %q. Use YYYY-MM-DD", d.Date), 400)
+		}
+		if seen[d.Date] {
+			return errors.New(fmt.Sprintf("Date %s is listed twice", d.Date), 400)
+		}
+		seen[d.Date] = true
+	}
+	sort.Slice(calendar.Dates, func(i, j int) bool { return calendar.Dates[i].Date < calendar.Dates[j].Date })
+
+	return nil
+}
+
+// loadHolidayCalendars loads the user holiday calendars that recurring
+// transactions refer to. Bundled calendars need no loading. A calendar that
+// no longer exists leaves its recurring transactions avoiding weekends only.
+func loadHolidayCalendars(ctx context.Context, repo repository.Repository, recurring ...*model.RecurringTransaction) error {
+	calendars := make(map[string]holiday.Calendar)
+	for _, rt := range recurring {
+		id := rt.HolidayCalendar
+		if id == "" || rt.Calendar != nil {
+			continue
+		}
+		if _, ok := holiday.Bundled(id); ok {
+			continue
+		}
+
+		cal, ok := calendars[id]
+		if !ok {
+			calendar, err := repo.GetHolidayCalendarByID(ctx, id)
+			if err != nil && err != errors.ErrNotFound {
+				return err
+			}
+			if calendar != nil && calendar.UserID == rt.UserID {
+				if cal, err = calendar.Calendar(); err != nil {
+					return errors.Wrap(err, "Failed to build holiday calendar", 500)
+				}
+			}
+			calendars[id] = cal
+		}
+		rt.Calendar = cal
+	}
+	return nil
+}
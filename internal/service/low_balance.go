@@ -0,0 +1,185 @@
+package service
+
+import (
+	"context"
+	"log"
+	"math"
+	"time"
+
+	"github.com/yeboahd24/personal-finance-manager/internal/errors"
+	"github.com/yeboahd24/personal-finance-manager/internal/model"
+	"github.com/yeboahd24/personal-finance-manager/internal/repository"
+)
+
+// LowBalanceService warns users when a recurring charge is projected to take
+// a checking or savings account below their minimum balance
+type LowBalanceService struct {
+	repo                repository.Repository
+	notificationService *NotificationService
+}
+
+func NewLowBalanceService(repo repository.Repository, notificationService *NotificationService) *LowBalanceService {
+	return &LowBalanceService{
+		repo:                repo,
+		notificationService: notificationService,
+	}
+}
+
+// SendLowBalanceAlerts projects the balances of every user with recurring
+// transactions due within the longest horizon and sends one alert per
+// account and predicted date
+func (s *LowBalanceService) SendLowBalanceAlerts(ctx context.Context) error {
+	now := time.Now().UTC()
+	from := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	due, err := s.repo.GetDueRecurringTransactions(ctx, from.AddDate(0, 0, model.MaxLowBalanceDays))
+	if err != nil {
+		return errors.Wrap(err, "Failed to get upcoming recurring transactions", 500)
+	}
+
+	checked := make(map[string]bool)
+	for _, rt := range due {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if checked[rt.UserID] {
+			continue
+		}
+		checked[rt.UserID] = true
+
+		if err := s.checkUser(ctx, rt.UserID, from); err != nil {
+			log.Printf("Error predicting low balances for user %s: %v", rt.UserID, err)
+		}
+	}
+
+	return nil
+}
+
+func (s *LowBalanceService) checkUser(ctx context.Context, userID string, from time.Time) error {
+	prefs, err := s.repo.GetNotificationPreferences(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if !prefs.LowBalanceAlerts {
+		return nil
+	}
+	days := prefs.LowBalanceDays
+	if days <= 0 {
+		days = model.DefaultLowBalanceDays
+	}
+
+	accounts, err := s.repo.GetAccountsByUserID(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	active := true
+	recurring, err := s.repo.GetRecurringTransactions(ctx, model.RecurringTransactionFilter{
+		UserID: userID,
+		Active: &active,
+	})
+	if err != nil {
+		return err
+	}
+	if err := loadHolidayCalendars(ctx, s.repo, recurring...); err != nil {
+		return err
+	}
+
+	cal := projectCashFlow(from, days, prefs.MinimumBalance, accounts, recurring)
+	for _, prediction := range predictLowBalances(cal, accounts) {
+		if err := s.alert(ctx, prediction); err != nil {
+			log.Printf("Error sending low balance alert for account %s: %v", prediction.Account.ID, err)
+		}
+	}
+	return nil
+}
+
+// alert sends the alert for prediction unless one was already sent for the
+// account and date. The alert is claimed first so concurrent runs can't both
+// send it.
+func (s *LowBalanceService) alert(ctx context.Context, prediction *model.LowBalancePrediction) error {
+	claimed, err := s.repo.ClaimLowBalanceAlert(ctx, prediction.Account.ID, prediction.Date)
+	if err != nil || !claimed {
+		return err
+	}
+
+	if err := s.notificationService.NotifyLowBalancePredicted(ctx, prediction); err != nil {
+		if releaseErr := s.repo.ReleaseLowBalanceAlert(ctx, prediction.Account.ID, prediction.Date); releaseErr != nil {
+			log.Printf("Error releasing low balance alert for account %s: %v", prediction.Account.ID, releaseErr)
+		}
+		return err
+	}
+
+	return nil
+}
+
+// predictLowBalances finds, for each cash account, the first charge in the
+// projection that takes it from at or above the minimum to below it. The
+// suggested transfer covers the account's lowest balance from then to the end
+// of the projection, from the other cash account in the same currency with
+// the most to spare.
+func predictLowBalances(cal *model.CashFlowCalendar, accounts []*model.Account) []*model.LowBalancePrediction {
+	byID := make(map[string]*model.Account, len(accounts))
+	running := make(map[string]float64, len(accounts))
+	for _, a := range accounts {
+		byID[a.ID] = a
+		running[a.ID] = a.Balance
+	}
+
+	var predictions []*model.LowBalancePrediction
+	lowest := make(map[*model.LowBalancePrediction]float64)
+	predicted := make(map[string]bool)
+	for i, day := range cal.Days {
+		for _, occ := range day.Occurrences {
+			before := running[occ.AccountID]
+			running[occ.AccountID] += occ.Amount
+			after := roundCents(running[occ.AccountID])
+
+			a := byID[occ.AccountID]
+			if predicted[a.ID] || !model.CashAccountTypes[a.Type] || occ.Amount >= 0 {
+				continue
+			}
+			if roundCents(before) < cal.MinimumBalance || after >= cal.MinimumBalance {
+				continue
+			}
+
+			predicted[a.ID] = true
+			prediction := &model.LowBalancePrediction{
+				Account: a,
+				Date:    cal.From.AddDate(0, 0, i),
+				Balance: after,
+				Minimum: cal.MinimumBalance,
+				Charge:  occ,
+			}
+			lowest[prediction] = math.Min(after, lowestBalance(cal.Days[i:], a.ID, after))
+			predictions = append(predictions, prediction)
+		}
+	}
+
+	for _, prediction := range predictions {
+		prediction.TransferAmount = math.Ceil((cal.MinimumBalance-lowest[prediction])*100-1e-6) / 100
+
+		var spareMost float64
+		for _, a := range accounts {
+			if a.ID == prediction.Account.ID || predicted[a.ID] || !model.CashAccountTypes[a.Type] || a.Currency != prediction.Account.Currency {
+				continue
+			}
+			spare := lowestBalance(cal.Days, a.ID, a.Balance) - cal.MinimumBalance
+			if spare >= prediction.TransferAmount && spare > spareMost {
+				spareMost = spare
+				prediction.TransferFrom = a
+			}
+		}
+	}
+
+	return predictions
+}
+
+// lowestBalance is the lowest end of day balance of an account over days,
+// starting from balance
+func lowestBalance(days []model.CashFlowDay, accountID string, balance float64) float64 {
+	lowest := balance
+	for _, day := range days {
+		lowest = math.Min(lowest, day.Balances[accountID])
+	}
+	return lowest
+}
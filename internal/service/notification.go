@@ -1,37 +1,39 @@
 package service
 
 import (
-	"bytes"
 	"context"
 	"fmt"
-	"html/template"
+	"log"
+	"math"
+	"strings"
 	"time"
 
+	"github.com/google/uuid"
+	"github.com/yeboahd24/personal-finance-manager/internal/errors"
 	"github.com/yeboahd24/personal-finance-manager/internal/model"
 	"github.com/yeboahd24/personal-finance-manager/internal/repository"
 )
 
+// maxDeferredDeliveries is how many held back deliveries are claimed at a time
+const maxDeferredDeliveries = 100
+
 type NotificationService struct {
 	repo         repository.Repository
 	emailService *EmailService
+	events       *EventService // Optional, pushes new notifications to open streams
 }
 
-type NotificationRequest struct {
-	UserID   string                 `json:"user_id"`
-	Title    string                 `json:"title"`
-	Message  string                 `json:"message"`
-	Type     string                 `json:"type"`
-	Priority string                 `json:"priority"`
-	Metadata map[string]interface{} `json:"metadata,omitempty"`
-}
-
-func NewNotificationService(repo repository.Repository, emailService *EmailService) *NotificationService {
+func NewNotificationService(repo repository.Repository, emailService *EmailService, events *EventService) *NotificationService {
 	return &NotificationService{
 		repo:         repo,
 		emailService: emailService,
+		events:       events,
 	}
 }
 
+// CreateNotification stores a notification and routes it to the channels the
+// user chose for its type. Email and push deliveries of all but high priority
+// notifications are held back during the user's quiet hours.
 func (s *NotificationService) CreateNotification(ctx context.Context, notification *model.Notification) error {
 	if err := s.repo.CreateNotification(ctx, notification); err != nil {
 		return err
@@ -44,25 +46,110 @@ func (s *NotificationService) CreateNotification(ctx context.Context, notificati
 	}
 
 	// Check if notification meets priority threshold
-	if !s.shouldSendNotification(notification, prefs) {
+	send := s.shouldSendNotification(notification, prefs)
+
+	// Webhooks get every notification; the live stream only the ones routed
+	// in-app
+	live := send && prefs.ChannelEnabled(notification.Type, model.ChannelInApp)
+	if err := s.events.publish(ctx, notification.UserID, model.EventNotification, notification, live); err != nil {
+		log.Printf("Error publishing notification %s: %v", notification.ID, err)
+	}
+
+	if !send {
 		return nil
 	}
 
-	// Send notifications based on user preferences
-	if prefs.EmailEnabled {
-		if err := s.sendEmailNotification(ctx, notification); err != nil {
+	quietUntil, quiet := prefs.QuietUntil(time.Now())
+	if notification.Priority == model.NotificationPriorityHigh {
+		quiet = false
+	}
+
+	for _, channel := range []model.NotificationChannel{model.ChannelEmail, model.ChannelPush} {
+		if !prefs.ChannelEnabled(notification.Type, channel) {
+			continue
+		}
+		// Digest users get their emails batched by the digest worker instead
+		if channel == model.ChannelEmail && prefs.Digests() {
+			continue
+		}
+
+		if quiet {
+			if err := s.repo.CreateNotificationDelivery(ctx, &model.NotificationDelivery{
+				NotificationID: notification.ID,
+				Channel:        channel,
+				DeliverAt:      quietUntil,
+			}); err != nil {
+				log.Printf("Error deferring %s notification %s: %v", channel, notification.ID, err)
+			}
+			continue
+		}
+
+		if err := s.deliver(ctx, notification, channel); err != nil {
 			// Log error but don't fail the notification creation
-			fmt.Printf("Failed to send email notification: %v\n", err)
+			log.Printf("Failed to send %s notification: %v", channel, err)
 		}
 	}
 
-	if prefs.PushEnabled {
-		if err := s.sendPushNotification(ctx, notification); err != nil {
-			fmt.Printf("Failed to send push notification: %v\n", err)
+	return nil
+}
+
+// deliver sends a notification through the email or push channel
+func (s *NotificationService) deliver(ctx context.Context, notification *model.Notification, channel model.NotificationChannel) error {
+	switch channel {
+	case model.ChannelEmail:
+		return s.sendEmailNotification(ctx, notification)
+	case model.ChannelPush:
+		return s.sendPushNotification(ctx, notification)
+	default:
+		return fmt.Errorf("unknown notification channel %q", channel)
+	}
+}
+
+// DeliverDeferred brings back notifications whose snooze has ended and sends
+// the deliveries held back by quiet hours. A held back delivery is dropped if
+// its notification was read or snoozed in the meantime.
+func (s *NotificationService) DeliverDeferred(ctx context.Context) error {
+	now := time.Now()
+
+	unsnoozed, err := s.repo.ReleaseSnoozedNotifications(ctx, now)
+	if err != nil {
+		return err
+	}
+	for _, notification := range unsnoozed {
+		if err := s.events.Publish(ctx, notification.UserID, model.EventNotificationUnsnoozed, notification); err != nil {
+			log.Printf("Error publishing unsnoozed notification %s: %v", notification.ID, err)
 		}
 	}
 
-	return nil
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		deliveries, err := s.repo.ClaimDueNotificationDeliveries(ctx, now, maxDeferredDeliveries)
+		if err != nil {
+			return err
+		}
+		for _, delivery := range deliveries {
+			notification, err := s.repo.GetNotificationByID(ctx, delivery.NotificationID)
+			if err == errors.ErrNotFound {
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			if notification.Read || (notification.SnoozedUntil != nil && notification.SnoozedUntil.After(now)) {
+				continue
+			}
+
+			if err := s.deliver(ctx, notification, delivery.Channel); err != nil {
+				log.Printf("Failed to send deferred %s notification %s: %v", delivery.Channel, notification.ID, err)
+			}
+		}
+		if len(deliveries) < maxDeferredDeliveries {
+			return nil
+		}
+	}
 }
 
 func (s *NotificationService) NotifyRecurringTransactionFailure(ctx context.Context, userID string, tx *model.RecurringTransaction, err error, retryCount int) error {
@@ -106,17 +193,265 @@ func (s *NotificationService) NotifyPermanentFailure(ctx context.Context, userID
 	return s.CreateNotification(ctx, notification)
 }
 
-func (s *NotificationService) NotifyUpcomingRecurring(ctx context.Context, userID string, tx *model.RecurringTransaction) error {
+// NotifyMissedOccurrencesSkipped tells the user that occurrences missed
+// while the server was down were not posted
+func (s *NotificationService) NotifyMissedOccurrencesSkipped(ctx context.Context, tx *model.RecurringTransaction, skipped []model.Occurrence) error {
+	dates := make([]string, len(skipped))
+	for i, occ := range skipped {
+		dates[i] = occ.Date.Format("2006-01-02")
+	}
+
 	notification := &model.Notification{
-		UserID:   userID,
-		Type:     model.NotificationTypeRecurringUpcoming,
+		UserID:   tx.UserID,
+		Type:     model.NotificationTypeRecurringMissed,
 		Priority: model.NotificationPriorityMedium,
-		Title:    "Upcoming Recurring Transaction",
-		Message:  fmt.Sprintf("Upcoming recurring transaction: %s for %.2f", tx.Description, tx.Amount),
+		Title:    "Missed Recurring Transactions Skipped",
+		Message:  fmt.Sprintf("%d missed occurrences of %s were not posted. Add them by hand if they went through.", len(skipped), tx.Description),
 		Data: map[string]interface{}{
 			"transaction_id": tx.ID,
 			"amount":         tx.Amount,
-			"due_date":       tx.NextRun,
+			"skipped_dates":  dates,
+		},
+		Read:      false,
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+	}
+
+	return s.CreateNotification(ctx, notification)
+}
+
+// NotifyUpcomingRecurring reminds the user of an occurrence of a recurring
+// payment and warns when the account's projected balance after it would be
+// negative
+func (s *NotificationService) NotifyUpcomingRecurring(ctx context.Context, userID string, tx *model.RecurringTransaction, occ model.Occurrence, projectedBalance float64) error {
+	accountName := "your account"
+	if tx.Account != nil && tx.Account.Name != "" {
+		accountName = tx.Account.Name
+	}
+
+	title := "Upcoming Recurring Transaction"
+	priority := model.NotificationPriorityMedium
+	message := fmt.Sprintf("Upcoming recurring transaction: %s for %.2f on %s. Projected balance of %s afterwards: %.2f",
+		occ.Description, occ.Amount, occ.Date.Format("Jan 2, 2006"), accountName, projectedBalance)
+	if projectedBalance < 0 {
+		title = "Upcoming Payment May Overdraw Account"
+		priority = model.NotificationPriorityHigh
+		message = fmt.Sprintf("%s for %.2f on %s would leave %s at %.2f",
+			occ.Description, occ.Amount, occ.Date.Format("Jan 2, 2006"), accountName, projectedBalance)
+	}
+
+	notification := &model.Notification{
+		UserID:   userID,
+		Type:     model.NotificationTypeRecurringUpcoming,
+		Priority: priority,
+		Title:    title,
+		Message:  message,
+		Data: map[string]interface{}{
+			"transaction_id":    tx.ID,
+			"account_id":        tx.AccountID,
+			"amount":            occ.Amount,
+			"due_date":          occ.Date,
+			"projected_balance": projectedBalance,
+			"negative_balance":  projectedBalance < 0,
+		},
+		Read:      false,
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+	}
+
+	return s.CreateNotification(ctx, notification)
+}
+
+// NotifyLowBalancePredicted warns that a recurring charge is projected to
+// take an account below the minimum balance
+func (s *NotificationService) NotifyLowBalancePredicted(ctx context.Context, prediction *model.LowBalancePrediction) error {
+	title := "Low Balance Predicted"
+	if prediction.Balance < 0 {
+		title = "Account May Be Overdrawn"
+	}
+
+	message := fmt.Sprintf("%s is projected to drop to %.2f on %s when %s (%.2f) posts.",
+		prediction.Account.Name, prediction.Balance, prediction.Date.Format("Jan 2, 2006"),
+		prediction.Charge.Description, prediction.Charge.Amount)
+	data := map[string]interface{}{
+		"account_id":      prediction.Account.ID,
+		"date":            prediction.Date,
+		"balance":         prediction.Balance,
+		"minimum":         prediction.Minimum,
+		"transaction_id":  prediction.Charge.RecurringID,
+		"amount":          prediction.Charge.Amount,
+		"transfer_amount": prediction.TransferAmount,
+	}
+	if prediction.TransferFrom != nil {
+		message += fmt.Sprintf(" Transfer %.2f from %s to cover it.", prediction.TransferAmount, prediction.TransferFrom.Name)
+		data["transfer_from_account_id"] = prediction.TransferFrom.ID
+	} else {
+		message += fmt.Sprintf(" Add %.2f to cover it.", prediction.TransferAmount)
+	}
+
+	notification := &model.Notification{
+		UserID:    prediction.Account.UserID,
+		Type:      model.NotificationTypeLowBalance,
+		Priority:  model.NotificationPriorityHigh,
+		Title:     title,
+		Message:   message,
+		Data:      data,
+		Read:      false,
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+	}
+
+	return s.CreateNotification(ctx, notification)
+}
+
+// NotifyTransactionAlert tells the user a new transaction tripped one or more
+// of their transaction alerts. reasons holds one line per alert type.
+func (s *NotificationService) NotifyTransactionAlert(ctx context.Context, tx *model.Transaction, alerts []*model.TransactionAlert, reasons []string) error {
+	alertIDs := make([]string, len(alerts))
+	alertTypes := make([]model.TransactionAlertType, 0, len(alerts))
+	seen := make(map[model.TransactionAlertType]bool)
+	for i, alert := range alerts {
+		alertIDs[i] = alert.ID
+		if !seen[alert.Type] {
+			seen[alert.Type] = true
+			alertTypes = append(alertTypes, alert.Type)
+		}
+	}
+
+	data := map[string]interface{}{
+		"transaction_id": tx.ID,
+		"account_id":     tx.AccountID,
+		"amount":         tx.Amount,
+		"date":           tx.Date,
+		"merchant":       transactionMerchant(tx),
+		"alert_ids":      alertIDs,
+		"alert_types":    alertTypes,
+		"reasons":        reasons,
+	}
+	if tx.Currency != "" {
+		data["currency"] = tx.Currency
+	}
+
+	notification := &model.Notification{
+		UserID:    tx.UserID,
+		Type:      model.NotificationTypeTransactionAlert,
+		Priority:  model.NotificationPriorityHigh,
+		Title:     "Unusual Transaction",
+		Message:   fmt.Sprintf("%.2f at %s on %s: %s.", math.Abs(tx.Amount), transactionMerchant(tx), tx.Date.Format("Jan 2, 2006"), strings.Join(reasons, "; ")),
+		Data:      data,
+		Read:      false,
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+	}
+
+	return s.CreateNotification(ctx, notification)
+}
+
+// NotifySpendingAnomaly tells the user about spending well above a category's
+// usual amount
+func (s *NotificationService) NotifySpendingAnomaly(ctx context.Context, userID string, anomaly *model.SpendingAnomaly) error {
+	data := map[string]interface{}{
+		"kind":          anomaly.Kind,
+		"category_id":   anomaly.CategoryID,
+		"category_name": anomaly.CategoryName,
+		"period":        anomaly.Period,
+		"period_start":  anomaly.PeriodStart,
+		"amount":        anomaly.Amount,
+		"baseline":      anomaly.Baseline,
+		"ratio":         anomaly.Ratio,
+		"score":         anomaly.Score,
+	}
+	if anomaly.TransactionID != "" {
+		data["transaction_id"] = anomaly.TransactionID
+		data["description"] = anomaly.Description
+		data["date"] = anomaly.Date
+	}
+
+	notification := &model.Notification{
+		UserID:    userID,
+		Type:      model.NotificationTypeSpendingAnomaly,
+		Priority:  model.NotificationPriorityMedium,
+		Title:     "Unusual Spending",
+		Message:   anomaly.Explanation + ".",
+		Data:      data,
+		Read:      false,
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+	}
+
+	return s.CreateNotification(ctx, notification)
+}
+
+func (s *NotificationService) NotifyGoalMilestone(ctx context.Context, goal *model.Goal, milestone int) error {
+	title := fmt.Sprintf("Goal %d%% Complete", milestone)
+	message := fmt.Sprintf("You've saved %.2f of %.2f towards %s", goal.CurrentAmount, goal.TargetAmount, goal.Name)
+	priority := model.NotificationPriorityLow
+	if milestone == 100 {
+		title = "Goal Reached"
+		message = fmt.Sprintf("You've reached your target of %.2f for %s", goal.TargetAmount, goal.Name)
+		priority = model.NotificationPriorityMedium
+	}
+
+	notification := &model.Notification{
+		UserID:   goal.UserID,
+		Type:     model.NotificationTypeGoalMilestone,
+		Priority: priority,
+		Title:    title,
+		Message:  message,
+		Data: map[string]interface{}{
+			"goal_id":   goal.ID,
+			"milestone": milestone,
+			"amount":    goal.CurrentAmount,
+			"target":    goal.TargetAmount,
+		},
+		Read:      false,
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+	}
+
+	return s.CreateNotification(ctx, notification)
+}
+
+func (s *NotificationService) NotifyGoalDeadlineRisk(ctx context.Context, goal *model.Goal) error {
+	data := map[string]interface{}{
+		"goal_id":  goal.ID,
+		"due_date": goal.Deadline,
+	}
+	if goal.Progress != nil {
+		data["remaining"] = goal.Progress.RemainingAmount
+		data["required_monthly"] = goal.Progress.RequiredMonthly
+		// Left out when the pace is too slow to project a date
+		if goal.Progress.ProjectedCompletion != nil {
+			data["projected_completion"] = *goal.Progress.ProjectedCompletion
+		}
+	}
+
+	notification := &model.Notification{
+		UserID:    goal.UserID,
+		Type:      model.NotificationTypeGoalDeadlineRisk,
+		Priority:  model.NotificationPriorityMedium,
+		Title:     "Goal Behind Schedule",
+		Message:   fmt.Sprintf("At your current pace %s won't be reached by %s", goal.Name, goal.Deadline.Format("Jan 2, 2006")),
+		Data:      data,
+		Read:      false,
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+	}
+
+	return s.CreateNotification(ctx, notification)
+}
+
+func (s *NotificationService) NotifyGoalContributionReminder(ctx context.Context, goal *model.Goal, days int) error {
+	notification := &model.Notification{
+		UserID:   goal.UserID,
+		Type:     model.NotificationTypeGoalReminder,
+		Priority: model.NotificationPriorityLow,
+		Title:    "Goal Contribution Reminder",
+		Message:  fmt.Sprintf("You haven't contributed to %s in %d days", goal.Name, days),
+		Data: map[string]interface{}{
+			"goal_id":  goal.ID,
+			"days":     days,
+			"due_date": goal.Deadline,
 		},
 		Read:      false,
 		CreatedAt: time.Now(),
@@ -141,10 +476,20 @@ func (s *NotificationService) shouldSendNotification(notification *model.Notific
 
 	// Check notification type preferences
 	switch notification.Type {
-	case model.NotificationTypeRecurringFailed, model.NotificationTypePermanentFail:
+	case model.NotificationTypeRecurringFailed, model.NotificationTypePermanentFail, model.NotificationTypeRecurringMissed:
 		return prefs.RecurringFailures
 	case model.NotificationTypeRecurringUpcoming:
 		return prefs.UpcomingRecurring
+	case model.NotificationTypeGoalMilestone:
+		return prefs.GoalMilestones
+	case model.NotificationTypeGoalDeadlineRisk:
+		return prefs.GoalDeadlineRisk
+	case model.NotificationTypeGoalReminder:
+		return prefs.GoalReminders
+	case model.NotificationTypeLowBalance:
+		return prefs.LowBalanceAlerts
+	case model.NotificationTypeSpendingAnomaly:
+		return prefs.SpendingAnomalies
 	default:
 		return true
 	}
@@ -157,29 +502,7 @@ func (s *NotificationService) sendEmailNotification(ctx context.Context, notific
 		return err
 	}
 
-	// Create email template
-	tmpl := template.Must(template.New("notification").Parse(`
-		<html>
-			<body>
-				<h2>{{.Title}}</h2>
-				<p>{{.Message}}</p>
-				{{if .Data.amount}}
-				<p>Amount: ${{.Data.amount}}</p>
-				{{end}}
-				{{if .Data.due_date}}
-				<p>Due Date: {{.Data.due_date}}</p>
-				{{end}}
-				<p>Please check your account for more details.</p>
-			</body>
-		</html>
-	`))
-
-	var body bytes.Buffer
-	if err := tmpl.Execute(&body, notification); err != nil {
-		return err
-	}
-
-	return s.emailService.SendEmail(ctx, user.Email, notification.Title, body.String())
+	return s.emailService.QueueNotification(ctx, user.Email, notification)
 }
 
 func (s *NotificationService) sendPushNotification(ctx context.Context, notification *model.Notification) error {
@@ -189,19 +512,191 @@ func (s *NotificationService) sendPushNotification(ctx context.Context, notifica
 }
 
 func (s *NotificationService) MarkAsRead(ctx context.Context, userID string, notificationID string) error {
+	if _, err := uuid.Parse(notificationID); err != nil {
+		return errors.ErrNotFound
+	}
 	return s.repo.MarkNotificationAsRead(ctx, userID, notificationID)
 }
 
-func (s *NotificationService) GetUserNotifications(ctx context.Context, userID string, unreadOnly bool) ([]*model.Notification, error) {
-	return s.repo.GetUserNotifications(ctx, userID, unreadOnly)
+func (s *NotificationService) GetUserNotifications(ctx context.Context, userID string, unreadOnly, includeSnoozed bool) ([]*model.Notification, error) {
+	notifications, err := s.repo.GetUserNotifications(ctx, userID, unreadOnly, includeSnoozed)
+	if err != nil {
+		return nil, err
+	}
+	if notifications == nil {
+		notifications = []*model.Notification{}
+	}
+	return notifications, nil
+}
+
+// MarkManyAsRead marks the selected notifications as read and returns how
+// many changed
+func (s *NotificationService) MarkManyAsRead(ctx context.Context, userID string, req *model.NotificationBulkRequest) (int64, error) {
+	if err := validateBulkRequest(req); err != nil {
+		return 0, err
+	}
+	return s.repo.MarkNotificationsAsRead(ctx, userID, req.IDs, req.All)
+}
+
+// DeleteMany deletes the selected notifications and returns how many were
+// deleted
+func (s *NotificationService) DeleteMany(ctx context.Context, userID string, req *model.NotificationBulkRequest) (int64, error) {
+	if err := validateBulkRequest(req); err != nil {
+		return 0, err
+	}
+	return s.repo.DeleteNotifications(ctx, userID, req.IDs, req.All)
+}
+
+func validateBulkRequest(req *model.NotificationBulkRequest) error {
+	if req.All {
+		if len(req.IDs) > 0 {
+			return errors.New("Give either ids or all, not both", 400)
+		}
+		return nil
+	}
+	if len(req.IDs) == 0 {
+		return errors.New("ids or all is required", 400)
+	}
+	if len(req.IDs) > model.MaxBulkNotifications {
+		return errors.New(fmt.Sprintf("At most %d notifications can be changed at once", model.MaxBulkNotifications), 400)
+	}
+	for _, id := range req.IDs {
+		if _, err := uuid.Parse(id); err != nil {
+			return errors.New(fmt.Sprintf("Invalid notification id %q", id), 400)
+		}
+	}
+	return nil
+}
+
+// Snooze hides a notification until the given time, when it comes back to
+// the user's list and stream
+func (s *NotificationService) Snooze(ctx context.Context, userID, notificationID string, until time.Time) error {
+	if _, err := uuid.Parse(notificationID); err != nil {
+		return errors.ErrNotFound
+	}
+	now := time.Now()
+	if !until.After(now) {
+		return errors.New("Snooze time must be in the future", 400)
+	}
+	if until.After(now.Add(model.MaxNotificationSnooze)) {
+		return errors.New(fmt.Sprintf("Notifications can be snoozed at most %d days ahead", int(model.MaxNotificationSnooze.Hours()/24)), 400)
+	}
+	return s.repo.SnoozeNotification(ctx, userID, notificationID, &until)
+}
+
+// Unsnooze brings a snoozed notification back now
+func (s *NotificationService) Unsnooze(ctx context.Context, userID, notificationID string) error {
+	if _, err := uuid.Parse(notificationID); err != nil {
+		return errors.ErrNotFound
+	}
+	return s.repo.SnoozeNotification(ctx, userID, notificationID, nil)
 }
 
 func (s *NotificationService) UpdateNotificationPreferences(ctx context.Context, userID string, prefs *model.NotificationPreferences) error {
 	prefs.UserID = userID
 	prefs.UpdatedAt = time.Now()
+	if prefs.GoalReminderDays <= 0 {
+		prefs.GoalReminderDays = model.DefaultGoalReminderDays
+	}
+	if prefs.UpcomingRecurringDays <= 0 {
+		prefs.UpcomingRecurringDays = model.DefaultUpcomingRecurringDays
+	}
+	if prefs.UpcomingRecurringDays > model.MaxUpcomingRecurringDays {
+		return errors.New(fmt.Sprintf("Upcoming recurring reminders can be sent at most %d days ahead", model.MaxUpcomingRecurringDays), 400)
+	}
+	if prefs.LowBalanceDays <= 0 {
+		prefs.LowBalanceDays = model.DefaultLowBalanceDays
+	}
+	if prefs.LowBalanceDays > model.MaxLowBalanceDays {
+		return errors.New(fmt.Sprintf("Low balances can be predicted at most %d days ahead", model.MaxLowBalanceDays), 400)
+	}
+	if err := validateDigestPreferences(prefs); err != nil {
+		return err
+	}
+	if err := validateRoutingPreferences(prefs); err != nil {
+		return err
+	}
 	return s.repo.UpdateNotificationPreferences(ctx, prefs)
 }
 
+// validateDigestPreferences checks the digest frequency, time, day and time
+// zone, filling in defaults for those left out
+func validateDigestPreferences(prefs *model.NotificationPreferences) error {
+	switch prefs.EmailDigest {
+	case "":
+		prefs.EmailDigest = model.DigestImmediate
+	case model.DigestImmediate, model.DigestDaily, model.DigestWeekly:
+	default:
+		return errors.New("Email digest must be one of immediate, daily, weekly", 400)
+	}
+
+	if prefs.DigestTime == "" {
+		prefs.DigestTime = model.DefaultDigestTime
+	}
+	if _, err := time.Parse(model.DigestTimeFormat, prefs.DigestTime); err != nil || len(prefs.DigestTime) != len(model.DigestTimeFormat) {
+		return errors.New("Digest time must be HH:MM", 400)
+	}
+
+	if prefs.DigestDay < time.Sunday || prefs.DigestDay > time.Saturday {
+		return errors.New("Digest day must be between 0 (Sunday) and 6 (Saturday)", 400)
+	}
+
+	if prefs.Timezone == "" {
+		prefs.Timezone = model.DefaultTimezone
+	}
+	if _, err := time.LoadLocation(prefs.Timezone); err != nil {
+		return errors.New(fmt.Sprintf("Unknown timezone %q", prefs.Timezone), 400)
+	}
+
+	return nil
+}
+
+// validateRoutingPreferences checks the per-type channels and quiet hours
+func validateRoutingPreferences(prefs *model.NotificationPreferences) error {
+	for notificationType, channels := range prefs.Channels {
+		if !knownNotificationType(notificationType) {
+			return errors.New(fmt.Sprintf("Unknown notification type %q", notificationType), 400)
+		}
+		seen := make(map[model.NotificationChannel]bool)
+		for _, channel := range channels {
+			switch channel {
+			case model.ChannelInApp, model.ChannelEmail, model.ChannelPush:
+			default:
+				return errors.New(fmt.Sprintf("Channel must be one of in_app, email, push, got %q", channel), 400)
+			}
+			if seen[channel] {
+				return errors.New(fmt.Sprintf("Channel %s is listed twice for %s", channel, notificationType), 400)
+			}
+			seen[channel] = true
+		}
+	}
+
+	if (prefs.QuietHoursStart == "") != (prefs.QuietHoursEnd == "") {
+		return errors.New("Quiet hours need both a start and an end", 400)
+	}
+	if prefs.QuietHoursStart == "" {
+		return nil
+	}
+	for _, t := range []string{prefs.QuietHoursStart, prefs.QuietHoursEnd} {
+		if _, err := time.Parse(model.DigestTimeFormat, t); err != nil || len(t) != len(model.DigestTimeFormat) {
+			return errors.New("Quiet hours must be HH:MM", 400)
+		}
+	}
+	if prefs.QuietHoursStart == prefs.QuietHoursEnd {
+		return errors.New("Quiet hours must start and end at different times", 400)
+	}
+	return nil
+}
+
+func knownNotificationType(t model.NotificationType) bool {
+	for _, known := range model.NotificationTypes {
+		if t == known {
+			return true
+		}
+	}
+	return false
+}
+
 func (s *NotificationService) GetNotificationPreferences(ctx context.Context, userID string) (*model.NotificationPreferences, error) {
 	return s.repo.GetNotificationPreferences(ctx, userID)
 }
@@ -2,25 +2,48 @@ package service
 
 import (
 	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
 	"time"
 
+	"github.com/google/uuid"
 	"github.com/yeboahd24/personal-finance-manager/internal/errors"
+	"github.com/yeboahd24/personal-finance-manager/internal/holiday"
 	"github.com/yeboahd24/personal-finance-manager/internal/metrics"
 	"github.com/yeboahd24/personal-finance-manager/internal/model"
+	"github.com/yeboahd24/personal-finance-manager/internal/queue"
 	"github.com/yeboahd24/personal-finance-manager/internal/repository"
+	"github.com/yeboahd24/personal-finance-manager/internal/rrule"
 )
 
+// maxRecurringRetries is how many times a failed occurrence is retried
+// before the user has to retry it by hand
+const maxRecurringRetries = 3
+
+// catchUpGrace is how overdue an occurrence can be before it counts as
+// missed and is subject to its rule's backfill policy
+const catchUpGrace = 24 * time.Hour
+
+// maxOccurrenceDays bounds how far ahead occurrences can be listed
+const maxOccurrenceDays = 366
+
 type RecurringTransactionService struct {
-	repo           repository.Repository
-	transactionSvc *TransactionService
-	metrics        *metrics.RecurringTransactionMetrics
+	repo                repository.Repository
+	transactionSvc      *TransactionService
+	notificationService *NotificationService
+	metrics             *metrics.RecurringTransactionMetrics
+	retryQueue          *queue.RetryQueue
 }
 
-func NewRecurringTransactionService(repo repository.Repository, transactionSvc *TransactionService) *RecurringTransactionService {
+func NewRecurringTransactionService(repo repository.Repository, transactionSvc *TransactionService, notificationService *NotificationService) *RecurringTransactionService {
 	return &RecurringTransactionService{
-		repo:           repo,
-		transactionSvc: transactionSvc,
-		metrics:        metrics.NewRecurringTransactionMetrics(),
+		repo:                repo,
+		transactionSvc:      transactionSvc,
+		notificationService: notificationService,
+		metrics:             metrics.NewRecurringTransactionMetrics(),
+		retryQueue:          queue.NewRetryQueue(repo, maxRecurringRetries, notificationService),
 	}
 }
 
@@ -41,36 +64,29 @@ func (s *RecurringTransactionService) CreateRecurringTransaction(ctx context.Con
 		return errors.New("Category ID is required", 400)
 	}
 
-	if tx.Interval == "" {
-		return errors.New("Interval is required", 400)
+	if tx.StartDate.IsZero() {
+		tx.StartDate = time.Now().UTC()
 	}
 
-	// Validate interval-specific fields
-	switch tx.Interval {
-	case model.RecurrenceDaily:
-		// No additional validation needed
-	case model.RecurrenceWeekly:
-		if tx.DayOfWeek != nil && (*tx.DayOfWeek < 0 || *tx.DayOfWeek > 6) {
-			return errors.New("Day of week must be between 0 (Sunday) and 6 (Saturday)", 400)
-		}
-	case model.RecurrenceMonthly:
-		if tx.DayOfMonth != nil && (*tx.DayOfMonth < 1 || *tx.DayOfMonth > 31) {
-			return errors.New("Day of month must be between 1 and 31", 400)
-		}
-	case model.RecurrenceYearly:
-		// No additional validation needed
-	default:
-		return errors.New("Invalid interval", 400)
+	if tx.BackfillPolicy == "" {
+		tx.BackfillPolicy = model.BackfillAll
+	}
+	if !tx.BackfillPolicy.Valid() {
+		return errors.New("Backfill policy must be all, latest or skip", 400)
 	}
 
-	if tx.StartDate.IsZero() {
-		tx.StartDate = time.Now().UTC()
+	if err := normalizeSchedule(tx); err != nil {
+		return err
 	}
 
 	if tx.EndDate != nil && tx.EndDate.Before(tx.StartDate) {
 		return errors.New("End date must be after start date", 400)
 	}
 
+	if err := s.validateBusinessDays(ctx, userID, tx); err != nil {
+		return err
+	}
+
 	// Verify account exists and belongs to user
 	account, err := s.repo.GetAccountByID(ctx, tx.AccountID)
 	if err != nil {
@@ -94,6 +110,9 @@ func (s *RecurringTransactionService) CreateRecurringTransaction(ctx context.Con
 	tx.UserID = userID
 	tx.Active = true
 	tx.NextRun = tx.CalculateNextRun(time.Now().UTC())
+	if tx.NextRun.IsZero() {
+		return errors.New("Schedule has no occurrences", 400)
+	}
 
 	return s.repo.CreateRecurringTransaction(ctx, tx)
 }
@@ -108,12 +127,25 @@ func (s *RecurringTransactionService) GetRecurringTransactionByID(ctx context.Co
 		return nil, errors.ErrNotFound
 	}
 
+	if err := loadHolidayCalendars(ctx, s.repo, tx); err != nil {
+		return nil, err
+	}
+
 	return tx, nil
 }
 
 func (s *RecurringTransactionService) GetRecurringTransactions(ctx context.Context, userID string, filter model.RecurringTransactionFilter) ([]*model.RecurringTransaction, error) {
 	filter.UserID = userID
-	return s.repo.GetRecurringTransactions(ctx, filter)
+	recurring, err := s.repo.GetRecurringTransactions(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := loadHolidayCalendars(ctx, s.repo, recurring...); err != nil {
+		return nil, err
+	}
+
+	return recurring, nil
 }
 
 func (s *RecurringTransactionService) UpdateRecurringTransaction(ctx context.Context, userID string, tx *model.RecurringTransaction) error {
@@ -126,8 +158,39 @@ func (s *RecurringTransactionService) UpdateRecurringTransaction(ctx context.Con
 		return errors.ErrNotFound
 	}
 
-	// Don't allow changing user_id
+	// Don't allow changing user_id or run history
 	tx.UserID = existing.UserID
+	tx.LastRun = existing.LastRun
+	tx.NextRun = existing.NextRun
+	tx.Overrides = existing.Overrides
+	tx.PausedAt = existing.PausedAt
+	tx.ResumeAt = existing.ResumeAt
+
+	if tx.StartDate.IsZero() {
+		tx.StartDate = existing.StartDate
+	}
+
+	if tx.BackfillPolicy == "" {
+		tx.BackfillPolicy = existing.BackfillPolicy
+	}
+	if !tx.BackfillPolicy.Valid() {
+		return errors.New("Backfill policy must be all, latest or skip", 400)
+	}
+
+	if err := normalizeSchedule(tx); err != nil {
+		return err
+	}
+
+	if tx.EndDate != nil && tx.EndDate.Before(tx.StartDate) {
+		return errors.New("End date must be after start date", 400)
+	}
+
+	if tx.BusinessDayAdjustment == "" {
+		tx.BusinessDayAdjustment = existing.BusinessDayAdjustment
+	}
+	if err := s.validateBusinessDays(ctx, userID, tx); err != nil {
+		return err
+	}
 
 	// Validate account if changed
 	if tx.AccountID != existing.AccountID {
@@ -154,11 +217,15 @@ func (s *RecurringTransactionService) UpdateRecurringTransaction(ctx context.Con
 	}
 
 	// Recalculate next run if schedule changed
-	if tx.Interval != existing.Interval ||
-		tx.DayOfMonth != existing.DayOfMonth ||
-		tx.DayOfWeek != existing.DayOfWeek ||
-		!tx.StartDate.Equal(existing.StartDate) {
+	if tx.RRule != existing.RRule ||
+		tx.ExDates.String() != existing.ExDates.String() ||
+		!tx.StartDate.Equal(existing.StartDate) ||
+		tx.BusinessDayAdjustment != existing.BusinessDayAdjustment ||
+		tx.HolidayCalendar != existing.HolidayCalendar {
 		tx.NextRun = tx.CalculateNextRun(time.Now().UTC())
+		if tx.NextRun.IsZero() {
+			return errors.New("Schedule has no upcoming occurrences", 400)
+		}
 	}
 
 	return s.repo.UpdateRecurringTransaction(ctx, tx)
@@ -177,52 +244,756 @@ func (s *RecurringTransactionService) DeleteRecurringTransaction(ctx context.Con
 	return s.repo.DeleteRecurringTransaction(ctx, id)
 }
 
-func (s *RecurringTransactionService) ProcessDueTransactions(ctx context.Context) error {
+// GetOccurrences lists the occurrences of one recurring transaction that
+// haven't posted yet and fall within the next days, with skips, moves,
+// overrides and pauses applied
+func (s *RecurringTransactionService) GetOccurrences(ctx context.Context, userID, id string, days int) ([]model.Occurrence, error) {
+	if days < 1 || days > maxOccurrenceDays {
+		return nil, errors.New(fmt.Sprintf("Days must be between 1 and %d", maxOccurrenceDays), 400)
+	}
+
+	rt, err := s.GetRecurringTransactionByID(ctx, userID, id)
+	if err != nil {
+		return nil, err
+	}
+
+	occurrences := upcomingOccurrences(rt, time.Now().UTC().AddDate(0, 0, days))
+	if occurrences == nil {
+		occurrences = []model.Occurrence{}
+	}
+	return occurrences, nil
+}
+
+// GetUpcomingOccurrences lists the occurrences of all the user's active
+// recurring transactions within the next days, in date order
+func (s *RecurringTransactionService) GetUpcomingOccurrences(ctx context.Context, userID string, days int) ([]model.Occurrence, error) {
+	if days < 1 || days > maxOccurrenceDays {
+		return nil, errors.New(fmt.Sprintf("Days must be between 1 and %d", maxOccurrenceDays), 400)
+	}
+
+	active := true
+	recurring, err := s.GetRecurringTransactions(ctx, userID, model.RecurringTransactionFilter{Active: &active})
+	if err != nil {
+		return nil, err
+	}
+
+	until := time.Now().UTC().AddDate(0, 0, days)
+	occurrences := []model.Occurrence{}
+	for _, rt := range recurring {
+		occurrences = append(occurrences, upcomingOccurrences(rt, until)...)
+	}
+	sort.SliceStable(occurrences, func(i, j int) bool {
+		return occurrences[i].Date.Before(occurrences[j].Date)
+	})
+	return occurrences, nil
+}
+
+// upcomingOccurrences returns rt's unposted occurrences up to until. Overdue
+// ones that haven't been processed yet are included.
+func upcomingOccurrences(rt *model.RecurringTransaction, until time.Time) []model.Occurrence {
+	if !rt.Active || rt.NextRun.IsZero() {
+		return nil
+	}
+	return rt.Occurrences(rt.NextRun, until)
+}
+
+// SkipOccurrence skips the occurrence scheduled on date (YYYY-MM-DD). Any
+// override for it is dropped.
+func (s *RecurringTransactionService) SkipOccurrence(ctx context.Context, userID, id, date string) (*model.RecurringTransaction, error) {
+	rt, err := s.GetRecurringTransactionByID(ctx, userID, id)
+	if err != nil {
+		return nil, err
+	}
+
+	scheduled, err := unpostedOccurrence(rt, date)
+	if err != nil {
+		return nil, err
+	}
+
+	rt.ExDates = append(rt.ExDates, scheduled)
+	removeOverride(rt, date)
+	if err := rescheduleNextRun(rt); err != nil {
+		return nil, err
+	}
+
+	if err := s.repo.UpdateRecurringTransaction(ctx, rt); err != nil {
+		return nil, err
+	}
+	return rt, nil
+}
+
+// UnskipOccurrence restores a skipped occurrence
+func (s *RecurringTransactionService) UnskipOccurrence(ctx context.Context, userID, id, date string) (*model.RecurringTransaction, error) {
+	rt, err := s.GetRecurringTransactionByID(ctx, userID, id)
+	if err != nil {
+		return nil, err
+	}
+
+	exdates := rt.ExDates[:0:0]
+	for _, d := range rt.ExDates {
+		if rt.OccurrenceKey(d) != date {
+			exdates = append(exdates, d)
+		}
+	}
+	if len(exdates) == len(rt.ExDates) {
+		return nil, errors.New("Occurrence is not skipped", 400)
+	}
+	rt.ExDates = exdates
+
+	if _, ok := rt.ScheduledOn(date); !ok {
+		return nil, errors.New("No occurrence is scheduled on that date", 400)
+	}
+	if err := rescheduleNextRun(rt); err != nil {
+		return nil, err
+	}
+
+	if err := s.repo.UpdateRecurringTransaction(ctx, rt); err != nil {
+		return nil, err
+	}
+	return rt, nil
+}
+
+// OverrideOccurrence moves the occurrence scheduled on date, or changes its
+// amount or description, without touching the rest of the schedule. It
+// replaces any earlier override for the occurrence.
+func (s *RecurringTransactionService) OverrideOccurrence(ctx context.Context, userID, id, date string, override model.OccurrenceOverride) (*model.RecurringTransaction, error) {
+	if override.MoveTo == nil && override.Amount == nil && override.Description == nil {
+		return nil, errors.New("Move date, amount or description is required", 400)
+	}
+	if override.Amount != nil && *override.Amount == 0 {
+		return nil, errors.New("Amount must not be zero", 400)
+	}
+	if override.Description != nil && *override.Description == "" {
+		return nil, errors.New("Description must not be empty", 400)
+	}
+
+	rt, err := s.GetRecurringTransactionByID(ctx, userID, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := unpostedOccurrence(rt, date); err != nil {
+		return nil, err
+	}
+
+	if override.MoveTo != nil {
+		moveTo := override.MoveTo.UTC()
+		if rt.LastRun != nil && !moveTo.After(*rt.LastRun) {
+			return nil, errors.New("Occurrence can't be moved before the last run", 400)
+		}
+		if rt.EndDate != nil && moveTo.After(*rt.EndDate) {
+			return nil, errors.New("Occurrence can't be moved past the end date", 400)
+		}
+		override.MoveTo = &moveTo
+	}
+
+	override.Date = date
+	removeOverride(rt, date)
+	rt.Overrides = append(rt.Overrides, override)
+	if err := rescheduleNextRun(rt); err != nil {
+		return nil, err
+	}
+
+	if err := s.repo.UpdateRecurringTransaction(ctx, rt); err != nil {
+		return nil, err
+	}
+	return rt, nil
+}
+
+// ClearOccurrenceOverride puts an overridden occurrence back as scheduled
+func (s *RecurringTransactionService) ClearOccurrenceOverride(ctx context.Context, userID, id, date string) (*model.RecurringTransaction, error) {
+	rt, err := s.GetRecurringTransactionByID(ctx, userID, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if !removeOverride(rt, date) {
+		return nil, errors.ErrNotFound
+	}
+	if err := rescheduleNextRun(rt); err != nil {
+		return nil, err
+	}
+
+	if err := s.repo.UpdateRecurringTransaction(ctx, rt); err != nil {
+		return nil, err
+	}
+	return rt, nil
+}
+
+// PauseRecurringTransaction stops posting a recurring transaction until
+// resumeAt, or until it is resumed when resumeAt is nil. Occurrences that
+// fall in the pause are dropped rather than posted later. Pausing a paused
+// rule changes when it resumes.
+func (s *RecurringTransactionService) PauseRecurringTransaction(ctx context.Context, userID, id string, resumeAt *time.Time) (*model.RecurringTransaction, error) {
+	rt, err := s.GetRecurringTransactionByID(ctx, userID, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if !rt.Active {
+		return nil, errors.New("Recurring transaction is not active", 400)
+	}
+
+	now := time.Now().UTC()
+	if resumeAt != nil {
+		if !resumeAt.After(now) {
+			return nil, errors.New("Resume date must be in the future", 400)
+		}
+		t := resumeAt.UTC()
+		resumeAt = &t
+	}
+
+	if !rt.Paused(now) {
+		rt.PausedAt = &now
+	}
+	rt.ResumeAt = resumeAt
+	if err := rescheduleNextRun(rt); err != nil {
+		return nil, err
+	}
+
+	if err := s.repo.UpdateRecurringTransaction(ctx, rt); err != nil {
+		return nil, err
+	}
+	return rt, nil
+}
+
+// ResumeRecurringTransaction ends a pause now. The next run is the first
+// occurrence from now on.
+func (s *RecurringTransactionService) ResumeRecurringTransaction(ctx context.Context, userID, id string) (*model.RecurringTransaction, error) {
+	rt, err := s.GetRecurringTransactionByID(ctx, userID, id)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	if !rt.Paused(now) {
+		return nil, errors.New("Recurring transaction is not paused", 400)
+	}
+
+	rt.ResumeAt = &now
+	if err := rescheduleNextRun(rt); err != nil {
+		return nil, err
+	}
+
+	if err := s.repo.UpdateRecurringTransaction(ctx, rt); err != nil {
+		return nil, err
+	}
+	return rt, nil
+}
+
+// unpostedOccurrence returns the occurrence of rt scheduled on date, as long
+// as it hasn't been posted yet
+func unpostedOccurrence(rt *model.RecurringTransaction, date string) (time.Time, error) {
+	if _, err := time.Parse(model.OccurrenceDateFormat, date); err != nil {
+		return time.Time{}, errors.New("Invalid date format. Use YYYY-MM-DD", 400)
+	}
+
+	scheduled, ok := rt.ScheduledOn(date)
+	if !ok {
+		return time.Time{}, errors.New("No occurrence is scheduled on that date", 400)
+	}
+
+	occ, ok := rt.Occurrence(scheduled)
+	if ok && rt.LastRun != nil && !occ.Date.After(*rt.LastRun) {
+		return time.Time{}, errors.New("Occurrence has already been posted", 400)
+	}
+	return scheduled, nil
+}
+
+// removeOverride drops the override for the occurrence scheduled on date and
+// reports whether there was one
+func removeOverride(rt *model.RecurringTransaction, date string) bool {
+	for i, o := range rt.Overrides {
+		if o.Date == date {
+			rt.Overrides = append(rt.Overrides[:i:i], rt.Overrides[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// rescheduleNextRun points the next run at the first occurrence that hasn't
+// posted after an exception changed the schedule. A rule paused with no
+// resume date keeps its next run, since it isn't processed until resumed.
+func rescheduleNextRun(rt *model.RecurringTransaction) error {
+	next := rt.CalculateNextRun(time.Time{})
+	if next.IsZero() {
+		if rt.Paused(time.Now()) {
+			return nil
+		}
+		return errors.New("Schedule has no upcoming occurrences", 400)
+	}
+	rt.NextRun = next
+	return nil
+}
+
+// ProcessDueTransactions posts every due recurring transaction, including
+// occurrences missed while the server wasn't running, as allowed by each
+// rule's backfill policy. Each rule is claimed with a row lock so concurrent
+// instances never process the same one, and its transactions and schedule
+// update are committed together. The report lists what was posted.
+func (s *RecurringTransactionService) ProcessDueTransactions(ctx context.Context) (*model.BackfillReport, error) {
 	start := time.Now()
 	defer func() {
 		s.metrics.SetProcessingTime(time.Since(start))
 	}()
 
 	now := time.Now().UTC()
-	transactions, err := s.repo.GetDueRecurringTransactions(ctx, now)
-	if err != nil {
-		s.metrics.IncrementFailed()
-		return err
-	}
+	report := &model.BackfillReport{StartedAt: now}
+	var processed []string
+	for {
+		if err := ctx.Err(); err != nil {
+			return report, err
+		}
 
-	for _, rt := range transactions {
-		// Create the actual transaction
-		tx := &model.Transaction{
-			UserID:      rt.UserID,
-			AccountID:   rt.AccountID,
-			CategoryID:  &rt.CategoryID,
-			Amount:      rt.Amount,
-			Date:        now,
-			Description: rt.Description,
+		rt, entry, err := s.processNextDue(ctx, now, processed)
+		if rt == nil {
+			if err != nil {
+				s.metrics.IncrementFailed()
+			}
+			return report, err
+		}
+		processed = append(processed, rt.ID)
+		report.Entries = append(report.Entries, entry)
+
+		if len(entry.Skipped) > 0 && rt.BackfillPolicy == model.BackfillSkip && s.notificationService != nil {
+			if err := s.notificationService.NotifyMissedOccurrencesSkipped(ctx, rt, entry.Skipped); err != nil {
+				log.Printf("Error notifying skipped occurrences for recurring transaction %s: %v", rt.ID, err)
+			}
 		}
 
-		if err := s.transactionSvc.CreateTransaction(ctx, rt.UserID, tx); err != nil {
+		if err != nil {
 			// Log error but continue processing other transactions
 			s.metrics.IncrementFailed()
+			log.Printf("Error processing recurring transaction %s: %v", rt.ID, err)
+			s.queueFailedOccurrences(ctx, rt, entry.Failed, err, now)
 			continue
 		}
 
+		s.metrics.IncrementProcessed()
+	}
+}
+
+// processNextDue claims the next due recurring transaction not in skip and
+// posts its due occurrences. It returns a nil recurring transaction when none
+// are due. On failure nothing is posted and the entry lists the occurrences
+// that should have been.
+func (s *RecurringTransactionService) processNextDue(ctx context.Context, now time.Time, skip []string) (*model.RecurringTransaction, *model.BackfillEntry, error) {
+	var rt *model.RecurringTransaction
+	var entry *model.BackfillEntry
+	var afterCommit []func()
+
+	err := s.repo.InTx(ctx, func(repo repository.Repository) error {
+		var err error
+		rt, err = repo.ClaimDueRecurringTransaction(ctx, now, skip)
+		if err != nil || rt == nil {
+			return err
+		}
+		if err := loadHolidayCalendars(ctx, repo, rt); err != nil {
+			return err
+		}
+
+		post, skipped := planBackfill(rt, rt.DueOccurrences(now), now)
+		entry = &model.BackfillEntry{
+			RecurringID: rt.ID,
+			UserID:      rt.UserID,
+			Description: rt.Description,
+			Policy:      rt.BackfillPolicy,
+			Posted:      post,
+			Skipped:     skipped,
+		}
+
+		for _, occurrence := range post {
+			fn, err := s.postOccurrence(ctx, repo, rt, occurrence)
+			if err != nil {
+				return err
+			}
+			if fn != nil {
+				afterCommit = append(afterCommit, fn)
+			}
+		}
+
 		// Update the recurring transaction's last run and next run dates
-		lastRun := now
-		nextRun := rt.CalculateNextRun(now)
+		return repo.UpdateLastRun(ctx, rt.ID, now, nextRunAfter(rt, now))
+	})
 
-		if err := s.repo.UpdateLastRun(ctx, rt.ID, lastRun, nextRun); err != nil {
-			// Log error but continue processing other transactions
+	if err != nil {
+		if entry != nil {
+			entry.Failed, entry.Posted = entry.Posted, nil
+		}
+		return rt, entry, err
+	}
+
+	for _, fn := range afterCommit {
+		fn()
+	}
+	return rt, entry, nil
+}
+
+// planBackfill splits a rule's due occurrences into those to post and those
+// its backfill policy skips. Occurrences within catchUpGrace of now are
+// on time and only the latest policy leaves them out.
+func planBackfill(rt *model.RecurringTransaction, due []model.Occurrence, now time.Time) (post, skip []model.Occurrence) {
+	switch rt.BackfillPolicy {
+	case model.BackfillLatest:
+		if len(due) == 0 {
+			return nil, nil
+		}
+		return due[len(due)-1:], due[:len(due)-1]
+
+	case model.BackfillSkip:
+		for _, occurrence := range due {
+			if now.Sub(occurrence.Date) > catchUpGrace {
+				skip = append(skip, occurrence)
+			} else {
+				post = append(post, occurrence)
+			}
+		}
+		return post, skip
+
+	default:
+		return due, nil
+	}
+}
+
+// queueFailedOccurrences hands occurrences that failed to post to the retry
+// queue and moves the schedule past them. If any can't be queued the
+// schedule is left alone so the next run tries again.
+func (s *RecurringTransactionService) queueFailedOccurrences(ctx context.Context, rt *model.RecurringTransaction, occurrences []model.Occurrence, err error, now time.Time) {
+	for _, occurrence := range occurrences {
+		if _, qerr := s.retryQueue.Add(ctx, rt, occurrence.ScheduledDate, err); qerr != nil {
+			log.Printf("Error queueing retry for recurring transaction %s: %v", rt.ID, qerr)
+			return
+		}
+	}
+
+	// The retry queue owns the occurrences now, so move the schedule on
+	if err := s.repo.UpdateNextRun(ctx, rt.ID, nextRunAfter(rt, now)); err != nil {
+		log.Printf("Error updating next run for recurring transaction %s: %v", rt.ID, err)
+	}
+}
+
+// ProcessRetries makes another attempt at each failed occurrence that is due
+// for one
+func (s *RecurringTransactionService) ProcessRetries(ctx context.Context) error {
+	now := time.Now().UTC()
+	var processed []string
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		retry, rt, err := s.processNextRetry(ctx, now, processed)
+		if retry == nil {
+			return err
+		}
+		processed = append(processed, retry.ID)
+
+		if err != nil {
 			s.metrics.IncrementFailed()
+			if rt == nil {
+				log.Printf("Error getting recurring transaction %s for retry: %v", retry.RecurringID, err)
+				continue
+			}
+			if _, qerr := s.retryQueue.Add(ctx, rt, retry.Occurrence, err); qerr != nil {
+				log.Printf("Error queueing retry for recurring transaction %s: %v", rt.ID, qerr)
+			}
 			continue
 		}
 
 		s.metrics.IncrementProcessed()
 	}
+}
+
+// processNextRetry claims the next due retry not in skip and posts its
+// occurrence. It returns a nil retry when none are due, and a nil recurring
+// transaction if the retry's schedule couldn't be loaded.
+func (s *RecurringTransactionService) processNextRetry(ctx context.Context, now time.Time, skip []string) (*model.RecurringRetry, *model.RecurringTransaction, error) {
+	var retry *model.RecurringRetry
+	var rt *model.RecurringTransaction
+	var afterCommit func()
+
+	err := s.repo.InTx(ctx, func(repo repository.Repository) error {
+		var err error
+		retry, err = repo.ClaimDueRecurringRetry(ctx, now, skip)
+		if err != nil || retry == nil {
+			return err
+		}
+
+		rt, err = repo.GetRecurringTransactionByID(ctx, retry.RecurringID)
+		if err != nil {
+			return err
+		}
+		if err := loadHolidayCalendars(ctx, repo, rt); err != nil {
+			return err
+		}
+
+		// The occurrence may have been skipped or paused since it failed
+		if occ, ok := rt.Occurrence(retry.Occurrence); ok {
+			afterCommit, err = s.postOccurrence(ctx, repo, rt, occ)
+			if err != nil {
+				return err
+			}
+		}
+
+		// The posted transaction keys this occurrence as done. LastRun and
+		// NextRun belong to the due processing, which already moved past it;
+		// advancing LastRun here would hide occurrences due since the failure.
+		return s.retryQueue.WithRepo(repo).Remove(ctx, retry.ID)
+	})
+
+	if err == nil && afterCommit != nil {
+		afterCommit()
+	}
+	return retry, rt, err
+}
+
+// postOccurrence creates the transaction for one occurrence of a recurring
+// transaction through repo. It is keyed by the scheduled date so a moved
+// occurrence still posts once. An occurrence that was already posted is left
+// alone. The returned function runs the transaction's follow-up work and is
+// called once repo's transaction commits.
+func (s *RecurringTransactionService) postOccurrence(ctx context.Context, repo repository.Repository, rt *model.RecurringTransaction, occurrence model.Occurrence) (func(), error) {
+	scheduled := occurrence.ScheduledDate
+	tx := &model.Transaction{
+		UserID:         rt.UserID,
+		AccountID:      rt.AccountID,
+		CategoryID:     &rt.CategoryID,
+		Amount:         occurrence.Amount,
+		Date:           occurrence.Date,
+		Description:    occurrence.Description,
+		RecurringID:    &rt.ID,
+		OccurrenceDate: &scheduled,
+	}
+
+	afterCommit, err := s.transactionSvc.CreateTransactionInTx(ctx, repo, rt.UserID, tx)
+	if err == errors.ErrDuplicateResource {
+		log.Printf("Occurrence %s of recurring transaction %s was already posted", scheduled.Format(time.RFC3339), rt.ID)
+		return nil, nil
+	}
+	return afterCommit, err
+}
+
+// nextRunAfter returns the run that follows now once the current one is done
+func nextRunAfter(rt *model.RecurringTransaction, now time.Time) time.Time {
+	done := *rt
+	done.LastRun = &now
+	return done.CalculateNextRun(now)
+}
+
+// GetFailedOccurrences returns the user's occurrences that failed to post,
+// optionally only those with the given status
+func (s *RecurringTransactionService) GetFailedOccurrences(ctx context.Context, userID string, status model.RecurringRetryStatus) ([]*model.RecurringRetry, error) {
+	switch status {
+	case "", model.RecurringRetryPending, model.RecurringRetryFailed, model.RecurringRetryDismissed:
+	default:
+		return nil, errors.New("Invalid status", 400)
+	}
+
+	retries, err := s.repo.GetRecurringRetries(ctx, model.RecurringRetryFilter{UserID: userID, Status: status})
+	if err != nil {
+		return nil, err
+	}
+
+	recurring, err := s.repo.GetRecurringTransactions(ctx, model.RecurringTransactionFilter{UserID: userID})
+	if err != nil {
+		return nil, err
+	}
+	byID := make(map[string]*model.RecurringTransaction, len(recurring))
+	for _, rt := range recurring {
+		byID[rt.ID] = rt
+	}
+	for _, retry := range retries {
+		retry.RecurringTransaction = byID[retry.RecurringID]
+	}
+
+	return retries, nil
+}
+
+// RetryFailedOccurrence queues a failed occurrence for an immediate attempt
+// with a fresh set of retries
+func (s *RecurringTransactionService) RetryFailedOccurrence(ctx context.Context, userID, id string) (*model.RecurringRetry, error) {
+	retry, err := s.getFailedOccurrence(ctx, userID, id)
+	if err != nil {
+		return nil, err
+	}
+
+	retry.Attempts = 0
+	retry.Status = model.RecurringRetryPending
+	retry.NextAttemptAt = time.Now().UTC()
+	if err := s.repo.SaveRecurringRetry(ctx, retry); err != nil {
+		return nil, err
+	}
+	return retry, nil
+}
+
+// DismissFailedOccurrence gives up on a failed occurrence
+func (s *RecurringTransactionService) DismissFailedOccurrence(ctx context.Context, userID, id string) error {
+	retry, err := s.getFailedOccurrence(ctx, userID, id)
+	if err != nil {
+		return err
+	}
+
+	retry.Status = model.RecurringRetryDismissed
+	return s.repo.SaveRecurringRetry(ctx, retry)
+}
+
+func (s *RecurringTransactionService) getFailedOccurrence(ctx context.Context, userID, id string) (*model.RecurringRetry, error) {
+	retry, err := s.repo.GetRecurringRetryByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if retry.UserID != userID {
+		return nil, errors.ErrNotFound
+	}
+
+	return retry, nil
+}
+
+// GetRetryQueueMetrics returns metrics about the retry queue
+func (s *RecurringTransactionService) GetRetryQueueMetrics(ctx context.Context) (queue.RetryQueueMetrics, error) {
+	return s.retryQueue.GetMetrics(ctx)
+}
+
+// validateBusinessDays defaults and checks a recurring transaction's business
+// day adjustment, and loads its holiday calendar if it is one of the user's
+func (s *RecurringTransactionService) validateBusinessDays(ctx context.Context, userID string, tx *model.RecurringTransaction) error {
+	if tx.BusinessDayAdjustment == "" {
+		tx.BusinessDayAdjustment = model.AdjustNone
+	}
+	if !tx.BusinessDayAdjustment.Valid() {
+		return errors.New("Business day adjustment must be none, previous, next or modified_following", 400)
+	}
+
+	tx.Calendar = nil
+	if tx.HolidayCalendar == "" {
+		return nil
+	}
+	if _, ok := holiday.Bundled(tx.HolidayCalendar); ok {
+		return nil
+	}
+
+	calendar, err := s.holidayCalendarByID(ctx, userID, tx.HolidayCalendar)
+	if err != nil {
+		return err
+	}
+	if tx.Calendar, err = calendar.Calendar(); err != nil {
+		return errors.Wrap(err, "Failed to build holiday calendar", 500)
+	}
+	return nil
+}
+
+// holidayCalendarByID returns one of the user's holiday calendars
+func (s *RecurringTransactionService) holidayCalendarByID(ctx context.Context, userID, id string) (*model.HolidayCalendar, error) {
+	notFound := errors.New(fmt.Sprintf("Holiday calendar must be one of %s or the ID of one of your calendars", strings.Join(holiday.BundledNames(), ", ")), 400)
+	if _, err := uuid.Parse(id); err != nil {
+		return nil, notFound
+	}
+
+	calendar, err := s.repo.GetHolidayCalendarByID(ctx, id)
+	if err == errors.ErrNotFound || (err == nil && calendar.UserID != userID) {
+		return nil, notFound
+	}
+	return calendar, err
+}
+
+// normalizeSchedule converts the deprecated interval fields to an RRULE when
+// no rule is given, and validates and canonicalises the rule
+func normalizeSchedule(tx *model.RecurringTransaction) error {
+	if tx.RRule == "" {
+		if tx.Interval == "" {
+			return errors.New("RRule is required", 400)
+		}
+
+		rule, err := tx.IntervalRRule()
+		if err != nil {
+			return errors.New(fmt.Sprintf("Invalid schedule: %v", err), 400)
+		}
+		tx.RRule = rule
+	}
+
+	rule, err := rrule.Parse(tx.RRule)
+	if err != nil {
+		return errors.New(fmt.Sprintf("Invalid rrule: %v", err), 400)
+	}
+	tx.RRule = rule.String()
 
 	return nil
 }
 
+// AcceptSinkingFundTransfer sets up a sinking fund's suggested transfer as a
+// recurring debit from its funding account and a matching recurring credit
+// into the fund, so the money moved isn't counted as new income
+func (s *RecurringTransactionService) AcceptSinkingFundTransfer(ctx context.Context, userID string, goal *model.Goal, transfer *model.SinkingFundTransfer) error {
+	if transfer.Accepted() {
+		return errors.New("Transfer has already been set up", 409)
+	}
+	if transfer.Amount <= 0 {
+		return errors.New("Sinking fund is already fully funded", 400)
+	}
+
+	categoryID, err := s.transferCategoryID(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	// A suggestion worked out a while ago starts from next month instead
+	if now := time.Now().UTC(); transfer.StartDate.Before(now) {
+		transfer.StartDate = model.NextTransferDate(now)
+	}
+	if transfer.EndDate.Before(transfer.StartDate) {
+		return errors.New("Sinking fund deadline is before the first transfer", 400)
+	}
+
+	debit, credit := transfer.Legs(categoryID, fmt.Sprintf("Sinking fund: %s", goal.Name))
+	if err := s.CreateRecurringTransaction(ctx, userID, debit); err != nil {
+		return err
+	}
+	if err := s.CreateRecurringTransaction(ctx, userID, credit); err != nil {
+		if delErr := s.repo.DeleteRecurringTransaction(ctx, debit.ID); delErr != nil {
+			log.Printf("Error removing transfer debit %s: %v", debit.ID, delErr)
+		}
+		return err
+	}
+
+	transfer.DebitRecurringID = &debit.ID
+	transfer.CreditRecurringID = &credit.ID
+	if err := s.repo.SaveSinkingFundTransfer(ctx, transfer); err != nil {
+		return errors.Wrap(err, "Failed to save transfer", 500)
+	}
+
+	transfer.Debit = debit
+	transfer.Credit = credit
+	return nil
+}
+
+// transferCategoryID finds the user's category for moving money between accounts
+func (s *RecurringTransactionService) transferCategoryID(ctx context.Context, userID string) (string, error) {
+	categories, err := s.repo.GetCategories(ctx, userID)
+	if err != nil {
+		return "", errors.Wrap(err, "Failed to get categories", 500)
+	}
+
+	fallback := ""
+	for _, c := range categories {
+		if c.Type != model.CategoryTypeTransfer {
+			continue
+		}
+		if c.Name == "Account Transfer" {
+			return c.ID, nil
+		}
+		if fallback == "" {
+			fallback = c.ID
+		}
+	}
+
+	if fallback == "" {
+		return "", errors.New("No transfer category found", 400)
+	}
+	return fallback, nil
+}
+
 // UpdateLastRun updates the last run and next run times for a recurring transaction
 func (s *RecurringTransactionService) UpdateLastRun(ctx context.Context, id string, lastRun, nextRun time.Time) error {
 	return s.repo.UpdateLastRun(ctx, id, lastRun, nextRun)
@@ -0,0 +1,160 @@
+package service
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/yeboahd24/personal-finance-manager/internal/errors"
+	"github.com/yeboahd24/personal-finance-manager/internal/model"
+	"github.com/yeboahd24/personal-finance-manager/internal/repository"
+)
+
+// BillReminderService reminds users of upcoming recurring transactions
+type BillReminderService struct {
+	repo                repository.Repository
+	notificationService *NotificationService
+}
+
+func NewBillReminderService(repo repository.Repository, notificationService *NotificationService) *BillReminderService {
+	return &BillReminderService{
+		repo:                repo,
+		notificationService: notificationService,
+	}
+}
+
+// userReminderContext caches what is needed to project a user's balances
+type userReminderContext struct {
+	prefs     *model.NotificationPreferences
+	balances  map[string]float64
+	recurring []*model.RecurringTransaction
+}
+
+// SendUpcomingReminders sends one reminder for each recurring transaction
+// whose next run falls within its owner's reminder lead time
+func (s *BillReminderService) SendUpcomingReminders(ctx context.Context) error {
+	now := time.Now().UTC()
+	upcoming, err := s.repo.GetDueRecurringTransactions(ctx, now.AddDate(0, 0, model.MaxUpcomingRecurringDays))
+	if err != nil {
+		return errors.Wrap(err, "Failed to get upcoming recurring transactions", 500)
+	}
+	if err := loadHolidayCalendars(ctx, s.repo, upcoming...); err != nil {
+		return err
+	}
+
+	users := make(map[string]*userReminderContext)
+	for _, rt := range upcoming {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		// Overdue runs are the recurring worker's concern
+		if !rt.NextRun.After(now) {
+			continue
+		}
+
+		uc, ok := users[rt.UserID]
+		if !ok {
+			uc, err = s.loadUser(ctx, rt.UserID)
+			if err != nil {
+				log.Printf("Error loading reminder context for user %s: %v", rt.UserID, err)
+				continue
+			}
+			users[rt.UserID] = uc
+		}
+
+		if !uc.prefs.UpcomingRecurring {
+			continue
+		}
+		days := uc.prefs.UpcomingRecurringDays
+		if days <= 0 {
+			days = model.DefaultUpcomingRecurringDays
+		}
+		if rt.NextRun.After(now.AddDate(0, 0, days)) {
+			continue
+		}
+
+		if err := s.remind(ctx, rt, uc); err != nil {
+			log.Printf("Error sending reminder for recurring transaction %s: %v", rt.ID, err)
+		}
+	}
+
+	return nil
+}
+
+func (s *BillReminderService) loadUser(ctx context.Context, userID string) (*userReminderContext, error) {
+	prefs, err := s.repo.GetNotificationPreferences(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	accounts, err := s.repo.GetAccountsByUserID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	balances := make(map[string]float64, len(accounts))
+	for _, account := range accounts {
+		balances[account.ID] = account.Balance
+	}
+
+	active := true
+	recurring, err := s.repo.GetRecurringTransactions(ctx, model.RecurringTransactionFilter{
+		UserID: userID,
+		Active: &active,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := loadHolidayCalendars(ctx, s.repo, recurring...); err != nil {
+		return nil, err
+	}
+
+	return &userReminderContext{
+		prefs:     prefs,
+		balances:  balances,
+		recurring: recurring,
+	}, nil
+}
+
+// remind sends the reminder for rt's next run unless one was already sent.
+// The occurrence is claimed first so concurrent runs can't both send it. The
+// claim is keyed on the occurrence's scheduled date, like overrides and
+// posted transactions, so moving the occurrence doesn't remind again.
+func (s *BillReminderService) remind(ctx context.Context, rt *model.RecurringTransaction, uc *userReminderContext) error {
+	occ, ok := rt.NextOccurrence(rt.NextRun, true)
+	if !ok {
+		return nil
+	}
+	key := rt.OccurrenceKey(occ.ScheduledDate)
+
+	claimed, err := s.repo.ClaimRecurringReminder(ctx, rt.ID, key)
+	if err != nil || !claimed {
+		return err
+	}
+
+	balance := projectedBalance(uc.balances[rt.AccountID], rt.AccountID, rt.NextRun, uc.recurring)
+	if err := s.notificationService.NotifyUpcomingRecurring(ctx, rt.UserID, rt, occ, balance); err != nil {
+		if releaseErr := s.repo.ReleaseRecurringReminder(ctx, rt.ID, key); releaseErr != nil {
+			log.Printf("Error releasing reminder for recurring transaction %s: %v", rt.ID, releaseErr)
+		}
+		return err
+	}
+
+	return nil
+}
+
+// projectedBalance applies every occurrence on the account up to and
+// including until to its current balance, with skips, moves and overrides
+// applied. Runs that are overdue but not yet processed are included, since
+// they will still be posted.
+func projectedBalance(balance float64, accountID string, until time.Time, recurring []*model.RecurringTransaction) float64 {
+	for _, rt := range recurring {
+		if rt.AccountID != accountID || !rt.Active || rt.NextRun.IsZero() || rt.NextRun.After(until) {
+			continue
+		}
+		for _, occ := range rt.Occurrences(rt.NextRun, until) {
+			balance += occ.Amount
+		}
+	}
+	return balance
+}
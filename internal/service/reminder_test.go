@@ -0,0 +1,83 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/yeboahd24/personal-finance-manager/internal/model"
+	"github.com/yeboahd24/personal-finance-manager/internal/repository"
+)
+
+// reminderRepo records claimed reminders and sent notifications
+type reminderRepo struct {
+	repository.Repository
+	claims        map[string]bool
+	notifications int
+}
+
+func (r *reminderRepo) ClaimRecurringReminder(ctx context.Context, recurringID, occurrenceDate string) (bool, error) {
+	key := recurringID + "|" + occurrenceDate
+	if r.claims[key] {
+		return false, nil
+	}
+	r.claims[key] = true
+	return true, nil
+}
+
+func (r *reminderRepo) CreateNotification(ctx context.Context, notification *model.Notification) error {
+	r.notifications++
+	return nil
+}
+
+func (r *reminderRepo) GetNotificationPreferences(ctx context.Context, userID string) (*model.NotificationPreferences, error) {
+	return &model.NotificationPreferences{MinPriority: model.NotificationPriorityHigh}, nil
+}
+
+func TestReminderNotRepeatedWhenOccurrenceMoves(t *testing.T) {
+	repo := &reminderRepo{claims: make(map[string]bool)}
+	s := NewBillReminderService(repo, NewNotificationService(repo, nil, nil))
+	ctx := context.Background()
+
+	start := time.Date(2024, 1, 10, 9, 0, 0, 0, time.UTC)
+	rt := &model.RecurringTransaction{
+		ID:          "rent",
+		UserID:      "user",
+		AccountID:   "checking",
+		Amount:      -900,
+		Description: "Rent",
+		RRule:       "FREQ=MONTHLY;BYMONTHDAY=10",
+		StartDate:   start,
+		NextRun:     start.AddDate(0, 2, 0),
+		Active:      true,
+	}
+	uc := &userReminderContext{balances: map[string]float64{"checking": 2000}}
+
+	if err := s.remind(ctx, rt, uc); err != nil {
+		t.Fatalf("remind returned error: %v", err)
+	}
+	if !repo.claims["rent|2024-03-10"] {
+		t.Fatalf("claims = %v, want the occurrence scheduled on 2024-03-10", repo.claims)
+	}
+
+	// The user moves the reminded occurrence, which moves the next run
+	moveTo := time.Date(2024, 3, 12, 9, 0, 0, 0, time.UTC)
+	rt.Overrides = model.OccurrenceOverrides{{Date: "2024-03-10", MoveTo: &moveTo}}
+	rt.NextRun = moveTo
+
+	if err := s.remind(ctx, rt, uc); err != nil {
+		t.Fatalf("remind returned error: %v", err)
+	}
+	if repo.notifications != 1 {
+		t.Errorf("sent %d reminders for one occurrence", repo.notifications)
+	}
+
+	// The following occurrence still gets its own reminder
+	rt.NextRun = start.AddDate(0, 3, 0)
+	if err := s.remind(ctx, rt, uc); err != nil {
+		t.Fatalf("remind returned error: %v", err)
+	}
+	if repo.notifications != 2 {
+		t.Errorf("sent %d reminders, want 2", repo.notifications)
+	}
+}
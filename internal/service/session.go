@@ -0,0 +1,213 @@
+package service
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/yeboahd24/personal-finance-manager/internal/errors"
+	"github.com/yeboahd24/personal-finance-manager/internal/model"
+	"github.com/yeboahd24/personal-finance-manager/internal/repository"
+)
+
+// staleSessionRetention is how long ended sessions stay in the sessions list
+const staleSessionRetention = 7 * 24 * time.Hour
+
+var (
+	errInvalidRefreshToken = errors.New("Invalid or expired refresh token", 401)
+	errSessionEnded        = errors.New("Session has ended", 401)
+)
+
+// SessionService manages login sessions and the refresh tokens that renew
+// them. Each refresh replaces the token with a new one; presenting a replaced
+// token again means it was stolen, so the whole session is revoked.
+type SessionService struct {
+	repo repository.Repository
+}
+
+func NewSessionService(repo repository.Repository) *SessionService {
+	return &SessionService{repo: repo}
+}
+
+// StartSession opens a session for a user who just logged in and returns it
+// with its first refresh token
+func (s *SessionService) StartSession(ctx context.Context, userID, userAgent, ipAddress string) (*model.Session, string, error) {
+	now := time.Now()
+	if _, err := s.repo.DeleteStaleSessions(ctx, userID, now.Add(-staleSessionRetention)); err != nil {
+		log.Printf("Error deleting stale sessions for user %s: %v", userID, err)
+	}
+
+	session := &model.Session{
+		UserID:    userID,
+		UserAgent: userAgent,
+		IPAddress: ipAddress,
+		ExpiresAt: now.Add(model.RefreshTokenTTL),
+	}
+
+	var token string
+	err := s.repo.InTx(ctx, func(repo repository.Repository) error {
+		if err := repo.CreateSession(ctx, session); err != nil {
+			return err
+		}
+		var err error
+		token, err = issueRefreshToken(ctx, repo, session.ID, session.ExpiresAt)
+		return err
+	})
+	if err != nil {
+		return nil, "", err
+	}
+
+	session.Current = true
+	return session, token, nil
+}
+
+// Refresh exchanges a refresh token for a new one, extending its session.
+// A token that was already exchanged, outside the short grace window for
+// concurrent requests, revokes the session.
+func (s *SessionService) Refresh(ctx context.Context, refreshToken, userAgent, ipAddress string) (*model.Session, string, error) {
+	if refreshToken == "" {
+		return nil, "", errInvalidRefreshToken
+	}
+
+	var (
+		session *model.Session
+		token   string
+		reused  bool
+	)
+	err := s.repo.InTx(ctx, func(repo repository.Repository) error {
+		now := time.Now()
+		stored, err := repo.GetRefreshTokenByHash(ctx, hashToken(refreshToken))
+		if err == errors.ErrNotFound {
+			return errInvalidRefreshToken
+		}
+		if err != nil {
+			return err
+		}
+
+		session, err = repo.GetSessionByID(ctx, stored.SessionID)
+		if err == errors.ErrNotFound {
+			return errInvalidRefreshToken
+		}
+		if err != nil {
+			return err
+		}
+		if !session.Active(now) || !now.Before(stored.ExpiresAt) {
+			return errInvalidRefreshToken
+		}
+
+		if stored.UsedAt != nil && now.Sub(*stored.UsedAt) > model.RefreshReuseGrace {
+			reused = true
+			// Commit the revocation rather than returning an error, which
+			// would roll it back
+			return repo.RevokeSession(ctx, session.UserID, session.ID, model.SessionReuse)
+		}
+
+		if stored.UsedAt == nil {
+			if err := repo.MarkRefreshTokenUsed(ctx, stored.ID, now); err != nil {
+				return err
+			}
+		}
+
+		session.UserAgent = userAgent
+		session.IPAddress = ipAddress
+		session.ExpiresAt = now.Add(model.RefreshTokenTTL)
+		if err := repo.TouchSession(ctx, session); err != nil {
+			return err
+		}
+
+		token, err = issueRefreshToken(ctx, repo, session.ID, session.ExpiresAt)
+		if err != nil {
+			return err
+		}
+
+		if _, err := repo.DeleteExpiredRefreshTokens(ctx, session.ID, now); err != nil {
+			return err
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	if reused {
+		log.Printf("Refresh token reused for session %s of user %s; session revoked", session.ID, session.UserID)
+		return nil, "", errInvalidRefreshToken
+	}
+
+	session.Current = true
+	return session, token, nil
+}
+
+// ValidateSession checks that the session an access token was issued for
+// still belongs to the user and hasn't ended
+func (s *SessionService) ValidateSession(ctx context.Context, userID, sessionID string) error {
+	if _, err := uuid.Parse(sessionID); err != nil {
+		return errSessionEnded
+	}
+	session, err := s.repo.GetSessionByID(ctx, sessionID)
+	if err == errors.ErrNotFound {
+		return errSessionEnded
+	}
+	if err != nil {
+		return err
+	}
+	if session.UserID != userID || !session.Active(time.Now()) {
+		return errSessionEnded
+	}
+	return nil
+}
+
+// GetSessions returns the user's active sessions, marking the one with
+// currentID as the current session
+func (s *SessionService) GetSessions(ctx context.Context, userID, currentID string) ([]*model.Session, error) {
+	sessions, err := s.repo.GetSessions(ctx, userID, true)
+	if err != nil {
+		return nil, err
+	}
+	for _, session := range sessions {
+		session.Current = session.ID == currentID
+	}
+	return sessions, nil
+}
+
+// RevokeSession ends one of the user's sessions, from the sessions list
+func (s *SessionService) RevokeSession(ctx context.Context, userID, sessionID string) error {
+	if _, err := uuid.Parse(sessionID); err != nil {
+		return errors.ErrNotFound
+	}
+	return s.repo.RevokeSession(ctx, userID, sessionID, model.SessionRevoked)
+}
+
+// Logout ends the session the request was made with
+func (s *SessionService) Logout(ctx context.Context, userID, sessionID string) error {
+	err := s.repo.RevokeSession(ctx, userID, sessionID, model.SessionLogout)
+	if err == errors.ErrNotFound {
+		return nil
+	}
+	return err
+}
+
+// LogoutAll ends every active session of the user, including the current
+// one, and returns how many were ended
+func (s *SessionService) LogoutAll(ctx context.Context, userID string) (int64, error) {
+	return s.repo.RevokeUserSessions(ctx, userID, "", model.SessionLogoutAll)
+}
+
+// issueRefreshToken generates a refresh token for a session and stores its
+// hash. Only the hash is kept, so a database leak doesn't expose live tokens.
+func issueRefreshToken(ctx context.Context, repo repository.Repository, sessionID string, expiresAt time.Time) (string, error) {
+	token, hash, err := newOpaqueToken()
+	if err != nil {
+		return "", err
+	}
+
+	err = repo.CreateRefreshToken(ctx, &model.RefreshToken{
+		SessionID: sessionID,
+		TokenHash: hash,
+		ExpiresAt: expiresAt,
+	})
+	if err != nil {
+		return "", err
+	}
+	return token, nil
+}
@@ -0,0 +1,456 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/yeboahd24/personal-finance-manager/internal/errors"
+	"github.com/yeboahd24/personal-finance-manager/internal/model"
+	"github.com/yeboahd24/personal-finance-manager/internal/repository"
+	"github.com/yeboahd24/personal-finance-manager/internal/rrule"
+)
+
+const (
+	// How far back transactions are scanned for subscriptions
+	subscriptionLookbackYears = 2
+	// Charges within this relative difference are treated as the same subscription
+	subscriptionAmountTolerance = 0.25
+	// Detected groups below this confidence are not reported
+	subscriptionMinConfidence = 0.5
+	// Increases smaller than this fraction are treated as rounding noise
+	subscriptionPriceIncreaseThreshold = 0.01
+)
+
+// Words that commonly pad bank descriptions without identifying the merchant
+var merchantNoiseWords = map[string]bool{
+	"pos": true, "debit": true, "credit": true, "card": true, "purchase": true,
+	"payment": true, "ach": true, "recurring": true, "autopay": true, "online": true,
+	"www": true, "com": true, "net": true, "org": true, "inc": true, "llc": true,
+	"ltd": true, "the": true, "bill": true, "pmt": true, "visa": true, "mastercard": true,
+}
+
+type SubscriptionService struct {
+	repo             repository.Repository
+	recurringService *RecurringTransactionService
+}
+
+func NewSubscriptionService(repo repository.Repository, recurringService *RecurringTransactionService) *SubscriptionService {
+	return &SubscriptionService{
+		repo:             repo,
+		recurringService: recurringService,
+	}
+}
+
+// DetectSubscriptions scans the user's transaction history for recurring
+// payments. Dismissed subscriptions are left out; tracked ones carry the ID
+// of their recurring transaction.
+func (s *SubscriptionService) DetectSubscriptions(ctx context.Context, userID string) ([]*model.Subscription, error) {
+	now := time.Now().UTC()
+	transactions, err := s.repo.GetTransactions(ctx, model.TransactionFilter{
+		UserID:    userID,
+		StartDate: now.AddDate(-subscriptionLookbackYears, 0, 0),
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to get transactions", 500)
+	}
+
+	decisions, err := s.repo.GetSubscriptionDecisions(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	decisionByID := make(map[string]*model.SubscriptionDecision, len(decisions))
+	for _, d := range decisions {
+		decisionByID[d.SubscriptionID] = d
+	}
+
+	// Subscriptions entered by hand are matched to their recurring transaction by merchant
+	recurring, err := s.repo.GetRecurringTransactions(ctx, model.RecurringTransactionFilter{UserID: userID})
+	if err != nil {
+		return nil, err
+	}
+	trackedByMerchant := make(map[string]string)
+	for _, rt := range recurring {
+		if key := normalizeMerchant(rt.Description); key != "" && rt.Amount < 0 {
+			trackedByMerchant[key] = rt.ID
+		}
+	}
+
+	var detected []*model.Subscription
+	for _, charges := range groupCharges(transactions) {
+		if sub := analyzeCharges(charges, now); sub != nil {
+			detected = append(detected, sub)
+		}
+	}
+	assignSubscriptionIDs(detected)
+
+	subscriptions := []*model.Subscription{}
+	for _, sub := range detected {
+		sub.UserID = userID
+
+		if d, ok := decisionByID[sub.ID]; ok {
+			if d.Status == model.SubscriptionDismissed {
+				continue
+			}
+			sub.RecurringTransactionID = d.RecurringTransactionID
+		}
+		if sub.RecurringTransactionID == nil {
+			if id, ok := trackedByMerchant[sub.MerchantKey]; ok {
+				sub.RecurringTransactionID = &id
+			}
+		}
+
+		subscriptions = append(subscriptions, sub)
+	}
+
+	sort.Slice(subscriptions, func(i, j int) bool {
+		return subscriptions[i].Confidence > subscriptions[j].Confidence
+	})
+	return subscriptions, nil
+}
+
+// GetSuggestions returns detected subscriptions that are still charging and
+// aren't tracked as recurring transactions yet
+func (s *SubscriptionService) GetSuggestions(ctx context.Context, userID string) ([]*model.Subscription, error) {
+	subscriptions, err := s.DetectSubscriptions(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	suggestions := []*model.Subscription{}
+	for _, sub := range subscriptions {
+		if sub.RecurringTransactionID == nil && !sub.Stopped {
+			suggestions = append(suggestions, sub)
+		}
+	}
+	return suggestions, nil
+}
+
+// AcceptSuggestion creates a recurring transaction for a detected subscription.
+// categoryID overrides the category of the subscription's charges when set.
+func (s *SubscriptionService) AcceptSuggestion(ctx context.Context, userID, id, categoryID string) (*model.RecurringTransaction, error) {
+	sub, err := s.findSubscription(ctx, userID, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if sub.RecurringTransactionID != nil {
+		return nil, errors.New("Subscription is already tracked", 400)
+	}
+	if sub.Stopped {
+		return nil, errors.New("Subscription appears to have stopped charging", 400)
+	}
+
+	rule, err := sub.RRule()
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to build schedule", 500)
+	}
+
+	if categoryID == "" && sub.CategoryID != nil {
+		categoryID = *sub.CategoryID
+	}
+
+	// Start from the next charge that hasn't happened yet
+	start := sub.NextExpectedDate
+	if now := time.Now().UTC(); start.Before(now) {
+		parsed, err := rrule.Parse(rule)
+		if err != nil {
+			return nil, errors.Wrap(err, "Failed to build schedule", 500)
+		}
+		start = rrule.NewSet(parsed, sub.LastDate, nil).After(now, false)
+	}
+
+	rt := &model.RecurringTransaction{
+		AccountID:   sub.AccountID,
+		CategoryID:  categoryID,
+		Amount:      sub.Amount,
+		Description: sub.Merchant,
+		RRule:       rule,
+		StartDate:   start,
+	}
+	if err := s.recurringService.CreateRecurringTransaction(ctx, userID, rt); err != nil {
+		return nil, err
+	}
+
+	decision := &model.SubscriptionDecision{
+		UserID:                 userID,
+		SubscriptionID:         sub.ID,
+		Status:                 model.SubscriptionAccepted,
+		RecurringTransactionID: &rt.ID,
+	}
+	if err := s.repo.SaveSubscriptionDecision(ctx, decision); err != nil {
+		return nil, err
+	}
+
+	return rt, nil
+}
+
+// DismissSuggestion hides a detected subscription from future results
+func (s *SubscriptionService) DismissSuggestion(ctx context.Context, userID, id string) error {
+	sub, err := s.findSubscription(ctx, userID, id)
+	if err != nil {
+		return err
+	}
+
+	return s.repo.SaveSubscriptionDecision(ctx, &model.SubscriptionDecision{
+		UserID:         userID,
+		SubscriptionID: sub.ID,
+		Status:         model.SubscriptionDismissed,
+	})
+}
+
+func (s *SubscriptionService) findSubscription(ctx context.Context, userID, id string) (*model.Subscription, error) {
+	subscriptions, err := s.DetectSubscriptions(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, sub := range subscriptions {
+		if sub.ID == id {
+			return sub, nil
+		}
+	}
+	return nil, errors.ErrNotFound
+}
+
+// groupCharges groups outgoing transactions by normalized merchant, then
+// splits each merchant's charges into clusters of similar amounts. Each
+// cluster is sorted oldest first.
+func groupCharges(transactions []*model.Transaction) [][]*model.Transaction {
+	byMerchant := make(map[string][]*model.Transaction)
+	for _, tx := range transactions {
+		if tx.Amount >= 0 {
+			continue
+		}
+		if key := merchantKey(tx); key != "" {
+			byMerchant[key] = append(byMerchant[key], tx)
+		}
+	}
+
+	var groups [][]*model.Transaction
+	for _, charges := range byMerchant {
+		sort.Slice(charges, func(i, j int) bool { return charges[i].Date.Before(charges[j].Date) })
+
+		var clusters [][]*model.Transaction
+		for _, tx := range charges {
+			best, bestDiff := -1, subscriptionAmountTolerance
+			for i, cluster := range clusters {
+				// Compare with the latest charge so gradual price changes stay together
+				if diff := relativeDiff(cluster[len(cluster)-1].Amount, tx.Amount); diff <= bestDiff {
+					best, bestDiff = i, diff
+				}
+			}
+			if best < 0 {
+				clusters = append(clusters, []*model.Transaction{tx})
+			} else {
+				clusters[best] = append(clusters[best], tx)
+			}
+		}
+		groups = append(groups, clusters...)
+	}
+	return groups
+}
+
+// analyzeCharges detects the periodicity of a cluster of charges, returning
+// nil when they don't look like a subscription
+func analyzeCharges(charges []*model.Transaction, now time.Time) *model.Subscription {
+	if len(charges) < 2 {
+		return nil
+	}
+
+	intervals := make([]float64, 0, len(charges)-1)
+	for i := 1; i < len(charges); i++ {
+		intervals = append(intervals, charges[i].Date.Sub(charges[i-1].Date).Hours()/24)
+	}
+
+	period, ok := matchPeriod(median(intervals))
+	if !ok || len(charges) < minSubscriptionCharges(period) {
+		return nil
+	}
+
+	// Share of gaps close to the period
+	regular := 0
+	for _, days := range intervals {
+		if math.Abs(days-period.Days()) <= period.Tolerance() {
+			regular++
+		}
+	}
+	regularity := float64(regular) / float64(len(intervals))
+
+	// Amount stability from the coefficient of variation
+	amounts := make([]float64, len(charges))
+	var sum float64
+	for i, tx := range charges {
+		amounts[i] = -tx.Amount
+		sum += amounts[i]
+	}
+	mean := sum / float64(len(amounts))
+	var variance float64
+	for _, a := range amounts {
+		variance += (a - mean) * (a - mean)
+	}
+	cv := math.Sqrt(variance/float64(len(amounts))) / mean
+	stability := math.Max(0, 1-cv*4)
+
+	history := math.Min(1, float64(len(charges)-1)/5)
+
+	confidence := math.Round((0.6*regularity+0.25*stability+0.15*history)*100) / 100
+	if confidence < subscriptionMinConfidence {
+		return nil
+	}
+
+	first, last := charges[0], charges[len(charges)-1]
+	sub := &model.Subscription{
+		AccountID:     last.AccountID,
+		Merchant:      merchantName(last),
+		MerchantKey:   merchantKey(first),
+		Period:        period,
+		Confidence:    confidence,
+		Amount:        last.Amount,
+		AverageAmount: -math.Round(mean*100) / 100,
+		Occurrences:   len(charges),
+		FirstDate:     first.Date,
+		LastDate:      last.Date,
+	}
+	for _, tx := range charges {
+		sub.TransactionIDs = append(sub.TransactionIDs, tx.ID)
+		if tx.CategoryID != nil {
+			sub.CategoryID = tx.CategoryID
+		}
+	}
+
+	// Expected next charge follows the same rule an accepted suggestion would use
+	sub.NextExpectedDate = last.Date.AddDate(0, 0, int(math.Round(period.Days())))
+	if rule, err := sub.RRule(); err == nil {
+		if parsed, err := rrule.Parse(rule); err == nil {
+			sub.NextExpectedDate = rrule.NewSet(parsed, last.Date, nil).After(last.Date, false)
+		}
+	}
+
+	previous := charges[len(charges)-2]
+	if -last.Amount > -previous.Amount*(1+subscriptionPriceIncreaseThreshold) {
+		sub.PriceIncrease = true
+		sub.PreviousAmount = previous.Amount
+		sub.PriceChange = math.Round((last.Amount/previous.Amount-1)*1000) / 10
+	}
+
+	// Allow half a period of slack before calling it stopped
+	grace := time.Duration(period.Days() / 2 * float64(24*time.Hour))
+	sub.Stopped = now.After(sub.NextExpectedDate.Add(grace))
+
+	return sub
+}
+
+// matchPeriod picks the subscription period closest to a typical gap in days
+func matchPeriod(days float64) (model.SubscriptionPeriod, bool) {
+	for _, p := range []model.SubscriptionPeriod{
+		model.SubscriptionWeekly,
+		model.SubscriptionBiweekly,
+		model.SubscriptionMonthly,
+		model.SubscriptionAnnual,
+	} {
+		if math.Abs(days-p.Days()) <= p.Tolerance() {
+			return p, true
+		}
+	}
+	return "", false
+}
+
+// minSubscriptionCharges is how many charges are needed before a period is trusted
+func minSubscriptionCharges(period model.SubscriptionPeriod) int {
+	switch period {
+	case model.SubscriptionAnnual:
+		return 2
+	case model.SubscriptionMonthly:
+		return 3
+	default:
+		return 4
+	}
+}
+
+// assignSubscriptionIDs gives each subscription an ID from its merchant and
+// period, which don't change as the lookback window slides or the price
+// changes. A merchant charging several subscriptions on the same period has
+// them numbered from the cheapest up.
+func assignSubscriptionIDs(subscriptions []*model.Subscription) {
+	sorted := make([]*model.Subscription, len(subscriptions))
+	copy(sorted, subscriptions)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Amount > sorted[j].Amount
+	})
+
+	seen := make(map[string]int)
+	for _, sub := range sorted {
+		base := sub.MerchantKey + "|" + string(sub.Period)
+		sub.ID = subscriptionID(sub.MerchantKey, sub.Period, seen[base])
+		seen[base]++
+	}
+}
+
+// subscriptionID derives a stable ID from what identifies a subscription
+func subscriptionID(key string, period model.SubscriptionPeriod, n int) string {
+	value := fmt.Sprintf("%s|%s", key, period)
+	if n > 0 {
+		value = fmt.Sprintf("%s|%d", value, n)
+	}
+	sum := sha256.Sum256([]byte(value))
+	return hex.EncodeToString(sum[:8])
+}
+
+func merchantKey(tx *model.Transaction) string {
+	if tx.MerchantName != nil && *tx.MerchantName != "" {
+		return normalizeMerchant(*tx.MerchantName)
+	}
+	return normalizeMerchant(tx.Description)
+}
+
+func merchantName(tx *model.Transaction) string {
+	if tx.MerchantName != nil && *tx.MerchantName != "" {
+		return *tx.MerchantName
+	}
+	return strings.TrimSpace(tx.Description)
+}
+
+// normalizeMerchant reduces a merchant name or bank description to its first
+// few identifying words, dropping reference numbers, location codes and noise
+func normalizeMerchant(s string) string {
+	fields := strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r)
+	})
+
+	var words []string
+	for _, f := range fields {
+		if len(f) < 3 || merchantNoiseWords[f] {
+			continue
+		}
+		words = append(words, f)
+		if len(words) == 3 {
+			break
+		}
+	}
+	return strings.Join(words, " ")
+}
+
+func relativeDiff(a, b float64) float64 {
+	a, b = math.Abs(a), math.Abs(b)
+	if a == 0 && b == 0 {
+		return 0
+	}
+	return math.Abs(a-b) / math.Max(a, b)
+}
+
+func median(values []float64) float64 {
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+	n := len(sorted)
+	if n%2 == 1 {
+		return sorted[n/2]
+	}
+	return (sorted[n/2-1] + sorted[n/2]) / 2
+}
@@ -0,0 +1,154 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/yeboahd24/personal-finance-manager/internal/model"
+	"github.com/yeboahd24/personal-finance-manager/internal/repository"
+)
+
+// subscriptionRepo serves transactions from inside the lookback window and
+// keeps subscription decisions in memory
+type subscriptionRepo struct {
+	repository.Repository
+	transactions []*model.Transaction
+	decisions    map[string]*model.SubscriptionDecision
+}
+
+func (r *subscriptionRepo) GetTransactions(ctx context.Context, filter model.TransactionFilter) ([]*model.Transaction, error) {
+	var transactions []*model.Transaction
+	for _, tx := range r.transactions {
+		if !tx.Date.Before(filter.StartDate) {
+			transactions = append(transactions, tx)
+		}
+	}
+	return transactions, nil
+}
+
+func (r *subscriptionRepo) GetRecurringTransactions(ctx context.Context, filter model.RecurringTransactionFilter) ([]*model.RecurringTransaction, error) {
+	return nil, nil
+}
+
+func (r *subscriptionRepo) GetSubscriptionDecisions(ctx context.Context, userID string) ([]*model.SubscriptionDecision, error) {
+	var decisions []*model.SubscriptionDecision
+	for _, d := range r.decisions {
+		decisions = append(decisions, d)
+	}
+	return decisions, nil
+}
+
+func (r *subscriptionRepo) SaveSubscriptionDecision(ctx context.Context, decision *model.SubscriptionDecision) error {
+	r.decisions[decision.SubscriptionID] = decision
+	return nil
+}
+
+// monthlyCharges returns a charge on the same day of each of the months
+// before now, oldest first
+func monthlyCharges(merchant string, now time.Time, amounts ...float64) []*model.Transaction {
+	var charges []*model.Transaction
+	for i, amount := range amounts {
+		charges = append(charges, &model.Transaction{
+			ID:          fmt.Sprintf("%s-%d", merchant, i),
+			AccountID:   "checking",
+			Amount:      amount,
+			Description: merchant,
+			Date:        now.AddDate(0, i-len(amounts), 0),
+		})
+	}
+	return charges
+}
+
+func TestSubscriptionIDSurvivesSlidingWindowAndPriceChange(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now().UTC()
+
+	tests := []struct {
+		name   string
+		status model.SubscriptionDecisionStatus
+	}{
+		{"accepted", model.SubscriptionAccepted},
+		{"dismissed", model.SubscriptionDismissed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &subscriptionRepo{
+				transactions: monthlyCharges("STREAMFLIX", now,
+					-9.99, -9.99, -9.99, -9.99, -9.99, -9.99,
+					-12.99, -12.99, -12.99, -12.99, -12.99, -12.99),
+				decisions: make(map[string]*model.SubscriptionDecision),
+			}
+			s := NewSubscriptionService(repo, nil)
+
+			subscriptions, err := s.DetectSubscriptions(ctx, "user")
+			if err != nil || len(subscriptions) != 1 {
+				t.Fatalf("DetectSubscriptions = %d subscriptions, %v; want 1", len(subscriptions), err)
+			}
+			id := subscriptions[0].ID
+
+			recurringID := "rt-1"
+			decision := &model.SubscriptionDecision{UserID: "user", SubscriptionID: id, Status: tt.status}
+			if tt.status == model.SubscriptionAccepted {
+				decision.RecurringTransactionID = &recurringID
+			}
+			repo.SaveSubscriptionDecision(ctx, decision)
+
+			// The window slides past every charge at the old price
+			repo.transactions = repo.transactions[6:]
+
+			subscriptions, err = s.DetectSubscriptions(ctx, "user")
+			if err != nil {
+				t.Fatal(err)
+			}
+			switch tt.status {
+			case model.SubscriptionDismissed:
+				if len(subscriptions) != 0 {
+					t.Errorf("dismissed subscription came back as %s", subscriptions[0].ID)
+				}
+			case model.SubscriptionAccepted:
+				if len(subscriptions) != 1 {
+					t.Fatalf("got %d subscriptions, want 1", len(subscriptions))
+				}
+				sub := subscriptions[0]
+				if sub.ID != id {
+					t.Errorf("ID changed from %s to %s", id, sub.ID)
+				}
+				if sub.RecurringTransactionID == nil || *sub.RecurringTransactionID != recurringID {
+					t.Errorf("accepted subscription lost its recurring transaction: %v", sub.RecurringTransactionID)
+				}
+			}
+		})
+	}
+}
+
+func TestSubscriptionIDsForSameMerchantAndPeriod(t *testing.T) {
+	now := time.Now().UTC()
+	basic := monthlyCharges("CLOUDBOX", now, -2.99, -2.99, -2.99, -2.99)
+	premium := monthlyCharges("CLOUDBOX", now, -29.99, -29.99, -29.99, -29.99)
+	for _, tx := range premium {
+		tx.ID += "-premium"
+	}
+
+	repo := &subscriptionRepo{
+		transactions: append(premium, basic...),
+		decisions:    make(map[string]*model.SubscriptionDecision),
+	}
+	subscriptions, err := NewSubscriptionService(repo, nil).DetectSubscriptions(context.Background(), "user")
+	if err != nil || len(subscriptions) != 2 {
+		t.Fatalf("DetectSubscriptions = %d subscriptions, %v; want 2", len(subscriptions), err)
+	}
+
+	ids := make(map[float64]string)
+	for _, sub := range subscriptions {
+		ids[sub.Amount] = sub.ID
+	}
+	if ids[-2.99] == ids[-29.99] {
+		t.Errorf("both subscriptions have ID %s", ids[-2.99])
+	}
+	if want := subscriptionID("cloudbox", model.SubscriptionMonthly, 0); ids[-2.99] != want {
+		t.Errorf("cheapest subscription ID = %s, want %s", ids[-2.99], want)
+	}
+}
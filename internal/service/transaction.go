@@ -5,6 +5,8 @@ import (
 	"database/sql"
 	"fmt"
 	"log"
+	"math"
+	"strings"
 	"time"
 
 	"github.com/yeboahd24/personal-finance-manager/internal/errors"
@@ -13,14 +15,20 @@ import (
 )
 
 type TransactionService struct {
-	repo  repository.Repository
-	plaid *PlaidService // Optional Plaid integration
+	repo   repository.Repository
+	plaid  *PlaidService            // Optional Plaid integration
+	goals  *GoalService             // Optional, resets sinking funds when their expense lands
+	events *EventService            // Optional, pushes transaction and budget events to streams and webhooks
+	alerts *TransactionAlertService // Optional, checks new transactions against the user's alerts
 }
 
-func NewTransactionService(repo repository.Repository, plaid *PlaidService) *TransactionService {
+func NewTransactionService(repo repository.Repository, plaid *PlaidService, goals *GoalService, events *EventService, alerts *TransactionAlertService) *TransactionService {
 	return &TransactionService{
-		repo:  repo,
-		plaid: plaid,
+		repo:   repo,
+		plaid:  plaid,
+		goals:  goals,
+		events: events,
+		alerts: alerts,
 	}
 }
 
@@ -56,6 +64,7 @@ func (s *TransactionService) SyncTransactions(ctx context.Context, userID string
 	}
 
 	// Save transactions
+	imported := 0
 	for _, plaidTx := range transactions {
 		accountID, ok := accountMap[plaidTx.AccountId]
 		if !ok {
@@ -75,12 +84,28 @@ func (s *TransactionService) SyncTransactions(ctx context.Context, userID string
 			Type:               s.determineTransactionType(plaidTx.Amount),
 			PlaidTransactionID: &plaidTx.TransactionId,
 			MerchantName:       plaidTx.MerchantName.Get(),
+			Currency:           plaidTx.GetIsoCurrencyCode(),
 			Categories:         plaidTx.Category,
 			UserID:             userID,
 		}
 
 		// Try to create transaction, ignore if it already exists
-		_ = s.repo.CreateTransaction(ctx, tx)
+		if err := s.repo.CreateTransaction(ctx, tx); err != nil {
+			continue
+		}
+		imported++
+
+		if err := s.events.Publish(ctx, userID, model.EventTransactionImported, tx); err != nil {
+			log.Printf("Error publishing import of transaction %s: %v", tx.ID, err)
+		}
+		s.afterCreate(ctx, tx)
+	}
+
+	if err := s.events.Publish(ctx, userID, model.EventSyncCompleted, map[string]interface{}{
+		"imported": imported,
+		"fetched":  len(transactions),
+	}); err != nil {
+		log.Printf("Error publishing sync completion for user %s: %v", userID, err)
 	}
 
 	return nil
@@ -125,7 +150,14 @@ func (s *TransactionService) UpdateTransaction(ctx context.Context, userID strin
 	existing.CategoryID = tx.CategoryID
 	existing.Description = tx.Description
 
-	return s.repo.UpdateTransaction(ctx, existing)
+	if err := s.repo.UpdateTransaction(ctx, existing); err != nil {
+		return err
+	}
+
+	if err := s.events.Publish(ctx, userID, model.EventTransactionUpdated, existing); err != nil {
+		log.Printf("Error publishing update of transaction %s: %v", existing.ID, err)
+	}
+	return nil
 }
 
 func (s *TransactionService) CreateTransaction(ctx context.Context, userID string, tx *model.Transaction) error {
@@ -146,12 +178,122 @@ func (s *TransactionService) CreateTransaction(ctx context.Context, userID strin
 	// Set the user ID
 	tx.UserID = userID
 
+	tx.Currency = strings.ToUpper(strings.TrimSpace(tx.Currency))
+	if tx.Currency != "" && len(tx.Currency) != 3 {
+		return errors.New("Currency must be a 3 letter ISO code", 400)
+	}
+
 	log.Printf("Creating transaction: %+v", tx)
 	if err := s.repo.CreateTransaction(ctx, tx); err != nil {
 		log.Printf("Error in repository.CreateTransaction: %+v", err)
 		return fmt.Errorf("failed to create transaction in repository: %w", err)
 	}
 
+	s.afterCreate(ctx, tx)
+
+	return nil
+}
+
+// CreateTransactionInTx stores a transaction through repo, which is bound to
+// a database transaction. The follow-up work is returned rather than run, to
+// be called once that transaction commits. Repository errors are returned
+// unwrapped so callers can recognise errors.ErrDuplicateResource.
+func (s *TransactionService) CreateTransactionInTx(ctx context.Context, repo repository.Repository, userID string, tx *model.Transaction) (func(), error) {
+	account, err := repo.GetAccountByID(ctx, tx.AccountID)
+	if err != nil {
+		return nil, err
+	}
+	if account.UserID != userID {
+		return nil, errors.ErrUnauthorized
+	}
+
+	tx.Type = s.determineTransactionType(tx.Amount)
+	tx.UserID = userID
+
+	if err := repo.CreateTransaction(ctx, tx); err != nil {
+		return nil, err
+	}
+
+	return func() { s.afterCreate(ctx, tx) }, nil
+}
+
+// afterCreate runs follow-up work for a newly stored transaction. Failures are
+// logged rather than returned since the transaction itself was saved.
+func (s *TransactionService) afterCreate(ctx context.Context, tx *model.Transaction) {
+	if s.goals != nil {
+		if err := s.goals.MatchSinkingFundExpense(ctx, tx); err != nil {
+			log.Printf("Error matching sinking fund expense for transaction %s: %v", tx.ID, err)
+		}
+	}
+	if s.events != nil {
+		// Imports are published by SyncTransactions
+		if tx.PlaidTransactionID == nil {
+			if err := s.events.Publish(ctx, tx.UserID, model.EventTransactionCreated, tx); err != nil {
+				log.Printf("Error publishing creation of transaction %s: %v", tx.ID, err)
+			}
+		}
+		if err := s.publishBudgetThresholds(ctx, tx); err != nil {
+			log.Printf("Error checking budget thresholds for transaction %s: %v", tx.ID, err)
+		}
+	}
+	// Scheduled recurring postings are expected, so they aren't checked
+	if s.alerts != nil && tx.RecurringID == nil {
+		if err := s.alerts.Evaluate(ctx, tx); err != nil {
+			log.Printf("Error checking transaction alerts for transaction %s: %v", tx.ID, err)
+		}
+	}
+}
+
+// publishBudgetThresholds raises an event for each budget covering tx whose
+// spending tx pushed past one of model.BudgetThresholds. Only the highest
+// threshold crossed is reported.
+func (s *TransactionService) publishBudgetThresholds(ctx context.Context, tx *model.Transaction) error {
+	if tx.CategoryID == nil || tx.Amount >= 0 {
+		return nil
+	}
+
+	budgets, err := s.repo.GetBudgets(ctx, tx.UserID, model.BudgetFilter{
+		UserID:      tx.UserID,
+		CategoryID:  *tx.CategoryID,
+		PeriodStart: tx.Date,
+		PeriodEnd:   tx.Date,
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, budget := range budgets {
+		if budget.Amount <= 0 || budget.SpentAmount == nil {
+			continue
+		}
+
+		// Spending is stored as negative amounts
+		spent := math.Abs(*budget.SpentAmount)
+		before := spent + tx.Amount
+		for i := len(model.BudgetThresholds) - 1; i >= 0; i-- {
+			threshold := model.BudgetThresholds[i]
+			limit := budget.Amount * threshold / 100
+			if before >= limit || spent < limit {
+				continue
+			}
+
+			data := map[string]interface{}{
+				"budget_id":      budget.ID,
+				"category_id":    budget.CategoryID,
+				"threshold":      threshold,
+				"spent":          spent,
+				"amount":         budget.Amount,
+				"transaction_id": tx.ID,
+			}
+			if budget.Category != nil {
+				data["category_name"] = budget.Category.Name
+			}
+			if err := s.events.Publish(ctx, tx.UserID, model.EventBudgetThresholdCrossed, data); err != nil {
+				return err
+			}
+			break
+		}
+	}
 	return nil
 }
 
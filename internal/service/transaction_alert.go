@@ -0,0 +1,239 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/yeboahd24/personal-finance-manager/internal/errors"
+	"github.com/yeboahd24/personal-finance-manager/internal/model"
+	"github.com/yeboahd24/personal-finance-manager/internal/repository"
+)
+
+// maxTransactionAlerts bounds how many alerts a user can define
+const maxTransactionAlerts = 50
+
+// TransactionAlertService manages users' transaction alerts and checks new
+// transactions against them
+type TransactionAlertService struct {
+	repo          repository.Repository
+	notifications *NotificationService
+}
+
+func NewTransactionAlertService(repo repository.Repository, notifications *NotificationService) *TransactionAlertService {
+	return &TransactionAlertService{
+		repo:          repo,
+		notifications: notifications,
+	}
+}
+
+// CreateAlert adds an active alert for the user
+func (s *TransactionAlertService) CreateAlert(ctx context.Context, userID string, alert *model.TransactionAlert) error {
+	if err := s.validateAlert(ctx, userID, alert); err != nil {
+		return err
+	}
+
+	existing, err := s.repo.GetTransactionAlerts(ctx, userID, false)
+	if err != nil {
+		return err
+	}
+	if len(existing) >= maxTransactionAlerts {
+		return errors.New(fmt.Sprintf("A user can have at most %d transaction alerts", maxTransactionAlerts), 400)
+	}
+
+	alert.UserID = userID
+	alert.Active = true
+	return s.repo.CreateTransactionAlert(ctx, alert)
+}
+
+func (s *TransactionAlertService) GetAlerts(ctx context.Context, userID string) ([]*model.TransactionAlert, error) {
+	alerts, err := s.repo.GetTransactionAlerts(ctx, userID, false)
+	if err != nil {
+		return nil, err
+	}
+	if alerts == nil {
+		alerts = []*model.TransactionAlert{}
+	}
+	return alerts, nil
+}
+
+func (s *TransactionAlertService) GetAlert(ctx context.Context, userID, id string) (*model.TransactionAlert, error) {
+	if _, err := uuid.Parse(id); err != nil {
+		return nil, errors.ErrNotFound
+	}
+
+	alert, err := s.repo.GetTransactionAlertByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if alert.UserID != userID {
+		return nil, errors.ErrNotFound
+	}
+	return alert, nil
+}
+
+// UpdateAlert replaces an alert's type, amount, account and active flag
+func (s *TransactionAlertService) UpdateAlert(ctx context.Context, userID string, alert *model.TransactionAlert) error {
+	existing, err := s.GetAlert(ctx, userID, alert.ID)
+	if err != nil {
+		return err
+	}
+
+	if err := s.validateAlert(ctx, userID, alert); err != nil {
+		return err
+	}
+
+	alert.UserID = existing.UserID
+	alert.CreatedAt = existing.CreatedAt
+	return s.repo.UpdateTransactionAlert(ctx, alert)
+}
+
+func (s *TransactionAlertService) DeleteAlert(ctx context.Context, userID, id string) error {
+	if _, err := s.GetAlert(ctx, userID, id); err != nil {
+		return err
+	}
+	return s.repo.DeleteTransactionAlert(ctx, id)
+}
+
+func (s *TransactionAlertService) validateAlert(ctx context.Context, userID string, alert *model.TransactionAlert) error {
+	switch alert.Type {
+	case model.AlertLargeDebit:
+		if alert.MinAmount <= 0 {
+			return errors.New("Large debit alerts need a min_amount above 0", 400)
+		}
+	case model.AlertNewMerchant, model.AlertForeignCurrency, model.AlertUnbudgetedCategory:
+		if alert.MinAmount < 0 {
+			return errors.New("min_amount can't be negative", 400)
+		}
+	default:
+		return errors.New("Alert type must be one of large_debit, new_merchant, foreign_currency, unbudgeted_category", 400)
+	}
+
+	if alert.AccountID != nil {
+		if _, err := uuid.Parse(*alert.AccountID); err != nil {
+			return errors.New("Account not found", 400)
+		}
+		account, err := s.repo.GetAccountByID(ctx, *alert.AccountID)
+		if err == errors.ErrNotFound || (err == nil && account.UserID != userID) {
+			return errors.New("Account not found", 400)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Evaluate checks a new transaction against its user's active alerts and
+// sends one notification listing every alert it tripped
+func (s *TransactionAlertService) Evaluate(ctx context.Context, tx *model.Transaction) error {
+	if tx.Amount >= 0 {
+		return nil
+	}
+
+	alerts, err := s.repo.GetTransactionAlerts(ctx, tx.UserID, true)
+	if err != nil {
+		return err
+	}
+
+	// Each kind of check runs once, however many alerts share it
+	checked := make(map[model.TransactionAlertType]string)
+	var tripped []*model.TransactionAlert
+	var reasons []string
+	var largest *model.TransactionAlert
+	for _, alert := range alerts {
+		if !alert.Applies(tx) {
+			continue
+		}
+
+		if alert.Type == model.AlertLargeDebit {
+			tripped = append(tripped, alert)
+			if largest == nil || alert.MinAmount > largest.MinAmount {
+				largest = alert
+			}
+			continue
+		}
+
+		reason, ok := checked[alert.Type]
+		if !ok {
+			if reason, err = s.check(ctx, alert.Type, tx); err != nil {
+				return err
+			}
+			checked[alert.Type] = reason
+			if reason != "" {
+				reasons = append(reasons, reason)
+			}
+		}
+		if reason != "" {
+			tripped = append(tripped, alert)
+		}
+	}
+	if largest != nil {
+		reasons = append([]string{fmt.Sprintf("larger than %.2f", largest.MinAmount)}, reasons...)
+	}
+	if len(tripped) == 0 {
+		return nil
+	}
+
+	return s.notifications.NotifyTransactionAlert(ctx, tx, tripped, reasons)
+}
+
+// check runs the check for an alert type against tx and describes why it
+// tripped, or returns an empty string if it didn't
+func (s *TransactionAlertService) check(ctx context.Context, alertType model.TransactionAlertType, tx *model.Transaction) (string, error) {
+	switch alertType {
+	case model.AlertNewMerchant:
+		merchant := transactionMerchant(tx)
+		if merchant == "" {
+			return "", nil
+		}
+		seen, err := s.repo.HasMerchantTransaction(ctx, tx.UserID, merchant, tx.ID)
+		if err != nil || seen {
+			return "", err
+		}
+		return fmt.Sprintf("first transaction at %s", merchant), nil
+
+	case model.AlertForeignCurrency:
+		if tx.Currency == "" {
+			return "", nil
+		}
+		account, err := s.repo.GetAccountByID(ctx, tx.AccountID)
+		if err != nil {
+			return "", err
+		}
+		if account.Currency == "" || strings.EqualFold(account.Currency, tx.Currency) {
+			return "", nil
+		}
+		return fmt.Sprintf("in %s rather than %s", strings.ToUpper(tx.Currency), account.Currency), nil
+
+	case model.AlertUnbudgetedCategory:
+		if tx.CategoryID == nil {
+			return "", nil
+		}
+		budgets, err := s.repo.GetBudgets(ctx, tx.UserID, model.BudgetFilter{
+			UserID:      tx.UserID,
+			CategoryID:  *tx.CategoryID,
+			PeriodStart: tx.Date,
+			PeriodEnd:   tx.Date,
+		})
+		if err != nil || len(budgets) > 0 {
+			return "", err
+		}
+		category := "a category"
+		if c, err := s.repo.GetCategoryByID(ctx, *tx.CategoryID); err == nil {
+			category = c.Name
+		}
+		return fmt.Sprintf("in %s, which has no budget", category), nil
+	}
+	return "", nil
+}
+
+// transactionMerchant is the merchant a transaction was made at, falling back
+// to its description
+func transactionMerchant(tx *model.Transaction) string {
+	if tx.MerchantName != nil && *tx.MerchantName != "" {
+		return *tx.MerchantName
+	}
+	return tx.Description
+}
@@ -0,0 +1,421 @@
+package service
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/yeboahd24/personal-finance-manager/internal/errors"
+	"github.com/yeboahd24/personal-finance-manager/internal/model"
+	"github.com/yeboahd24/personal-finance-manager/internal/repository"
+	"github.com/yeboahd24/personal-finance-manager/internal/totp"
+)
+
+const (
+	defaultTOTPIssuer = "Personal Finance Manager"
+
+	// totpSkew is how many 30 second steps either side of now a code is
+	// accepted for
+	totpSkew = 1
+
+	// recoveryCodeSize is the recovery code length in bytes, 16 base32
+	// characters
+	recoveryCodeSize = 10
+)
+
+var (
+	errTwoFactorNotConfigured  = errors.New("Two-factor authentication is not configured", 503)
+	errTwoFactorNotEnabled     = errors.New("Two-factor authentication is not enabled", 400)
+	errTwoFactorAlreadyEnabled = errors.New("Two-factor authentication is already enabled", 409)
+	errInvalidTwoFactorCode    = errors.New("Invalid code", 401)
+	errInvalidLoginChallenge   = errors.New("Invalid or expired login challenge", 401)
+	errInvalidPassword         = errors.New("Invalid password", 401)
+)
+
+// TwoFactorService manages TOTP two-factor authentication: enrolment,
+// recovery codes and the second step of logging in
+type TwoFactorService struct {
+	repo   repository.Repository
+	aead   cipher.AEAD // nil when no encryption key is configured
+	issuer string
+}
+
+// NewTwoFactorService creates the service with the key TOTP secrets are
+// encrypted with, 32 bytes encoded as base64 or hex. Without a key users
+// can't enrol, and those already enrolled can't log in.
+func NewTwoFactorService(repo repository.Repository, encryptionKey, issuer string) (*TwoFactorService, error) {
+	s := &TwoFactorService{repo: repo, issuer: issuer}
+	if s.issuer == "" {
+		s.issuer = defaultTOTPIssuer
+	}
+	if encryptionKey == "" {
+		log.Printf("Warning: TOTP_ENCRYPTION_KEY is not set, two-factor authentication is unavailable")
+		return s, nil
+	}
+
+	key, err := decodeEncryptionKey(encryptionKey)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	if s.aead, err = cipher.NewGCM(block); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// GetStatus returns whether the user has two-factor authentication on
+func (s *TwoFactorService) GetStatus(ctx context.Context, userID string) (*model.TwoFactorStatus, error) {
+	twoFactor, err := s.getTwoFactor(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if !twoFactor.Enabled() {
+		return &model.TwoFactorStatus{}, nil
+	}
+
+	remaining, err := s.repo.CountRecoveryCodes(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	return &model.TwoFactorStatus{
+		Enabled:                true,
+		EnabledAt:              twoFactor.EnabledAt,
+		RecoveryCodesRemaining: remaining,
+	}, nil
+}
+
+// Setup starts enrolment with a new secret, replacing any earlier setup that
+// wasn't confirmed. Two-factor authentication is only on once Enable
+// confirms a code from the authenticator app.
+func (s *TwoFactorService) Setup(ctx context.Context, userID string) (*model.TwoFactorSetup, error) {
+	if s.aead == nil {
+		return nil, errTwoFactorNotConfigured
+	}
+
+	existing, err := s.getTwoFactor(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if existing.Enabled() {
+		return nil, errTwoFactorAlreadyEnabled
+	}
+
+	user, err := s.repo.GetUserByID(ctx, userID)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to get user", 500)
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to generate secret", 500)
+	}
+	encrypted, err := s.encrypt(userID, secret)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.repo.SaveTwoFactor(ctx, &model.TwoFactor{UserID: userID, SecretEncrypted: encrypted}); err != nil {
+		return nil, err
+	}
+
+	return &model.TwoFactorSetup{
+		Secret: secret,
+		URI:    totp.URI(s.issuer, user.Email, secret),
+	}, nil
+}
+
+// Enable confirms enrolment with a code from the authenticator app and
+// returns the user's recovery codes. They are only ever shown here.
+func (s *TwoFactorService) Enable(ctx context.Context, userID, code string) ([]string, error) {
+	twoFactor, err := s.getTwoFactor(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if twoFactor == nil {
+		return nil, errors.New("Set up two-factor authentication first", 400)
+	}
+	if twoFactor.Enabled() {
+		return nil, errTwoFactorAlreadyEnabled
+	}
+
+	secret, err := s.decrypt(userID, twoFactor.SecretEncrypted)
+	if err != nil {
+		return nil, err
+	}
+	step, ok := totp.Validate(secret, normalizeCode(code), time.Now(), totpSkew)
+	if !ok {
+		return nil, errInvalidTwoFactorCode
+	}
+
+	var codes []string
+	err = s.repo.InTx(ctx, func(repo repository.Repository) error {
+		if err := repo.EnableTwoFactor(ctx, userID, step); err != nil {
+			return err
+		}
+		var err error
+		codes, err = replaceRecoveryCodes(ctx, repo, userID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// Disable turns two-factor authentication off. The user must enter their
+// password and a current code or recovery code.
+func (s *TwoFactorService) Disable(ctx context.Context, userID, password, code string) error {
+	if _, err := s.reauthenticate(ctx, userID, password, code); err != nil {
+		return err
+	}
+	return s.repo.DeleteTwoFactor(ctx, userID)
+}
+
+// RegenerateRecoveryCodes replaces the user's recovery codes. The user must
+// enter their password and a current code or recovery code.
+func (s *TwoFactorService) RegenerateRecoveryCodes(ctx context.Context, userID, password, code string) ([]string, error) {
+	if _, err := s.reauthenticate(ctx, userID, password, code); err != nil {
+		return nil, err
+	}
+	return replaceRecoveryCodes(ctx, s.repo, userID)
+}
+
+// BeginLogin is called once a user's password is checked. For users with
+// two-factor authentication on it returns a challenge token to send with
+// their code to CompleteLogin; for others it returns "".
+func (s *TwoFactorService) BeginLogin(ctx context.Context, user *model.User) (string, error) {
+	twoFactor, err := s.getTwoFactor(ctx, user.ID)
+	if err != nil || !twoFactor.Enabled() {
+		return "", err
+	}
+
+	now := time.Now()
+	if _, err := s.repo.DeleteExpiredLoginChallenges(ctx, user.ID, now); err != nil {
+		log.Printf("Error deleting expired login challenges for user %s: %v", user.ID, err)
+	}
+
+	token, hash, err := newOpaqueToken()
+	if err != nil {
+		return "", err
+	}
+	err = s.repo.CreateLoginChallenge(ctx, &model.LoginChallenge{
+		UserID:    user.ID,
+		TokenHash: hash,
+		ExpiresAt: now.Add(model.LoginChallengeTTL),
+	})
+	if err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// CompleteLogin checks the code, or a recovery code, for a login challenge and
+// returns the user logging in. A challenge allows a few attempts and
+// completes once.
+func (s *TwoFactorService) CompleteLogin(ctx context.Context, challengeToken, code string) (*model.User, error) {
+	challenge, err := s.repo.GetLoginChallengeByHash(ctx, hashToken(challengeToken))
+	if err == errors.ErrNotFound {
+		return nil, errInvalidLoginChallenge
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !time.Now().Before(challenge.ExpiresAt) {
+		return nil, errInvalidLoginChallenge
+	}
+
+	allowed, err := s.repo.AttemptLoginChallenge(ctx, challenge.ID, model.MaxLoginChallengeAttempts)
+	if err != nil {
+		return nil, err
+	}
+	if !allowed {
+		return nil, errInvalidLoginChallenge
+	}
+
+	twoFactor, err := s.getTwoFactor(ctx, challenge.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if !twoFactor.Enabled() {
+		return nil, errInvalidLoginChallenge
+	}
+	if err := s.verifyCode(ctx, twoFactor, code); err != nil {
+		return nil, err
+	}
+
+	completed, err := s.repo.DeleteLoginChallenge(ctx, challenge.ID)
+	if err != nil {
+		return nil, err
+	}
+	if !completed {
+		return nil, errInvalidLoginChallenge
+	}
+
+	user, err := s.repo.GetUserByID(ctx, challenge.UserID)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to get user", 500)
+	}
+	return user, nil
+}
+
+// reauthenticate checks the user's password and second factor before a
+// change to their two-factor settings
+func (s *TwoFactorService) reauthenticate(ctx context.Context, userID, password, code string) (*model.TwoFactor, error) {
+	user, err := s.repo.GetUserByID(ctx, userID)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to get user", 500)
+	}
+	if !checkPassword(user, password) {
+		return nil, errInvalidPassword
+	}
+
+	twoFactor, err := s.getTwoFactor(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if !twoFactor.Enabled() {
+		return nil, errTwoFactorNotEnabled
+	}
+	if err := s.verifyCode(ctx, twoFactor, code); err != nil {
+		return nil, err
+	}
+	return twoFactor, nil
+}
+
+// verifyCode accepts a current TOTP code that hasn't been used yet, or an
+// unused recovery code, which is then spent
+func (s *TwoFactorService) verifyCode(ctx context.Context, twoFactor *model.TwoFactor, code string) error {
+	code = normalizeCode(code)
+
+	if len(code) == totp.Digits && strings.Trim(code, "0123456789") == "" {
+		secret, err := s.decrypt(twoFactor.UserID, twoFactor.SecretEncrypted)
+		if err != nil {
+			return err
+		}
+		step, ok := totp.Validate(secret, code, time.Now(), totpSkew)
+		if !ok {
+			return errInvalidTwoFactorCode
+		}
+		used, err := s.repo.UseTwoFactorStep(ctx, twoFactor.UserID, step)
+		if err != nil {
+			return err
+		}
+		if !used {
+			return errInvalidTwoFactorCode
+		}
+		return nil
+	}
+
+	used, err := s.repo.UseRecoveryCode(ctx, twoFactor.UserID, hashToken(code))
+	if err != nil {
+		return err
+	}
+	if !used {
+		return errInvalidTwoFactorCode
+	}
+	log.Printf("Recovery code used by user %s", twoFactor.UserID)
+	return nil
+}
+
+// getTwoFactor returns the user's enrolment, or nil if they have none
+func (s *TwoFactorService) getTwoFactor(ctx context.Context, userID string) (*model.TwoFactor, error) {
+	twoFactor, err := s.repo.GetTwoFactor(ctx, userID)
+	if err == errors.ErrNotFound {
+		return nil, nil
+	}
+	return twoFactor, err
+}
+
+// encrypt seals a TOTP secret with AES-GCM. The user ID is bound in as
+// additional data, so a secret copied to another user's row won't decrypt.
+func (s *TwoFactorService) encrypt(userID, secret string) (string, error) {
+	nonce := make([]byte, s.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", errors.Wrap(err, "Failed to encrypt secret", 500)
+	}
+	sealed := s.aead.Seal(nonce, nonce, []byte(secret), []byte(userID))
+	return base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+func (s *TwoFactorService) decrypt(userID, encrypted string) (string, error) {
+	if s.aead == nil {
+		return "", errTwoFactorNotConfigured
+	}
+	sealed, err := base64.StdEncoding.DecodeString(encrypted)
+	if err != nil || len(sealed) < s.aead.NonceSize() {
+		return "", errors.New("Failed to decrypt secret", 500)
+	}
+	nonce, ciphertext := sealed[:s.aead.NonceSize()], sealed[s.aead.NonceSize():]
+	secret, err := s.aead.Open(nil, nonce, ciphertext, []byte(userID))
+	if err != nil {
+		return "", errors.Wrap(err, "Failed to decrypt secret", 500)
+	}
+	return string(secret), nil
+}
+
+// replaceRecoveryCodes issues the user a new set of recovery codes, storing
+// only their hashes
+func replaceRecoveryCodes(ctx context.Context, repo repository.Repository, userID string) ([]string, error) {
+	encoding := base32.StdEncoding.WithPadding(base32.NoPadding)
+	codes := make([]string, model.RecoveryCodeCount)
+	hashes := make([]string, model.RecoveryCodeCount)
+	for i := range codes {
+		b := make([]byte, recoveryCodeSize)
+		if _, err := rand.Read(b); err != nil {
+			return nil, errors.Wrap(err, "Failed to generate recovery code", 500)
+		}
+		code := encoding.EncodeToString(b)
+		hashes[i] = hashToken(code)
+		codes[i] = fmt.Sprintf("%s-%s-%s-%s", code[0:4], code[4:8], code[8:12], code[12:16])
+	}
+
+	if err := repo.ReplaceRecoveryCodes(ctx, userID, hashes); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// normalizeCode strips the spaces and dashes users type or paste with codes
+func normalizeCode(code string) string {
+	return strings.ToUpper(strings.NewReplacer(" ", "", "-", "").Replace(strings.TrimSpace(code)))
+}
+
+// newOpaqueToken returns a random token and the hash to store for it
+func newOpaqueToken() (string, string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", errors.Wrap(err, "Failed to generate token", 500)
+	}
+	token := base64.RawURLEncoding.EncodeToString(b)
+	return token, hashToken(token), nil
+}
+
+// hashToken returns the SHA-256 hash stored for a token or code
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// decodeEncryptionKey reads a 32 byte AES-256 key from base64 or hex
+func decodeEncryptionKey(key string) ([]byte, error) {
+	if b, err := hex.DecodeString(key); err == nil && len(b) == 32 {
+		return b, nil
+	}
+	if b, err := base64.StdEncoding.DecodeString(key); err == nil && len(b) == 32 {
+		return b, nil
+	}
+	return nil, fmt.Errorf("TOTP_ENCRYPTION_KEY must be 32 bytes, base64 or hex encoded")
+}
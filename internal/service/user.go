@@ -2,20 +2,30 @@ package service
 
 import (
 	"context"
-	"errors"
+	"strings"
 
+	"github.com/yeboahd24/personal-finance-manager/internal/errors"
 	"github.com/yeboahd24/personal-finance-manager/internal/model"
 	"github.com/yeboahd24/personal-finance-manager/internal/repository"
 	"golang.org/x/crypto/bcrypt"
 )
 
+var errInvalidCredentials = errors.New("invalid credentials", 401)
+
 type UserService struct {
-	repo repository.Repository
+	repo         repository.Repository
+	emailService *EmailService
+	appURL       string // Base URL of the web app, for links in emails
 }
 
-func NewUserService(repo repository.Repository) *UserService {
+func NewUserService(repo repository.Repository, emailService *EmailService, appURL string) *UserService {
+	if appURL == "" {
+		appURL = defaultAppURL
+	}
 	return &UserService{
-		repo: repo,
+		repo:         repo,
+		emailService: emailService,
+		appURL:       strings.TrimRight(appURL, "/"),
 	}
 }
 
@@ -23,7 +33,7 @@ func (s *UserService) CreateUser(ctx context.Context, email, password, firstName
 	// Check if user already exists
 	existing, err := s.repo.GetUserByEmail(ctx, email)
 	if err == nil && existing != nil {
-		return nil, errors.New("user already exists")
+		return nil, errors.New("user already exists", 409)
 	}
 
 	// Hash password
@@ -54,11 +64,11 @@ func (s *UserService) CreateUser(ctx context.Context, email, password, firstName
 func (s *UserService) AuthenticateUser(ctx context.Context, email, password string) (*model.User, error) {
 	user, err := s.repo.GetUserByEmail(ctx, email)
 	if err != nil {
-		return nil, errors.New("invalid credentials")
+		return nil, errInvalidCredentials
 	}
 
 	if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password)); err != nil {
-		return nil, errors.New("invalid credentials")
+		return nil, errInvalidCredentials
 	}
 
 	return user, nil
@@ -75,3 +85,8 @@ func (s *UserService) GetUserByEmail(ctx context.Context, email string) (*model.
 func (s *UserService) UpdateUser(ctx context.Context, user *model.User) error {
 	return s.repo.UpdateUser(ctx, user)
 }
+
+// checkPassword reports whether password is the user's password
+func checkPassword(user *model.User, password string) bool {
+	return bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password)) == nil
+}
@@ -0,0 +1,334 @@
+package service
+
+import (
+	"context"
+	"log"
+	"net/mail"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/yeboahd24/personal-finance-manager/internal/errors"
+	"github.com/yeboahd24/personal-finance-manager/internal/model"
+	"github.com/yeboahd24/personal-finance-manager/internal/repository"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const defaultAppURL = "http://localhost:8080"
+
+var (
+	errInvalidEmail         = errors.New("Invalid email address", 400)
+	errPasswordTooShort     = errors.New("Password must be at least 8 characters", 400)
+	errPasswordTooLong      = errors.New("Password must be at most 72 characters", 400)
+	errInvalidUserToken     = errors.New("Invalid or expired token", 400)
+	errEmailAlreadyVerified = errors.New("Email address is already verified", 409)
+	errTooManyEmails        = errors.New("Too many emails sent, try again later", 429)
+	errEmailNotVerified     = errors.New("Verify your email address before linking a bank account", 403)
+	errSamePassword         = errors.New("New password must be different from the current one", 400)
+)
+
+// accountEmail is the data for the email_verification, password_reset and
+// password_changed templates
+type accountEmail struct {
+	FirstName string
+	Email     string
+	URL       string
+	ExpiresIn string
+	ChangedAt time.Time
+	Reset     bool // The password was reset from an email rather than changed
+}
+
+// Register creates an account from the sign-up form and emails a link to
+// verify its address. Unlike CreateUser it checks the email and password.
+func (s *UserService) Register(ctx context.Context, email, password, firstName, lastName string) (*model.User, error) {
+	address, err := mail.ParseAddress(strings.TrimSpace(email))
+	if err != nil || address.Name != "" {
+		return nil, errInvalidEmail
+	}
+	if err := validatePassword(password); err != nil {
+		return nil, err
+	}
+
+	user, err := s.CreateUser(ctx, address.Address, password, firstName, lastName)
+	if err != nil {
+		return nil, err
+	}
+
+	// The account is usable without verifying, so a failed email only means
+	// the user has to ask for another
+	if err := s.sendVerificationEmail(ctx, user); err != nil {
+		log.Printf("Error sending verification email to user %s: %v", user.ID, err)
+	}
+	return user, nil
+}
+
+// RequestEmailVerification emails the user a new link to verify their address.
+// Links sent earlier stop working.
+func (s *UserService) RequestEmailVerification(ctx context.Context, userID string) error {
+	user, err := s.repo.GetUserByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if user.EmailVerified() {
+		return errEmailAlreadyVerified
+	}
+
+	limited, err := s.rateLimited(ctx, user.ID, model.TokenEmailVerification)
+	if err != nil {
+		return err
+	}
+	if limited {
+		return errTooManyEmails
+	}
+	return s.sendVerificationEmail(ctx, user)
+}
+
+// VerifyEmail marks the address a verification token was sent to as verified.
+// A token for an address the user has since changed is rejected.
+func (s *UserService) VerifyEmail(ctx context.Context, token string) error {
+	userToken, err := useToken(ctx, s.repo, model.TokenEmailVerification, token)
+	if err != nil {
+		return err
+	}
+
+	verified, err := s.repo.SetEmailVerified(ctx, userToken.UserID, userToken.Email)
+	if err != nil {
+		return err
+	}
+	if !verified {
+		return errInvalidUserToken
+	}
+	return nil
+}
+
+// RequestPasswordReset emails a password reset link to the account with this
+// address. It succeeds whether or not there is one, so it can't be used to
+// find out which addresses have accounts.
+func (s *UserService) RequestPasswordReset(ctx context.Context, email string) error {
+	user, err := s.repo.GetUserByEmail(ctx, strings.TrimSpace(email))
+	if err != nil {
+		return nil
+	}
+
+	limited, err := s.rateLimited(ctx, user.ID, model.TokenPasswordReset)
+	if err != nil {
+		return err
+	}
+	if limited {
+		log.Printf("Not sending password reset to user %s: too many sent in the last hour", user.ID)
+		return nil
+	}
+
+	if err := s.repo.RevokeUserTokens(ctx, user.ID, model.TokenPasswordReset); err != nil {
+		return err
+	}
+	token, err := s.createToken(ctx, user, model.TokenPasswordReset, model.PasswordResetTTL)
+	if err != nil {
+		return err
+	}
+	return s.emailService.QueueEmail(ctx, user.Email, "Reset your password", "password_reset", &accountEmail{
+		FirstName: user.FirstName,
+		Email:     user.Email,
+		URL:       s.link("/reset-password", token),
+		ExpiresIn: "1 hour",
+	})
+}
+
+// ResetPassword sets a new password with a token from a password reset email
+// and logs the user out everywhere
+func (s *UserService) ResetPassword(ctx context.Context, token, newPassword string) error {
+	if err := validatePassword(newPassword); err != nil {
+		return err
+	}
+	hash, err := hashPassword(newPassword)
+	if err != nil {
+		return err
+	}
+
+	var user *model.User
+	err = s.repo.InTx(ctx, func(repo repository.Repository) error {
+		userToken, err := useToken(ctx, repo, model.TokenPasswordReset, token)
+		if err != nil {
+			return err
+		}
+		if user, err = repo.GetUserByID(ctx, userToken.UserID); err != nil {
+			return err
+		}
+		// A reset sent before the user changed their email address is no
+		// longer theirs to use
+		if !strings.EqualFold(user.Email, userToken.Email) {
+			return errInvalidUserToken
+		}
+		return setPassword(ctx, repo, user.ID, hash, "")
+	})
+	if err != nil {
+		return err
+	}
+
+	s.sendPasswordChangedEmail(ctx, user, true)
+	return nil
+}
+
+// ChangePassword replaces the user's password after checking the current one,
+// and logs out every session but the one making the change
+func (s *UserService) ChangePassword(ctx context.Context, userID, currentSessionID, currentPassword, newPassword string) error {
+	user, err := s.repo.GetUserByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if !checkPassword(user, currentPassword) {
+		return errInvalidPassword
+	}
+	if err := validatePassword(newPassword); err != nil {
+		return err
+	}
+	if currentPassword == newPassword {
+		return errSamePassword
+	}
+	hash, err := hashPassword(newPassword)
+	if err != nil {
+		return err
+	}
+
+	err = s.repo.InTx(ctx, func(repo repository.Repository) error {
+		return setPassword(ctx, repo, user.ID, hash, currentSessionID)
+	})
+	if err != nil {
+		return err
+	}
+
+	s.sendPasswordChangedEmail(ctx, user, false)
+	return nil
+}
+
+// requireVerifiedEmail returns an error unless the user has verified their
+// email address. Unverified accounts can't link bank accounts.
+func requireVerifiedEmail(ctx context.Context, repo repository.Repository, userID string) error {
+	user, err := repo.GetUserByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if !user.EmailVerified() {
+		return errEmailNotVerified
+	}
+	return nil
+}
+
+func (s *UserService) sendVerificationEmail(ctx context.Context, user *model.User) error {
+	if err := s.repo.RevokeUserTokens(ctx, user.ID, model.TokenEmailVerification); err != nil {
+		return err
+	}
+	token, err := s.createToken(ctx, user, model.TokenEmailVerification, model.EmailVerificationTTL)
+	if err != nil {
+		return err
+	}
+	return s.emailService.QueueEmail(ctx, user.Email, "Verify your email address", "email_verification", &accountEmail{
+		FirstName: user.FirstName,
+		Email:     user.Email,
+		URL:       s.link("/verify-email", token),
+		ExpiresIn: "48 hours",
+	})
+}
+
+func (s *UserService) sendPasswordChangedEmail(ctx context.Context, user *model.User, reset bool) {
+	err := s.emailService.QueueEmail(ctx, user.Email, "Your password was changed", "password_changed", &accountEmail{
+		FirstName: user.FirstName,
+		Email:     user.Email,
+		URL:       s.appURL + "/reset-password",
+		ChangedAt: time.Now(),
+		Reset:     reset,
+	})
+	if err != nil {
+		log.Printf("Error sending password changed email to user %s: %v", user.ID, err)
+	}
+}
+
+// createToken stores the hash of a new token for the user's current address
+// and returns the token
+func (s *UserService) createToken(ctx context.Context, user *model.User, purpose model.UserTokenPurpose, ttl time.Duration) (string, error) {
+	token, hash, err := newOpaqueToken()
+	if err != nil {
+		return "", errors.Wrap(err, "Failed to generate token", 500)
+	}
+	err = s.repo.CreateUserToken(ctx, &model.UserToken{
+		UserID:    user.ID,
+		Purpose:   purpose,
+		TokenHash: hash,
+		Email:     user.Email,
+		ExpiresAt: time.Now().Add(ttl),
+	})
+	if err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// useToken looks up a token and marks it used, failing if it doesn't exist,
+// has expired or was already used
+func useToken(ctx context.Context, repo repository.Repository, purpose model.UserTokenPurpose, token string) (*model.UserToken, error) {
+	token = strings.TrimSpace(token)
+	if token == "" {
+		return nil, errInvalidUserToken
+	}
+
+	userToken, err := repo.GetUserTokenByHash(ctx, purpose, hashToken(token))
+	if err == errors.ErrNotFound {
+		return nil, errInvalidUserToken
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	used, err := repo.UseUserToken(ctx, userToken.ID, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	if !used {
+		return nil, errInvalidUserToken
+	}
+	return userToken, nil
+}
+
+// setPassword stores a new password hash, logs out every session except
+// keepSessionID and cancels any outstanding password resets
+func setPassword(ctx context.Context, repo repository.Repository, userID, hash, keepSessionID string) error {
+	if err := repo.UpdatePassword(ctx, userID, hash); err != nil {
+		return err
+	}
+	if _, err := repo.RevokeUserSessions(ctx, userID, keepSessionID, model.SessionPasswordChange); err != nil {
+		return err
+	}
+	return repo.RevokeUserTokens(ctx, userID, model.TokenPasswordReset)
+}
+
+// rateLimited reports whether the user has been sent MaxUserTokensPerHour
+// tokens for purpose in the last hour
+func (s *UserService) rateLimited(ctx context.Context, userID string, purpose model.UserTokenPurpose) (bool, error) {
+	count, err := s.repo.CountUserTokensSince(ctx, userID, purpose, time.Now().Add(-time.Hour))
+	if err != nil {
+		return false, err
+	}
+	return count >= model.MaxUserTokensPerHour, nil
+}
+
+func (s *UserService) link(path, token string) string {
+	return s.appURL + path + "?token=" + url.QueryEscape(token)
+}
+
+func validatePassword(password string) error {
+	if len(password) < model.MinPasswordLength {
+		return errPasswordTooShort
+	}
+	if len(password) > model.MaxPasswordLength {
+		return errPasswordTooLong
+	}
+	return nil
+}
+
+func hashPassword(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", errors.Wrap(err, "Failed to hash password", 500)
+	}
+	return string(hash), nil
+}
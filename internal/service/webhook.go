@@ -0,0 +1,568 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/yeboahd24/personal-finance-manager/internal/errors"
+	"github.com/yeboahd24/personal-finance-manager/internal/model"
+	"github.com/yeboahd24/personal-finance-manager/internal/repository"
+)
+
+const (
+	// maxWebhooks bounds how many webhooks a user can register
+	maxWebhooks = 10
+
+	// maxWebhookAttempts is how many times a delivery is sent before it is
+	// marked failed
+	maxWebhookAttempts = 10
+
+	// webhookRetryDelay is the wait after the first failed attempt. It doubles
+	// after each further failure, up to maxWebhookRetryDelay.
+	webhookRetryDelay    = 30 * time.Second
+	maxWebhookRetryDelay = 6 * time.Hour
+
+	// webhookTimeout bounds a single delivery attempt
+	webhookTimeout = 10 * time.Second
+
+	// webhookLease is how long a claimed delivery is hidden from other
+	// workers while it is sent
+	webhookLease = 2 * time.Minute
+
+	// maxWebhookResponseBody is how much of a response is read before the
+	// connection is closed. Only the status code is kept.
+	maxWebhookResponseBody = 1024
+
+	// webhookDeliveryLog is how many recent deliveries are listed per webhook
+	webhookDeliveryLog = 100
+)
+
+// WebhookService manages user webhooks and delivers events to them. Events
+// are queued in a persistent outbox and sent by a worker, retrying with
+// exponential backoff until the endpoint answers with a 2xx status.
+//
+// Each request carries an X-Webhook-Signature header of the form
+// "t=<unix time>,v1=<hex HMAC-SHA256 of "<unix time>.<body>" keyed by the
+// webhook secret>".
+//
+// Endpoints are user supplied, so deliveries only connect to public
+// addresses. The check runs on the address actually dialled, which a
+// hostname re-pointed after validation can't get around.
+type WebhookService struct {
+	repo                 repository.Repository
+	client               *http.Client
+	allowPrivateNetworks bool
+}
+
+// NewWebhookService creates the webhook service. allowPrivateNetworks is for
+// development only; it accepts plain HTTP endpoints and delivers to loopback
+// and private addresses.
+func NewWebhookService(repo repository.Repository, allowPrivateNetworks bool) *WebhookService {
+	dialer := &net.Dialer{Timeout: webhookTimeout}
+	if !allowPrivateNetworks {
+		dialer.Control = dialPublicOnly
+	}
+
+	return &WebhookService{
+		repo:                 repo,
+		allowPrivateNetworks: allowPrivateNetworks,
+		client: &http.Client{
+			Timeout: webhookTimeout,
+			Transport: &http.Transport{
+				// A proxy would be dialled instead of the endpoint, hiding
+				// its address from the check
+				Proxy:               nil,
+				DialContext:         dialer.DialContext,
+				TLSHandshakeTimeout: webhookTimeout,
+				MaxIdleConns:        10,
+				IdleConnTimeout:     90 * time.Second,
+			},
+			// A redirect could send the signed payload somewhere the user
+			// didn't register
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+	}
+}
+
+// CreateWebhook registers an active webhook with a new secret. The secret is
+// only returned here and by RotateSecret.
+func (s *WebhookService) CreateWebhook(ctx context.Context, userID string, webhook *model.Webhook) error {
+	if err := s.validateWebhook(webhook); err != nil {
+		return err
+	}
+
+	existing, err := s.repo.GetWebhooks(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if len(existing) >= maxWebhooks {
+		return errors.New(fmt.Sprintf("A user can have at most %d webhooks", maxWebhooks), 400)
+	}
+
+	secret, err := newWebhookSecret()
+	if err != nil {
+		return err
+	}
+
+	webhook.UserID = userID
+	webhook.Secret = secret
+	webhook.Active = true
+	return s.repo.CreateWebhook(ctx, webhook)
+}
+
+func (s *WebhookService) GetWebhooks(ctx context.Context, userID string) ([]*model.Webhook, error) {
+	webhooks, err := s.repo.GetWebhooks(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if webhooks == nil {
+		webhooks = []*model.Webhook{}
+	}
+	for _, webhook := range webhooks {
+		webhook.Secret = ""
+	}
+	return webhooks, nil
+}
+
+// GetWebhook returns one of the user's webhooks without its secret
+func (s *WebhookService) GetWebhook(ctx context.Context, userID, id string) (*model.Webhook, error) {
+	webhook, err := s.getWebhook(ctx, userID, id)
+	if err != nil {
+		return nil, err
+	}
+	webhook.Secret = ""
+	return webhook, nil
+}
+
+func (s *WebhookService) getWebhook(ctx context.Context, userID, id string) (*model.Webhook, error) {
+	if _, err := uuid.Parse(id); err != nil {
+		return nil, errors.ErrNotFound
+	}
+
+	webhook, err := s.repo.GetWebhookByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if webhook.UserID != userID {
+		return nil, errors.ErrNotFound
+	}
+	return webhook, nil
+}
+
+// UpdateWebhook replaces a webhook's URL, description, events and active flag
+func (s *WebhookService) UpdateWebhook(ctx context.Context, userID string, webhook *model.Webhook) error {
+	existing, err := s.getWebhook(ctx, userID, webhook.ID)
+	if err != nil {
+		return err
+	}
+
+	if err := s.validateWebhook(webhook); err != nil {
+		return err
+	}
+
+	webhook.UserID = existing.UserID
+	webhook.Secret = ""
+	webhook.CreatedAt = existing.CreatedAt
+	return s.repo.UpdateWebhook(ctx, webhook)
+}
+
+func (s *WebhookService) DeleteWebhook(ctx context.Context, userID, id string) error {
+	if _, err := s.getWebhook(ctx, userID, id); err != nil {
+		return err
+	}
+	return s.repo.DeleteWebhook(ctx, id)
+}
+
+// RotateSecret gives a webhook a new secret, which signs every delivery sent
+// from now on, including retries of earlier events
+func (s *WebhookService) RotateSecret(ctx context.Context, userID, id string) (*model.Webhook, error) {
+	webhook, err := s.getWebhook(ctx, userID, id)
+	if err != nil {
+		return nil, err
+	}
+
+	secret, err := newWebhookSecret()
+	if err != nil {
+		return nil, err
+	}
+	if err := s.repo.UpdateWebhookSecret(ctx, id, secret); err != nil {
+		return nil, err
+	}
+
+	webhook.Secret = secret
+	return webhook, nil
+}
+
+// GetDeliveries returns a webhook's most recent deliveries, newest first
+func (s *WebhookService) GetDeliveries(ctx context.Context, userID, webhookID string) ([]*model.WebhookDelivery, error) {
+	if _, err := s.getWebhook(ctx, userID, webhookID); err != nil {
+		return nil, err
+	}
+
+	deliveries, err := s.repo.GetWebhookDeliveries(ctx, webhookID, webhookDeliveryLog)
+	if err != nil {
+		return nil, err
+	}
+	if deliveries == nil {
+		deliveries = []*model.WebhookDelivery{}
+	}
+	return deliveries, nil
+}
+
+// ReplayDelivery queues a delivery's payload to be sent again right away. The
+// original stays in the log unchanged.
+func (s *WebhookService) ReplayDelivery(ctx context.Context, userID, webhookID, deliveryID string) (*model.WebhookDelivery, error) {
+	if _, err := s.getWebhook(ctx, userID, webhookID); err != nil {
+		return nil, err
+	}
+	if _, err := uuid.Parse(deliveryID); err != nil {
+		return nil, errors.ErrNotFound
+	}
+
+	original, err := s.repo.GetWebhookDeliveryByID(ctx, deliveryID)
+	if err != nil {
+		return nil, err
+	}
+	if original.WebhookID != webhookID {
+		return nil, errors.ErrNotFound
+	}
+
+	replay := &model.WebhookDelivery{
+		WebhookID:     original.WebhookID,
+		UserID:        original.UserID,
+		Event:         original.Event,
+		Payload:       original.Payload,
+		Status:        model.WebhookDeliveryPending,
+		NextAttemptAt: time.Now(),
+		ReplayOf:      &original.ID,
+	}
+	if err := s.repo.CreateWebhookDelivery(ctx, replay); err != nil {
+		return nil, err
+	}
+	return replay, nil
+}
+
+// Enqueue queues an event for each of its user's active webhooks that
+// subscribe to it. Events with no webhook counterpart are ignored, as is
+// everything on a nil service.
+func (s *WebhookService) Enqueue(ctx context.Context, event *model.Event) error {
+	if s == nil {
+		return nil
+	}
+
+	webhookEvent, ok := model.WebhookEventFor(event.Type)
+	if !ok {
+		return nil
+	}
+
+	webhooks, err := s.repo.GetSubscribedWebhooks(ctx, event.UserID, webhookEvent)
+	if err != nil || len(webhooks) == 0 {
+		return err
+	}
+
+	payload, err := json.Marshal(model.WebhookPayload{
+		ID:        uuid.NewString(),
+		Event:     webhookEvent,
+		CreatedAt: event.CreatedAt,
+		Data:      event.Data,
+	})
+	if err != nil {
+		return errors.Wrap(err, "Failed to marshal webhook payload", 500)
+	}
+
+	for _, webhook := range webhooks {
+		if err := s.repo.CreateWebhookDelivery(ctx, &model.WebhookDelivery{
+			WebhookID:     webhook.ID,
+			UserID:        webhook.UserID,
+			Event:         webhookEvent,
+			Payload:       payload,
+			Status:        model.WebhookDeliveryPending,
+			NextAttemptAt: event.CreatedAt,
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DeliverDue sends due deliveries one at a time until none are left or ctx
+// is too close to its deadline to fit another attempt. It returns how many
+// were sent, successfully or not.
+func (s *WebhookService) DeliverDue(ctx context.Context) (int, error) {
+	sent := 0
+	for {
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < webhookTimeout {
+			return sent, nil
+		}
+
+		delivery, err := s.repo.ClaimDueWebhookDelivery(ctx, time.Now(), webhookLease)
+		if err != nil || delivery == nil {
+			return sent, err
+		}
+
+		if err := s.deliver(ctx, delivery); err != nil {
+			log.Printf("Error recording webhook delivery %s: %v", delivery.ID, err)
+		}
+		sent++
+	}
+}
+
+// deliver sends one attempt of a claimed delivery and records the outcome
+func (s *WebhookService) deliver(ctx context.Context, delivery *model.WebhookDelivery) error {
+	webhook, err := s.repo.GetWebhookByID(ctx, delivery.WebhookID)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	delivery.Attempts++
+	delivery.ResponseCode = nil
+	delivery.LatencyMS = nil
+	delivery.LastError = ""
+
+	if !webhook.Active {
+		delivery.Status = model.WebhookDeliveryFailed
+		delivery.LastError = "Webhook is inactive"
+		return s.repo.UpdateWebhookDelivery(ctx, delivery)
+	}
+
+	code, latency, err := s.send(ctx, webhook, delivery, now)
+	if err != nil {
+		delivery.LastError = err.Error()
+	} else {
+		ms := int(latency.Milliseconds())
+		delivery.ResponseCode = &code
+		delivery.LatencyMS = &ms
+	}
+
+	switch {
+	case err == nil && code >= 200 && code < 300:
+		delivery.Status = model.WebhookDeliveryDelivered
+		delivery.DeliveredAt = &now
+	case delivery.Attempts >= maxWebhookAttempts:
+		delivery.Status = model.WebhookDeliveryFailed
+	default:
+		delivery.NextAttemptAt = now.Add(webhookBackoff(delivery.Attempts))
+	}
+	return s.repo.UpdateWebhookDelivery(ctx, delivery)
+}
+
+// send posts the signed payload and returns the response status and how long
+// it took. The response body is never kept; it could be an internal page the
+// endpoint proxies.
+func (s *WebhookService) send(ctx context.Context, webhook *model.Webhook, delivery *model.WebhookDelivery, now time.Time) (int, time.Duration, error) {
+	ctx, cancel := context.WithTimeout(ctx, webhookTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhook.URL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return 0, 0, err
+	}
+
+	timestamp := strconv.FormatInt(now.Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "personal-finance-manager-webhooks/1.0")
+	req.Header.Set("X-Webhook-Event", string(delivery.Event))
+	req.Header.Set("X-Webhook-Delivery", delivery.ID)
+	req.Header.Set("X-Webhook-Signature", "t="+timestamp+",v1="+SignWebhookPayload(webhook.Secret, timestamp, delivery.Payload))
+
+	start := time.Now()
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer resp.Body.Close()
+
+	// Drain a little so the connection can be reused
+	io.Copy(io.Discard, io.LimitReader(resp.Body, maxWebhookResponseBody))
+	return resp.StatusCode, time.Since(start), nil
+}
+
+// SignWebhookPayload returns the hex HMAC-SHA256 of "<timestamp>.<payload>"
+// keyed by secret, as sent in the v1 part of X-Webhook-Signature
+func SignWebhookPayload(secret, timestamp string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(payload)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// webhookBackoff returns the wait before the next attempt after the given
+// number of failed ones
+func webhookBackoff(attempts int) time.Duration {
+	delay := webhookRetryDelay
+	for i := 1; i < attempts && delay < maxWebhookRetryDelay; i++ {
+		delay *= 2
+	}
+	if delay > maxWebhookRetryDelay {
+		delay = maxWebhookRetryDelay
+	}
+	return delay
+}
+
+func newWebhookSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", errors.Wrap(err, "Failed to generate webhook secret", 500)
+	}
+	return "whsec_" + hex.EncodeToString(b), nil
+}
+
+// validateWebhook checks a webhook's URL and events. Endpoints must use HTTPS
+// and can't name a non-public address; where a hostname resolves to is
+// checked when connecting.
+func (s *WebhookService) validateWebhook(webhook *model.Webhook) error {
+	webhook.URL = strings.TrimSpace(webhook.URL)
+	u, err := url.Parse(webhook.URL)
+	if err != nil || u.Host == "" {
+		return errors.New("URL must be an absolute HTTPS URL", 400)
+	}
+	if u.User != nil {
+		return errors.New("URL must not contain credentials", 400)
+	}
+	switch u.Scheme {
+	case "https":
+	case "http":
+		if !s.allowPrivateNetworks {
+			return errors.New("URL must use HTTPS", 400)
+		}
+	default:
+		return errors.New("URL must be an absolute HTTPS URL", 400)
+	}
+	if !s.allowPrivateNetworks && !isPublicHost(u.Hostname()) {
+		return errors.New("URL must point to a public address", 400)
+	}
+
+	webhook.Description = strings.TrimSpace(webhook.Description)
+	if len(webhook.Description) > 255 {
+		return errors.New("Description must be at most 255 characters", 400)
+	}
+
+	if len(webhook.Events) == 0 {
+		return errors.New("At least one event is required", 400)
+	}
+	seen := make(map[model.WebhookEvent]bool, len(webhook.Events))
+	events := webhook.Events[:0]
+	for _, event := range webhook.Events {
+		if !isWebhookEvent(event) {
+			names := make([]string, len(model.WebhookEvents))
+			for i, e := range model.WebhookEvents {
+				names[i] = string(e)
+			}
+			return errors.New(fmt.Sprintf("Event must be one of %s", strings.Join(names, ", ")), 400)
+		}
+		if !seen[event] {
+			seen[event] = true
+			events = append(events, event)
+		}
+	}
+	webhook.Events = events
+
+	return nil
+}
+
+func isWebhookEvent(event model.WebhookEvent) bool {
+	for _, e := range model.WebhookEvents {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+// isPublicHost rejects hostnames that are, or obviously name, a non-public
+// address. Other names are checked once resolved, by dialPublicOnly.
+func isPublicHost(host string) bool {
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return false
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		return isPublicIP(ip)
+	}
+	return true
+}
+
+// errNonPublicAddress is returned when a webhook host resolves to an address
+// deliveries may not reach
+var errNonPublicAddress = fmt.Errorf("webhook endpoint resolves to a non-public address")
+
+// dialPublicOnly is a net.Dialer Control hook refusing connections to
+// anything but public addresses. It sees the resolved IP of every
+// connection attempt.
+func dialPublicOnly(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || !isPublicIP(ip) {
+		return errNonPublicAddress
+	}
+	return nil
+}
+
+// nonPublicNetworks are ranges not covered by the net.IP predicates that
+// still reach internal or special purpose hosts
+var nonPublicNetworks = mustParseCIDRs(
+	"0.0.0.0/8",         // "This" network
+	"100.64.0.0/10",     // Carrier-grade NAT, also some cloud metadata services
+	"192.0.0.0/24",      // IETF protocol assignments
+	"192.0.2.0/24",      // Documentation
+	"198.18.0.0/15",     // Benchmarking
+	"198.51.100.0/24",   // Documentation
+	"203.0.113.0/24",    // Documentation
+	"240.0.0.0/4",       // Reserved, and broadcast
+	"64:ff9b::/96",      // NAT64, which maps onto IPv4 addresses
+	"64:ff9b:1::/48",    // Local-use NAT64
+	"2001:db8::/32",     // Documentation
+	"fd00:ec2::254/128", // EC2 metadata over IPv6, also inside fc00::/7
+)
+
+// isPublicIP reports whether ip is a globally routable unicast address. It
+// excludes loopback, private, link-local (including the 169.254.169.254
+// cloud metadata address), multicast and unspecified addresses.
+func isPublicIP(ip net.IP) bool {
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() {
+		return false
+	}
+	for _, network := range nonPublicNetworks {
+		if network.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+func mustParseCIDRs(cidrs ...string) []*net.IPNet {
+	networks := make([]*net.IPNet, len(cidrs))
+	for i, cidr := range cidrs {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(err)
+		}
+		networks[i] = network
+	}
+	return networks
+}
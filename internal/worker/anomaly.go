@@ -0,0 +1,68 @@
+package worker
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/yeboahd24/personal-finance-manager/internal/service"
+)
+
+type SpendingAnomalyWorker struct {
+	anomalyService *service.SpendingAnomalyService
+	interval       time.Duration
+	stopChan       chan struct{}
+	wg             sync.WaitGroup
+}
+
+// NewSpendingAnomalyWorker creates a new worker that periodically sends spending anomaly alerts
+func NewSpendingAnomalyWorker(anomalyService *service.SpendingAnomalyService, interval time.Duration) *SpendingAnomalyWorker {
+	if interval < time.Minute {
+		interval = time.Minute
+	}
+	return &SpendingAnomalyWorker{
+		anomalyService: anomalyService,
+		interval:       interval,
+		stopChan:       make(chan struct{}),
+	}
+}
+
+func (w *SpendingAnomalyWorker) Start(ctx context.Context) {
+	w.wg.Add(1)
+	go func() {
+		defer w.wg.Done()
+		ticker := time.NewTicker(w.interval)
+		defer ticker.Stop()
+
+		// Run once immediately on startup
+		w.sendAlerts(ctx)
+
+		for {
+			select {
+			case <-ctx.Done():
+				log.Println("Context cancelled, stopping spending anomaly worker")
+				return
+			case <-w.stopChan:
+				log.Println("Stop signal received, stopping spending anomaly worker")
+				return
+			case <-ticker.C:
+				w.sendAlerts(ctx)
+			}
+		}
+	}()
+}
+
+func (w *SpendingAnomalyWorker) Stop() {
+	close(w.stopChan)
+	w.wg.Wait()
+}
+
+func (w *SpendingAnomalyWorker) sendAlerts(ctx context.Context) {
+	ctx, cancel := context.WithTimeout(ctx, w.interval/2)
+	defer cancel()
+
+	if err := w.anomalyService.SendAnomalyAlerts(ctx); err != nil {
+		log.Printf("Error sending spending anomaly alerts: %v", err)
+	}
+}
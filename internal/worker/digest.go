@@ -0,0 +1,68 @@
+package worker
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/yeboahd24/personal-finance-manager/internal/service"
+)
+
+type DigestWorker struct {
+	digestService *service.DigestService
+	interval      time.Duration
+	stopChan      chan struct{}
+	wg            sync.WaitGroup
+}
+
+// NewDigestWorker creates a new worker that periodically sends notification digests that are due
+func NewDigestWorker(digestService *service.DigestService, interval time.Duration) *DigestWorker {
+	if interval < time.Minute {
+		interval = time.Minute
+	}
+	return &DigestWorker{
+		digestService: digestService,
+		interval:      interval,
+		stopChan:      make(chan struct{}),
+	}
+}
+
+func (w *DigestWorker) Start(ctx context.Context) {
+	w.wg.Add(1)
+	go func() {
+		defer w.wg.Done()
+		ticker := time.NewTicker(w.interval)
+		defer ticker.Stop()
+
+		// Run once immediately on startup
+		w.sendDigests(ctx)
+
+		for {
+			select {
+			case <-ctx.Done():
+				log.Println("Context cancelled, stopping digest worker")
+				return
+			case <-w.stopChan:
+				log.Println("Stop signal received, stopping digest worker")
+				return
+			case <-ticker.C:
+				w.sendDigests(ctx)
+			}
+		}
+	}()
+}
+
+func (w *DigestWorker) Stop() {
+	close(w.stopChan)
+	w.wg.Wait()
+}
+
+func (w *DigestWorker) sendDigests(ctx context.Context) {
+	ctx, cancel := context.WithTimeout(ctx, w.interval/2)
+	defer cancel()
+
+	if err := w.digestService.SendDigests(ctx); err != nil {
+		log.Printf("Error sending notification digests: %v", err)
+	}
+}
@@ -0,0 +1,72 @@
+package worker
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/yeboahd24/personal-finance-manager/internal/service"
+)
+
+type EmailWorker struct {
+	emailService *service.EmailService
+	interval     time.Duration
+	stopChan     chan struct{}
+	wg           sync.WaitGroup
+}
+
+// NewEmailWorker creates a new worker that periodically sends the emails queued in the outbox
+func NewEmailWorker(emailService *service.EmailService, interval time.Duration) *EmailWorker {
+	if interval < time.Minute {
+		interval = time.Minute
+	}
+	return &EmailWorker{
+		emailService: emailService,
+		interval:     interval,
+		stopChan:     make(chan struct{}),
+	}
+}
+
+func (w *EmailWorker) Start(ctx context.Context) {
+	w.wg.Add(1)
+	go func() {
+		defer w.wg.Done()
+		ticker := time.NewTicker(w.interval)
+		defer ticker.Stop()
+
+		// Run once immediately on startup
+		w.send(ctx)
+
+		for {
+			select {
+			case <-ctx.Done():
+				log.Println("Context cancelled, stopping email worker")
+				return
+			case <-w.stopChan:
+				log.Println("Stop signal received, stopping email worker")
+				return
+			case <-ticker.C:
+				w.send(ctx)
+			}
+		}
+	}()
+}
+
+func (w *EmailWorker) Stop() {
+	close(w.stopChan)
+	w.wg.Wait()
+}
+
+func (w *EmailWorker) send(ctx context.Context) {
+	ctx, cancel := context.WithTimeout(ctx, w.interval/2)
+	defer cancel()
+
+	sent, err := w.emailService.ProcessOutbox(ctx)
+	if err != nil {
+		log.Printf("Error sending emails: %v", err)
+	}
+	if sent > 0 {
+		log.Printf("Sent %d emails", sent)
+	}
+}
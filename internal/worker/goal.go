@@ -0,0 +1,68 @@
+package worker
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/yeboahd24/personal-finance-manager/internal/service"
+)
+
+type GoalNotificationWorker struct {
+	goalService *service.GoalService
+	interval    time.Duration
+	stopChan    chan struct{}
+	wg          sync.WaitGroup
+}
+
+// NewGoalNotificationWorker creates a new worker that periodically evaluates goal notifications
+func NewGoalNotificationWorker(goalService *service.GoalService, interval time.Duration) *GoalNotificationWorker {
+	if interval < time.Minute {
+		interval = time.Minute
+	}
+	return &GoalNotificationWorker{
+		goalService: goalService,
+		interval:    interval,
+		stopChan:    make(chan struct{}),
+	}
+}
+
+func (w *GoalNotificationWorker) Start(ctx context.Context) {
+	w.wg.Add(1)
+	go func() {
+		defer w.wg.Done()
+		ticker := time.NewTicker(w.interval)
+		defer ticker.Stop()
+
+		// Run once immediately on startup
+		w.evaluateGoals(ctx)
+
+		for {
+			select {
+			case <-ctx.Done():
+				log.Println("Context cancelled, stopping goal notification worker")
+				return
+			case <-w.stopChan:
+				log.Println("Stop signal received, stopping goal notification worker")
+				return
+			case <-ticker.C:
+				w.evaluateGoals(ctx)
+			}
+		}
+	}()
+}
+
+func (w *GoalNotificationWorker) Stop() {
+	close(w.stopChan)
+	w.wg.Wait()
+}
+
+func (w *GoalNotificationWorker) evaluateGoals(ctx context.Context) {
+	ctx, cancel := context.WithTimeout(ctx, w.interval/2)
+	defer cancel()
+
+	if err := w.goalService.EvaluateNotifications(ctx); err != nil {
+		log.Printf("Error evaluating goal notifications: %v", err)
+	}
+}
@@ -0,0 +1,68 @@
+package worker
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/yeboahd24/personal-finance-manager/internal/service"
+)
+
+type LowBalanceWorker struct {
+	lowBalanceService *service.LowBalanceService
+	interval          time.Duration
+	stopChan          chan struct{}
+	wg                sync.WaitGroup
+}
+
+// NewLowBalanceWorker creates a new worker that periodically sends predicted low balance alerts
+func NewLowBalanceWorker(lowBalanceService *service.LowBalanceService, interval time.Duration) *LowBalanceWorker {
+	if interval < time.Minute {
+		interval = time.Minute
+	}
+	return &LowBalanceWorker{
+		lowBalanceService: lowBalanceService,
+		interval:          interval,
+		stopChan:          make(chan struct{}),
+	}
+}
+
+func (w *LowBalanceWorker) Start(ctx context.Context) {
+	w.wg.Add(1)
+	go func() {
+		defer w.wg.Done()
+		ticker := time.NewTicker(w.interval)
+		defer ticker.Stop()
+
+		// Run once immediately on startup
+		w.sendAlerts(ctx)
+
+		for {
+			select {
+			case <-ctx.Done():
+				log.Println("Context cancelled, stopping low balance worker")
+				return
+			case <-w.stopChan:
+				log.Println("Stop signal received, stopping low balance worker")
+				return
+			case <-ticker.C:
+				w.sendAlerts(ctx)
+			}
+		}
+	}()
+}
+
+func (w *LowBalanceWorker) Stop() {
+	close(w.stopChan)
+	w.wg.Wait()
+}
+
+func (w *LowBalanceWorker) sendAlerts(ctx context.Context) {
+	ctx, cancel := context.WithTimeout(ctx, w.interval/2)
+	defer cancel()
+
+	if err := w.lowBalanceService.SendLowBalanceAlerts(ctx); err != nil {
+		log.Printf("Error sending low balance alerts: %v", err)
+	}
+}
@@ -0,0 +1,68 @@
+package worker
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/yeboahd24/personal-finance-manager/internal/service"
+)
+
+type NotificationDeliveryWorker struct {
+	notificationService *service.NotificationService
+	interval            time.Duration
+	stopChan            chan struct{}
+	wg                  sync.WaitGroup
+}
+
+// NewNotificationDeliveryWorker creates a new worker that periodically sends notifications held back by quiet hours and brings back snoozed ones
+func NewNotificationDeliveryWorker(notificationService *service.NotificationService, interval time.Duration) *NotificationDeliveryWorker {
+	if interval < 30*time.Second {
+		interval = 30 * time.Second
+	}
+	return &NotificationDeliveryWorker{
+		notificationService: notificationService,
+		interval:            interval,
+		stopChan:            make(chan struct{}),
+	}
+}
+
+func (w *NotificationDeliveryWorker) Start(ctx context.Context) {
+	w.wg.Add(1)
+	go func() {
+		defer w.wg.Done()
+		ticker := time.NewTicker(w.interval)
+		defer ticker.Stop()
+
+		// Run once immediately on startup
+		w.deliver(ctx)
+
+		for {
+			select {
+			case <-ctx.Done():
+				log.Println("Context cancelled, stopping notification delivery worker")
+				return
+			case <-w.stopChan:
+				log.Println("Stop signal received, stopping notification delivery worker")
+				return
+			case <-ticker.C:
+				w.deliver(ctx)
+			}
+		}
+	}()
+}
+
+func (w *NotificationDeliveryWorker) Stop() {
+	close(w.stopChan)
+	w.wg.Wait()
+}
+
+func (w *NotificationDeliveryWorker) deliver(ctx context.Context) {
+	ctx, cancel := context.WithTimeout(ctx, w.interval/2)
+	defer cancel()
+
+	if err := w.notificationService.DeliverDeferred(ctx); err != nil {
+		log.Printf("Error delivering deferred notifications: %v", err)
+	}
+}
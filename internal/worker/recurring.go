@@ -14,21 +14,19 @@ import (
 type RecurringTransactionWorker struct {
 	recurringService *service.RecurringTransactionService
 	interval         time.Duration
-	retryQueue       *queue.RetryQueue
 	stopChan         chan struct{}
 	wg               sync.WaitGroup
 }
 
 // NewRecurringTransactionWorker creates a new worker for processing recurring transactions
-func NewRecurringTransactionWorker(recurringService *service.RecurringTransactionService, notificationService *service.NotificationService, interval time.Duration) *RecurringTransactionWorker {
+func NewRecurringTransactionWorker(recurringService *service.RecurringTransactionService, interval time.Duration) *RecurringTransactionWorker {
 	if interval < time.Minute {
 		interval = time.Minute
 	}
 	return &RecurringTransactionWorker{
 		recurringService: recurringService,
-		interval:        interval,
-		retryQueue:      queue.NewRetryQueue(3, notificationService), // Max 3 retries
-		stopChan:        make(chan struct{}),
+		interval:         interval,
+		stopChan:         make(chan struct{}),
 	}
 }
 
@@ -87,56 +85,43 @@ func (w *RecurringTransactionWorker) processRecurringTransactions(ctx context.Co
 	ctx, cancel := context.WithTimeout(ctx, w.interval/2)
 	defer cancel()
 
-	if err := w.recurringService.ProcessDueTransactions(ctx); err != nil {
+	// Failed occurrences are queued for retry by the service itself
+	report, err := w.recurringService.ProcessDueTransactions(ctx)
+	if err != nil {
 		log.Printf("Error processing recurring transactions: %v", err)
-		w.retryQueue.Add(&model.RecurringTransaction{}, err)
 	}
+	logBackfillReport(report)
 }
 
 func (w *RecurringTransactionWorker) processRetries(ctx context.Context) {
-	dueItems := w.retryQueue.GetDueItems(time.Now())
-	for _, item := range dueItems {
-		// Create a new context with timeout for each retry
-		ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
-
-		err := w.processTransaction(ctx, item.Transaction)
-		if err != nil {
-			// If still failing, add back to retry queue
-			w.retryQueue.Add(item.Transaction, err)
-		} else {
-			// If successful, remove from retry queue
-			w.retryQueue.Remove(item.Transaction.ID)
-		}
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
 
-		cancel()
+	if err := w.recurringService.ProcessRetries(ctx); err != nil {
+		log.Printf("Error processing recurring transaction retries: %v", err)
 	}
 }
 
-func (w *RecurringTransactionWorker) processTransaction(ctx context.Context, rt *model.RecurringTransaction) error {
-	now := time.Now().UTC()
-
-	// Create the actual transaction
-	tx := &model.Transaction{
-		UserID:      rt.UserID,
-		AccountID:   rt.AccountID,
-		CategoryID:  &rt.CategoryID,
-		Amount:      rt.Amount,
-		Date:        now,
-		Description: rt.Description,
-	}
+// GetRetryQueueMetrics returns metrics about the retry queue
+func (w *RecurringTransactionWorker) GetRetryQueueMetrics(ctx context.Context) (queue.RetryQueueMetrics, error) {
+	return w.recurringService.GetRetryQueueMetrics(ctx)
+}
 
-	if err := w.recurringService.CreateTransactionForRecurring(ctx, rt.UserID, tx); err != nil {
-		return err
+// logBackfillReport logs what a processing run did with each recurring
+// transaction that had occurrences other than the one currently due
+func logBackfillReport(report *model.BackfillReport) {
+	if report == nil || len(report.Entries) == 0 {
+		return
 	}
 
-	// Update the recurring transaction's last run and next run dates
-	lastRun := now
-	nextRun := rt.CalculateNextRun(now)
-
-	return w.recurringService.UpdateLastRun(ctx, rt.ID, lastRun, nextRun)
-}
+	for _, e := range report.Entries {
+		if len(e.Posted)+len(e.Skipped)+len(e.Failed) > 1 {
+			log.Printf("Recurring transaction %s (%s, policy %s): posted %d, skipped %d, failed %d",
+				e.RecurringID, e.Description, e.Policy, len(e.Posted), len(e.Skipped), len(e.Failed))
+		}
+	}
 
-// GetRetryQueueMetrics returns metrics about the retry queue
-func (w *RecurringTransactionWorker) GetRetryQueueMetrics() queue.RetryQueueMetrics {
-	return w.retryQueue.GetMetrics()
+	posted, skipped, failed := report.Counts()
+	log.Printf("Processed %d recurring transactions: %d occurrences posted, %d skipped, %d failed",
+		len(report.Entries), posted, skipped, failed)
 }
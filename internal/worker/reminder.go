@@ -0,0 +1,68 @@
+package worker
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/yeboahd24/personal-finance-manager/internal/service"
+)
+
+type BillReminderWorker struct {
+	reminderService *service.BillReminderService
+	interval        time.Duration
+	stopChan        chan struct{}
+	wg              sync.WaitGroup
+}
+
+// NewBillReminderWorker creates a new worker that periodically sends upcoming recurring transaction reminders
+func NewBillReminderWorker(reminderService *service.BillReminderService, interval time.Duration) *BillReminderWorker {
+	if interval < time.Minute {
+		interval = time.Minute
+	}
+	return &BillReminderWorker{
+		reminderService: reminderService,
+		interval:        interval,
+		stopChan:        make(chan struct{}),
+	}
+}
+
+func (w *BillReminderWorker) Start(ctx context.Context) {
+	w.wg.Add(1)
+	go func() {
+		defer w.wg.Done()
+		ticker := time.NewTicker(w.interval)
+		defer ticker.Stop()
+
+		// Run once immediately on startup
+		w.sendReminders(ctx)
+
+		for {
+			select {
+			case <-ctx.Done():
+				log.Println("Context cancelled, stopping bill reminder worker")
+				return
+			case <-w.stopChan:
+				log.Println("Stop signal received, stopping bill reminder worker")
+				return
+			case <-ticker.C:
+				w.sendReminders(ctx)
+			}
+		}
+	}()
+}
+
+func (w *BillReminderWorker) Stop() {
+	close(w.stopChan)
+	w.wg.Wait()
+}
+
+func (w *BillReminderWorker) sendReminders(ctx context.Context) {
+	ctx, cancel := context.WithTimeout(ctx, w.interval/2)
+	defer cancel()
+
+	if err := w.reminderService.SendUpcomingReminders(ctx); err != nil {
+		log.Printf("Error sending upcoming recurring reminders: %v", err)
+	}
+}
@@ -0,0 +1,72 @@
+package worker
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/yeboahd24/personal-finance-manager/internal/service"
+)
+
+type WebhookWorker struct {
+	webhookService *service.WebhookService
+	interval       time.Duration
+	stopChan       chan struct{}
+	wg             sync.WaitGroup
+}
+
+// NewWebhookWorker creates a new worker that periodically delivers queued webhook events
+func NewWebhookWorker(webhookService *service.WebhookService, interval time.Duration) *WebhookWorker {
+	if interval < 10*time.Second {
+		interval = 10 * time.Second
+	}
+	return &WebhookWorker{
+		webhookService: webhookService,
+		interval:       interval,
+		stopChan:       make(chan struct{}),
+	}
+}
+
+func (w *WebhookWorker) Start(ctx context.Context) {
+	w.wg.Add(1)
+	go func() {
+		defer w.wg.Done()
+		ticker := time.NewTicker(w.interval)
+		defer ticker.Stop()
+
+		// Run once immediately on startup
+		w.deliver(ctx)
+
+		for {
+			select {
+			case <-ctx.Done():
+				log.Println("Context cancelled, stopping webhook worker")
+				return
+			case <-w.stopChan:
+				log.Println("Stop signal received, stopping webhook worker")
+				return
+			case <-ticker.C:
+				w.deliver(ctx)
+			}
+		}
+	}()
+}
+
+func (w *WebhookWorker) Stop() {
+	close(w.stopChan)
+	w.wg.Wait()
+}
+
+func (w *WebhookWorker) deliver(ctx context.Context) {
+	ctx, cancel := context.WithTimeout(ctx, w.interval/2)
+	defer cancel()
+
+	sent, err := w.webhookService.DeliverDue(ctx)
+	if err != nil {
+		log.Printf("Error delivering webhooks: %v", err)
+	}
+	if sent > 0 {
+		log.Printf("Sent %d webhook deliveries", sent)
+	}
+}
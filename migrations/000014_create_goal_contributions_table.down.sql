@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS goal_contributions;
+ALTER TABLE goals DROP COLUMN IF EXISTS account_id;
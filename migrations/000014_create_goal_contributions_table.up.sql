@@ -0,0 +1,17 @@
+-- Designated account that linked contributions must land in
+ALTER TABLE goals ADD COLUMN IF NOT EXISTS account_id UUID REFERENCES accounts(id) ON DELETE SET NULL;
+
+CREATE TABLE IF NOT EXISTS goal_contributions (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    goal_id UUID NOT NULL REFERENCES goals(id) ON DELETE CASCADE,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    transaction_id UUID REFERENCES transactions(id) ON DELETE CASCADE,
+    amount DECIMAL(15,2) NOT NULL,
+    date TIMESTAMP WITH TIME ZONE NOT NULL,
+    note TEXT,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT unique_goal_transaction UNIQUE (goal_id, transaction_id)
+);
+
+CREATE INDEX idx_goal_contributions_goal_id ON goal_contributions(goal_id);
+CREATE INDEX idx_goal_contributions_date ON goal_contributions(date);
@@ -0,0 +1,6 @@
+DROP TABLE IF EXISTS goal_accounts;
+ALTER TABLE goals DROP COLUMN IF EXISTS last_matched_transaction_id;
+ALTER TABLE goals DROP COLUMN IF EXISTS cycle_start;
+ALTER TABLE goals DROP COLUMN IF EXISTS recurrence;
+ALTER TABLE goals DROP COLUMN IF EXISTS expense_match;
+ALTER TABLE goals DROP COLUMN IF EXISTS kind;
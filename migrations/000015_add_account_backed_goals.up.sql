@@ -0,0 +1,17 @@
+ALTER TABLE goals ADD COLUMN IF NOT EXISTS kind VARCHAR(50) NOT NULL DEFAULT 'savings';
+ALTER TABLE goals ADD COLUMN IF NOT EXISTS expense_match TEXT;
+ALTER TABLE goals ADD COLUMN IF NOT EXISTS recurrence TEXT;
+ALTER TABLE goals ADD COLUMN IF NOT EXISTS cycle_start TIMESTAMP WITH TIME ZONE;
+ALTER TABLE goals ADD COLUMN IF NOT EXISTS last_matched_transaction_id UUID REFERENCES transactions(id) ON DELETE SET NULL;
+
+-- Accounts whose balance (or a fraction of it) backs a goal
+CREATE TABLE IF NOT EXISTS goal_accounts (
+    goal_id UUID NOT NULL REFERENCES goals(id) ON DELETE CASCADE,
+    account_id UUID NOT NULL REFERENCES accounts(id) ON DELETE CASCADE,
+    fraction DECIMAL(5,4) NOT NULL DEFAULT 1 CHECK (fraction > 0 AND fraction <= 1),
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (goal_id, account_id)
+);
+
+CREATE INDEX idx_goal_accounts_account_id ON goal_accounts(account_id);
+CREATE INDEX idx_goals_kind ON goals(kind);
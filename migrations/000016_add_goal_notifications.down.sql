@@ -0,0 +1,8 @@
+DROP TABLE IF EXISTS goal_notification_state;
+ALTER TABLE notification_preferences DROP COLUMN IF EXISTS goal_reminder_days;
+ALTER TABLE notification_preferences DROP COLUMN IF EXISTS goal_reminders;
+ALTER TABLE notification_preferences DROP COLUMN IF EXISTS goal_deadline_risk;
+ALTER TABLE notification_preferences DROP COLUMN IF EXISTS goal_milestones;
+
+-- Postgres cannot drop enum values; remove any rows using them instead
+DELETE FROM notifications WHERE type IN ('goal_milestone', 'goal_deadline_risk', 'goal_contribution_reminder');
@@ -0,0 +1,17 @@
+ALTER TYPE notification_type ADD VALUE IF NOT EXISTS 'goal_milestone';
+ALTER TYPE notification_type ADD VALUE IF NOT EXISTS 'goal_deadline_risk';
+ALTER TYPE notification_type ADD VALUE IF NOT EXISTS 'goal_contribution_reminder';
+
+ALTER TABLE notification_preferences ADD COLUMN IF NOT EXISTS goal_milestones BOOLEAN NOT NULL DEFAULT true;
+ALTER TABLE notification_preferences ADD COLUMN IF NOT EXISTS goal_deadline_risk BOOLEAN NOT NULL DEFAULT true;
+ALTER TABLE notification_preferences ADD COLUMN IF NOT EXISTS goal_reminders BOOLEAN NOT NULL DEFAULT true;
+ALTER TABLE notification_preferences ADD COLUMN IF NOT EXISTS goal_reminder_days INTEGER NOT NULL DEFAULT 30 CHECK (goal_reminder_days > 0);
+
+-- What has already been sent for each goal, so the evaluator doesn't repeat itself
+CREATE TABLE IF NOT EXISTS goal_notification_state (
+    goal_id UUID PRIMARY KEY REFERENCES goals(id) ON DELETE CASCADE,
+    milestone INTEGER NOT NULL DEFAULT 0,
+    deadline_risk_notified BOOLEAN NOT NULL DEFAULT false,
+    last_reminder_at TIMESTAMP WITH TIME ZONE,
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
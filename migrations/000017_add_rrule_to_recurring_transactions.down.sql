@@ -0,0 +1,16 @@
+ALTER TABLE recurring_transactions ADD COLUMN IF NOT EXISTS interval TEXT;
+ALTER TABLE recurring_transactions ADD COLUMN IF NOT EXISTS day_of_month INTEGER;
+ALTER TABLE recurring_transactions ADD COLUMN IF NOT EXISTS day_of_week INTEGER;
+
+-- Rules that can't be expressed as an interval keep only their frequency
+UPDATE recurring_transactions SET
+    interval = lower(substring(rrule FROM 'FREQ=([A-Z]+)')),
+    day_of_month = CASE
+        WHEN rrule ~ 'BYSETPOS=-1' THEN substring(rrule FROM 'BYMONTHDAY=(?:[0-9]+,)*([0-9]+)')::int
+        ELSE substring(rrule FROM 'BYMONTHDAY=([0-9]+)')::int
+    END,
+    day_of_week = array_position(ARRAY['SU', 'MO', 'TU', 'WE', 'TH', 'FR', 'SA'], substring(rrule FROM 'BYDAY=([A-Z]{2})')) - 1;
+
+ALTER TABLE recurring_transactions ALTER COLUMN interval SET NOT NULL;
+ALTER TABLE recurring_transactions DROP COLUMN IF EXISTS exdates;
+ALTER TABLE recurring_transactions DROP COLUMN IF EXISTS rrule;
@@ -0,0 +1,29 @@
+ALTER TABLE recurring_transactions ADD COLUMN IF NOT EXISTS rrule TEXT;
+ALTER TABLE recurring_transactions ADD COLUMN IF NOT EXISTS exdates TEXT;
+
+-- Convert the interval and day fields to equivalent RFC 5545 rules. Days of
+-- the month past the 28th fall back to the last day in shorter months, and
+-- yearly rules from Feb 29 to Feb 28.
+UPDATE recurring_transactions SET rrule = CASE interval
+    WHEN 'daily' THEN 'FREQ=DAILY'
+    WHEN 'weekly' THEN 'FREQ=WEEKLY' || COALESCE(';BYDAY=' || (ARRAY['SU', 'MO', 'TU', 'WE', 'TH', 'FR', 'SA'])[day_of_week + 1], '')
+    WHEN 'monthly' THEN CASE
+        WHEN COALESCE(day_of_month, EXTRACT(DAY FROM start_date)::int) <= 28
+            THEN 'FREQ=MONTHLY;BYMONTHDAY=' || COALESCE(day_of_month, EXTRACT(DAY FROM start_date)::int)
+        ELSE 'FREQ=MONTHLY;BYMONTHDAY=' || (
+            SELECT string_agg(d::text, ',' ORDER BY d)
+            FROM generate_series(28, COALESCE(day_of_month, EXTRACT(DAY FROM start_date)::int)) AS d
+        ) || ';BYSETPOS=-1'
+        END
+    ELSE CASE
+        WHEN EXTRACT(MONTH FROM start_date) = 2 AND EXTRACT(DAY FROM start_date) = 29
+            THEN 'FREQ=YEARLY;BYMONTH=2;BYMONTHDAY=28,29;BYSETPOS=-1'
+        ELSE 'FREQ=YEARLY'
+        END
+END
+WHERE rrule IS NULL;
+
+ALTER TABLE recurring_transactions ALTER COLUMN rrule SET NOT NULL;
+ALTER TABLE recurring_transactions DROP COLUMN IF EXISTS interval;
+ALTER TABLE recurring_transactions DROP COLUMN IF EXISTS day_of_month;
+ALTER TABLE recurring_transactions DROP COLUMN IF EXISTS day_of_week;
@@ -0,0 +1,10 @@
+-- Accepted and dismissed subscription suggestions. Deleting the recurring
+-- transaction created from a suggestion lets it be suggested again.
+CREATE TABLE IF NOT EXISTS subscription_decisions (
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    subscription_id VARCHAR(64) NOT NULL,
+    status VARCHAR(20) NOT NULL CHECK (status IN ('accepted', 'dismissed')),
+    recurring_transaction_id UUID REFERENCES recurring_transactions(id) ON DELETE CASCADE,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (user_id, subscription_id)
+);
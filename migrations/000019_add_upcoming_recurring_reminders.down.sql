@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS recurring_reminders;
+ALTER TABLE notification_preferences DROP COLUMN IF EXISTS upcoming_recurring_days;
@@ -0,0 +1,9 @@
+ALTER TABLE notification_preferences ADD COLUMN IF NOT EXISTS upcoming_recurring_days INTEGER NOT NULL DEFAULT 3 CHECK (upcoming_recurring_days BETWEEN 1 AND 30);
+
+-- One row per reminded occurrence, so restarts and overlapping runs don't repeat a reminder
+CREATE TABLE IF NOT EXISTS recurring_reminders (
+    recurring_id UUID NOT NULL REFERENCES recurring_transactions(id) ON DELETE CASCADE,
+    occurrence TIMESTAMP WITH TIME ZONE NOT NULL,
+    sent_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (recurring_id, occurrence)
+);
@@ -0,0 +1,17 @@
+-- Recurring transaction occurrences that failed to post, retried with backoff
+CREATE TABLE IF NOT EXISTS recurring_retries (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    recurring_id UUID NOT NULL REFERENCES recurring_transactions(id) ON DELETE CASCADE,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    occurrence TIMESTAMP WITH TIME ZONE NOT NULL,
+    attempts INTEGER NOT NULL DEFAULT 0,
+    last_error TEXT NOT NULL DEFAULT '',
+    status VARCHAR(20) NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'failed', 'dismissed')),
+    next_attempt_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (recurring_id, occurrence)
+);
+
+CREATE INDEX IF NOT EXISTS idx_recurring_retries_due ON recurring_retries(next_attempt_at) WHERE status = 'pending';
+CREATE INDEX IF NOT EXISTS idx_recurring_retries_user_id ON recurring_retries(user_id);
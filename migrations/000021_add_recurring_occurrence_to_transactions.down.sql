@@ -0,0 +1,3 @@
+ALTER TABLE transactions DROP CONSTRAINT IF EXISTS transactions_recurring_occurrence_key;
+ALTER TABLE transactions DROP COLUMN IF EXISTS occurrence_date;
+ALTER TABLE transactions DROP COLUMN IF EXISTS recurring_id;
@@ -0,0 +1,6 @@
+-- Transactions posted from a recurring schedule record the occurrence they
+-- belong to, so an occurrence can only ever be posted once
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS recurring_id UUID REFERENCES recurring_transactions(id) ON DELETE SET NULL;
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS occurrence_date DATE;
+
+ALTER TABLE transactions ADD CONSTRAINT transactions_recurring_occurrence_key UNIQUE (recurring_id, occurrence_date);
@@ -0,0 +1,4 @@
+ALTER TABLE recurring_transactions DROP COLUMN IF EXISTS backfill_policy;
+
+-- Postgres cannot drop enum values; remove any rows using them instead
+DELETE FROM notifications WHERE type = 'recurring_missed';
@@ -0,0 +1,5 @@
+-- What to do with occurrences missed while the server wasn't running
+ALTER TABLE recurring_transactions ADD COLUMN IF NOT EXISTS backfill_policy VARCHAR(10) NOT NULL DEFAULT 'all'
+    CHECK (backfill_policy IN ('all', 'latest', 'skip'));
+
+ALTER TYPE notification_type ADD VALUE IF NOT EXISTS 'recurring_missed';
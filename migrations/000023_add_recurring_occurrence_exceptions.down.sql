@@ -0,0 +1,4 @@
+ALTER TABLE recurring_transactions
+    DROP COLUMN IF EXISTS resume_at,
+    DROP COLUMN IF EXISTS paused_at,
+    DROP COLUMN IF EXISTS overrides;
@@ -0,0 +1,5 @@
+-- Per-occurrence moves and amount/description changes, and pausing a rule
+ALTER TABLE recurring_transactions
+    ADD COLUMN IF NOT EXISTS overrides JSONB NOT NULL DEFAULT '[]',
+    ADD COLUMN IF NOT EXISTS paused_at TIMESTAMP WITH TIME ZONE,
+    ADD COLUMN IF NOT EXISTS resume_at TIMESTAMP WITH TIME ZONE;
@@ -0,0 +1,5 @@
+ALTER TABLE recurring_transactions
+    DROP COLUMN IF EXISTS holiday_calendar,
+    DROP COLUMN IF EXISTS business_day_adjustment;
+
+DROP TABLE IF EXISTS holiday_calendars;
@@ -0,0 +1,18 @@
+-- User defined holiday calendars, optionally on top of a bundled one
+CREATE TABLE IF NOT EXISTS holiday_calendars (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name VARCHAR(100) NOT NULL,
+    base VARCHAR(10),
+    dates JSONB NOT NULL DEFAULT '[]',
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_holiday_calendars_user_id ON holiday_calendars(user_id);
+
+-- Where occurrences that fall on weekends and holidays post
+ALTER TABLE recurring_transactions
+    ADD COLUMN IF NOT EXISTS business_day_adjustment VARCHAR(20) NOT NULL DEFAULT 'none'
+        CHECK (business_day_adjustment IN ('none', 'previous', 'next', 'modified_following')),
+    ADD COLUMN IF NOT EXISTS holiday_calendar VARCHAR(36);
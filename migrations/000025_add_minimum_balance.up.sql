@@ -0,0 +1,2 @@
+ALTER TABLE notification_preferences
+    ADD COLUMN IF NOT EXISTS minimum_balance NUMERIC(15,2) NOT NULL DEFAULT 0;
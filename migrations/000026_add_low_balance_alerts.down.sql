@@ -0,0 +1,6 @@
+DROP TABLE IF EXISTS low_balance_alerts;
+ALTER TABLE notification_preferences DROP COLUMN IF EXISTS low_balance_days;
+ALTER TABLE notification_preferences DROP COLUMN IF EXISTS low_balance_alerts;
+
+-- Postgres cannot drop enum values; remove any rows using them instead
+DELETE FROM notifications WHERE type = 'low_balance_predicted';
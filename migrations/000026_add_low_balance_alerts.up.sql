@@ -0,0 +1,12 @@
+ALTER TYPE notification_type ADD VALUE IF NOT EXISTS 'low_balance_predicted';
+
+ALTER TABLE notification_preferences ADD COLUMN IF NOT EXISTS low_balance_alerts BOOLEAN NOT NULL DEFAULT TRUE;
+ALTER TABLE notification_preferences ADD COLUMN IF NOT EXISTS low_balance_days INTEGER NOT NULL DEFAULT 14 CHECK (low_balance_days BETWEEN 1 AND 60);
+
+-- One row per account and predicted date, so the daily check doesn't repeat an alert
+CREATE TABLE IF NOT EXISTS low_balance_alerts (
+    account_id UUID NOT NULL REFERENCES accounts(id) ON DELETE CASCADE,
+    predicted_date DATE NOT NULL,
+    sent_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (account_id, predicted_date)
+);
@@ -0,0 +1,24 @@
+-- Live events streamed to clients. Ids are the SSE event ids clients resume from.
+CREATE TABLE IF NOT EXISTS user_events (
+    id BIGSERIAL PRIMARY KEY,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    type VARCHAR(50) NOT NULL,
+    data JSONB NOT NULL DEFAULT '{}',
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_user_events_user_id ON user_events(user_id, id);
+CREATE INDEX IF NOT EXISTS idx_user_events_created_at ON user_events(created_at);
+
+-- Announce each event as "id:user_id" so every server instance can push it
+-- to the streams it holds for that user
+CREATE OR REPLACE FUNCTION notify_user_event() RETURNS TRIGGER AS $$
+BEGIN
+    PERFORM pg_notify('user_events', NEW.id::text || ':' || NEW.user_id::text);
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER user_events_notify
+    AFTER INSERT ON user_events
+    FOR EACH ROW EXECUTE FUNCTION notify_user_event();
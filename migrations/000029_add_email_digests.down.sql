@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS notification_digests;
+ALTER TABLE notification_preferences DROP COLUMN IF EXISTS timezone;
+ALTER TABLE notification_preferences DROP COLUMN IF EXISTS digest_day;
+ALTER TABLE notification_preferences DROP COLUMN IF EXISTS digest_time;
+ALTER TABLE notification_preferences DROP COLUMN IF EXISTS email_digest;
@@ -0,0 +1,16 @@
+ALTER TABLE notification_preferences ADD COLUMN IF NOT EXISTS email_digest VARCHAR(10) NOT NULL DEFAULT 'immediate'
+    CHECK (email_digest IN ('immediate', 'daily', 'weekly'));
+ALTER TABLE notification_preferences ADD COLUMN IF NOT EXISTS digest_time VARCHAR(5) NOT NULL DEFAULT '08:00'
+    CHECK (digest_time ~ '^([01][0-9]|2[0-3]):[0-5][0-9]$');
+ALTER TABLE notification_preferences ADD COLUMN IF NOT EXISTS digest_day SMALLINT NOT NULL DEFAULT 1
+    CHECK (digest_day BETWEEN 0 AND 6);
+ALTER TABLE notification_preferences ADD COLUMN IF NOT EXISTS timezone VARCHAR(64) NOT NULL DEFAULT 'UTC';
+
+-- One row per user and local day a digest was sent. The latest sent_at is
+-- where the next digest starts.
+CREATE TABLE IF NOT EXISTS notification_digests (
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    digest_date DATE NOT NULL,
+    sent_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (user_id, digest_date)
+);
@@ -0,0 +1,6 @@
+DROP TABLE IF EXISTS notification_deliveries;
+DROP INDEX IF EXISTS idx_notifications_snoozed_until;
+ALTER TABLE notifications DROP COLUMN IF EXISTS snoozed_until;
+ALTER TABLE notification_preferences DROP COLUMN IF EXISTS quiet_hours_end;
+ALTER TABLE notification_preferences DROP COLUMN IF EXISTS quiet_hours_start;
+ALTER TABLE notification_preferences DROP COLUMN IF EXISTS channels;
@@ -0,0 +1,24 @@
+-- Channels per notification type, e.g. {"low_balance_predicted": ["in_app", "email"]}.
+-- Types left out use the email_enabled, push_enabled and in_app_enabled switches.
+ALTER TABLE notification_preferences ADD COLUMN IF NOT EXISTS channels JSONB NOT NULL DEFAULT '{}';
+
+-- Quiet hours in the user's timezone. Both are NULL when quiet hours are off.
+ALTER TABLE notification_preferences ADD COLUMN IF NOT EXISTS quiet_hours_start VARCHAR(5)
+    CHECK (quiet_hours_start ~ '^([01][0-9]|2[0-3]):[0-5][0-9]$');
+ALTER TABLE notification_preferences ADD COLUMN IF NOT EXISTS quiet_hours_end VARCHAR(5)
+    CHECK (quiet_hours_end ~ '^([01][0-9]|2[0-3]):[0-5][0-9]$');
+
+ALTER TABLE notifications ADD COLUMN IF NOT EXISTS snoozed_until TIMESTAMP WITH TIME ZONE;
+CREATE INDEX IF NOT EXISTS idx_notifications_snoozed_until ON notifications(snoozed_until)
+    WHERE snoozed_until IS NOT NULL;
+
+-- Email and push deliveries held back until the user's quiet hours end
+CREATE TABLE IF NOT EXISTS notification_deliveries (
+    notification_id UUID NOT NULL REFERENCES notifications(id) ON DELETE CASCADE,
+    channel VARCHAR(10) NOT NULL CHECK (channel IN ('email', 'push')),
+    deliver_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (notification_id, channel)
+);
+
+CREATE INDEX IF NOT EXISTS idx_notification_deliveries_deliver_at ON notification_deliveries(deliver_at);
@@ -0,0 +1,7 @@
+DROP TABLE IF EXISTS transaction_alerts;
+DROP INDEX IF EXISTS idx_transactions_user_merchant;
+ALTER TABLE transactions DROP COLUMN IF EXISTS currency;
+ALTER TABLE transactions DROP COLUMN IF EXISTS merchant_name;
+
+-- Postgres cannot drop enum values; remove any rows using them instead
+DELETE FROM notifications WHERE type = 'transaction_alert';
@@ -0,0 +1,25 @@
+ALTER TYPE notification_type ADD VALUE IF NOT EXISTS 'transaction_alert';
+
+-- Merchant and currency as reported by the bank, used to spot new merchants
+-- and foreign currency transactions
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS merchant_name VARCHAR(255);
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS currency VARCHAR(3);
+
+CREATE INDEX IF NOT EXISTS idx_transactions_user_merchant
+    ON transactions(user_id, lower(COALESCE(merchant_name, description)));
+
+CREATE TABLE IF NOT EXISTS transaction_alerts (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    type VARCHAR(30) NOT NULL
+        CHECK (type IN ('large_debit', 'new_merchant', 'foreign_currency', 'unbudgeted_category')),
+    -- Only debits larger than this trigger the alert
+    min_amount DECIMAL(15,2) NOT NULL DEFAULT 0 CHECK (min_amount >= 0),
+    -- Limits the alert to one account when set
+    account_id UUID REFERENCES accounts(id) ON DELETE CASCADE,
+    active BOOLEAN NOT NULL DEFAULT true,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_transaction_alerts_user_id ON transaction_alerts(user_id);
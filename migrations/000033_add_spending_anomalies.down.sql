@@ -0,0 +1,6 @@
+DROP INDEX IF EXISTS idx_transactions_user_category_date;
+DROP TABLE IF EXISTS spending_anomaly_alerts;
+ALTER TABLE notification_preferences DROP COLUMN IF EXISTS spending_anomalies;
+
+-- Postgres cannot drop enum values; remove any rows using them instead
+DELETE FROM notifications WHERE type = 'spending_anomaly';
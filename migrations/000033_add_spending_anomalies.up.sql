@@ -0,0 +1,17 @@
+ALTER TYPE notification_type ADD VALUE IF NOT EXISTS 'spending_anomaly';
+
+-- Anomaly notifications are opt in, the daily check only looks at users who
+-- turned them on
+ALTER TABLE notification_preferences ADD COLUMN IF NOT EXISTS spending_anomalies BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- One row per notified anomaly, so the daily check doesn't repeat one. The
+-- key names the category and period, or the transaction.
+CREATE TABLE IF NOT EXISTS spending_anomaly_alerts (
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    anomaly_key VARCHAR(100) NOT NULL,
+    sent_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (user_id, anomaly_key)
+);
+
+-- Baselines group a user's debits by category and date
+CREATE INDEX IF NOT EXISTS idx_transactions_user_category_date ON transactions(user_id, category_id, date);
@@ -0,0 +1,7 @@
+UPDATE sessions SET revoked_reason = 'revoked' WHERE revoked_reason = 'password_change';
+ALTER TABLE sessions DROP CONSTRAINT IF EXISTS sessions_revoked_reason_check;
+ALTER TABLE sessions ADD CONSTRAINT sessions_revoked_reason_check
+    CHECK (revoked_reason IN ('logout', 'logout_all', 'revoked', 'reuse'));
+
+DROP TABLE IF EXISTS user_tokens;
+ALTER TABLE users DROP COLUMN IF EXISTS email_verified_at;
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS sinking_fund_transfers;
+ALTER TABLE goals DROP COLUMN IF EXISTS funding_account_id;
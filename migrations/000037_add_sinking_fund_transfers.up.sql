@@ -0,0 +1,18 @@
+-- Account a sinking fund's monthly transfer is taken from
+ALTER TABLE goals ADD COLUMN IF NOT EXISTS funding_account_id UUID REFERENCES accounts(id) ON DELETE SET NULL;
+
+-- Suggested monthly transfer into each sinking fund, refreshed when the fund is
+-- created, changed or starts a new cycle. Accepting it creates a recurring
+-- debit from the funding account and a recurring credit into the fund.
+CREATE TABLE IF NOT EXISTS sinking_fund_transfers (
+    goal_id UUID PRIMARY KEY REFERENCES goals(id) ON DELETE CASCADE,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    from_account_id UUID NOT NULL REFERENCES accounts(id) ON DELETE CASCADE,
+    to_account_id UUID NOT NULL REFERENCES accounts(id) ON DELETE CASCADE,
+    amount DECIMAL(15,2) NOT NULL,
+    start_date TIMESTAMP WITH TIME ZONE NOT NULL,
+    end_date TIMESTAMP WITH TIME ZONE NOT NULL,
+    debit_recurring_id UUID REFERENCES recurring_transactions(id) ON DELETE SET NULL,
+    credit_recurring_id UUID REFERENCES recurring_transactions(id) ON DELETE SET NULL,
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
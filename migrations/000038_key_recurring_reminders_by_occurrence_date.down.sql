@@ -0,0 +1,7 @@
+ALTER TABLE recurring_reminders ADD COLUMN IF NOT EXISTS occurrence TIMESTAMP WITH TIME ZONE;
+UPDATE recurring_reminders SET occurrence = occurrence_date::timestamp AT TIME ZONE 'UTC';
+
+ALTER TABLE recurring_reminders DROP CONSTRAINT IF EXISTS recurring_reminders_pkey;
+ALTER TABLE recurring_reminders DROP COLUMN IF EXISTS occurrence_date;
+ALTER TABLE recurring_reminders ALTER COLUMN occurrence SET NOT NULL;
+ALTER TABLE recurring_reminders ADD PRIMARY KEY (recurring_id, occurrence);
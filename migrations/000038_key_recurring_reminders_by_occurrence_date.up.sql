@@ -0,0 +1,16 @@
+-- Reminders are keyed by the date the rule schedules the occurrence on, like
+-- overrides and posted transactions, so moving an occurrence after its
+-- reminder went out doesn't remind again
+ALTER TABLE recurring_reminders ADD COLUMN IF NOT EXISTS occurrence_date DATE;
+UPDATE recurring_reminders SET occurrence_date = occurrence::date;
+
+DELETE FROM recurring_reminders a
+USING recurring_reminders b
+WHERE a.recurring_id = b.recurring_id
+    AND a.occurrence_date = b.occurrence_date
+    AND a.occurrence > b.occurrence;
+
+ALTER TABLE recurring_reminders DROP CONSTRAINT IF EXISTS recurring_reminders_pkey;
+ALTER TABLE recurring_reminders DROP COLUMN IF EXISTS occurrence;
+ALTER TABLE recurring_reminders ALTER COLUMN occurrence_date SET NOT NULL;
+ALTER TABLE recurring_reminders ADD PRIMARY KEY (recurring_id, occurrence_date);
@@ -16,9 +16,13 @@ function isAuthenticated() {
 }
 
 // Handle logout
-function logout() {
-    // Remove auth cookie
-    document.cookie = 'authToken=; path=/; expires=Thu, 01 Jan 1970 00:00:00 GMT';
+async function logout() {
+    // End the session on the server, which also clears the auth cookies
+    try {
+        await fetch('/api/users/logout', { method: 'POST', credentials: 'include' });
+    } catch (error) {
+        console.error('Logout error:', error);
+    }
     window.location.href = '/login';
 }
 